@@ -0,0 +1,39 @@
+package adaptor
+
+import (
+	"fmt"
+	"receipt-detector/config"
+	"receipt-detector/external/notifier"
+	"time"
+)
+
+const (
+	NotifierTypeLog     = "log"
+	NotifierTypeWebhook = "webhook"
+)
+
+// NewNotifier picks the notifier alerts are delivered through, defaulting to
+// logging them.
+func NewNotifier(config config.NotifierConfig) (notifier.Notifier, error) {
+	switch config.Type {
+	case "", NotifierTypeLog:
+		return notifier.NewLogNotifier(), nil
+	case NotifierTypeWebhook:
+		if config.Webhook.Url == "" {
+			return nil, fmt.Errorf("[adaptor][NewNotifier] Webhook url must be set for the webhook notifier")
+		}
+
+		timeout := time.Duration(config.Webhook.Timeout)
+		if timeout == 0 {
+			timeout = 10 * time.Second
+		}
+
+		return notifier.NewWebhookNotifier(notifier.WebhookNotifierOpt{
+			Url:     config.Webhook.Url,
+			Secret:  config.Webhook.Secret,
+			Timeout: timeout,
+		}), nil
+	default:
+		return nil, fmt.Errorf("[adaptor][NewNotifier] Unknown notifier type: %s", config.Type)
+	}
+}
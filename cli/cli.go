@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"receipt-detector/config"
+	"receipt-detector/log"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type command struct {
+	description string
+	run         func(ctx context.Context, config *config.AppConfig, args []string) error
+}
+
+var (
+	commands = map[string]command{
+		"export-dataset": {
+			description: "Export approved detection corrections as a training dataset archive",
+			run:         exportDataset,
+		},
+		"export-receipts": {
+			description: "Export a device's receipts and their items as CSV or XLSX",
+			run:         exportReceipts,
+		},
+		"export-ledger": {
+			description: "Export a device's receipts as ledger, hledger or beancount transactions",
+			run:         exportLedger,
+		},
+		"import-exchange-rates": {
+			description: "Load daily exchange rates from a CSV or ECB XML file",
+			run:         importExchangeRates,
+		},
+		"import-receipts": {
+			description: "Import historical receipts and items from a CSV file",
+			run:         importReceipts,
+		},
+		"scan-duplicates": {
+			description: "Score every saved receipt against its neighbours and record suspected duplicates",
+			run:         scanDuplicates,
+		},
+		"reindex-receipts": {
+			description: "Rebuild the receipt search index from postgres",
+			run:         reindexReceipts,
+		},
+	}
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: receipt-detector [command] [flags]")
+	fmt.Fprintln(os.Stderr, "\nRun without a command to start the server.\n\nCommands:")
+
+	for name, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-20s %s\n", name, cmd.description)
+	}
+}
+
+func Run(args []string) {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	config, err := config.Init()
+	if err != nil {
+		logrus.Panic(err)
+	}
+
+	log.Init(config.LogLevel)
+
+	err = cmd.run(context.Background(), &config, args[1:])
+	if err != nil {
+		logrus.Errorf("[cli][Run][%s] %v", args[0], err)
+		os.Exit(1)
+	}
+}
+
+func parseDate(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid date %q, expected yyyy-mm-dd", value)
+	}
+
+	return t.UnixMilli(), nil
+}
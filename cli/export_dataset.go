@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"receipt-detector/adaptor"
+	"receipt-detector/config"
+	"receipt-detector/entity"
+	"receipt-detector/repository/elasticsearch"
+	"receipt-detector/repository/localstorage"
+	"receipt-detector/repository/postgres"
+	"receipt-detector/service"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func exportDataset(ctx context.Context, config *config.AppConfig, args []string) error {
+	flags := flag.NewFlagSet("export-dataset", flag.ExitOnError)
+
+	from := flags.String("from", "", "Only include detections created on or after this date (yyyy-mm-dd)")
+	to := flags.String("to", "", "Only include detections created before this date (yyyy-mm-dd)")
+	version := flags.String("version", "", "Dataset version, defaults to the current UTC timestamp")
+	sampleRatio := flags.Float64("sample-ratio", 1, "Fraction of eligible detections to include")
+	validationRatio := flags.Float64("validation-ratio", 0.1, "Fraction of included detections assigned to the validation split")
+	seed := flags.String("seed", "receipt-detector", "Seed for deterministic sampling and splitting")
+	out := flags.String("out", "", "Output archive path, defaults to dataset-<version>.zip")
+
+	flags.Parse(args)
+
+	createdFrom, err := parseDate(*from)
+	if err != nil {
+		return err
+	}
+
+	createdTo, err := parseDate(*to)
+	if err != nil {
+		return err
+	}
+
+	if *version == "" {
+		*version = time.Now().UTC().Format("20060102T150405Z")
+	}
+
+	if *out == "" {
+		*out = fmt.Sprintf("dataset-%s.zip", *version)
+	}
+
+	db, err := adaptor.ConnectPostgres(config.Db)
+	if err != nil {
+		return fmt.Errorf("failed to connect to db: %w", err)
+	}
+	defer db.Close()
+
+	es, err := adaptor.ConnectElastic(config.Elasticsearch)
+	if err != nil {
+		return fmt.Errorf("failed to connect to es: %w", err)
+	}
+
+	datasetExportService := service.NewDatasetExportService(service.DatasetExportOpts{
+		ReceiptDetectionHistoriesRepo: postgres.NewReceiptDetectionHistories(db),
+		ReceiptDetectionResultsRepo:   elasticsearch.NewReceiptDetectionResults(es, config.Elasticsearch.Indices.ReceiptDetectionResults),
+		ReceiptImagesRepo:             localstorage.NewReceiptImages(localstorage.ReceiptImagesOpt{LocalDirectory: config.Storage.Local.Directory}),
+	})
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer file.Close()
+
+	metadata, err := datasetExportService.Export(ctx, entity.DatasetExportRequest{
+		Version:         *version,
+		CreatedFrom:     createdFrom,
+		CreatedTo:       createdTo,
+		SampleRatio:     *sampleRatio,
+		ValidationRatio: *validationRatio,
+		Seed:            *seed,
+	}, file)
+	if err != nil {
+		os.Remove(*out)
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"version":    metadata.Version,
+		"train":      metadata.TrainCount,
+		"validation": metadata.ValidationCount,
+		"skipped":    metadata.SkippedCount,
+	}).Infof("Dataset written to %s", *out)
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"receipt-detector/adaptor"
+	"receipt-detector/config"
+	"receipt-detector/entity"
+	"receipt-detector/repository/postgres"
+	"receipt-detector/service"
+	"time"
+
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ledgerFileExtensions = map[string]string{
+		entity.LedgerFormatLedger:    "ledger",
+		entity.LedgerFormatHledger:   "journal",
+		entity.LedgerFormatBeancount: "beancount",
+	}
+)
+
+func exportLedger(ctx context.Context, config *config.AppConfig, args []string) error {
+	flags := flag.NewFlagSet("export-ledger", flag.ExitOnError)
+
+	deviceId := flags.String("device", "", "Device whose receipts are exported")
+	format := flags.String("format", entity.LedgerFormatLedger, "Output format, ledger, hledger or beancount")
+	posting := flags.String("posting", entity.LedgerPostingPerItem, "Post one line per item or per category")
+	paymentAccount := flags.String("payment-account", "", "Account the receipts were paid from, defaults to ledger.payment_account")
+	from := flags.String("from", "", "Only include receipts dated on or after this date (yyyy-mm-dd)")
+	to := flags.String("to", "", "Only include receipts dated before this date (yyyy-mm-dd)")
+	name := flags.String("name", "", "Only include receipts whose name contains this text")
+	category := flags.String("category", "", "Only include receipts with an item in this category")
+	currency := flags.String("currency", "", "Only include receipts with an item in this currency")
+	out := flags.String("out", "", "Output file path, defaults to receipts-<timestamp>.<extension>")
+
+	flags.Parse(args)
+
+	if *deviceId == "" {
+		return fmt.Errorf("-device is required")
+	}
+
+	filter, err := parseExportFilter(*from, *to, *name, *category, *currency)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		*out = fmt.Sprintf("receipts-%s.%s", time.Now().UTC().Format("20060102T150405Z"), ledgerFileExtensions[*format])
+	}
+
+	db, err := adaptor.ConnectPostgres(config.Db)
+	if err != nil {
+		return fmt.Errorf("failed to connect to db: %w", err)
+	}
+	defer db.Close()
+
+	receiptExportService, err := service.NewReceiptExportService(service.ReceiptExportOpts{
+		ReceiptsRepo:           postgres.NewReceipts(db),
+		ReceiptItemsRepo:       postgres.NewReceiptItems(db),
+		LedgerPaymentAccount:   config.Ledger.PaymentAccount,
+		LedgerDefaultAccount:   config.Ledger.DefaultAccount,
+		LedgerCategoryAccounts: config.Ledger.CategoryAccounts,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create export service: %w", err)
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer file.Close()
+
+	ctx = context.WithValue(ctx, hAppconstant.DeviceIdKey, *deviceId)
+
+	err = receiptExportService.ExportLedger(ctx, entity.ExportLedgerRequest{
+		ReceiptExportFilter: filter,
+		Format:              *format,
+		Posting:             *posting,
+		PaymentAccount:      *paymentAccount,
+	}, file)
+	if err != nil {
+		os.Remove(*out)
+		return err
+	}
+
+	logrus.Infof("Transactions written to %s", *out)
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"receipt-detector/adaptor"
+	"receipt-detector/config"
+	"receipt-detector/entity"
+	"receipt-detector/repository/postgres"
+	"receipt-detector/service"
+	"time"
+
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+	"github.com/sirupsen/logrus"
+)
+
+func exportReceipts(ctx context.Context, config *config.AppConfig, args []string) error {
+	flags := flag.NewFlagSet("export-receipts", flag.ExitOnError)
+
+	deviceId := flags.String("device", "", "Device whose receipts are exported")
+	format := flags.String("format", entity.ReceiptExportFormatCsv, "Output format, csv or xlsx")
+	columns := flags.String("columns", "", "Comma separated list of columns, defaults to all columns")
+	from := flags.String("from", "", "Only include receipts dated on or after this date (yyyy-mm-dd)")
+	to := flags.String("to", "", "Only include receipts dated before this date (yyyy-mm-dd)")
+	name := flags.String("name", "", "Only include receipts whose name contains this text")
+	category := flags.String("category", "", "Only include receipts with an item in this category")
+	currency := flags.String("currency", "", "Only include receipts with an item in this currency")
+	out := flags.String("out", "", "Output file path, defaults to receipts-<timestamp>.<format>")
+
+	flags.Parse(args)
+
+	if *deviceId == "" {
+		return fmt.Errorf("-device is required")
+	}
+
+	filter, err := parseExportFilter(*from, *to, *name, *category, *currency)
+	if err != nil {
+		return err
+	}
+
+	req := entity.ExportReceiptsRequest{
+		ReceiptExportFilter: filter,
+		Format:              *format,
+		Columns:             *columns,
+	}
+
+	if *out == "" {
+		*out = fmt.Sprintf("receipts-%s.%s", time.Now().UTC().Format("20060102T150405Z"), *format)
+	}
+
+	db, err := adaptor.ConnectPostgres(config.Db)
+	if err != nil {
+		return fmt.Errorf("failed to connect to db: %w", err)
+	}
+	defer db.Close()
+
+	receiptExportService, err := service.NewReceiptExportService(service.ReceiptExportOpts{
+		ReceiptsRepo:     postgres.NewReceipts(db),
+		ReceiptItemsRepo: postgres.NewReceiptItems(db),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create export service: %w", err)
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer file.Close()
+
+	ctx = context.WithValue(ctx, hAppconstant.DeviceIdKey, *deviceId)
+
+	err = receiptExportService.Export(ctx, req, file)
+	if err != nil {
+		os.Remove(*out)
+		return err
+	}
+
+	logrus.Infof("Receipts written to %s", *out)
+
+	return nil
+}
+
+func parseExportFilter(from, to, name, category, currency string) (entity.ReceiptExportFilter, error) {
+	filter := entity.ReceiptExportFilter{
+		Name:     name,
+		Category: category,
+		Currency: currency,
+	}
+
+	if from != "" {
+		dateFrom, err := parseDate(from)
+		if err != nil {
+			return filter, err
+		}
+
+		filter.DateFrom = &dateFrom
+	}
+
+	if to != "" {
+		dateTo, err := parseDate(to)
+		if err != nil {
+			return filter, err
+		}
+
+		filter.DateTo = &dateTo
+	}
+
+	return filter, nil
+}
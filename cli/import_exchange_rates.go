@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"receipt-detector/adaptor"
+	"receipt-detector/config"
+	"receipt-detector/entity"
+	"receipt-detector/repository"
+	"receipt-detector/repository/postgres"
+	"receipt-detector/repository/redis"
+	"receipt-detector/service"
+
+	"github.com/sirupsen/logrus"
+)
+
+func importExchangeRates(ctx context.Context, config *config.AppConfig, args []string) error {
+	flags := flag.NewFlagSet("import-exchange-rates", flag.ExitOnError)
+
+	file := flags.String("file", "", "CSV or ECB XML file to import")
+	format := flags.String("format", entity.ExchangeRateFormatCsv, "File format, csv or ecb")
+
+	flags.Parse(args)
+
+	if *file == "" {
+		return fmt.Errorf("-file is required")
+	}
+
+	if *format != entity.ExchangeRateFormatCsv && *format != entity.ExchangeRateFormatEcb {
+		return fmt.Errorf("unknown format %q, expected csv or ecb", *format)
+	}
+
+	in, err := os.Open(*file)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer in.Close()
+
+	db, err := adaptor.ConnectPostgres(config.Db)
+	if err != nil {
+		return fmt.Errorf("failed to connect to db: %w", err)
+	}
+	defer db.Close()
+
+	rds := adaptor.ConnectRedis(config.Redis)
+	defer rds.Close()
+
+	exchangeRateService := service.NewExchangeRateService(service.ExchangeRateOpts{
+		ExchangeRatesRepo: postgres.NewExchangeRates(db),
+		CacheRepo:         redis.NewCache(redis.CacheOpt{Client: rds}),
+		UnitOfWork:        repository.NewUnitOfWork(db),
+	})
+
+	res, err := exchangeRateService.Import(ctx, entity.ImportExchangeRatesRequest{
+		Format: *format,
+	}, in)
+	if err != nil {
+		return err
+	}
+
+	for _, rowErr := range res.Errors {
+		logrus.Warnf("Row %d: %s %s", rowErr.Row, rowErr.Field, rowErr.Message)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"rows":     res.RowCount,
+		"errors":   len(res.Errors),
+		"upserted": res.UpsertedCount,
+	}).Info("Import finished")
+
+	if len(res.Errors) > 0 {
+		return fmt.Errorf("file has %d invalid rows, nothing was imported", len(res.Errors))
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"receipt-detector/adaptor"
+	"receipt-detector/config"
+	"receipt-detector/entity"
+	"receipt-detector/repository"
+	"receipt-detector/repository/elasticsearch"
+	"receipt-detector/repository/postgres"
+	"receipt-detector/repository/redis"
+	"receipt-detector/service"
+	"time"
+
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+	"github.com/sirupsen/logrus"
+)
+
+func importReceipts(ctx context.Context, config *config.AppConfig, args []string) error {
+	flags := flag.NewFlagSet("import-receipts", flag.ExitOnError)
+
+	deviceId := flags.String("device", "", "Device the receipts are imported for")
+	file := flags.String("file", "", "CSV file to import")
+	mapping := flags.String("mapping", "", `Column mapping as JSON, e.g. {"receipt_name":"Store","receipt_date":"Date"}`)
+	dateFormat := flags.String("date-format", "", "Go time layout of the date column, defaults to unix millis, yyyy-mm-dd or RFC 3339")
+	currency := flags.String("currency", "", "Currency for rows without one")
+	dryRun := flags.Bool("dry-run", false, "Validate the file without importing it")
+	importDuplicates := flags.Bool("import-duplicates", false, "Import receipts that match an existing receipt")
+
+	flags.Parse(args)
+
+	if *deviceId == "" {
+		return fmt.Errorf("-device is required")
+	}
+
+	if *file == "" {
+		return fmt.Errorf("-file is required")
+	}
+
+	in, err := os.Open(*file)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer in.Close()
+
+	db, err := adaptor.ConnectPostgres(config.Db)
+	if err != nil {
+		return fmt.Errorf("failed to connect to db: %w", err)
+	}
+	defer db.Close()
+
+	es, err := adaptor.ConnectElastic(config.Elasticsearch)
+	if err != nil {
+		return fmt.Errorf("failed to connect to es: %w", err)
+	}
+
+	rds := adaptor.ConnectRedis(config.Redis)
+	defer rds.Close()
+
+	budgetNotifier, err := adaptor.NewNotifier(config.Notifier)
+	if err != nil {
+		return fmt.Errorf("failed to create notifier: %w", err)
+	}
+
+	cacheRepo := redis.NewCache(redis.CacheOpt{
+		Client:       rds,
+		AnalyticsTTL: time.Duration(config.Cache.TTL.Analytics),
+	})
+
+	receiptImportService := service.NewReceiptImportService(service.ReceiptImportOpts{
+		ReceiptsRepo:               postgres.NewReceipts(db),
+		ReceiptItemsRepo:           postgres.NewReceiptItems(db),
+		UnitOfWork:                 repository.NewUnitOfWork(db),
+		ReceiptSearchRepo:          elasticsearch.NewReceiptSearch(es, config.Elasticsearch.Indices.Receipts),
+		ReceiptTagsRepo:            postgres.NewReceiptTags(db),
+		CacheRepo:                  cacheRepo,
+		BudgetsRepo:                postgres.NewBudgets(db),
+		BudgetAlertsRepo:           postgres.NewBudgetAlerts(db),
+		SpendingAnalyticsRepo:      postgres.NewSpendingAnalytics(db),
+		Notifier:                   budgetNotifier,
+		AuditLogsRepo:              postgres.NewAuditLogs(db),
+		ReceiptParticipantsRepo:    postgres.NewReceiptParticipants(db),
+		ReceiptItemAssignmentsRepo: postgres.NewReceiptItemAssignments(db),
+		ReceiptDuplicatesRepo:      postgres.NewReceiptDuplicates(db),
+		DuplicateThreshold:         config.Duplicate.Threshold,
+		DuplicateDateWindow:        time.Duration(config.Duplicate.DateWindow),
+	})
+
+	ctx = context.WithValue(ctx, hAppconstant.DeviceIdKey, *deviceId)
+
+	res, err := receiptImportService.Import(ctx, entity.ImportReceiptsRequest{
+		Mapping:          *mapping,
+		DateFormat:       *dateFormat,
+		Currency:         *currency,
+		DryRun:           *dryRun,
+		ImportDuplicates: *importDuplicates,
+	}, in)
+	if err != nil {
+		return err
+	}
+
+	for _, rowErr := range res.Errors {
+		logrus.Warnf("Row %d: %s %s", rowErr.Row, rowErr.Field, rowErr.Message)
+	}
+
+	for _, duplicate := range res.Duplicates {
+		logrus.Warnf("Row %d: %q duplicates receipt %d", duplicate.Row, duplicate.ReceiptName, duplicate.ExistingReceiptId)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"rows":       res.RowCount,
+		"receipts":   res.ReceiptCount,
+		"items":      res.ItemCount,
+		"duplicates": res.DuplicateCount,
+		"errors":     len(res.Errors),
+		"imported":   res.ImportedCount,
+		"dry_run":    res.DryRun,
+	}).Info("Import finished")
+
+	if len(res.Errors) > 0 {
+		return fmt.Errorf("file has %d invalid rows, nothing was imported", len(res.Errors))
+	}
+
+	return nil
+}
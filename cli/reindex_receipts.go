@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"receipt-detector/adaptor"
+	"receipt-detector/config"
+	"receipt-detector/repository/elasticsearch"
+	"receipt-detector/repository/postgres"
+	"receipt-detector/service"
+
+	"github.com/sirupsen/logrus"
+)
+
+func reindexReceipts(ctx context.Context, config *config.AppConfig, args []string) error {
+	db, err := adaptor.ConnectPostgres(config.Db)
+	if err != nil {
+		return fmt.Errorf("failed to connect to db: %w", err)
+	}
+	defer db.Close()
+
+	es, err := adaptor.ConnectElastic(config.Elasticsearch)
+	if err != nil {
+		return fmt.Errorf("failed to connect to es: %w", err)
+	}
+
+	receiptSearchService := service.NewReceiptSearchService(service.ReceiptSearchOpts{
+		ReceiptsRepo:      postgres.NewReceipts(db),
+		ReceiptItemsRepo:  postgres.NewReceiptItems(db),
+		ReceiptSearchRepo: elasticsearch.NewReceiptSearch(es, config.Elasticsearch.Indices.Receipts),
+		ReceiptTagsRepo:   postgres.NewReceiptTags(db),
+	})
+
+	indexed, err := receiptSearchService.Reindex(ctx)
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Indexed %d receipts", indexed)
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"receipt-detector/adaptor"
+	"receipt-detector/config"
+	"receipt-detector/repository/postgres"
+	"receipt-detector/service"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func scanDuplicates(ctx context.Context, config *config.AppConfig, args []string) error {
+	db, err := adaptor.ConnectPostgres(config.Db)
+	if err != nil {
+		return fmt.Errorf("failed to connect to db: %w", err)
+	}
+	defer db.Close()
+
+	receiptDuplicateService := service.NewReceiptDuplicateService(service.ReceiptDuplicateOpts{
+		ReceiptsRepo:               postgres.NewReceipts(db),
+		ReceiptItemsRepo:           postgres.NewReceiptItems(db),
+		ReceiptDuplicatesRepo:      postgres.NewReceiptDuplicates(db),
+		Threshold:                  config.Duplicate.Threshold,
+		DateWindow:                 time.Duration(config.Duplicate.DateWindow),
+		ReceiptParticipantsRepo:    postgres.NewReceiptParticipants(db),
+		ReceiptItemAssignmentsRepo: postgres.NewReceiptItemAssignments(db),
+	})
+
+	found, err := receiptDuplicateService.Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Found %d suspected duplicate pairs", found)
+
+	return nil
+}
@@ -19,12 +19,19 @@ type OcrConfig struct {
 	AllowedFileType map[string]bool `json:"allowed_file_type"`
 }
 
+type AttachmentConfig struct {
+	MaxFileSize     float64         `json:"max_file_size_mb"`
+	AllowedFileType map[string]bool `json:"allowed_file_type"`
+	MaxPerReceipt   int             `json:"max_per_receipt"`
+}
+
 type CorsConfig struct {
 	AllowedOrigins []string `json:"allowed_origins"`
 }
 
 type ElasticSearchIndicesConfig struct {
 	ReceiptDetectionResults string `json:"receipt_detection_results"`
+	Receipts                string `json:"receipts"`
 }
 
 type ElasticSearchConfig struct {
@@ -40,6 +47,7 @@ type CacheDurationConfig struct {
 	ReceiptDetectionResult hEntity.Duration `json:"receipt_detection_result"`
 	Receipt                hEntity.Duration `json:"receipt"`
 	ReceiptItems           hEntity.Duration `json:"receipt_items"`
+	Analytics              hEntity.Duration `json:"analytics"`
 }
 
 type CacheConfig struct {
@@ -47,16 +55,61 @@ type CacheConfig struct {
 }
 
 type LocalStorageConfig struct {
-	Directory          string `json:"directory"`
-	EnableStaticServer bool   `json:"enable_static_server"`
-	ServerHost         string `json:"server_host"`
-	ServerStaticPath   string `json:"server_static_path"`
+	Directory          string           `json:"directory"`
+	EnableStaticServer bool             `json:"enable_static_server"`
+	ServerHost         string           `json:"server_host"`
+	ServerStaticPath   string           `json:"server_static_path"`
+	SignedUrlSecret    string           `json:"signed_url_secret"`
+	SignedUrlTTL       hEntity.Duration `json:"signed_url_ttl"`
 }
 
 type StorageConfig struct {
 	Local LocalStorageConfig `json:"local"`
 }
 
+type TrashConfig struct {
+	RetentionPeriod hEntity.Duration `json:"retention_period"`
+	PurgeInterval   hEntity.Duration `json:"purge_interval"`
+}
+
+type IdempotencyConfig struct {
+	TTL     hEntity.Duration `json:"ttl"`
+	LockTTL hEntity.Duration `json:"lock_ttl"`
+}
+
+type LedgerConfig struct {
+	PaymentAccount   string            `json:"payment_account"`
+	DefaultAccount   string            `json:"default_account"`
+	CategoryAccounts map[string]string `json:"category_accounts"`
+}
+
+type WebhookNotifierConfig struct {
+	Url     string           `json:"url"`
+	Secret  string           `json:"secret"`
+	Timeout hEntity.Duration `json:"timeout"`
+}
+
+type NotifierConfig struct {
+	Type    string                `json:"type"`
+	Webhook WebhookNotifierConfig `json:"webhook"`
+}
+
+type AdminConfig struct {
+	ApiKey string `json:"api_key"`
+}
+
+type ShareConfig struct {
+	SigningSecret string           `json:"signing_secret"`
+	BaseUrl       string           `json:"base_url"`
+	DefaultTTL    hEntity.Duration `json:"default_ttl"`
+	MaxTTL        hEntity.Duration `json:"max_ttl"`
+}
+
+type DuplicateConfig struct {
+	Threshold  float64          `json:"threshold"`
+	DateWindow hEntity.Duration `json:"date_window"`
+}
+
 type AppConfig struct {
 	Port           string              `json:"port"`
 	LogLevel       string              `json:"log_level"`
@@ -68,7 +121,15 @@ type AppConfig struct {
 	Cache          CacheConfig         `json:"cache"`
 	Storage        StorageConfig       `json:"storage"`
 	Ocr            OcrConfig           `json:"ocr"`
+	Attachment     AttachmentConfig    `json:"attachment"`
 	Hash           hHelper.HashConfig  `json:"hash"`
+	Trash          TrashConfig         `json:"trash"`
+	Idempotency    IdempotencyConfig   `json:"idempotency"`
+	Ledger         LedgerConfig        `json:"ledger"`
+	Notifier       NotifierConfig      `json:"notifier"`
+	Admin          AdminConfig         `json:"admin"`
+	Share          ShareConfig         `json:"share"`
+	Duplicate      DuplicateConfig     `json:"duplicate"`
 }
 
 func Init() (AppConfig, error) {
@@ -0,0 +1,66 @@
+package entity
+
+import "encoding/json"
+
+const (
+	AuditEntityReceipt          = "receipt"
+	AuditEntityReceiptItem      = "receipt_item"
+	AuditEntityDetectionHistory = "detection_history"
+
+	// Tags are logged as the sorted tag ids of a receipt and assignments as
+	// the assignments of one item, so each entry holds the whole set.
+	AuditEntityReceiptTags            = "receipt_tags"
+	AuditEntityReceiptParticipant     = "receipt_participant"
+	AuditEntityReceiptItemAssignments = "receipt_item_assignments"
+)
+
+const (
+	AuditOperationCreate   = "create"
+	AuditOperationUpdate   = "update"
+	AuditOperationDelete   = "delete"
+	AuditOperationRestore  = "restore"
+	AuditOperationReorder  = "reorder"
+	AuditOperationImport   = "import"
+	AuditOperationMerge    = "merge"
+	AuditOperationSplit    = "split"
+	AuditOperationDetect   = "detect"
+	AuditOperationResolve  = "resolve_duplicate"
+	AuditOperationPurge    = "purge"
+	AuditOperationOcrMerge = "attachment_ocr"
+)
+
+// AuditLog is one append-only entry describing a change to a single entity.
+// Before and after hold the full entity state, null when it did not exist or
+// was not live, so any earlier state can be rebuilt by replaying them.
+type AuditLog struct {
+	AuditId    int64           `json:"audit_id"`
+	DeviceId   string          `json:"device_id"`
+	RequestId  string          `json:"request_id,omitempty"`
+	EntityType string          `json:"entity_type"`
+	EntityId   string          `json:"entity_id"`
+	ReceiptId  *int64          `json:"receipt_id,omitempty"`
+	Operation  string          `json:"operation"`
+	BeforeData json.RawMessage `json:"before"`
+	AfterData  json.RawMessage `json:"after"`
+	CreatedAt  int64           `json:"created_at"`
+}
+
+type ReceiptHistoryRequest struct {
+	AsOf *int64 `form:"as_of" binding:"omitempty,min=0"`
+}
+
+// ReceiptState is the receipt as it was at AsOf. Receipt is null when the
+// receipt did not exist yet or was in the trash at that time.
+type ReceiptState struct {
+	AsOf         int64                   `json:"as_of"`
+	Receipt      *Receipt                `json:"receipt"`
+	ReceiptItems []ReceiptItem           `json:"receipt_items"`
+	TagIds       []int64                 `json:"tag_ids"`
+	Participants []ReceiptParticipant    `json:"participants"`
+	Assignments  []ReceiptItemAssignment `json:"assignments"`
+}
+
+type ReceiptHistoryResponse struct {
+	Entries []AuditLog    `json:"entries"`
+	State   *ReceiptState `json:"state,omitempty"`
+}
@@ -0,0 +1,80 @@
+package entity
+
+const (
+	BudgetPeriodWeekly  = "weekly"
+	BudgetPeriodMonthly = "monthly"
+
+	BudgetAlertEventType = "budget.threshold_crossed"
+)
+
+// BudgetAlertThresholds are the percentages of a budget that raise an alert
+// the first time spending reaches them within a period.
+var BudgetAlertThresholds = []int{80, 100}
+
+type Budget struct {
+	BudgetId  int64   `json:"budget_id"`
+	DeviceId  string  `json:"-"`
+	Category  string  `json:"category"`
+	Period    string  `json:"period"`
+	Currency  string  `json:"currency"`
+	Amount    float64 `json:"amount"`
+	Timezone  string  `json:"timezone"`
+	CreatedAt int64   `json:"created_at"`
+	UpdatedAt *int64  `json:"updated_at,omitempty"`
+}
+
+type CreateBudgetRequest struct {
+	Category string   `json:"category" binding:"required"`
+	Period   string   `json:"period" binding:"required,oneof=weekly monthly"`
+	Currency string   `json:"currency" binding:"required"`
+	Amount   *float64 `json:"amount" binding:"required,gt=0"`
+	Timezone string   `json:"timezone"`
+}
+
+type CreateBudgetResponse struct {
+	BudgetId int64 `json:"budget_id"`
+}
+
+type UpdateBudgetRequest struct {
+	BudgetId int64    `json:"-"`
+	DeviceId string   `json:"-"`
+	Amount   *float64 `json:"amount" binding:"omitempty,gt=0"`
+	Timezone *string  `json:"timezone"`
+}
+
+type ListBudgetsResponse struct {
+	Budgets []Budget `json:"budgets"`
+}
+
+type BudgetStatus struct {
+	Budget
+	PeriodStart int64   `json:"period_start"`
+	PeriodEnd   int64   `json:"period_end"`
+	Spent       float64 `json:"spent"`
+	Remaining   float64 `json:"remaining"`
+	Projected   float64 `json:"projected"`
+	Percent     float64 `json:"percent"`
+}
+
+type ListBudgetStatusResponse struct {
+	Budgets []BudgetStatus `json:"budgets"`
+}
+
+type BudgetAlert struct {
+	AlertId     int64   `json:"alert_id"`
+	BudgetId    int64   `json:"budget_id"`
+	PeriodStart int64   `json:"period_start"`
+	Threshold   int     `json:"threshold"`
+	Spent       float64 `json:"spent"`
+	CreatedAt   int64   `json:"created_at"`
+}
+
+// BudgetAlertEvent is what notifiers deliver when spending in a budget period
+// crosses one of the alert thresholds.
+type BudgetAlertEvent struct {
+	Type       string       `json:"type"`
+	DeviceId   string       `json:"device_id"`
+	Threshold  int          `json:"threshold"`
+	Status     BudgetStatus `json:"status"`
+	OccurredAt int64        `json:"occurred_at"`
+}
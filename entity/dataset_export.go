@@ -0,0 +1,44 @@
+package entity
+
+const (
+	DatasetSplitTrain      = "train"
+	DatasetSplitValidation = "validation"
+)
+
+type ReceiptDetectionHistoryFilter struct {
+	CreatedFrom    int64
+	CreatedTo      int64
+	AfterHistoryId int64
+	Limit          int
+}
+
+type DatasetExportRequest struct {
+	Version         string  `json:"version"`
+	CreatedFrom     int64   `json:"created_from"`
+	CreatedTo       int64   `json:"created_to"`
+	SampleRatio     float64 `json:"sample_ratio"`
+	ValidationRatio float64 `json:"validation_ratio"`
+	Seed            string  `json:"seed"`
+}
+
+type DatasetManifestEntry struct {
+	ResultId   string                `json:"result_id"`
+	RevisionId string                `json:"revision_id"`
+	Image      string                `json:"image"`
+	Original   []OcrEngineItemDetail `json:"original"`
+	Approved   []OcrEngineItemDetail `json:"approved"`
+	CreatedAt  int64                 `json:"created_at"`
+}
+
+type DatasetMetadata struct {
+	Version         string  `json:"version"`
+	CreatedAt       int64   `json:"created_at"`
+	CreatedFrom     int64   `json:"created_from"`
+	CreatedTo       int64   `json:"created_to"`
+	SampleRatio     float64 `json:"sample_ratio"`
+	ValidationRatio float64 `json:"validation_ratio"`
+	Seed            string  `json:"seed"`
+	TrainCount      int     `json:"train_count"`
+	ValidationCount int     `json:"validation_count"`
+	SkippedCount    int     `json:"skipped_count"`
+}
@@ -0,0 +1,19 @@
+package entity
+
+type DeviceSetting struct {
+	DeviceId        string `json:"-"`
+	DefaultLanguage string `json:"default_language" binding:"omitempty,bcp47_language_tag"`
+	DefaultCurrency string `json:"default_currency" binding:"omitempty,len=3"`
+	DefaultCountry  string `json:"default_country" binding:"omitempty,len=2"`
+	BaseCurrency    string `json:"base_currency" binding:"omitempty,len=3"`
+	CreatedAt       int64  `json:"created_at"`
+	UpdatedAt       *int64 `json:"updated_at"`
+}
+
+func (d DeviceSetting) OcrEngineOptions() OcrEngineOptions {
+	return OcrEngineOptions{
+		Language: d.DefaultLanguage,
+		Currency: d.DefaultCurrency,
+		Country:  d.DefaultCountry,
+	}
+}
@@ -0,0 +1,74 @@
+package entity
+
+const (
+	ExchangeRateFormatCsv = "csv"
+	ExchangeRateFormatEcb = "ecb"
+
+	ExchangeRateSourceApi = "api"
+	ExchangeRateSourceCsv = "csv"
+	ExchangeRateSourceEcb = "ecb"
+
+	// EcbBaseCurrency is the currency ECB reference rates are quoted against.
+	EcbBaseCurrency = "EUR"
+)
+
+// ExchangeRate is the value of one unit of BaseCurrency in QuoteCurrency on
+// RateDate, formatted as yyyy-mm-dd.
+type ExchangeRate struct {
+	RateDate      string  `json:"rate_date" binding:"required,datetime=2006-01-02"`
+	BaseCurrency  string  `json:"base_currency" binding:"required,len=3"`
+	QuoteCurrency string  `json:"quote_currency" binding:"required,len=3"`
+	Rate          float64 `json:"rate" binding:"required,gt=0"`
+	Source        string  `json:"source"`
+	CreatedAt     int64   `json:"created_at"`
+	UpdatedAt     *int64  `json:"updated_at,omitempty"`
+}
+
+type UpsertExchangeRatesRequest struct {
+	Rates []ExchangeRate `json:"rates" binding:"required,min=1,max=10000,dive"`
+}
+
+type ImportExchangeRatesRequest struct {
+	Format string `form:"format" binding:"required,oneof=csv ecb"`
+}
+
+type UpsertExchangeRatesResponse struct {
+	RowCount      int              `json:"row_count"`
+	UpsertedCount int              `json:"upserted_count"`
+	Errors        []ImportRowError `json:"errors"`
+}
+
+type ListExchangeRatesRequest struct {
+	BaseCurrency  string `form:"base_currency"`
+	QuoteCurrency string `form:"quote_currency"`
+	DateFrom      string `form:"date_from" binding:"omitempty,datetime=2006-01-02"`
+	DateTo        string `form:"date_to" binding:"omitempty,datetime=2006-01-02"`
+	Limit         int    `form:"limit" binding:"omitempty,min=1,max=1000"`
+}
+
+type ExchangeRateFilter struct {
+	BaseCurrency  string
+	QuoteCurrency string
+	DateFrom      string
+	DateTo        string
+	Limit         int
+}
+
+type ListExchangeRatesResponse struct {
+	Rates []ExchangeRate `json:"rates"`
+}
+
+// ExchangeRateLookup asks for the rate of Currency on RateDate, formatted as
+// yyyy-mm-dd.
+type ExchangeRateLookup struct {
+	Currency string
+	RateDate string
+}
+
+// ConvertedAmount is an amount converted into the base currency of the device
+// with the rate of the receipt date.
+type ConvertedAmount struct {
+	Currency string   `json:"currency"`
+	Amount   float64  `json:"amount"`
+	Rate     *float64 `json:"rate,omitempty"`
+}
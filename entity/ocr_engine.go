@@ -28,3 +28,11 @@ type OcrEngineItemDetail struct {
 func (p PriceDetail) MarshalJSON() ([]byte, error) {
 	return []byte(fmt.Sprintf(`{"currency":%q,"numeric":%.2f}`, p.Currency, p.Numeric)), nil
 }
+
+// OcrEngineOptions tune detection. Currency and country are checked once they
+// are normalized, so they accept any case.
+type OcrEngineOptions struct {
+	Language string `json:"language,omitempty" form:"language" binding:"omitempty,bcp47_language_tag"`
+	Currency string `json:"currency,omitempty" form:"currency"`
+	Country  string `json:"country,omitempty" form:"country"`
+}
@@ -1,26 +1,34 @@
 package entity
 
 type Receipt struct {
-	ReceiptId       int64  `json:"receipt_id,omitempty"`
-	ReceiptName     string `json:"receipt_name" binding:"required"`
-	ReceiptDate     int64  `json:"receipt_date"`
-	ReceiptImageUrl string `json:"receipt_image_url"`
-	ResultId        string `json:"result_id" binding:"required"`
-	DeviceId        string `json:"device_id,omitempty"`
-	CreatedAt       int64  `json:"created_at"`
-	UpdatedAt       *int64 `json:"updated_at"`
-	DeletedAt       *int64 `json:"deleted_at,omitempty"`
+	ReceiptId       int64            `json:"receipt_id,omitempty"`
+	ReceiptName     string           `json:"receipt_name" binding:"required"`
+	ReceiptDate     int64            `json:"receipt_date"`
+	ReceiptImageUrl string           `json:"receipt_image_url"`
+	ResultId        string           `json:"result_id" binding:"required"`
+	DeviceId        string           `json:"device_id,omitempty"`
+	Total           *float64         `json:"total,omitempty"`
+	TotalCurrency   *string          `json:"total_currency,omitempty"`
+	Summary         *ReceiptSummary  `json:"summary,omitempty"`
+	Converted       *ConvertedAmount `json:"converted,omitempty"`
+	Tags            []Tag            `json:"tags,omitempty"`
+	ItemsOverridden bool             `json:"items_overridden"`
+	CreatedAt       int64            `json:"created_at"`
+	UpdatedAt       *int64           `json:"updated_at"`
+	DeletedAt       *int64           `json:"deleted_at,omitempty"`
 }
 
 type CreateReceiptResponse struct {
-	ReceiptId int64 `json:"receipt_id"`
+	ReceiptId         int64              `json:"receipt_id"`
+	ItemsOverridden   bool               `json:"items_overridden"`
+	DuplicateWarnings []DuplicateWarning `json:"duplicate_warnings"`
 }
 
 type DetectionResult []OcrEngineItemDetail
 
 type CreateReceiptRequest struct {
 	Receipt         Receipt         `json:"receipt" binding:"required"`
-	DetectionResult DetectionResult `json:"detection_result" binding:"required"`
+	DetectionResult DetectionResult `json:"detection_result"`
 }
 
 type GetByReceiptIdResponse struct {
@@ -29,7 +37,67 @@ type GetByReceiptIdResponse struct {
 }
 
 type UpdateReceiptRequest struct {
-	ReceiptId   int64
+	ReceiptId   int64   `json:"-"`
+	DeviceId    string  `json:"-"`
 	ReceiptName *string `json:"receipt_name" binding:"required_without=ReceiptDate"`
 	ReceiptDate *int64  `json:"receipt_date" binding:"required_without=ReceiptName"`
 }
+
+const (
+	ReceiptSortByReceiptDate = "receipt_date"
+	ReceiptSortByCreatedAt   = "created_at"
+	ReceiptSortByTotal       = "total"
+	ReceiptSortByDeletedAt   = "deleted_at"
+
+	SortOrderAsc  = "asc"
+	SortOrderDesc = "desc"
+)
+
+type ListReceiptsRequest struct {
+	Cursor    string   `form:"cursor"`
+	Limit     int      `form:"limit" binding:"omitempty,min=1,max=100"`
+	SortBy    string   `form:"sort_by" binding:"omitempty,oneof=receipt_date created_at total"`
+	SortOrder string   `form:"sort_order" binding:"omitempty,oneof=asc desc"`
+	DateFrom  *int64   `form:"date_from"`
+	DateTo    *int64   `form:"date_to"`
+	Name      string   `form:"name"`
+	Category  string   `form:"category"`
+	Currency  string   `form:"currency"`
+	AmountMin *float64 `form:"amount_min"`
+	AmountMax *float64 `form:"amount_max"`
+	TagIds    []int64  `form:"tag_id" binding:"max=10"`
+}
+
+type ListTrashRequest struct {
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+type ListReceiptsResponse struct {
+	Receipts   []Receipt `json:"receipts"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+type ReceiptCursor struct {
+	SortBy    string `json:"sort_by"`
+	SortOrder string `json:"sort_order"`
+	Value     string `json:"value"`
+	ReceiptId int64  `json:"receipt_id"`
+}
+
+type ReceiptFilter struct {
+	DeviceId        string
+	SortBy          string
+	SortOrder       string
+	DateFrom        *int64
+	DateTo          *int64
+	Name            string
+	Category        string
+	Currency        string
+	AmountMin       *float64
+	AmountMax       *float64
+	TagIds          []int64
+	CursorValue     any
+	CursorReceiptId int64
+	Limit           int
+}
@@ -0,0 +1,40 @@
+package entity
+
+const (
+	AttachmentKindImage    = "image"
+	AttachmentKindDocument = "document"
+)
+
+type ReceiptAttachment struct {
+	AttachmentId    int64   `json:"attachment_id"`
+	ReceiptId       int64   `json:"receipt_id"`
+	DeviceId        string  `json:"-"`
+	FilePath        string  `json:"-"`
+	FileName        string  `json:"file_name"`
+	ContentType     string  `json:"content_type"`
+	FileSize        int64   `json:"file_size"`
+	Kind            string  `json:"kind"`
+	AttachmentOrder int     `json:"attachment_order"`
+	ResultId        *string `json:"result_id,omitempty"`
+	Url             string  `json:"url"`
+	CreatedAt       int64   `json:"created_at"`
+	UpdatedAt       *int64  `json:"updated_at,omitempty"`
+}
+
+type UploadReceiptAttachmentRequest struct {
+	OcrEngineOptions
+	Ocr bool `form:"ocr"`
+}
+
+type UploadReceiptAttachmentResponse struct {
+	Attachment      ReceiptAttachment `json:"attachment"`
+	MergedItemCount int               `json:"merged_item_count"`
+}
+
+type ListReceiptAttachmentsResponse struct {
+	Attachments []ReceiptAttachment `json:"attachments"`
+}
+
+type ReorderReceiptAttachmentsRequest struct {
+	AttachmentIds []int64 `json:"attachment_ids" binding:"required,min=1"`
+}
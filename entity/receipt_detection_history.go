@@ -1,13 +1,15 @@
 package entity
 
 type ReceiptDetectionHistory struct {
-	HistoryId  int64
-	ImagePath  string
-	ResultId   string
-	RevisionId string
-	IsApproced bool
-	IsReviewed bool
-	CreatedAt  int64
-	UpdatedAt  *int64
-	DeletedAt  *int64
+	HistoryId  int64            `json:"history_id"`
+	ImagePath  string           `json:"image_path"`
+	ResultId   string           `json:"result_id"`
+	RevisionId string           `json:"revision_id"`
+	DeviceId   string           `json:"device_id"`
+	IsApproced bool             `json:"is_approved"`
+	IsReviewed bool             `json:"is_reviewed"`
+	OcrOptions OcrEngineOptions `json:"ocr_options"`
+	CreatedAt  int64            `json:"created_at"`
+	UpdatedAt  *int64           `json:"updated_at,omitempty"`
+	DeletedAt  *int64           `json:"deleted_at,omitempty"`
 }
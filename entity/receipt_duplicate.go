@@ -0,0 +1,56 @@
+package entity
+
+const (
+	DuplicateStatusPending   = "pending"
+	DuplicateStatusDismissed = "dismissed"
+	DuplicateStatusConfirmed = "confirmed"
+
+	DuplicateActionDismiss = "dismiss"
+	DuplicateActionConfirm = "confirm"
+)
+
+// Signals that contributed to a duplicate score.
+const (
+	DuplicateReasonMerchant = "merchant"
+	DuplicateReasonDate     = "date"
+	DuplicateReasonTotal    = "total"
+	DuplicateReasonItems    = "items"
+)
+
+// ReceiptDuplicate is a suspected duplicate pair. ReceiptId is always the
+// lower id of the pair.
+type ReceiptDuplicate struct {
+	DuplicateId        int64    `json:"duplicate_id"`
+	DeviceId           string   `json:"-"`
+	ReceiptId          int64    `json:"receipt_id"`
+	DuplicateReceiptId int64    `json:"duplicate_receipt_id"`
+	Score              float64  `json:"score"`
+	Reasons            []string `json:"reasons"`
+	Status             string   `json:"status"`
+	CreatedAt          int64    `json:"created_at"`
+	UpdatedAt          *int64   `json:"updated_at,omitempty"`
+	ResolvedAt         *int64   `json:"resolved_at,omitempty"`
+}
+
+type DuplicateWarning struct {
+	ReceiptId int64    `json:"receipt_id"`
+	Score     float64  `json:"score"`
+	Reasons   []string `json:"reasons"`
+}
+
+type ListReceiptDuplicatesRequest struct {
+	Status string `form:"status" binding:"omitempty,oneof=pending dismissed confirmed"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+type ListReceiptDuplicatesResponse struct {
+	Duplicates []ReceiptDuplicate `json:"duplicates"`
+}
+
+// ResolveReceiptDuplicateRequest either dismisses the pair or confirms it,
+// moving the receipt other than KeepReceiptId to the trash.
+type ResolveReceiptDuplicateRequest struct {
+	DuplicateId   int64
+	Action        string `json:"action" binding:"required,oneof=dismiss confirm"`
+	KeepReceiptId int64  `json:"keep_receipt_id" binding:"required_if=Action confirm"`
+}
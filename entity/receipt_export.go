@@ -0,0 +1,53 @@
+package entity
+
+const (
+	ReceiptExportFormatCsv  = "csv"
+	ReceiptExportFormatXlsx = "xlsx"
+)
+
+const (
+	LedgerFormatLedger    = "ledger"
+	LedgerFormatHledger   = "hledger"
+	LedgerFormatBeancount = "beancount"
+
+	LedgerPostingPerItem     = "item"
+	LedgerPostingPerCategory = "category"
+)
+
+const (
+	ReceiptExportColumnReceiptId         = "receipt_id"
+	ReceiptExportColumnReceiptName       = "receipt_name"
+	ReceiptExportColumnReceiptDate       = "receipt_date"
+	ReceiptExportColumnReceiptTotal      = "receipt_total"
+	ReceiptExportColumnReceiptCurrency   = "receipt_currency"
+	ReceiptExportColumnReceiptItemId     = "receipt_item_id"
+	ReceiptExportColumnItemCategory      = "item_category"
+	ReceiptExportColumnItemName          = "item_name"
+	ReceiptExportColumnItemQuantity      = "item_quantity"
+	ReceiptExportColumnItemPriceCurrency = "item_price_currency"
+	ReceiptExportColumnItemPriceNumeric  = "item_price_numeric"
+	ReceiptExportColumnItemAmount        = "item_amount"
+)
+
+type ReceiptExportFilter struct {
+	DateFrom  *int64   `form:"date_from"`
+	DateTo    *int64   `form:"date_to"`
+	Name      string   `form:"name"`
+	Category  string   `form:"category"`
+	Currency  string   `form:"currency"`
+	AmountMin *float64 `form:"amount_min"`
+	AmountMax *float64 `form:"amount_max"`
+}
+
+type ExportReceiptsRequest struct {
+	ReceiptExportFilter
+	Format  string `form:"format" binding:"omitempty,oneof=csv xlsx"`
+	Columns string `form:"columns"`
+}
+
+type ExportLedgerRequest struct {
+	ReceiptExportFilter
+	Format         string `form:"format" binding:"omitempty,oneof=ledger hledger beancount"`
+	Posting        string `form:"posting" binding:"omitempty,oneof=item category"`
+	PaymentAccount string `form:"payment_account"`
+}
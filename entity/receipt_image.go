@@ -0,0 +1,6 @@
+package entity
+
+type SignedImageRequest struct {
+	Expires   int64  `form:"expires" binding:"required"`
+	Signature string `form:"signature" binding:"required"`
+}
@@ -0,0 +1,48 @@
+package entity
+
+// ReceiptImportMapping maps receipt fields to CSV header names. Empty fields
+// fall back to the field name itself, so a file produced by the CSV export can
+// be imported without a mapping.
+type ReceiptImportMapping struct {
+	ReceiptRef        string `json:"receipt_ref"`
+	ReceiptName       string `json:"receipt_name"`
+	ReceiptDate       string `json:"receipt_date"`
+	ItemCategory      string `json:"item_category"`
+	ItemName          string `json:"item_name"`
+	ItemQuantity      string `json:"item_quantity"`
+	ItemPriceCurrency string `json:"item_price_currency"`
+	ItemPriceNumeric  string `json:"item_price_numeric"`
+}
+
+type ImportReceiptsRequest struct {
+	Mapping          string `form:"mapping"`
+	DateFormat       string `form:"date_format"`
+	Currency         string `form:"currency"`
+	DryRun           bool   `form:"dry_run"`
+	ImportDuplicates bool   `form:"import_duplicates"`
+}
+
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+type ImportDuplicate struct {
+	Row               int    `json:"row"`
+	ReceiptName       string `json:"receipt_name"`
+	ReceiptDate       int64  `json:"receipt_date"`
+	ExistingReceiptId int64  `json:"existing_receipt_id"`
+}
+
+type ImportReceiptsResponse struct {
+	DryRun         bool              `json:"dry_run"`
+	RowCount       int               `json:"row_count"`
+	ReceiptCount   int               `json:"receipt_count"`
+	ItemCount      int               `json:"item_count"`
+	ImportedCount  int               `json:"imported_count"`
+	DuplicateCount int               `json:"duplicate_count"`
+	ReceiptIds     []int64           `json:"receipt_ids"`
+	Duplicates     []ImportDuplicate `json:"duplicates"`
+	Errors         []ImportRowError  `json:"errors"`
+}
@@ -1,14 +1,51 @@
 package entity
 
+// Item categories that adjust the receipt total instead of describing a
+// purchased item.
+const (
+	ItemCategoryTax           = "tax"
+	ItemCategoryService       = "service"
+	ItemCategoryServiceCharge = "service_charge"
+	ItemCategoryDiscount      = "discount"
+)
+
 type ReceiptItem struct {
-	ReceiptItemId     int64   `json:"receipt_item_id"`
-	ReceiptId         int64   `json:"receipt_id"`
-	ItemCategory      string  `json:"item_category"`
-	ItemName          string  `json:"item_name"`
-	ItemQuantity      *int    `json:"item_quantity"`
-	ItemPriceCurrency string  `json:"item_price_currency"`
-	ItemPriceNumeric  float64 `json:"item_price_numeric"`
-	CreatedAt         int64   `json:"created_at"`
-	UpdatedAt         *int64  `json:"updated_at,omitempty"`
-	DeletedAt         *int64  `json:"deleted_at,omitempty"`
+	ReceiptItemId     int64            `json:"receipt_item_id"`
+	ReceiptId         int64            `json:"receipt_id"`
+	ItemCategory      string           `json:"item_category"`
+	ItemName          string           `json:"item_name"`
+	ItemQuantity      *int             `json:"item_quantity"`
+	ItemPriceCurrency string           `json:"item_price_currency"`
+	ItemPriceNumeric  float64          `json:"item_price_numeric"`
+	ItemOrder         int              `json:"item_order"`
+	Converted         *ConvertedAmount `json:"converted,omitempty"`
+	CreatedAt         int64            `json:"created_at"`
+	UpdatedAt         *int64           `json:"updated_at,omitempty"`
+	DeletedAt         *int64           `json:"deleted_at,omitempty"`
+}
+
+type AddReceiptItemRequest struct {
+	ItemCategory      string   `json:"item_category"`
+	ItemName          string   `json:"item_name" binding:"required"`
+	ItemQuantity      *int     `json:"item_quantity" binding:"omitempty,min=1"`
+	ItemPriceCurrency string   `json:"item_price_currency" binding:"required"`
+	ItemPriceNumeric  *float64 `json:"item_price_numeric" binding:"required"`
+}
+
+type AddReceiptItemResponse struct {
+	ReceiptItemId int64 `json:"receipt_item_id"`
+}
+
+type UpdateReceiptItemRequest struct {
+	ReceiptId         int64    `json:"-"`
+	ReceiptItemId     int64    `json:"-"`
+	ItemCategory      *string  `json:"item_category"`
+	ItemName          *string  `json:"item_name" binding:"omitempty,min=1"`
+	ItemQuantity      *int     `json:"item_quantity" binding:"omitempty,min=1"`
+	ItemPriceCurrency *string  `json:"item_price_currency"`
+	ItemPriceNumeric  *float64 `json:"item_price_numeric"`
+}
+
+type ReorderReceiptItemsRequest struct {
+	ReceiptItemIds []int64 `json:"receipt_item_ids" binding:"required,min=1"`
 }
@@ -0,0 +1,45 @@
+package entity
+
+const (
+	LineageOperationMerge = "merge"
+	LineageOperationSplit = "split"
+)
+
+// ReceiptLineage records that items moved from one receipt to another.
+type ReceiptLineage struct {
+	LineageId       int64   `json:"lineage_id"`
+	DeviceId        string  `json:"-"`
+	Operation       string  `json:"operation"`
+	SourceReceiptId int64   `json:"source_receipt_id"`
+	TargetReceiptId int64   `json:"target_receipt_id"`
+	ReceiptItemIds  []int64 `json:"receipt_item_ids"`
+	CreatedAt       int64   `json:"created_at"`
+}
+
+type MergeReceiptsRequest struct {
+	TargetReceiptId  int64   `json:"target_receipt_id" binding:"required"`
+	SourceReceiptIds []int64 `json:"source_receipt_ids" binding:"required,min=1,max=20"`
+}
+
+type MergeReceiptsResponse struct {
+	ReceiptId        int64   `json:"receipt_id"`
+	MergedReceiptIds []int64 `json:"merged_receipt_ids"`
+	MovedItemCount   int     `json:"moved_item_count"`
+}
+
+// SplitReceiptRequest moves the listed items into a new receipt. The new
+// receipt inherits the name and date of the original unless they are given.
+type SplitReceiptRequest struct {
+	ReceiptItemIds []int64 `json:"receipt_item_ids" binding:"required,min=1"`
+	ReceiptName    *string `json:"receipt_name" binding:"omitempty,min=1,max=255"`
+	ReceiptDate    *int64  `json:"receipt_date"`
+}
+
+type SplitReceiptResponse struct {
+	ReceiptId      int64 `json:"receipt_id"`
+	MovedItemCount int   `json:"moved_item_count"`
+}
+
+type ReceiptLineageResponse struct {
+	Lineage []ReceiptLineage `json:"lineage"`
+}
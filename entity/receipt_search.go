@@ -0,0 +1,68 @@
+package entity
+
+type ReceiptSearchItem struct {
+	ReceiptItemId     int64   `json:"receipt_item_id"`
+	ItemCategory      string  `json:"item_category"`
+	ItemName          string  `json:"item_name"`
+	ItemQuantity      *int    `json:"item_quantity"`
+	ItemPriceCurrency string  `json:"item_price_currency"`
+	ItemPriceNumeric  float64 `json:"item_price_numeric"`
+}
+
+type ReceiptSearchDocument struct {
+	ReceiptId     int64               `json:"receipt_id"`
+	DeviceId      string              `json:"device_id"`
+	ReceiptName   string              `json:"receipt_name"`
+	ReceiptDate   int64               `json:"receipt_date"`
+	Total         float64             `json:"total"`
+	TotalCurrency *string             `json:"total_currency"`
+	Items         []ReceiptSearchItem `json:"items"`
+	TagIds        []int64             `json:"tag_ids"`
+	Tags          []string            `json:"tags"`
+	CreatedAt     int64               `json:"created_at"`
+	UpdatedAt     *int64              `json:"updated_at"`
+}
+
+type SearchReceiptsRequest struct {
+	Query     string   `form:"q"`
+	Item      string   `form:"item"`
+	Merchant  string   `form:"merchant"`
+	DateFrom  *int64   `form:"date_from"`
+	DateTo    *int64   `form:"date_to"`
+	AmountMin *float64 `form:"amount_min"`
+	AmountMax *float64 `form:"amount_max"`
+	TagIds    []int64  `form:"tag_id" binding:"max=10"`
+	Offset    int      `form:"offset" binding:"omitempty,min=0"`
+	Limit     int      `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+type ReceiptSearchFilter struct {
+	DeviceId  string
+	Query     string
+	Item      string
+	Merchant  string
+	DateFrom  *int64
+	DateTo    *int64
+	AmountMin *float64
+	AmountMax *float64
+	TagIds    []int64
+	From      int
+	Size      int
+}
+
+type ReceiptSearchHit struct {
+	Receipt   ReceiptSearchDocument `json:"receipt"`
+	Score     *float64              `json:"score,omitempty"`
+	Highlight map[string][]string   `json:"highlight,omitempty"`
+}
+
+type ReceiptSearchResult struct {
+	Total int64
+	Hits  []ReceiptSearchHit
+}
+
+type SearchReceiptsResponse struct {
+	Total      int64              `json:"total"`
+	Hits       []ReceiptSearchHit `json:"hits"`
+	NextOffset *int               `json:"next_offset,omitempty"`
+}
@@ -0,0 +1,82 @@
+package entity
+
+const (
+	PaymentMethodCash         = "cash"
+	PaymentMethodBankTransfer = "bank_transfer"
+	PaymentMethodCard         = "card"
+	PaymentMethodEWallet      = "e_wallet"
+	PaymentMethodOther        = "other"
+
+	PaymentStatusUnpaid   = "unpaid"
+	PaymentStatusPartial  = "partial"
+	PaymentStatusSettled  = "settled"
+	PaymentStatusOverpaid = "overpaid"
+)
+
+type ReceiptPayment struct {
+	PaymentId       int64   `json:"payment_id"`
+	ReceiptId       int64   `json:"receipt_id"`
+	ParticipantId   int64   `json:"participant_id"`
+	PaymentCurrency string  `json:"payment_currency"`
+	PaymentAmount   float64 `json:"payment_amount"`
+	PaymentMethod   string  `json:"payment_method"`
+	Note            string  `json:"note"`
+	PaidAt          int64   `json:"paid_at"`
+	CreatedAt       int64   `json:"created_at"`
+}
+
+type AddReceiptPaymentRequest struct {
+	ParticipantId   int64    `json:"participant_id" binding:"required"`
+	PaymentCurrency string   `json:"payment_currency" binding:"required"`
+	PaymentAmount   *float64 `json:"payment_amount" binding:"required,gt=0"`
+	PaymentMethod   string   `json:"payment_method" binding:"omitempty,oneof=cash bank_transfer card e_wallet other"`
+	Note            string   `json:"note" binding:"max=500"`
+	PaidAt          int64    `json:"paid_at"`
+}
+
+type AddReceiptPaymentResponse struct {
+	PaymentId int64 `json:"payment_id"`
+}
+
+type SetReceiptPayerRequest struct {
+	ParticipantId int64 `json:"participant_id" binding:"required"`
+}
+
+type ParticipantBalance struct {
+	ParticipantId   int64   `json:"participant_id"`
+	ParticipantName string  `json:"participant_name"`
+	IsPayer         bool    `json:"is_payer"`
+	Share           float64 `json:"share"`
+	Paid            float64 `json:"paid"`
+	Outstanding     float64 `json:"outstanding"`
+	Status          string  `json:"status"`
+}
+
+type ReceiptCurrencyBalance struct {
+	Currency    string               `json:"currency"`
+	Total       float64              `json:"total"`
+	Outstanding float64              `json:"outstanding"`
+	Balances    []ParticipantBalance `json:"balances"`
+}
+
+type ReceiptBalance struct {
+	ReceiptId  int64                    `json:"receipt_id"`
+	PayerId    *int64                   `json:"payer_id"`
+	Currencies []ReceiptCurrencyBalance `json:"currencies"`
+}
+
+type SettleUpRequest struct {
+	ReceiptIds []int64 `json:"receipt_ids" binding:"required,min=1,max=100,dive,gt=0"`
+}
+
+type SettlementTransfer struct {
+	From     string  `json:"from"`
+	To       string  `json:"to"`
+	Currency string  `json:"currency"`
+	Amount   float64 `json:"amount"`
+}
+
+type SettleUpResponse struct {
+	Transfers         []SettlementTransfer `json:"transfers"`
+	SkippedReceiptIds []int64              `json:"skipped_receipt_ids"`
+}
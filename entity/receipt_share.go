@@ -0,0 +1,73 @@
+package entity
+
+// Outcomes recorded for every attempt to open a share link.
+const (
+	ShareAccessGranted      = "granted"
+	ShareAccessExpired      = "expired"
+	ShareAccessRevoked      = "revoked"
+	ShareAccessLimitReached = "limit_reached"
+)
+
+type ReceiptShare struct {
+	ShareId     int64  `json:"share_id"`
+	ReceiptId   int64  `json:"receipt_id"`
+	DeviceId    string `json:"-"`
+	TokenHash   string `json:"-"`
+	ExpiresAt   int64  `json:"expires_at"`
+	MaxAccess   *int   `json:"max_access,omitempty"`
+	AccessCount int    `json:"access_count"`
+	RevokedAt   *int64 `json:"revoked_at,omitempty"`
+	CreatedAt   int64  `json:"created_at"`
+	UpdatedAt   *int64 `json:"updated_at,omitempty"`
+}
+
+// CreateReceiptShareRequest falls back to the configured default lifetime
+// when ExpiresInHours is omitted. MaxAccess leaves the link unlimited when
+// omitted.
+type CreateReceiptShareRequest struct {
+	ExpiresInHours *int `json:"expires_in_hours" binding:"omitempty,min=1"`
+	MaxAccess      *int `json:"max_access" binding:"omitempty,min=1"`
+}
+
+// CreateReceiptShareResponse is the only place the token is returned; only
+// its hash is stored.
+type CreateReceiptShareResponse struct {
+	Share ReceiptShare `json:"share"`
+	Token string       `json:"token"`
+	Url   string       `json:"url"`
+}
+
+type ListReceiptSharesResponse struct {
+	Shares []ReceiptShare `json:"shares"`
+}
+
+type ReceiptShareAccess struct {
+	AccessId   int64  `json:"access_id"`
+	ShareId    int64  `json:"share_id"`
+	Outcome    string `json:"outcome"`
+	IpAddress  string `json:"ip_address"`
+	UserAgent  string `json:"user_agent"`
+	AccessedAt int64  `json:"accessed_at"`
+}
+
+type ListReceiptShareAccessesRequest struct {
+	Limit int `form:"limit" binding:"omitempty,min=1,max=500"`
+}
+
+type ListReceiptShareAccessesResponse struct {
+	Accesses []ReceiptShareAccess `json:"accesses"`
+}
+
+// SharedReceipt is the read-only view served to share link holders. It
+// leaves out device and detection identifiers.
+type SharedReceipt struct {
+	ReceiptName     string         `json:"receipt_name"`
+	ReceiptDate     int64          `json:"receipt_date"`
+	ReceiptImageUrl string         `json:"receipt_image_url,omitempty"`
+	Total           *float64       `json:"total,omitempty"`
+	TotalCurrency   *string        `json:"total_currency,omitempty"`
+	Summary         ReceiptSummary `json:"summary"`
+	ReceiptItems    []ReceiptItem  `json:"receipt_items"`
+	Split           *ReceiptSplit  `json:"split,omitempty"`
+	ExpiresAt       int64          `json:"expires_at"`
+}
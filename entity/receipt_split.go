@@ -0,0 +1,63 @@
+package entity
+
+type ReceiptParticipant struct {
+	ParticipantId   int64  `json:"participant_id"`
+	ReceiptId       int64  `json:"receipt_id"`
+	ParticipantName string `json:"participant_name"`
+	IsPayer         bool   `json:"is_payer"`
+	CreatedAt       int64  `json:"created_at"`
+	UpdatedAt       *int64 `json:"updated_at,omitempty"`
+}
+
+type AddReceiptParticipantRequest struct {
+	ParticipantName string `json:"participant_name" binding:"required,max=255"`
+}
+
+type AddReceiptParticipantResponse struct {
+	ParticipantId int64 `json:"participant_id"`
+}
+
+type ReceiptItemAssignment struct {
+	ReceiptItemId int64   `json:"receipt_item_id"`
+	ParticipantId int64   `json:"participant_id"`
+	ShareWeight   float64 `json:"share_weight"`
+}
+
+type ItemAssignmentRequest struct {
+	ParticipantId int64    `json:"participant_id" binding:"required"`
+	ShareWeight   *float64 `json:"share_weight" binding:"omitempty,gt=0"`
+}
+
+// SetItemAssignmentsRequest replaces every assignment of an item. Weights
+// default to 1, so omitting them splits the item evenly.
+type SetItemAssignmentsRequest struct {
+	Assignments []ItemAssignmentRequest `json:"assignments" binding:"dive"`
+}
+
+type ParticipantItemShare struct {
+	ReceiptItemId int64   `json:"receipt_item_id"`
+	ItemName      string  `json:"item_name"`
+	Amount        float64 `json:"amount"`
+}
+
+type ParticipantShare struct {
+	ParticipantId   int64                  `json:"participant_id"`
+	ParticipantName string                 `json:"participant_name"`
+	Subtotal        float64                `json:"subtotal"`
+	Tax             float64                `json:"tax"`
+	ServiceCharge   float64                `json:"service_charge"`
+	Discount        float64                `json:"discount"`
+	Total           float64                `json:"total"`
+	Items           []ParticipantItemShare `json:"items"`
+}
+
+type ReceiptCurrencySplit struct {
+	Currency string             `json:"currency"`
+	Total    float64            `json:"total"`
+	Shares   []ParticipantShare `json:"shares"`
+}
+
+type ReceiptSplit struct {
+	ReceiptId  int64                  `json:"receipt_id"`
+	Currencies []ReceiptCurrencySplit `json:"currencies"`
+}
@@ -0,0 +1,19 @@
+package entity
+
+type ReceiptCurrencySummary struct {
+	Currency      string   `json:"currency"`
+	ItemCount     int      `json:"item_count"`
+	TotalQuantity int      `json:"total_quantity"`
+	Subtotal      float64  `json:"subtotal"`
+	Tax           *float64 `json:"tax,omitempty"`
+	ServiceCharge *float64 `json:"service_charge,omitempty"`
+	Discount      *float64 `json:"discount,omitempty"`
+	Total         float64  `json:"total"`
+}
+
+type ReceiptSummary struct {
+	ItemCount       int                      `json:"item_count"`
+	TotalQuantity   int                      `json:"total_quantity"`
+	PrimaryCurrency string                   `json:"primary_currency,omitempty"`
+	Currencies      []ReceiptCurrencySummary `json:"currencies"`
+}
@@ -0,0 +1,78 @@
+package entity
+
+const (
+	SpendingGroupByCategory = "category"
+	SpendingGroupByMerchant = "merchant"
+	SpendingGroupByCurrency = "currency"
+
+	SpendingIntervalDay   = "day"
+	SpendingIntervalWeek  = "week"
+	SpendingIntervalMonth = "month"
+)
+
+type SpendingBreakdownRequest struct {
+	DateFrom     *int64 `form:"date_from" binding:"required"`
+	DateTo       *int64 `form:"date_to" binding:"required"`
+	Category     string `form:"category"`
+	Currency     string `form:"currency"`
+	Limit        int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	BaseCurrency string `form:"base_currency" binding:"omitempty,iso4217"`
+}
+
+type SpendingTimeseriesRequest struct {
+	DateFrom     *int64 `form:"date_from" binding:"required"`
+	DateTo       *int64 `form:"date_to" binding:"required"`
+	Category     string `form:"category"`
+	Currency     string `form:"currency"`
+	Interval     string `form:"interval" binding:"omitempty,oneof=day week month"`
+	Timezone     string `form:"timezone"`
+	BaseCurrency string `form:"base_currency" binding:"omitempty,iso4217"`
+}
+
+type SpendingFilter struct {
+	DeviceId     string
+	DateFrom     int64
+	DateTo       int64
+	Category     string
+	Currency     string
+	GroupBy      string
+	Interval     string
+	Timezone     string
+	Limit        int
+	BaseCurrency string
+}
+
+type SpendingBreakdown struct {
+	Key            string   `json:"key"`
+	Currency       string   `json:"currency"`
+	Total          float64  `json:"total"`
+	ItemCount      int      `json:"item_count"`
+	ReceiptCount   int      `json:"receipt_count"`
+	ConvertedTotal *float64 `json:"converted_total,omitempty"`
+}
+
+type SpendingTimeBucket struct {
+	Start          int64    `json:"start"`
+	Currency       string   `json:"currency"`
+	Total          float64  `json:"total"`
+	ItemCount      int      `json:"item_count"`
+	ReceiptCount   int      `json:"receipt_count"`
+	ConvertedTotal *float64 `json:"converted_total,omitempty"`
+}
+
+type SpendingBreakdownResponse struct {
+	GroupBy      string              `json:"group_by"`
+	BaseCurrency string              `json:"base_currency,omitempty"`
+	DateFrom     int64               `json:"date_from"`
+	DateTo       int64               `json:"date_to"`
+	Breakdown    []SpendingBreakdown `json:"breakdown"`
+}
+
+type SpendingTimeseriesResponse struct {
+	Interval     string               `json:"interval"`
+	BaseCurrency string               `json:"base_currency,omitempty"`
+	Timezone     string               `json:"timezone"`
+	DateFrom     int64                `json:"date_from"`
+	DateTo       int64                `json:"date_to"`
+	Series       []SpendingTimeBucket `json:"series"`
+}
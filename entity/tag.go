@@ -0,0 +1,54 @@
+package entity
+
+type Tag struct {
+	TagId     int64   `json:"tag_id"`
+	DeviceId  string  `json:"-"`
+	TagName   string  `json:"tag_name"`
+	Color     *string `json:"color,omitempty"`
+	CreatedAt int64   `json:"created_at"`
+	UpdatedAt *int64  `json:"updated_at,omitempty"`
+}
+
+type ReceiptTag struct {
+	ReceiptId int64
+	Tag       Tag
+}
+
+type TagCount struct {
+	Tag
+	ReceiptCount int64 `json:"receipt_count"`
+}
+
+type CreateTagRequest struct {
+	TagName string  `json:"tag_name" binding:"required,max=64"`
+	Color   *string `json:"color" binding:"omitempty,hexcolor"`
+}
+
+type CreateTagResponse struct {
+	TagId int64 `json:"tag_id"`
+}
+
+type UpdateTagRequest struct {
+	TagId    int64   `json:"-"`
+	DeviceId string  `json:"-"`
+	TagName  *string `json:"tag_name" binding:"omitempty,max=64"`
+	Color    *string `json:"color" binding:"omitempty,hexcolor"`
+}
+
+type ListTagsRequest struct {
+	Query string `form:"q"`
+	Limit int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+type ListTagsResponse struct {
+	Tags []TagCount `json:"tags"`
+}
+
+type SetReceiptTagsRequest struct {
+	ReceiptId int64   `json:"-"`
+	TagIds    []int64 `json:"tag_ids" binding:"max=50"`
+}
+
+type ReceiptTagsResponse struct {
+	Tags []Tag `json:"tags"`
+}
@@ -0,0 +1,10 @@
+package notifier
+
+import (
+	"context"
+	"receipt-detector/entity"
+)
+
+type Notifier interface {
+	NotifyBudgetAlert(ctx context.Context, event entity.BudgetAlertEvent) error
+}
@@ -0,0 +1,35 @@
+package notifier
+
+import (
+	"context"
+	"receipt-detector/entity"
+
+	"github.com/sirupsen/logrus"
+)
+
+type logNotifier struct {
+	logHeading string
+}
+
+func NewLogNotifier() *logNotifier {
+	return &logNotifier{
+		logHeading: "[external][notifier][logNotifier]",
+	}
+}
+
+func (n *logNotifier) NotifyBudgetAlert(ctx context.Context, event entity.BudgetAlertEvent) error {
+	logHeading := n.logHeading + "[NotifyBudgetAlert]"
+
+	logrus.WithFields(logrus.Fields{
+		"device_id": event.DeviceId,
+		"budget_id": event.Status.BudgetId,
+		"category":  event.Status.Category,
+		"period":    event.Status.Period,
+		"currency":  event.Status.Currency,
+		"amount":    event.Status.Amount,
+		"spent":     event.Status.Spent,
+		"threshold": event.Threshold,
+	}).Infof("%s Budget threshold crossed", logHeading)
+
+	return nil
+}
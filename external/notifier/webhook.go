@@ -0,0 +1,80 @@
+package notifier
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"receipt-detector/entity"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	WebhookSignatureHeader = "X-Signature-256"
+	WebhookEventHeader     = "X-Event-Type"
+)
+
+type webhookNotifier struct {
+	client *resty.Client
+	url    string
+	secret string
+
+	logHeading string
+}
+
+type WebhookNotifierOpt struct {
+	Url     string
+	Secret  string
+	Timeout time.Duration
+}
+
+func NewWebhookNotifier(opt WebhookNotifierOpt) *webhookNotifier {
+	return &webhookNotifier{
+		client: resty.New().SetTimeout(opt.Timeout),
+		url:    opt.Url,
+		secret: opt.Secret,
+
+		logHeading: "[external][notifier][webhookNotifier]",
+	}
+}
+
+// post delivers the event as a JSON body. When a secret is configured the body
+// is signed with HMAC-SHA256 so that receivers can verify where it came from.
+func (n *webhookNotifier) post(ctx context.Context, logHeading, eventType string, event any) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("%s[json.Marshal] %w", logHeading, err)
+	}
+
+	req := n.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetHeader(WebhookEventHeader, eventType).
+		SetBody(body)
+
+	if n.secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write(body)
+
+		req.SetHeader(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := req.Post(n.url)
+	if err != nil {
+		return fmt.Errorf("%s[client.R()] %w", logHeading, err)
+	}
+
+	if resp.IsError() {
+		return fmt.Errorf("%s[resp.IsError] Error Response [status_code: %v][resp: %s]", logHeading, resp.StatusCode(), string(resp.Body()))
+	}
+
+	return nil
+}
+
+func (n *webhookNotifier) NotifyBudgetAlert(ctx context.Context, event entity.BudgetAlertEvent) error {
+	return n.post(ctx, n.logHeading+"[NotifyBudgetAlert]", event.Type, event)
+}
@@ -7,5 +7,5 @@ import (
 )
 
 type OcrEngine interface {
-	DetectReceipt(ctx context.Context, file multipart.File, fileHeader *multipart.FileHeader) ([]entity.OcrEngineItemDetail, error)
+	DetectReceipt(ctx context.Context, file multipart.File, fileHeader *multipart.FileHeader, opts entity.OcrEngineOptions) ([]entity.OcrEngineItemDetail, error)
 }
@@ -15,6 +15,9 @@ type ocrEngineRestClient struct {
 
 	detectReceiptPath string
 	fileParam         string
+	languageParam     string
+	currencyParam     string
+	countryParam      string
 
 	logHeading string
 }
@@ -26,18 +29,36 @@ func NewOcEngineRestClient(baseUrl string) *ocrEngineRestClient {
 
 		detectReceiptPath: "/receipt/detect",
 		fileParam:         "file",
+		languageParam:     "language",
+		currencyParam:     "currency",
+		countryParam:      "country",
 
 		logHeading: "[external][ocr][ocrEngineRestClient]",
 	}
 }
 
-func (r *ocrEngineRestClient) DetectReceipt(ctx context.Context, file multipart.File, fileHeader *multipart.FileHeader) ([]entity.OcrEngineItemDetail, error) {
+func (r *ocrEngineRestClient) DetectReceipt(ctx context.Context, file multipart.File, fileHeader *multipart.FileHeader, opts entity.OcrEngineOptions) ([]entity.OcrEngineItemDetail, error) {
 	logHeading := r.logHeading + "[DetectReceipt]"
 
 	ocrResponse := &entity.OcrEngineResponse[[]entity.OcrEngineItemDetail]{}
 
+	hints := map[string]string{}
+
+	if opts.Language != "" {
+		hints[r.languageParam] = opts.Language
+	}
+
+	if opts.Currency != "" {
+		hints[r.currencyParam] = opts.Currency
+	}
+
+	if opts.Country != "" {
+		hints[r.countryParam] = opts.Country
+	}
+
 	resp, err := r.client.R().
 		SetFileReader(r.fileParam, fileHeader.Filename, file).
+		SetFormData(hints).
 		SetResult(ocrResponse).
 		SetError(ocrResponse).
 		Post(r.baseUrl + r.detectReceiptPath)
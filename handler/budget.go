@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"receipt-detector/entity"
+	"receipt-detector/service"
+
+	"github.com/gin-gonic/gin"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type Budget struct {
+	budgetService service.Budget
+}
+
+func NewBudget(budgetService service.Budget) *Budget {
+	return &Budget{
+		budgetService: budgetService,
+	}
+}
+
+func (h *Budget) Create(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.CreateBudgetRequest
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.budgetService.Create(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+func (h *Budget) List(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	res, err := h.budgetService.List(ctx.Request.Context())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+func (h *Budget) Update(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	budgetId, err := paramId(ctx, "budget_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req entity.UpdateBudgetRequest
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	req.BudgetId = budgetId
+
+	err = h.budgetService.Update(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
+
+func (h *Budget) Delete(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	budgetId, err := paramId(ctx, "budget_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	err = h.budgetService.Delete(ctx.Request.Context(), budgetId)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
+
+func (h *Budget) GetStatus(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	budgetId, err := paramId(ctx, "budget_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.budgetService.GetStatus(ctx.Request.Context(), budgetId)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+func (h *Budget) ListStatus(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	res, err := h.budgetService.ListStatus(ctx.Request.Context())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
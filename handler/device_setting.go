@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"receipt-detector/entity"
+	"receipt-detector/service"
+
+	"github.com/gin-gonic/gin"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type DeviceSetting struct {
+	deviceSettingService service.DeviceSetting
+}
+
+func NewDeviceSetting(deviceSettingService service.DeviceSetting) *DeviceSetting {
+	return &DeviceSetting{
+		deviceSettingService: deviceSettingService,
+	}
+}
+
+func (h *DeviceSetting) GetSetting(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	setting, err := h.deviceSettingService.GetSetting(ctx.Request.Context())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, setting)
+}
+
+func (h *DeviceSetting) UpdateSetting(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.DeviceSetting
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	err = h.deviceSettingService.UpdateSetting(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
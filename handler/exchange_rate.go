@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"receipt-detector/entity"
+	"receipt-detector/service"
+
+	"github.com/gin-gonic/gin"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type ExchangeRate struct {
+	exchangeRateService service.ExchangeRate
+}
+
+func NewExchangeRate(exchangeRateService service.ExchangeRate) *ExchangeRate {
+	return &ExchangeRate{
+		exchangeRateService: exchangeRateService,
+	}
+}
+
+func (h *ExchangeRate) Upsert(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.UpsertExchangeRatesRequest
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.exchangeRateService.Upsert(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+func (h *ExchangeRate) Import(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	file, _, err := ctx.Request.FormFile("file")
+	if err != nil {
+		ctx.Error(hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:    http.StatusUnprocessableEntity,
+			Message: fmt.Sprintf("Failed to read file from request: %v", err),
+		}))
+		return
+	}
+	defer file.Close()
+
+	var req entity.ImportExchangeRatesRequest
+	err = ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.exchangeRateService.Import(ctx.Request.Context(), req, file)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+func (h *ExchangeRate) List(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.ListExchangeRatesRequest
+	err := ctx.ShouldBindQuery(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.exchangeRateService.List(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+)
+
+func paramId(ctx *gin.Context, param string) (int64, error) {
+	idStr := ctx.Param(param)
+	if idStr == "" {
+		return 0, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			ResponseMessage: param + " must be provided",
+		})
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return 0, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			ResponseMessage: param + " must be a number",
+		})
+	}
+
+	return id, nil
+}
@@ -3,10 +3,8 @@ package handler
 import (
 	"receipt-detector/entity"
 	"receipt-detector/service"
-	"strconv"
 
 	"github.com/gin-gonic/gin"
-	hApperror "github.com/michaelyusak/go-helper/apperror"
 	"github.com/michaelyusak/go-helper/helper"
 )
 
@@ -30,37 +28,25 @@ func (h *Receipt) Create(ctx *gin.Context) {
 		return
 	}
 
-	receiptId, err := h.receiptService.CreateOne(ctx.Request.Context(), req.Receipt, req.DetectionResult)
+	res, err := h.receiptService.CreateOne(ctx.Request.Context(), req.Receipt, req.DetectionResult)
 	if err != nil {
 		ctx.Error(err)
 		return
 	}
 
-	helper.ResponseOK(ctx, entity.CreateReceiptResponse{
-		ReceiptId: receiptId,
-	})
+	helper.ResponseOK(ctx, res)
 }
 
 func (h *Receipt) GetByReceiptId(ctx *gin.Context) {
 	ctx.Header("Content-Type", "application/json")
 
-	receiptIdStr := ctx.Param("receipt_id")
-	if receiptIdStr == "" {
-		ctx.Error(hApperror.BadRequestError(hApperror.AppErrorOpt{
-			ResponseMessage: "receipt_id must be provided",
-		}))
-		return
-	}
-
-	receiptId, err := strconv.Atoi(receiptIdStr)
+	receiptId, err := paramId(ctx, "receipt_id")
 	if err != nil {
-		ctx.Error(hApperror.BadRequestError(hApperror.AppErrorOpt{
-			ResponseMessage: "receipt_id must be a number",
-		}))
+		ctx.Error(err)
 		return
 	}
 
-	receipt, receiptItems, err := h.receiptService.GetByReceiptId(ctx.Request.Context(), int64(receiptId))
+	receipt, receiptItems, err := h.receiptService.GetByReceiptId(ctx.Request.Context(), receiptId)
 	if err != nil {
 		ctx.Error(err)
 		return
@@ -75,19 +61,9 @@ func (h *Receipt) GetByReceiptId(ctx *gin.Context) {
 func (h *Receipt) UpdateReceipt(ctx *gin.Context) {
 	ctx.Header("Content-Type", "application/json")
 
-	receiptIdStr := ctx.Param("receipt_id")
-	if receiptIdStr == "" {
-		ctx.Error(hApperror.BadRequestError(hApperror.AppErrorOpt{
-			ResponseMessage: "receipt_id must be provided",
-		}))
-		return
-	}
-
-	receiptId, err := strconv.Atoi(receiptIdStr)
+	receiptId, err := paramId(ctx, "receipt_id")
 	if err != nil {
-		ctx.Error(hApperror.BadRequestError(hApperror.AppErrorOpt{
-			ResponseMessage: "receipt_id must be a number",
-		}))
+		ctx.Error(err)
 		return
 	}
 
@@ -98,7 +74,7 @@ func (h *Receipt) UpdateReceipt(ctx *gin.Context) {
 		return
 	}
 
-	req.ReceiptId = int64(receiptId)
+	req.ReceiptId = receiptId
 
 	err = h.receiptService.UpdateOne(ctx, req)
 	if err != nil {
@@ -108,3 +84,77 @@ func (h *Receipt) UpdateReceipt(ctx *gin.Context) {
 
 	helper.ResponseOK(ctx, nil)
 }
+
+func (h *Receipt) List(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.ListReceiptsRequest
+	err := ctx.ShouldBindQuery(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.receiptService.List(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	helper.ResponseOK(ctx, res)
+}
+
+func (h *Receipt) Delete(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	err = h.receiptService.DeleteOne(ctx.Request.Context(), receiptId)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	helper.ResponseOK(ctx, nil)
+}
+
+func (h *Receipt) Restore(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	err = h.receiptService.RestoreOne(ctx.Request.Context(), receiptId)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	helper.ResponseOK(ctx, nil)
+}
+
+func (h *Receipt) ListTrash(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.ListTrashRequest
+	err := ctx.ShouldBindQuery(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.receiptService.ListTrash(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	helper.ResponseOK(ctx, res)
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"receipt-detector/entity"
+	"receipt-detector/service"
+
+	"github.com/gin-gonic/gin"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type ReceiptAttachment struct {
+	receiptAttachmentService service.ReceiptAttachment
+}
+
+func NewReceiptAttachment(receiptAttachmentService service.ReceiptAttachment) *ReceiptAttachment {
+	return &ReceiptAttachment{
+		receiptAttachmentService: receiptAttachmentService,
+	}
+}
+
+func (h *ReceiptAttachment) Upload(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	file, fileHeader, err := ctx.Request.FormFile("file")
+	if err != nil {
+		ctx.Error(hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:    http.StatusUnprocessableEntity,
+			Message: fmt.Sprintf("Failed to read file from request: %v", err),
+		}))
+		return
+	}
+
+	var req entity.UploadReceiptAttachmentRequest
+	err = ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.receiptAttachmentService.Upload(ctx.Request.Context(), receiptId, file, fileHeader, req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+func (h *ReceiptAttachment) List(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.receiptAttachmentService.List(ctx.Request.Context(), receiptId)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+func (h *ReceiptAttachment) Delete(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	attachmentId, err := paramId(ctx, "attachment_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	err = h.receiptAttachmentService.Delete(ctx.Request.Context(), receiptId, attachmentId)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
+
+func (h *ReceiptAttachment) Reorder(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req entity.ReorderReceiptAttachmentsRequest
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	err = h.receiptAttachmentService.Reorder(ctx.Request.Context(), receiptId, req.AttachmentIds)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
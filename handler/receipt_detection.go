@@ -3,6 +3,7 @@ package handler
 import (
 	"fmt"
 	"net/http"
+	"receipt-detector/entity"
 	"receipt-detector/service"
 
 	"github.com/gin-gonic/gin"
@@ -32,7 +33,14 @@ func (h *ReceiptDetection) DetectReceipt(ctx *gin.Context) {
 		return
 	}
 
-	data, err := h.receiptDetectionService.DetectAndStoreReceipt(ctx.Request.Context(), file, fileHeader)
+	var ocrOptions entity.OcrEngineOptions
+	err = ctx.ShouldBind(&ocrOptions)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	data, err := h.receiptDetectionService.DetectAndStoreReceipt(ctx.Request.Context(), file, fileHeader, ocrOptions)
 	if err != nil {
 		ctx.Error(err)
 		return
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"receipt-detector/entity"
+	"receipt-detector/service"
+
+	"github.com/gin-gonic/gin"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type ReceiptDuplicate struct {
+	receiptDuplicateService service.ReceiptDuplicate
+}
+
+func NewReceiptDuplicate(receiptDuplicateService service.ReceiptDuplicate) *ReceiptDuplicate {
+	return &ReceiptDuplicate{
+		receiptDuplicateService: receiptDuplicateService,
+	}
+}
+
+func (h *ReceiptDuplicate) List(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.ListReceiptDuplicatesRequest
+	err := ctx.ShouldBindQuery(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.receiptDuplicateService.List(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+func (h *ReceiptDuplicate) Resolve(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	duplicateId, err := paramId(ctx, "duplicate_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req entity.ResolveReceiptDuplicateRequest
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	req.DuplicateId = duplicateId
+
+	err = h.receiptDuplicateService.Resolve(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
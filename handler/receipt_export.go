@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	receiptExportContentTypes = map[string]string{
+		entity.ReceiptExportFormatCsv:  "text/csv; charset=utf-8",
+		entity.ReceiptExportFormatXlsx: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	}
+
+	ledgerExportExtensions = map[string]string{
+		entity.LedgerFormatLedger:    "ledger",
+		entity.LedgerFormatHledger:   "journal",
+		entity.LedgerFormatBeancount: "beancount",
+	}
+)
+
+type ReceiptExport struct {
+	receiptExportService service.ReceiptExport
+}
+
+func NewReceiptExport(receiptExportService service.ReceiptExport) *ReceiptExport {
+	return &ReceiptExport{
+		receiptExportService: receiptExportService,
+	}
+}
+
+// exportResponseWriter defers the download headers until the first byte is
+// written, so that validation errors are still returned as JSON.
+type exportResponseWriter struct {
+	ctx         *gin.Context
+	contentType string
+	filename    string
+	started     bool
+}
+
+func (w *exportResponseWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.ctx.Header("Content-Type", w.contentType)
+		w.ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, w.filename))
+	}
+
+	return w.ctx.Writer.Write(p)
+}
+
+func (h *ReceiptExport) Export(ctx *gin.Context) {
+	var req entity.ExportReceiptsRequest
+	err := ctx.ShouldBindQuery(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	if req.Format == "" {
+		req.Format = entity.ReceiptExportFormatCsv
+	}
+
+	w := &exportResponseWriter{
+		ctx:         ctx,
+		contentType: receiptExportContentTypes[req.Format],
+		filename:    exportFilename(req.Format),
+	}
+
+	err = h.receiptExportService.Export(ctx.Request.Context(), req, w)
+	if err != nil {
+		handleExportError(ctx, w, err)
+	}
+}
+
+func (h *ReceiptExport) ExportLedger(ctx *gin.Context) {
+	var req entity.ExportLedgerRequest
+	err := ctx.ShouldBindQuery(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	if req.Format == "" {
+		req.Format = entity.LedgerFormatLedger
+	}
+
+	w := &exportResponseWriter{
+		ctx:         ctx,
+		contentType: "text/plain; charset=utf-8",
+		filename:    exportFilename(ledgerExportExtensions[req.Format]),
+	}
+
+	err = h.receiptExportService.ExportLedger(ctx.Request.Context(), req, w)
+	if err != nil {
+		handleExportError(ctx, w, err)
+	}
+}
+
+func exportFilename(extension string) string {
+	return fmt.Sprintf("receipts-%s.%s", time.Now().UTC().Format("20060102T150405Z"), extension)
+}
+
+func handleExportError(ctx *gin.Context, w *exportResponseWriter, err error) {
+	if !w.started {
+		ctx.Error(err)
+		return
+	}
+
+	// The body is already partially sent, so the error can only be logged.
+	logrus.Errorf("[handler][ReceiptExport] Export interrupted: %v", err)
+	ctx.Abort()
+}
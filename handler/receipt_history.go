@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"receipt-detector/entity"
+	"receipt-detector/service"
+
+	"github.com/gin-gonic/gin"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type ReceiptHistory struct {
+	receiptHistoryService service.ReceiptHistory
+}
+
+func NewReceiptHistory(receiptHistoryService service.ReceiptHistory) *ReceiptHistory {
+	return &ReceiptHistory{
+		receiptHistoryService: receiptHistoryService,
+	}
+}
+
+func (h *ReceiptHistory) Get(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req entity.ReceiptHistoryRequest
+	err = ctx.ShouldBindQuery(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.receiptHistoryService.Get(ctx.Request.Context(), receiptId, req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"receipt-detector/entity"
+	"receipt-detector/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReceiptImage struct {
+	receiptImageService service.ReceiptImage
+}
+
+func NewReceiptImage(receiptImageService service.ReceiptImage) *ReceiptImage {
+	return &ReceiptImage{
+		receiptImageService: receiptImageService,
+	}
+}
+
+func (h *ReceiptImage) GetSignedImage(ctx *gin.Context) {
+	var req entity.SignedImageRequest
+	err := ctx.ShouldBindQuery(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	filePath, err := h.receiptImageService.GetSignedImagePath(ctx.Request.Context(), ctx.Param("filepath"), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Header("Cache-Control", "private, max-age=300")
+	ctx.File(filePath)
+}
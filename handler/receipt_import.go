@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"receipt-detector/entity"
+	"receipt-detector/service"
+
+	"github.com/gin-gonic/gin"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type ReceiptImport struct {
+	receiptImportService service.ReceiptImport
+}
+
+func NewReceiptImport(receiptImportService service.ReceiptImport) *ReceiptImport {
+	return &ReceiptImport{
+		receiptImportService: receiptImportService,
+	}
+}
+
+func (h *ReceiptImport) Import(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	file, _, err := ctx.Request.FormFile("file")
+	if err != nil {
+		ctx.Error(hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:    http.StatusUnprocessableEntity,
+			Message: fmt.Sprintf("Failed to read file from request: %v", err),
+		}))
+		return
+	}
+	defer file.Close()
+
+	var req entity.ImportReceiptsRequest
+	err = ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.receiptImportService.Import(ctx.Request.Context(), req, file)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
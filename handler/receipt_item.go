@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"receipt-detector/entity"
+	"receipt-detector/service"
+
+	"github.com/gin-gonic/gin"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type ReceiptItem struct {
+	receiptItemService service.ReceiptItem
+}
+
+func NewReceiptItem(receiptItemService service.ReceiptItem) *ReceiptItem {
+	return &ReceiptItem{
+		receiptItemService: receiptItemService,
+	}
+}
+
+func (h *ReceiptItem) Add(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req entity.AddReceiptItemRequest
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	receiptItemId, err := h.receiptItemService.AddItem(ctx.Request.Context(), receiptId, req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, entity.AddReceiptItemResponse{
+		ReceiptItemId: receiptItemId,
+	})
+}
+
+func (h *ReceiptItem) Update(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	receiptItemId, err := paramId(ctx, "receipt_item_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req entity.UpdateReceiptItemRequest
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	req.ReceiptId = receiptId
+	req.ReceiptItemId = receiptItemId
+
+	err = h.receiptItemService.UpdateItem(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
+
+func (h *ReceiptItem) Delete(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	receiptItemId, err := paramId(ctx, "receipt_item_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	err = h.receiptItemService.DeleteItem(ctx.Request.Context(), receiptId, receiptItemId)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
+
+func (h *ReceiptItem) Reorder(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req entity.ReorderReceiptItemsRequest
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	err = h.receiptItemService.ReorderItems(ctx.Request.Context(), receiptId, req.ReceiptItemIds)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"receipt-detector/entity"
+	"receipt-detector/service"
+
+	"github.com/gin-gonic/gin"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type ReceiptLineage struct {
+	receiptLineageService service.ReceiptLineage
+}
+
+func NewReceiptLineage(receiptLineageService service.ReceiptLineage) *ReceiptLineage {
+	return &ReceiptLineage{
+		receiptLineageService: receiptLineageService,
+	}
+}
+
+func (h *ReceiptLineage) Merge(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.MergeReceiptsRequest
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.receiptLineageService.Merge(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+func (h *ReceiptLineage) Split(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req entity.SplitReceiptRequest
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.receiptLineageService.Split(ctx.Request.Context(), receiptId, req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+func (h *ReceiptLineage) List(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.receiptLineageService.List(ctx.Request.Context(), receiptId)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"receipt-detector/entity"
+	"receipt-detector/service"
+
+	"github.com/gin-gonic/gin"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type ReceiptSearch struct {
+	receiptSearchService service.ReceiptSearch
+}
+
+func NewReceiptSearch(receiptSearchService service.ReceiptSearch) *ReceiptSearch {
+	return &ReceiptSearch{
+		receiptSearchService: receiptSearchService,
+	}
+}
+
+func (h *ReceiptSearch) Search(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.SearchReceiptsRequest
+	err := ctx.ShouldBindQuery(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.receiptSearchService.Search(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"receipt-detector/entity"
+	"receipt-detector/service"
+
+	"github.com/gin-gonic/gin"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type ReceiptSettlement struct {
+	receiptSettlementService service.ReceiptSettlement
+}
+
+func NewReceiptSettlement(receiptSettlementService service.ReceiptSettlement) *ReceiptSettlement {
+	return &ReceiptSettlement{
+		receiptSettlementService: receiptSettlementService,
+	}
+}
+
+func (h *ReceiptSettlement) SetPayer(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req entity.SetReceiptPayerRequest
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	err = h.receiptSettlementService.SetPayer(ctx.Request.Context(), receiptId, req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
+
+func (h *ReceiptSettlement) AddPayment(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req entity.AddReceiptPaymentRequest
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	paymentId, err := h.receiptSettlementService.AddPayment(ctx.Request.Context(), receiptId, req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, entity.AddReceiptPaymentResponse{
+		PaymentId: paymentId,
+	})
+}
+
+func (h *ReceiptSettlement) ListPayments(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	payments, err := h.receiptSettlementService.ListPayments(ctx.Request.Context(), receiptId)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, payments)
+}
+
+func (h *ReceiptSettlement) DeletePayment(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	paymentId, err := paramId(ctx, "payment_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	err = h.receiptSettlementService.DeletePayment(ctx.Request.Context(), receiptId, paymentId)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
+
+func (h *ReceiptSettlement) GetBalance(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	balance, err := h.receiptSettlementService.GetBalance(ctx.Request.Context(), receiptId)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, balance)
+}
+
+func (h *ReceiptSettlement) SettleUp(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.SettleUpRequest
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.receiptSettlementService.SettleUp(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
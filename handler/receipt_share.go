@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"receipt-detector/entity"
+	"receipt-detector/service"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type ReceiptShare struct {
+	receiptShareService service.ReceiptShare
+}
+
+func NewReceiptShare(receiptShareService service.ReceiptShare) *ReceiptShare {
+	return &ReceiptShare{
+		receiptShareService: receiptShareService,
+	}
+}
+
+func (h *ReceiptShare) Create(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req entity.CreateReceiptShareRequest
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.receiptShareService.Create(ctx.Request.Context(), receiptId, req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+func (h *ReceiptShare) List(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.receiptShareService.List(ctx.Request.Context(), receiptId)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+func (h *ReceiptShare) Revoke(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	shareId, err := paramId(ctx, "share_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	err = h.receiptShareService.Revoke(ctx.Request.Context(), receiptId, shareId)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
+
+func (h *ReceiptShare) ListAccesses(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	shareId, err := paramId(ctx, "share_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req entity.ListReceiptShareAccessesRequest
+	err = ctx.ShouldBindQuery(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.receiptShareService.ListAccesses(ctx.Request.Context(), receiptId, shareId, req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+// GetShared serves the public view of a share link. It does not depend on the
+// device id of the caller.
+func (h *ReceiptShare) GetShared(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+	ctx.Header("Cache-Control", "no-store")
+
+	ipAddress := strings.TrimSpace(ctx.Request.Header.Get(hAppconstant.CfConnectingIp))
+	if ipAddress == "" {
+		ipAddress = ctx.ClientIP()
+	}
+
+	res, err := h.receiptShareService.GetShared(ctx.Request.Context(), ctx.Param("token"), ipAddress, ctx.Request.UserAgent())
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"receipt-detector/entity"
+	"receipt-detector/service"
+
+	"github.com/gin-gonic/gin"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type ReceiptSplit struct {
+	receiptSplitService service.ReceiptSplit
+}
+
+func NewReceiptSplit(receiptSplitService service.ReceiptSplit) *ReceiptSplit {
+	return &ReceiptSplit{
+		receiptSplitService: receiptSplitService,
+	}
+}
+
+func (h *ReceiptSplit) ListParticipants(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	participants, err := h.receiptSplitService.ListParticipants(ctx.Request.Context(), receiptId)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, participants)
+}
+
+func (h *ReceiptSplit) AddParticipant(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req entity.AddReceiptParticipantRequest
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	participantId, err := h.receiptSplitService.AddParticipant(ctx.Request.Context(), receiptId, req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, entity.AddReceiptParticipantResponse{
+		ParticipantId: participantId,
+	})
+}
+
+func (h *ReceiptSplit) DeleteParticipant(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	participantId, err := paramId(ctx, "participant_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	err = h.receiptSplitService.DeleteParticipant(ctx.Request.Context(), receiptId, participantId)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
+
+func (h *ReceiptSplit) SetItemAssignments(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	receiptItemId, err := paramId(ctx, "receipt_item_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req entity.SetItemAssignmentsRequest
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	err = h.receiptSplitService.SetItemAssignments(ctx.Request.Context(), receiptId, receiptItemId, req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
+
+func (h *ReceiptSplit) GetSplit(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	split, err := h.receiptSplitService.GetSplit(ctx.Request.Context(), receiptId)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, split)
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"receipt-detector/entity"
+	"receipt-detector/service"
+
+	"github.com/gin-gonic/gin"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type SpendingAnalytics struct {
+	spendingAnalyticsService service.SpendingAnalytics
+}
+
+func NewSpendingAnalytics(spendingAnalyticsService service.SpendingAnalytics) *SpendingAnalytics {
+	return &SpendingAnalytics{
+		spendingAnalyticsService: spendingAnalyticsService,
+	}
+}
+
+func (h *SpendingAnalytics) breakdown(ctx *gin.Context, groupBy string) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.SpendingBreakdownRequest
+	err := ctx.ShouldBindQuery(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.spendingAnalyticsService.GetBreakdown(ctx.Request.Context(), groupBy, req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+func (h *SpendingAnalytics) Categories(ctx *gin.Context) {
+	h.breakdown(ctx, entity.SpendingGroupByCategory)
+}
+
+func (h *SpendingAnalytics) Merchants(ctx *gin.Context) {
+	h.breakdown(ctx, entity.SpendingGroupByMerchant)
+}
+
+func (h *SpendingAnalytics) Currencies(ctx *gin.Context) {
+	h.breakdown(ctx, entity.SpendingGroupByCurrency)
+}
+
+func (h *SpendingAnalytics) Timeseries(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.SpendingTimeseriesRequest
+	err := ctx.ShouldBindQuery(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.spendingAnalyticsService.GetTimeseries(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
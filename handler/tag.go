@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"receipt-detector/entity"
+	"receipt-detector/service"
+
+	"github.com/gin-gonic/gin"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+)
+
+type Tag struct {
+	tagService service.Tag
+}
+
+func NewTag(tagService service.Tag) *Tag {
+	return &Tag{
+		tagService: tagService,
+	}
+}
+
+func (h *Tag) Create(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.CreateTagRequest
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.tagService.Create(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+func (h *Tag) List(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	var req entity.ListTagsRequest
+	err := ctx.ShouldBindQuery(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	res, err := h.tagService.List(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+func (h *Tag) Update(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	tagId, err := paramId(ctx, "tag_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req entity.UpdateTagRequest
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	req.TagId = tagId
+
+	err = h.tagService.Update(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
+
+func (h *Tag) Delete(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	tagId, err := paramId(ctx, "tag_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	err = h.tagService.Delete(ctx.Request.Context(), tagId)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
+
+func (h *Tag) SetReceiptTags(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	var req entity.SetReceiptTagsRequest
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	req.ReceiptId = receiptId
+
+	res, err := h.tagService.SetReceiptTags(ctx.Request.Context(), req)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, res)
+}
+
+func (h *Tag) RemoveReceiptTag(ctx *gin.Context) {
+	ctx.Header("Content-Type", "application/json")
+
+	receiptId, err := paramId(ctx, "receipt_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	tagId, err := paramId(ctx, "tag_id")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	err = h.tagService.RemoveReceiptTag(ctx.Request.Context(), receiptId, tagId)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	hHelper.ResponseOK(ctx, nil)
+}
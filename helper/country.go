@@ -0,0 +1,19 @@
+package helper
+
+import (
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var countryValidator = validator.New()
+
+func NormalizeCountry(country string) string {
+	return strings.ToUpper(strings.TrimSpace(country))
+}
+
+// IsKnownCountry reports whether country is an ISO 3166-1 alpha-2 code, using
+// the same list as the iso3166_1_alpha2 binding.
+func IsKnownCountry(country string) bool {
+	return countryValidator.Var(NormalizeCountry(country), "required,iso3166_1_alpha2") == nil
+}
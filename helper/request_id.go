@@ -0,0 +1,18 @@
+package helper
+
+import (
+	"context"
+
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+)
+
+// RequestIdKey carries the request id in the request context, so what the
+// services write can be traced back to the request that caused it.
+const RequestIdKey hAppconstant.ContextKey = "request_id"
+
+// RequestIdFromContext returns the request id, or an empty string outside of a
+// request such as in background jobs and the cli.
+func RequestIdFromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(RequestIdKey).(string)
+	return requestId
+}
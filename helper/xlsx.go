@@ -0,0 +1,177 @@
+package helper
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+</Types>`
+
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+
+	// Cell styles 1 to 4 format numbers with 0, 2, 3 and 4 decimals.
+	xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="2"><numFmt numFmtId="164" formatCode="0.000"/><numFmt numFmtId="165" formatCode="0.0000"/></numFmts>
+<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="5">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="1" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="2" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+</cellXfs>
+</styleSheet>`
+
+	xlsxSheetHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+
+	xlsxSheetFooter = `</sheetData></worksheet>`
+)
+
+var (
+	xlsxDecimalStyles = map[int]int{0: 1, 2: 2, 3: 3, 4: 4}
+)
+
+type XlsxCell struct {
+	Text     string
+	Number   *float64
+	Decimals int
+}
+
+// XlsxWriter writes a single-sheet workbook row by row without holding the
+// sheet in memory. Strings are written inline, so no shared string table is
+// needed.
+type XlsxWriter struct {
+	archive *zip.Writer
+	sheet   io.Writer
+}
+
+func NewXlsxWriter(w io.Writer, sheetName string) (*XlsxWriter, error) {
+	archive := zip.NewWriter(w)
+
+	var escapedName xmlBuffer
+	xml.EscapeText(&escapedName, []byte(sheetName))
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, escapedName.String())},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+
+	for _, part := range parts {
+		pw, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = io.WriteString(pw, part.content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.WriteString(sheet, xlsxSheetHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &XlsxWriter{
+		archive: archive,
+		sheet:   sheet,
+	}, nil
+}
+
+func (x *XlsxWriter) WriteRow(cells []XlsxCell) error {
+	var row xmlBuffer
+
+	row.WriteString("<row>")
+
+	for _, cell := range cells {
+		if cell.Number != nil {
+			style := xlsxDecimalStyles[cell.Decimals]
+			row.WriteString(`<c s="` + strconv.Itoa(style) + `"><v>`)
+			row.WriteString(strconv.FormatFloat(*cell.Number, 'f', -1, 64))
+			row.WriteString("</v></c>")
+			continue
+		}
+
+		row.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+		xml.EscapeText(&row, []byte(cell.Text))
+		row.WriteString("</t></is></c>")
+	}
+
+	row.WriteString("</row>")
+
+	_, err := x.sheet.Write(row.Bytes())
+
+	return err
+}
+
+func (x *XlsxWriter) Close() error {
+	_, err := io.WriteString(x.sheet, xlsxSheetFooter)
+	if err != nil {
+		return err
+	}
+
+	return x.archive.Close()
+}
+
+type xmlBuffer struct {
+	buf []byte
+}
+
+func (b *xmlBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+func (b *xmlBuffer) WriteString(s string) {
+	b.buf = append(b.buf, s...)
+}
+
+func (b *xmlBuffer) Bytes() []byte {
+	return b.buf
+}
+
+func (b *xmlBuffer) String() string {
+	return string(b.buf)
+}
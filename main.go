@@ -1,7 +1,16 @@
 package main
 
-import "receipt-detector/server"
+import (
+	"os"
+	"receipt-detector/cli"
+	"receipt-detector/server"
+)
 
 func main() {
+	if len(os.Args) > 1 {
+		cli.Run(os.Args[1:])
+		return
+	}
+
 	server.Init()
 }
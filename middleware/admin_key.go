@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+)
+
+const (
+	AdminKeyHeader = "X-Admin-Key"
+)
+
+type AdminKeyOpt struct {
+	Key string
+}
+
+type adminKey struct {
+	key string
+
+	logTag string
+}
+
+func NewAdminKey(opt AdminKeyOpt) *adminKey {
+	return &adminKey{
+		key: opt.Key,
+
+		logTag: "[middleware][adminKey]",
+	}
+}
+
+// Handle guards the admin routes with a shared key. Admin routes stay closed
+// while no key is configured.
+func (m *adminKey) Handle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logTag := m.logTag + "[Handle]"
+
+		if m.key == "" {
+			c.Error(hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Code:            http.StatusForbidden,
+				Message:         fmt.Sprintf("%s Admin key is not configured", logTag),
+				ResponseMessage: "admin api is disabled",
+			}))
+			c.Abort()
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader(AdminKeyHeader)), []byte(m.key)) != 1 {
+			c.Error(hApperror.UnauthorizedError(hApperror.AppErrorOpt{
+				Message:         fmt.Sprintf("%s Invalid admin key", logTag),
+				ResponseMessage: fmt.Sprintf("missing or invalid %s", AdminKeyHeader),
+			}))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
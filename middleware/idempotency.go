@@ -0,0 +1,279 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"receipt-detector/entity"
+	"receipt-detector/repository"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	idempotencyKeyMaxLength   = 255
+	idempotencyReleaseTimeout = 5 * time.Second
+
+	// idempotencyBodyOverhead leaves room for multipart headers and form
+	// fields on top of the largest file an upload endpoint accepts.
+	idempotencyBodyOverhead = 1024 * 1024
+)
+
+type IdempotencyOpt struct {
+	IdempotencyKeysRepo repository.IdempotencyKeys
+	TTL                 time.Duration
+	LockTTL             time.Duration
+	MaxBodySizeMb       float64
+}
+
+type idempotency struct {
+	idempotencyKeysRepo repository.IdempotencyKeys
+
+	ttl     time.Duration
+	lockTTL time.Duration
+
+	maxBodySize int64
+
+	logTag string
+}
+
+func NewIdempotency(opt IdempotencyOpt) *idempotency {
+	return &idempotency{
+		idempotencyKeysRepo: opt.IdempotencyKeysRepo,
+
+		ttl:     opt.TTL,
+		lockTTL: opt.LockTTL,
+
+		maxBodySize: int64(opt.MaxBodySizeMb*1024*1024) + idempotencyBodyOverhead,
+
+		logTag: "[middleware][idempotency]",
+	}
+}
+
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// requestHash fingerprints the request so that a replay with a different
+// payload can be told apart from a genuine retry. Multipart bodies are hashed
+// part by part because clients pick a new boundary on every attempt.
+func (m *idempotency) requestHash(c *gin.Context, body []byte) (string, error) {
+	h := sha256.New()
+
+	fmt.Fprintf(h, "%s %s\n", c.Request.Method, c.Request.URL.Path)
+
+	mediaType, params, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		h.Write(body)
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	err = m.hashMultipart(h, body, params["boundary"])
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (m *idempotency) hashMultipart(h hash.Hash, body []byte, boundary string) error {
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(h, "%s\x00%s\x00", part.FormName(), part.FileName())
+
+		_, err = io.Copy(h, part)
+		if err != nil {
+			return err
+		}
+
+		h.Write([]byte{0})
+	}
+}
+
+func (m *idempotency) release(deviceId, idempotencyKey string) {
+	ctx, cancel := context.WithTimeout(context.Background(), idempotencyReleaseTimeout)
+	defer cancel()
+
+	err := m.idempotencyKeysRepo.Release(ctx, deviceId, idempotencyKey)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"idempotency_key": idempotencyKey,
+			"error":           err,
+		}).Errorf("%s[idempotencyKeysRepo.Release] Failed to release key", m.logTag)
+	}
+}
+
+func (m *idempotency) rejectReplay(c *gin.Context, logTag, idempotencyKey, requestHash string, record *entity.IdempotencyRecord) {
+	if record == nil || record.Status == entity.IdempotencyStatusProcessing {
+		c.Error(hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusConflict,
+			Message:         fmt.Sprintf("%s Request still in progress [idempotency_key: %s]", logTag, idempotencyKey),
+			ResponseMessage: "A request with this Idempotency-Key is still being processed",
+		}))
+		c.Abort()
+		return
+	}
+
+	if record.RequestHash != requestHash {
+		c.Error(hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusUnprocessableEntity,
+			Message:         fmt.Sprintf("%s Request payload mismatch [idempotency_key: %s]", logTag, idempotencyKey),
+			ResponseMessage: "Idempotency-Key was already used with a different request",
+		}))
+		c.Abort()
+		return
+	}
+
+	c.Header(IdempotentReplayedHeader, "true")
+	c.Data(record.StatusCode, record.ContentType, record.Body)
+	c.Abort()
+}
+
+func (m *idempotency) Handle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logTag := m.logTag + "[Handle]"
+
+		idempotencyKey := strings.TrimSpace(c.GetHeader(IdempotencyKeyHeader))
+		if idempotencyKey == "" {
+			c.Next()
+			return
+		}
+
+		if len(idempotencyKey) > idempotencyKeyMaxLength {
+			c.Error(hApperror.BadRequestError(hApperror.AppErrorOpt{
+				ResponseMessage: fmt.Sprintf("%s must be at most %v characters", IdempotencyKeyHeader, idempotencyKeyMaxLength),
+			}))
+			c.Abort()
+			return
+		}
+
+		deviceId := c.Request.Context().Value(hAppconstant.DeviceIdKey).(string)
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, m.maxBodySize))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				c.Error(hApperror.BadRequestError(hApperror.AppErrorOpt{
+					Code:            http.StatusRequestEntityTooLarge,
+					Message:         fmt.Sprintf("%s[io.ReadAll] Request body too large [limit: %v]", logTag, maxBytesErr.Limit),
+					ResponseMessage: "Request body too large",
+				}))
+				c.Abort()
+				return
+			}
+
+			c.Error(hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Message:         fmt.Sprintf("%s[io.ReadAll] Failed to read request body: %v", logTag, err),
+				ResponseMessage: "Failed to read request body",
+			}))
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		requestHash, err := m.requestHash(c, body)
+		if err != nil {
+			c.Error(hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Message:         fmt.Sprintf("%s[m.requestHash] Failed to hash request: %v", logTag, err),
+				ResponseMessage: "Malformed request body",
+			}))
+			c.Abort()
+			return
+		}
+
+		acquired, err := m.idempotencyKeysRepo.Acquire(c.Request.Context(), deviceId, idempotencyKey, entity.IdempotencyRecord{
+			Status:      entity.IdempotencyStatusProcessing,
+			RequestHash: requestHash,
+		}, m.lockTTL)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"idempotency_key": idempotencyKey,
+				"error":           err,
+			}).Errorf("%s[idempotencyKeysRepo.Acquire] Failed to acquire key, continuing without idempotency", logTag)
+			c.Next()
+			return
+		}
+
+		if !acquired {
+			record, err := m.idempotencyKeysRepo.Get(c.Request.Context(), deviceId, idempotencyKey)
+			if err != nil {
+				c.Error(hApperror.InternalServerError(hApperror.AppErrorOpt{
+					Message: fmt.Sprintf("%s[idempotencyKeysRepo.Get] Failed to get stored response: %v [idempotency_key: %s]", logTag, err, idempotencyKey),
+				}))
+				c.Abort()
+				return
+			}
+
+			m.rejectReplay(c, logTag, idempotencyKey, requestHash, record)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		defer func() {
+			if p := recover(); p != nil {
+				m.release(deviceId, idempotencyKey)
+				panic(p)
+			}
+		}()
+
+		c.Next()
+
+		// Failed requests are not stored so that the client can retry them.
+		if len(c.Errors) > 0 || recorder.Status() >= http.StatusInternalServerError {
+			m.release(deviceId, idempotencyKey)
+			return
+		}
+
+		err = m.idempotencyKeysRepo.Complete(c.Request.Context(), deviceId, idempotencyKey, entity.IdempotencyRecord{
+			Status:      entity.IdempotencyStatusCompleted,
+			RequestHash: requestHash,
+			StatusCode:  recorder.Status(),
+			ContentType: recorder.Header().Get("Content-Type"),
+			Body:        recorder.body.Bytes(),
+		}, m.ttl)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"idempotency_key": idempotencyKey,
+				"error":           err,
+			}).Errorf("%s[idempotencyKeysRepo.Complete] Failed to store response", logTag)
+			m.release(deviceId, idempotencyKey)
+		}
+	}
+}
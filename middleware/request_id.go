@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"context"
+	"receipt-detector/helper"
+
+	"github.com/gin-gonic/gin"
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+)
+
+// RequestIdContext copies the request id set by the go-helper request id
+// middleware into the request context, which is what the services receive.
+// It must be registered after that middleware.
+func RequestIdContext(c *gin.Context) {
+	requestId := c.GetString(hAppconstant.RequestId)
+	if requestId != "" {
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), helper.RequestIdKey, requestId))
+	}
+
+	c.Next()
+}
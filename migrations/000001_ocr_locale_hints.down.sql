@@ -0,0 +1,6 @@
+ALTER TABLE receipt_detection_histories
+    DROP COLUMN IF EXISTS ocr_language,
+    DROP COLUMN IF EXISTS ocr_currency,
+    DROP COLUMN IF EXISTS ocr_country;
+
+DROP TABLE IF EXISTS device_settings;
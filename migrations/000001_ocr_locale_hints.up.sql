@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS device_settings (
+    device_id TEXT PRIMARY KEY,
+    default_language VARCHAR(35) NOT NULL DEFAULT '',
+    default_currency VARCHAR(3) NOT NULL DEFAULT '',
+    default_country VARCHAR(2) NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL,
+    updated_at BIGINT,
+    deleted_at BIGINT
+);
+
+ALTER TABLE receipt_detection_histories
+    ADD COLUMN IF NOT EXISTS ocr_language VARCHAR(35) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS ocr_currency VARCHAR(3) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS ocr_country VARCHAR(2) NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS receipt_items_item_price_currency_idx;
+DROP INDEX IF EXISTS receipt_items_item_category_idx;
+DROP INDEX IF EXISTS receipt_items_receipt_id_idx;
+DROP INDEX IF EXISTS receipts_receipt_name_trgm_idx;
+DROP INDEX IF EXISTS receipts_device_id_created_at_idx;
+DROP INDEX IF EXISTS receipts_device_id_receipt_date_idx;
@@ -0,0 +1,25 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS receipts_device_id_receipt_date_idx
+    ON receipts (device_id, receipt_date, receipt_id)
+    WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS receipts_device_id_created_at_idx
+    ON receipts (device_id, created_at, receipt_id)
+    WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS receipts_receipt_name_trgm_idx
+    ON receipts USING GIN (receipt_name gin_trgm_ops)
+    WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS receipt_items_receipt_id_idx
+    ON receipt_items (receipt_id)
+    WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS receipt_items_item_category_idx
+    ON receipt_items (item_category, receipt_id)
+    WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS receipt_items_item_price_currency_idx
+    ON receipt_items (item_price_currency, receipt_id)
+    WHERE deleted_at IS NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE receipt_items
+    DROP COLUMN IF EXISTS item_order;
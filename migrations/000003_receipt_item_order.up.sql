@@ -0,0 +1,10 @@
+ALTER TABLE receipt_items
+    ADD COLUMN IF NOT EXISTS item_order INT NOT NULL DEFAULT 0;
+
+UPDATE receipt_items ri
+SET item_order = o.item_order
+FROM (
+    SELECT receipt_item_id, ROW_NUMBER() OVER (PARTITION BY receipt_id ORDER BY receipt_item_id) - 1 AS item_order
+    FROM receipt_items
+) o
+WHERE ri.receipt_item_id = o.receipt_item_id;
@@ -0,0 +1,8 @@
+ALTER TABLE receipts
+    DROP COLUMN IF EXISTS items_overridden;
+
+DROP INDEX IF EXISTS receipt_detection_histories_revision_id_idx;
+DROP INDEX IF EXISTS receipt_detection_histories_result_id_idx;
+
+ALTER TABLE receipt_detection_histories
+    DROP COLUMN IF EXISTS device_id;
@@ -0,0 +1,13 @@
+ALTER TABLE receipt_detection_histories
+    ADD COLUMN IF NOT EXISTS device_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS receipt_detection_histories_result_id_idx
+    ON receipt_detection_histories (result_id)
+    WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS receipt_detection_histories_revision_id_idx
+    ON receipt_detection_histories (revision_id)
+    WHERE deleted_at IS NULL;
+
+ALTER TABLE receipts
+    ADD COLUMN IF NOT EXISTS items_overridden BOOLEAN NOT NULL DEFAULT FALSE;
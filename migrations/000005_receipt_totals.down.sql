@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS receipts_device_id_total_amount_idx;
+
+ALTER TABLE receipts
+    DROP COLUMN IF EXISTS total_currency,
+    DROP COLUMN IF EXISTS total_amount;
@@ -0,0 +1,29 @@
+ALTER TABLE receipts
+    ADD COLUMN IF NOT EXISTS total_amount NUMERIC NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS total_currency VARCHAR(3);
+
+WITH currency_totals AS (
+    SELECT receipt_id,
+        UPPER(item_price_currency) AS currency,
+        COUNT(*) FILTER (WHERE LOWER(item_category) NOT IN ('tax', 'service', 'service_charge', 'discount')) AS item_count,
+        SUM(CASE
+            WHEN LOWER(item_category) = 'discount' THEN -ABS(item_price_numeric * COALESCE(item_quantity, 1))
+            ELSE item_price_numeric * COALESCE(item_quantity, 1)
+        END) AS total
+    FROM receipt_items
+    WHERE deleted_at IS NULL
+    GROUP BY receipt_id, UPPER(item_price_currency)
+), primary_totals AS (
+    SELECT DISTINCT ON (receipt_id) receipt_id, currency, total
+    FROM currency_totals
+    ORDER BY receipt_id, item_count DESC, total DESC, currency ASC
+)
+UPDATE receipts r
+SET total_amount = p.total,
+    total_currency = p.currency
+FROM primary_totals p
+WHERE r.receipt_id = p.receipt_id;
+
+CREATE INDEX IF NOT EXISTS receipts_device_id_total_amount_idx
+    ON receipts (device_id, total_amount, receipt_id)
+    WHERE deleted_at IS NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS receipt_item_assignments;
+DROP TABLE IF EXISTS receipt_participants;
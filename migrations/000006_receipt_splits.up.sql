@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS receipt_participants (
+    participant_id BIGSERIAL PRIMARY KEY,
+    receipt_id BIGINT NOT NULL,
+    participant_name VARCHAR(255) NOT NULL,
+    created_at BIGINT NOT NULL,
+    updated_at BIGINT,
+    deleted_at BIGINT
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS receipt_participants_receipt_id_name_idx
+    ON receipt_participants (receipt_id, LOWER(participant_name))
+    WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS receipt_item_assignments (
+    receipt_item_id BIGINT NOT NULL,
+    participant_id BIGINT NOT NULL,
+    share_weight NUMERIC NOT NULL DEFAULT 1 CHECK (share_weight > 0),
+    created_at BIGINT NOT NULL,
+    PRIMARY KEY (receipt_item_id, participant_id)
+);
+
+CREATE INDEX IF NOT EXISTS receipt_item_assignments_participant_id_idx
+    ON receipt_item_assignments (participant_id);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS receipt_payments;
+
+ALTER TABLE receipt_participants
+    DROP COLUMN IF EXISTS is_payer;
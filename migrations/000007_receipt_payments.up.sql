@@ -0,0 +1,20 @@
+ALTER TABLE receipt_participants
+    ADD COLUMN IF NOT EXISTS is_payer BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS receipt_payments (
+    payment_id BIGSERIAL PRIMARY KEY,
+    receipt_id BIGINT NOT NULL,
+    participant_id BIGINT NOT NULL,
+    payment_currency VARCHAR(3) NOT NULL,
+    payment_amount NUMERIC NOT NULL CHECK (payment_amount > 0),
+    payment_method VARCHAR(50) NOT NULL DEFAULT '',
+    note TEXT NOT NULL DEFAULT '',
+    paid_at BIGINT NOT NULL,
+    created_at BIGINT NOT NULL,
+    updated_at BIGINT,
+    deleted_at BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS receipt_payments_receipt_id_idx
+    ON receipt_payments (receipt_id, paid_at)
+    WHERE deleted_at IS NULL;
@@ -0,0 +1,6 @@
+UPDATE receipts
+SET result_id = ''
+WHERE result_id IS NULL;
+
+ALTER TABLE receipts
+    ALTER COLUMN result_id SET NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE receipts
+    ALTER COLUMN result_id DROP NOT NULL;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS receipt_items_spending_idx;
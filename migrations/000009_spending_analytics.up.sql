@@ -0,0 +1,4 @@
+CREATE INDEX IF NOT EXISTS receipt_items_spending_idx
+    ON receipt_items (receipt_id)
+    INCLUDE (item_category, item_price_currency, item_price_numeric, item_quantity)
+    WHERE deleted_at IS NULL;
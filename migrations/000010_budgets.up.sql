@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS budgets (
+    budget_id BIGSERIAL PRIMARY KEY,
+    device_id TEXT NOT NULL,
+    category VARCHAR(255) NOT NULL,
+    period VARCHAR(10) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    amount NUMERIC NOT NULL CHECK (amount > 0),
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    created_at BIGINT NOT NULL,
+    updated_at BIGINT,
+    deleted_at BIGINT
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS budgets_device_id_category_period_currency_idx
+    ON budgets (device_id, category, period, currency)
+    WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS budget_alerts (
+    alert_id BIGSERIAL PRIMARY KEY,
+    budget_id BIGINT NOT NULL,
+    period_start BIGINT NOT NULL,
+    threshold INT NOT NULL,
+    spent NUMERIC NOT NULL,
+    created_at BIGINT NOT NULL,
+    UNIQUE (budget_id, period_start, threshold)
+);
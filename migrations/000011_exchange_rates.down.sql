@@ -0,0 +1,5 @@
+ALTER TABLE device_settings
+    DROP COLUMN IF EXISTS base_currency;
+
+DROP FUNCTION IF EXISTS exchange_rate(TEXT, TEXT, DATE);
+DROP TABLE IF EXISTS exchange_rates;
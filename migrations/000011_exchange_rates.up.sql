@@ -0,0 +1,58 @@
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    base_currency VARCHAR(3) NOT NULL,
+    quote_currency VARCHAR(3) NOT NULL,
+    rate_date DATE NOT NULL,
+    rate NUMERIC NOT NULL CHECK (rate > 0),
+    source VARCHAR(20) NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL,
+    updated_at BIGINT,
+    PRIMARY KEY (base_currency, quote_currency, rate_date)
+);
+
+CREATE INDEX IF NOT EXISTS exchange_rates_quote_currency_rate_date_idx
+    ON exchange_rates (quote_currency, rate_date);
+
+-- exchange_rate returns how much one unit of from_currency is worth in
+-- to_currency using the latest rate on or before on_date. Rates are looked up
+-- directly, inverted, or crossed through a base currency both sides are quoted
+-- against (e.g. IDR -> JPY through EUR for ECB rates). It returns NULL when no
+-- rate is known.
+CREATE OR REPLACE FUNCTION exchange_rate(from_currency TEXT, to_currency TEXT, on_date DATE)
+RETURNS NUMERIC
+LANGUAGE sql
+STABLE
+AS $$
+    SELECT CASE
+        WHEN UPPER(from_currency) = UPPER(to_currency) THEN 1
+        ELSE (
+            SELECT x.rate
+            FROM (
+                SELECT rate_date, rate, 1 AS priority
+                FROM exchange_rates
+                WHERE base_currency = UPPER(from_currency)
+                    AND quote_currency = UPPER(to_currency)
+                    AND rate_date <= on_date
+                UNION ALL
+                SELECT rate_date, 1 / rate, 2 AS priority
+                FROM exchange_rates
+                WHERE base_currency = UPPER(to_currency)
+                    AND quote_currency = UPPER(from_currency)
+                    AND rate_date <= on_date
+                UNION ALL
+                SELECT f.rate_date, t.rate / f.rate, 3 AS priority
+                FROM exchange_rates f
+                JOIN exchange_rates t
+                    ON t.base_currency = f.base_currency
+                    AND t.rate_date = f.rate_date
+                    AND t.quote_currency = UPPER(to_currency)
+                WHERE f.quote_currency = UPPER(from_currency)
+                    AND f.rate_date <= on_date
+            ) x
+            ORDER BY x.rate_date DESC, x.priority
+            LIMIT 1
+        )
+    END
+$$;
+
+ALTER TABLE device_settings
+    ADD COLUMN IF NOT EXISTS base_currency VARCHAR(3) NOT NULL DEFAULT '';
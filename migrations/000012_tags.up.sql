@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS tags (
+    tag_id BIGSERIAL PRIMARY KEY,
+    device_id TEXT NOT NULL,
+    tag_name VARCHAR(64) NOT NULL,
+    color VARCHAR(7),
+    created_at BIGINT NOT NULL,
+    updated_at BIGINT,
+    deleted_at BIGINT
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS tags_device_id_tag_name_idx
+    ON tags (device_id, LOWER(tag_name))
+    WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS receipt_tags (
+    receipt_id BIGINT NOT NULL,
+    tag_id BIGINT NOT NULL,
+    created_at BIGINT NOT NULL,
+    PRIMARY KEY (receipt_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS receipt_tags_tag_id_idx
+    ON receipt_tags (tag_id, receipt_id);
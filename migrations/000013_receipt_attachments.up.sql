@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS receipt_attachments (
+    attachment_id BIGSERIAL PRIMARY KEY,
+    receipt_id BIGINT NOT NULL,
+    device_id TEXT NOT NULL,
+    file_path TEXT NOT NULL,
+    file_name VARCHAR(255) NOT NULL DEFAULT '',
+    content_type VARCHAR(255) NOT NULL,
+    file_size BIGINT NOT NULL,
+    kind VARCHAR(10) NOT NULL,
+    attachment_order INT NOT NULL DEFAULT 0,
+    result_id TEXT,
+    created_at BIGINT NOT NULL,
+    updated_at BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS receipt_attachments_receipt_id_idx
+    ON receipt_attachments (receipt_id, attachment_order);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS receipt_share_accesses;
+DROP TABLE IF EXISTS receipt_shares;
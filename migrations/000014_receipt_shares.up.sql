@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS receipt_shares (
+    share_id BIGSERIAL PRIMARY KEY,
+    receipt_id BIGINT NOT NULL,
+    device_id TEXT NOT NULL,
+    token_hash VARCHAR(64) NOT NULL,
+    expires_at BIGINT NOT NULL,
+    max_access INT,
+    access_count INT NOT NULL DEFAULT 0,
+    revoked_at BIGINT,
+    created_at BIGINT NOT NULL,
+    updated_at BIGINT
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS receipt_shares_token_hash_idx
+    ON receipt_shares (token_hash);
+
+CREATE INDEX IF NOT EXISTS receipt_shares_receipt_id_idx
+    ON receipt_shares (receipt_id);
+
+CREATE TABLE IF NOT EXISTS receipt_share_accesses (
+    access_id BIGSERIAL PRIMARY KEY,
+    share_id BIGINT NOT NULL,
+    outcome VARCHAR(20) NOT NULL,
+    ip_address VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    accessed_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS receipt_share_accesses_share_id_idx
+    ON receipt_share_accesses (share_id, accessed_at DESC);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS receipt_lineage (
+    lineage_id BIGSERIAL PRIMARY KEY,
+    device_id TEXT NOT NULL,
+    operation VARCHAR(10) NOT NULL,
+    source_receipt_id BIGINT NOT NULL,
+    target_receipt_id BIGINT NOT NULL,
+    receipt_item_ids JSONB NOT NULL DEFAULT '[]',
+    created_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS receipt_lineage_source_receipt_id_idx
+    ON receipt_lineage (source_receipt_id);
+
+CREATE INDEX IF NOT EXISTS receipt_lineage_target_receipt_id_idx
+    ON receipt_lineage (target_receipt_id);
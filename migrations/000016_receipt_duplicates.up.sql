@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS receipt_duplicates (
+    duplicate_id BIGSERIAL PRIMARY KEY,
+    device_id TEXT NOT NULL,
+    receipt_id BIGINT NOT NULL,
+    duplicate_receipt_id BIGINT NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    reasons VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    created_at BIGINT NOT NULL,
+    updated_at BIGINT,
+    resolved_at BIGINT
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS receipt_duplicates_pair_idx
+    ON receipt_duplicates (receipt_id, duplicate_receipt_id);
+
+CREATE INDEX IF NOT EXISTS receipt_duplicates_device_id_status_idx
+    ON receipt_duplicates (device_id, status, score DESC);
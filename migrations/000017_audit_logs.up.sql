@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS audit_logs (
+    audit_id BIGSERIAL PRIMARY KEY,
+    device_id TEXT NOT NULL,
+    request_id TEXT NOT NULL DEFAULT '',
+    entity_type VARCHAR(30) NOT NULL,
+    entity_id TEXT NOT NULL,
+    receipt_id BIGINT,
+    operation VARCHAR(30) NOT NULL,
+    before_data JSONB,
+    after_data JSONB,
+    created_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_logs_receipt_id_idx
+    ON audit_logs (receipt_id, created_at);
+
+CREATE INDEX IF NOT EXISTS audit_logs_entity_idx
+    ON audit_logs (entity_type, entity_id, created_at);
+
+CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_logs is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_logs_append_only ON audit_logs;
+
+CREATE TRIGGER audit_logs_append_only
+    BEFORE UPDATE OR DELETE ON audit_logs
+    FOR EACH ROW EXECUTE FUNCTION audit_logs_append_only();
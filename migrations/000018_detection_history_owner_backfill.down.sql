@@ -0,0 +1 @@
+-- The backfilled owners are kept, they are correct on either schema version.
@@ -0,0 +1,5 @@
+UPDATE receipt_detection_histories h
+SET device_id = r.device_id
+FROM receipts r
+WHERE h.device_id = ''
+    AND r.result_id = h.result_id;
@@ -0,0 +1,236 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"receipt-detector/entity"
+	"strconv"
+
+	"github.com/elastic/go-elasticsearch/v9"
+)
+
+const (
+	receiptSearchMapping = `{
+		"dynamic": "strict",
+		"properties": {
+			"receipt_id": {"type": "long"},
+			"device_id": {"type": "keyword"},
+			"receipt_name": {
+				"type": "text",
+				"fields": {"keyword": {"type": "keyword", "ignore_above": 256}}
+			},
+			"receipt_date": {"type": "long"},
+			"total": {"type": "double"},
+			"total_currency": {"type": "keyword"},
+			"items": {
+				"properties": {
+					"receipt_item_id": {"type": "long"},
+					"item_category": {
+						"type": "text",
+						"fields": {"keyword": {"type": "keyword", "ignore_above": 256}}
+					},
+					"item_name": {"type": "text"},
+					"item_quantity": {"type": "integer"},
+					"item_price_currency": {"type": "keyword"},
+					"item_price_numeric": {"type": "double"}
+				}
+			},
+			"tag_ids": {"type": "long"},
+			"tags": {
+				"type": "text",
+				"fields": {"keyword": {"type": "keyword", "ignore_above": 256}}
+			},
+			"created_at": {"type": "long"},
+			"updated_at": {"type": "long"}
+		}
+	}`
+)
+
+type receiptSearch struct {
+	client *elasticsearch.TypedClient
+
+	receiptsIndex string
+}
+
+func NewReceiptSearch(client *elasticsearch.TypedClient, receiptsIndex string) *receiptSearch {
+	return &receiptSearch{
+		client:        client,
+		receiptsIndex: receiptsIndex,
+	}
+}
+
+func (r *receiptSearch) EnsureIndex(ctx context.Context) error {
+	exists, err := r.client.Indices.Exists(r.receiptsIndex).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("[repository][elasticsearch][receiptSearch][EnsureIndex][client.Indices.Exists]: %w [index: %s]", err, r.receiptsIndex)
+	}
+
+	// Fields added to the mapping after the index was created are put onto it,
+	// as the strict mapping would reject documents carrying them.
+	if exists {
+		_, err = r.client.Indices.PutMapping(r.receiptsIndex).Raw(bytes.NewReader([]byte(receiptSearchMapping))).Do(ctx)
+		if err != nil {
+			return fmt.Errorf("[repository][elasticsearch][receiptSearch][EnsureIndex][client.Indices.PutMapping]: %w [index: %s]", err, r.receiptsIndex)
+		}
+
+		return nil
+	}
+
+	_, err = r.client.Indices.Create(r.receiptsIndex).Raw(bytes.NewReader([]byte(`{"mappings": ` + receiptSearchMapping + `}`))).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("[repository][elasticsearch][receiptSearch][EnsureIndex][client.Indices.Create]: %w [index: %s]", err, r.receiptsIndex)
+	}
+
+	return nil
+}
+
+func (r *receiptSearch) IndexOne(ctx context.Context, document entity.ReceiptSearchDocument) error {
+	_, err := r.client.Index(r.receiptsIndex).
+		Id(strconv.FormatInt(document.ReceiptId, 10)).
+		Request(document).
+		Do(ctx)
+	if err != nil {
+		return fmt.Errorf("[repository][elasticsearch][receiptSearch][IndexOne][client.Index]: %w [receipt_id: %v]", err, document.ReceiptId)
+	}
+
+	return nil
+}
+
+func (r *receiptSearch) DeleteOne(ctx context.Context, receiptId int64) error {
+	_, err := r.client.Delete(r.receiptsIndex, strconv.FormatInt(receiptId, 10)).IsSuccess(ctx)
+	if err != nil {
+		return fmt.Errorf("[repository][elasticsearch][receiptSearch][DeleteOne][client.Delete]: %w [receipt_id: %v]", err, receiptId)
+	}
+
+	return nil
+}
+
+func (r *receiptSearch) buildQuery(filter entity.ReceiptSearchFilter) map[string]any {
+	must := []any{}
+	filters := []any{
+		map[string]any{"term": map[string]any{"device_id": filter.DeviceId}},
+	}
+
+	if filter.Query != "" {
+		must = append(must, map[string]any{
+			"multi_match": map[string]any{
+				"query":     filter.Query,
+				"fields":    []string{"receipt_name^2", "tags^2", "items.item_name", "items.item_category"},
+				"fuzziness": "AUTO",
+			},
+		})
+	}
+
+	if filter.Item != "" {
+		must = append(must, map[string]any{
+			"match": map[string]any{
+				"items.item_name": map[string]any{"query": filter.Item, "fuzziness": "AUTO"},
+			},
+		})
+	}
+
+	if filter.Merchant != "" {
+		must = append(must, map[string]any{
+			"match": map[string]any{
+				"receipt_name": map[string]any{"query": filter.Merchant, "fuzziness": "AUTO", "operator": "and"},
+			},
+		})
+	}
+
+	dateRange := map[string]any{}
+	if filter.DateFrom != nil {
+		dateRange["gte"] = *filter.DateFrom
+	}
+	if filter.DateTo != nil {
+		dateRange["lt"] = *filter.DateTo
+	}
+	if len(dateRange) > 0 {
+		filters = append(filters, map[string]any{"range": map[string]any{"receipt_date": dateRange}})
+	}
+
+	amountRange := map[string]any{}
+	if filter.AmountMin != nil {
+		amountRange["gte"] = *filter.AmountMin
+	}
+	if filter.AmountMax != nil {
+		amountRange["lte"] = *filter.AmountMax
+	}
+	if len(amountRange) > 0 {
+		filters = append(filters, map[string]any{"range": map[string]any{"total": amountRange}})
+	}
+
+	for _, tagId := range filter.TagIds {
+		filters = append(filters, map[string]any{"term": map[string]any{"tag_ids": tagId}})
+	}
+
+	sort := []any{
+		map[string]any{"receipt_date": "desc"},
+		map[string]any{"receipt_id": "desc"},
+	}
+	if len(must) > 0 {
+		sort = append([]any{"_score"}, sort...)
+	}
+
+	return map[string]any{
+		"from":             filter.From,
+		"size":             filter.Size,
+		"track_total_hits": true,
+		"query": map[string]any{
+			"bool": map[string]any{
+				"must":   must,
+				"filter": filters,
+			},
+		},
+		"sort": sort,
+		"highlight": map[string]any{
+			"pre_tags":  []string{"<em>"},
+			"post_tags": []string{"</em>"},
+			"fields": map[string]any{
+				"receipt_name":    map[string]any{"number_of_fragments": 0},
+				"items.item_name": map[string]any{"number_of_fragments": 0},
+			},
+		},
+	}
+}
+
+func (r *receiptSearch) Search(ctx context.Context, filter entity.ReceiptSearchFilter) (*entity.ReceiptSearchResult, error) {
+	body, err := json.Marshal(r.buildQuery(filter))
+	if err != nil {
+		return nil, fmt.Errorf("[repository][elasticsearch][receiptSearch][Search][json.Marshal]: %w", err)
+	}
+
+	esRes, err := r.client.Search().Index(r.receiptsIndex).Raw(bytes.NewReader(body)).Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][elasticsearch][receiptSearch][Search][client.Search]: %w", err)
+	}
+
+	res := entity.ReceiptSearchResult{
+		Hits: []entity.ReceiptSearchHit{},
+	}
+
+	if esRes.Hits.Total != nil {
+		res.Total = esRes.Hits.Total.Value
+	}
+
+	for _, esHit := range esRes.Hits.Hits {
+		hit := entity.ReceiptSearchHit{
+			Highlight: esHit.Highlight,
+		}
+
+		if esHit.Score_ != nil {
+			score := float64(*esHit.Score_)
+			hit.Score = &score
+		}
+
+		err = json.Unmarshal(esHit.Source_, &hit.Receipt)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][elasticsearch][receiptSearch][Search][json.Unmarshal]: %w", err)
+		}
+
+		res.Hits = append(res.Hits, hit)
+	}
+
+	return &res, nil
+}
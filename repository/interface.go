@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"io"
 	"mime/multipart"
 	"receipt-detector/entity"
 	"time"
@@ -19,6 +20,8 @@ type ReceiptDetectionHistories interface {
 	NewTx(tx *sql.Tx) ReceiptDetectionHistories
 	InsertOne(ctx context.Context, history entity.ReceiptDetectionHistory) error
 	GetByResultId(ctx context.Context, resultId string) (*entity.ReceiptDetectionHistory, error)
+	GetApprovedRevisions(ctx context.Context, filter entity.ReceiptDetectionHistoryFilter) ([]entity.ReceiptDetectionHistory, error)
+	SoftDeleteByResultId(ctx context.Context, resultId string) error
 }
 
 type ReceiptDetectionResults interface {
@@ -26,14 +29,25 @@ type ReceiptDetectionResults interface {
 	GetByResultId(ctx context.Context, resultId string) ([]entity.OcrEngineItemDetail, error)
 }
 
+type ReceiptSearch interface {
+	EnsureIndex(ctx context.Context) error
+	IndexOne(ctx context.Context, document entity.ReceiptSearchDocument) error
+	DeleteOne(ctx context.Context, receiptId int64) error
+	Search(ctx context.Context, filter entity.ReceiptSearchFilter) (*entity.ReceiptSearchResult, error)
+}
+
 type ReceiptImages interface {
 	StoreOne(ctx context.Context, contentType string, fileHeader *multipart.FileHeader) (string, error)
 	GetImageUrl(ctx context.Context, filePath string) (string, error)
+	ResolveSignedPath(ctx context.Context, relativePath string, expiresAt int64, signature string) (string, bool, error)
+	OpenOne(ctx context.Context, filePath string) (io.ReadCloser, error)
+	DeleteOne(ctx context.Context, filePath string) error
 }
 
 type Cache interface {
 	Set(ctx context.Context, key string, data []byte, duration time.Duration) error
 	Get(ctx context.Context, key string) ([]byte, error)
+	Del(ctx context.Context, keys ...string) error
 
 	SetReceiptDetectionResult(ctx context.Context, detectionResult entity.ReceiptDetectionResult) error
 	GetReceiptDetectionResult(ctx context.Context, resultId string) (*entity.ReceiptDetectionResult, error)
@@ -43,23 +57,184 @@ type Cache interface {
 
 	SetReceiptItems(ctx context.Context, receiptId int64, receiptItems []entity.ReceiptItem) error
 	GetReceiptItems(ctx context.Context, receiptId int64) ([]entity.ReceiptItem, error)
+
+	DeleteReceipt(ctx context.Context, receiptId int64) error
+
+	GetAnalyticsVersion(ctx context.Context, deviceId string) (int64, error)
+	BumpAnalyticsVersion(ctx context.Context, deviceId string) error
+	SetAnalytics(ctx context.Context, deviceId string, version int64, queryHash string, data []byte) error
+	GetAnalytics(ctx context.Context, deviceId string, version int64, queryHash string) ([]byte, error)
+
+	GetExchangeRatesVersion(ctx context.Context) (int64, error)
+	BumpExchangeRatesVersion(ctx context.Context) error
 }
 
 type Receipts interface {
 	NewTx(tx *sql.Tx) Receipts
 	InsertOne(ctx context.Context, receipt entity.Receipt) (int64, error)
 	GetByReceiptId(ctx context.Context, receiptId int64, deviceId string) (*entity.Receipt, error)
-	UpdateOne(ctx context.Context, newReceipt entity.UpdateReceiptRequest) error
+	UpdateOne(ctx context.Context, newReceipt entity.UpdateReceiptRequest) (bool, error)
+	GetMany(ctx context.Context, filter entity.ReceiptFilter) ([]entity.Receipt, error)
+	SoftDeleteOne(ctx context.Context, receiptId int64, deviceId string) (bool, error)
+	RestoreOne(ctx context.Context, receiptId int64, deviceId string) (bool, error)
+	GetManyDeleted(ctx context.Context, filter entity.ReceiptFilter) ([]entity.Receipt, error)
+	GetPurgeable(ctx context.Context, deletedBefore int64, limit int) ([]entity.Receipt, error)
+	HardDeleteMany(ctx context.Context, receiptIds []int64) ([]int64, error)
+	GetResultIdsInUse(ctx context.Context, resultIds []string, excludeReceiptIds []int64) ([]string, error)
+	UpdateTotal(ctx context.Context, receiptId int64, totalAmount float64, totalCurrency *string) error
+	GetByDateRange(ctx context.Context, deviceId string, dateFrom, dateTo int64) ([]entity.Receipt, error)
+	GetAfterId(ctx context.Context, afterReceiptId int64, limit int) ([]entity.Receipt, error)
 }
 
 type ReceiptItems interface {
 	NewTx(tx *sql.Tx) ReceiptItems
 	InsertMany(ctx context.Context, receiptItems []entity.ReceiptItem) error
 	GetByReceiptId(ctx context.Context, receiptId int64) ([]entity.ReceiptItem, error)
+	GetByReceiptIds(ctx context.Context, receiptIds []int64) ([]entity.ReceiptItem, error)
+	InsertOne(ctx context.Context, receiptItem entity.ReceiptItem) (int64, error)
+	UpdateOne(ctx context.Context, req entity.UpdateReceiptItemRequest) (bool, error)
+	SoftDeleteOne(ctx context.Context, receiptId, receiptItemId int64) (bool, error)
+	UpdateOrder(ctx context.Context, receiptId int64, receiptItemIds []int64) error
+	MoveMany(ctx context.Context, toReceiptId int64, receiptItemIds []int64) error
+}
+
+type ReceiptParticipants interface {
+	NewTx(tx *sql.Tx) ReceiptParticipants
+	InsertOne(ctx context.Context, participant entity.ReceiptParticipant) (int64, error)
+	GetByReceiptId(ctx context.Context, receiptId int64) ([]entity.ReceiptParticipant, error)
+	GetByReceiptIds(ctx context.Context, receiptIds []int64) ([]entity.ReceiptParticipant, error)
+	SoftDeleteOne(ctx context.Context, receiptId, participantId int64) (bool, error)
+	SetPayer(ctx context.Context, receiptId, participantId int64) error
+}
+
+type ReceiptItemAssignments interface {
+	NewTx(tx *sql.Tx) ReceiptItemAssignments
+	GetByReceiptId(ctx context.Context, receiptId int64) ([]entity.ReceiptItemAssignment, error)
+	GetByReceiptIds(ctx context.Context, receiptIds []int64) ([]entity.ReceiptItemAssignment, error)
+	ReplaceForItem(ctx context.Context, receiptItemId int64, assignments []entity.ReceiptItemAssignment) error
+	DeleteByParticipantId(ctx context.Context, participantId int64) error
+	DeleteByReceiptItemIds(ctx context.Context, receiptItemIds []int64) error
+}
+
+type ReceiptPayments interface {
+	NewTx(tx *sql.Tx) ReceiptPayments
+	InsertOne(ctx context.Context, payment entity.ReceiptPayment) (int64, error)
+	GetByReceiptId(ctx context.Context, receiptId int64) ([]entity.ReceiptPayment, error)
+	GetByReceiptIds(ctx context.Context, receiptIds []int64) ([]entity.ReceiptPayment, error)
+	SoftDeleteOne(ctx context.Context, receiptId, paymentId int64) (bool, error)
+}
+
+type SpendingAnalytics interface {
+	GetBreakdown(ctx context.Context, filter entity.SpendingFilter) ([]entity.SpendingBreakdown, error)
+	GetTimeseries(ctx context.Context, filter entity.SpendingFilter) ([]entity.SpendingTimeBucket, error)
+}
+
+type Budgets interface {
+	NewTx(tx *sql.Tx) Budgets
+	InsertOne(ctx context.Context, budget entity.Budget) (int64, error)
+	GetByBudgetId(ctx context.Context, budgetId int64, deviceId string) (*entity.Budget, error)
+	GetByDeviceId(ctx context.Context, deviceId string) ([]entity.Budget, error)
+	UpdateOne(ctx context.Context, req entity.UpdateBudgetRequest) (bool, error)
+	SoftDeleteOne(ctx context.Context, budgetId int64, deviceId string) (bool, error)
+}
+
+type BudgetAlerts interface {
+	InsertOne(ctx context.Context, alert entity.BudgetAlert) (bool, error)
+}
+
+type ExchangeRates interface {
+	NewTx(tx *sql.Tx) ExchangeRates
+	UpsertMany(ctx context.Context, rates []entity.ExchangeRate) error
+	GetMany(ctx context.Context, filter entity.ExchangeRateFilter) ([]entity.ExchangeRate, error)
+	GetRates(ctx context.Context, toCurrency string, lookups []entity.ExchangeRateLookup) (map[entity.ExchangeRateLookup]float64, error)
+}
+
+type Tags interface {
+	NewTx(tx *sql.Tx) Tags
+	InsertOne(ctx context.Context, tag entity.Tag) (int64, error)
+	GetByTagId(ctx context.Context, tagId int64, deviceId string) (*entity.Tag, error)
+	GetByTagName(ctx context.Context, tagName, deviceId string) (*entity.Tag, error)
+	GetByTagIds(ctx context.Context, tagIds []int64, deviceId string) ([]entity.Tag, error)
+	GetCounts(ctx context.Context, deviceId, query string, limit int) ([]entity.TagCount, error)
+	UpdateOne(ctx context.Context, req entity.UpdateTagRequest) (bool, error)
+	SoftDeleteOne(ctx context.Context, tagId int64, deviceId string) (bool, error)
+}
+
+type ReceiptTags interface {
+	NewTx(tx *sql.Tx) ReceiptTags
+	GetByReceiptIds(ctx context.Context, receiptIds []int64) ([]entity.ReceiptTag, error)
+	GetReceiptIdsByTagId(ctx context.Context, tagId int64) ([]int64, error)
+	ReplaceByReceiptId(ctx context.Context, receiptId int64, tagIds []int64) error
+	DeleteOne(ctx context.Context, receiptId, tagId int64) (bool, error)
+	DeleteByTagId(ctx context.Context, tagId int64) ([]int64, error)
+}
+
+type ReceiptAttachments interface {
+	NewTx(tx *sql.Tx) ReceiptAttachments
+	InsertOne(ctx context.Context, attachment entity.ReceiptAttachment) (int64, error)
+	GetByReceiptId(ctx context.Context, receiptId int64) ([]entity.ReceiptAttachment, error)
+	GetByReceiptIds(ctx context.Context, receiptIds []int64) ([]entity.ReceiptAttachment, error)
+	CountByReceiptId(ctx context.Context, receiptId int64) (int, error)
+	DeleteOne(ctx context.Context, receiptId, attachmentId int64) (*entity.ReceiptAttachment, error)
+	UpdateOrder(ctx context.Context, receiptId int64, attachmentIds []int64) error
+	MoveMany(ctx context.Context, fromReceiptIds []int64, toReceiptId int64) error
+	GetFilePathsInUse(ctx context.Context, filePaths []string, excludeReceiptIds []int64) ([]string, error)
+}
+
+type ReceiptLineage interface {
+	NewTx(tx *sql.Tx) ReceiptLineage
+	InsertOne(ctx context.Context, lineage entity.ReceiptLineage) error
+	GetByReceiptId(ctx context.Context, receiptId int64, deviceId string) ([]entity.ReceiptLineage, error)
+}
+
+type ReceiptShares interface {
+	InsertOne(ctx context.Context, share entity.ReceiptShare) (int64, error)
+	GetByShareId(ctx context.Context, receiptId, shareId int64) (*entity.ReceiptShare, error)
+	GetByTokenHash(ctx context.Context, tokenHash string) (*entity.ReceiptShare, error)
+	GetByReceiptId(ctx context.Context, receiptId int64) ([]entity.ReceiptShare, error)
+	ConsumeAccess(ctx context.Context, shareId int64) (bool, error)
+	RevokeOne(ctx context.Context, receiptId, shareId int64) (bool, error)
+}
+
+type ReceiptShareAccesses interface {
+	InsertOne(ctx context.Context, access entity.ReceiptShareAccess) error
+	GetByShareId(ctx context.Context, shareId int64, limit int) ([]entity.ReceiptShareAccess, error)
+}
+
+type ReceiptDuplicates interface {
+	NewTx(tx *sql.Tx) ReceiptDuplicates
+	UpsertMany(ctx context.Context, duplicates []entity.ReceiptDuplicate) error
+	GetMany(ctx context.Context, deviceId, status string, limit int) ([]entity.ReceiptDuplicate, error)
+	GetByDuplicateId(ctx context.Context, duplicateId int64, deviceId string) (*entity.ReceiptDuplicate, error)
+	UpdateStatus(ctx context.Context, duplicateId int64, status string) (bool, error)
+}
+
+type DeviceSettings interface {
+	NewTx(tx *sql.Tx) DeviceSettings
+	GetByDeviceId(ctx context.Context, deviceId string) (*entity.DeviceSetting, error)
+	UpsertOne(ctx context.Context, setting entity.DeviceSetting) error
+}
+
+type IdempotencyKeys interface {
+	Acquire(ctx context.Context, deviceId, idempotencyKey string, record entity.IdempotencyRecord, ttl time.Duration) (bool, error)
+	Get(ctx context.Context, deviceId, idempotencyKey string) (*entity.IdempotencyRecord, error)
+	Complete(ctx context.Context, deviceId, idempotencyKey string, record entity.IdempotencyRecord, ttl time.Duration) error
+	Release(ctx context.Context, deviceId, idempotencyKey string) error
+}
+
+// AuditLogs is append-only, entries are never updated or deleted.
+type AuditLogs interface {
+	NewTx(tx *sql.Tx) AuditLogs
+	InsertMany(ctx context.Context, entries []entity.AuditLog) error
+	GetByReceiptId(ctx context.Context, receiptId int64, deviceId string) ([]entity.AuditLog, error)
 }
 
 type Transaction interface {
-	Begin() (*sql.Tx, error)
+	Begin(ctx context.Context) (*sql.Tx, error)
 	Rollback() error
 	Commit() error
 }
+
+type UnitOfWork interface {
+	WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error
+}
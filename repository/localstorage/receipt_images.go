@@ -2,10 +2,16 @@ package localstorage
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"mime/multipart"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -28,12 +34,25 @@ var (
 type receiptImages struct {
 	localDirectory string
 	serverBaseUrl  string
+
+	signedUrlSecret []byte
+	signedUrlTTL    time.Duration
+}
+
+type ReceiptImagesOpt struct {
+	LocalDirectory  string
+	ServerBaseUrl   string
+	SignedUrlSecret string
+	SignedUrlTTL    time.Duration
 }
 
-func NewReceiptImages(localDirectory, serverBaseUrl string) *receiptImages {
+func NewReceiptImages(opt ReceiptImagesOpt) *receiptImages {
 	return &receiptImages{
-		localDirectory: localDirectory,
-		serverBaseUrl:  serverBaseUrl,
+		localDirectory: opt.LocalDirectory,
+		serverBaseUrl:  opt.ServerBaseUrl,
+
+		signedUrlSecret: []byte(opt.SignedUrlSecret),
+		signedUrlTTL:    opt.SignedUrlTTL,
 	}
 }
 
@@ -81,8 +100,69 @@ func (r *receiptImages) StoreOne(ctx context.Context, contentType string, fileHe
 	return fileName, nil
 }
 
+func (r *receiptImages) sign(relativePath string, expiresAt int64) string {
+	mac := hmac.New(sha256.New, r.signedUrlSecret)
+	fmt.Fprintf(mac, "%s\n%d", relativePath, expiresAt)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GetImageUrl returns a URL for the image that is valid until the signed URL
+// TTL elapses.
 func (r *receiptImages) GetImageUrl(ctx context.Context, filePath string) (string, error) {
-	url := strings.Replace(filePath, r.localDirectory, r.serverBaseUrl, 1)
+	if !strings.HasPrefix(filePath, r.localDirectory) {
+		return "", fmt.Errorf("[repository][localstorage][GetImageUrl] File is outside storage directory [file_path: %s]", filePath)
+	}
+
+	relativePath := strings.TrimPrefix(filePath, r.localDirectory)
+	expiresAt := time.Now().Add(r.signedUrlTTL).Unix()
+
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expiresAt, 10))
+	query.Set("signature", r.sign(relativePath, expiresAt))
+
+	return r.serverBaseUrl + relativePath + "?" + query.Encode(), nil
+}
+
+// ResolveSignedPath checks a signed URL produced by GetImageUrl and returns the
+// local file path it points to. It returns false when the signature is invalid
+// or has expired.
+func (r *receiptImages) ResolveSignedPath(ctx context.Context, relativePath string, expiresAt int64, signature string) (string, bool, error) {
+	if time.Now().Unix() > expiresAt {
+		return "", false, nil
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(r.sign(relativePath, expiresAt))) {
+		return "", false, nil
+	}
+
+	filePath := filepath.Join(r.localDirectory, filepath.Clean("/"+relativePath))
+	if !strings.HasPrefix(filePath, filepath.Clean(r.localDirectory)+string(filepath.Separator)) {
+		return "", false, fmt.Errorf("[repository][localstorage][ResolveSignedPath] Path escapes storage directory [relative_path: %s]", relativePath)
+	}
+
+	_, err := os.Stat(filePath)
+	if err != nil {
+		return "", false, fmt.Errorf("[repository][localstorage][ResolveSignedPath][os.Stat] %w", err)
+	}
+
+	return filePath, true, nil
+}
+
+func (r *receiptImages) OpenOne(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][localstorage][OpenOne][os.Open] Failed to open file: %w [file_path: %s]", err, filePath)
+	}
+
+	return file, nil
+}
+
+func (r *receiptImages) DeleteOne(ctx context.Context, filePath string) error {
+	err := os.Remove(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("[repository][localstorage][DeleteOne][os.Remove] Failed to remove file: %w [file_path: %s]", err, filePath)
+	}
 
-	return url, nil
+	return nil
 }
@@ -0,0 +1,149 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+	"strconv"
+)
+
+type auditLogs struct {
+	dbtx repository.DBTX
+}
+
+func NewAuditLogs(dbtx repository.DBTX) *auditLogs {
+	return &auditLogs{
+		dbtx: dbtx,
+	}
+}
+
+func (r *auditLogs) NewTx(tx *sql.Tx) repository.AuditLogs {
+	return &auditLogs{
+		dbtx: tx,
+	}
+}
+
+func (r *auditLogs) InsertMany(ctx context.Context, entries []entity.AuditLog) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	q := `
+		INSERT
+		INTO audit_logs (device_id, request_id, entity_type, entity_id, receipt_id, operation, before_data, after_data, created_at)
+		VALUES
+	`
+
+	now := helper.NowUnixMilli()
+	args := []any{}
+
+	for i, entry := range entries {
+		offset := i * 8
+
+		q += `($` + strconv.Itoa(offset+1) +
+			`, $` + strconv.Itoa(offset+2) +
+			`, $` + strconv.Itoa(offset+3) +
+			`, $` + strconv.Itoa(offset+4) +
+			`, $` + strconv.Itoa(offset+5) +
+			`, $` + strconv.Itoa(offset+6) +
+			`, $` + strconv.Itoa(offset+7) + `::JSONB` +
+			`, $` + strconv.Itoa(offset+8) + `::JSONB` +
+			`, ` + strconv.FormatInt(now, 10) + `)`
+
+		if i < len(entries)-1 {
+			q += `, `
+		}
+
+		args = append(args,
+			entry.DeviceId,
+			entry.RequestId,
+			entry.EntityType,
+			entry.EntityId,
+			entry.ReceiptId,
+			nullableJson(entry.BeforeData),
+			nullableJson(entry.AfterData),
+		)
+	}
+
+	_, err := r.dbtx.ExecContext(ctx, q, args...)
+	if err != nil {
+		return fmt.Errorf("[repository][postgres][auditLogs][InsertMany][dbtx.ExecContext] %w", err)
+	}
+
+	return nil
+}
+
+// GetByReceiptId returns the entries of the receipt and its items, together
+// with the entries of the detection history the receipt was created from,
+// oldest first.
+func (r *auditLogs) GetByReceiptId(ctx context.Context, receiptId int64, deviceId string) ([]entity.AuditLog, error) {
+	q := `
+		SELECT audit_id, device_id, request_id, entity_type, entity_id, receipt_id, operation, before_data, after_data, created_at
+		FROM audit_logs
+		WHERE device_id = $2
+			AND (
+				receipt_id = $1
+				OR (
+					entity_type = $3
+					AND entity_id IN (
+						SELECT COALESCE(after_data->>'result_id', before_data->>'result_id')
+						FROM audit_logs
+						WHERE receipt_id = $1
+							AND entity_type = $4
+							AND device_id = $2
+					)
+				)
+			)
+		ORDER BY created_at, audit_id
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, receiptId, deviceId, entity.AuditEntityDetectionHistory, entity.AuditEntityReceipt)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][auditLogs][GetByReceiptId][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	entries := []entity.AuditLog{}
+
+	for rows.Next() {
+		var (
+			entry      entity.AuditLog
+			beforeData []byte
+			afterData  []byte
+		)
+
+		err = rows.Scan(
+			&entry.AuditId,
+			&entry.DeviceId,
+			&entry.RequestId,
+			&entry.EntityType,
+			&entry.EntityId,
+			&entry.ReceiptId,
+			&entry.Operation,
+			&beforeData,
+			&afterData,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][postgres][auditLogs][GetByReceiptId][rows.Scan] %w", err)
+		}
+
+		entry.BeforeData = beforeData
+		entry.AfterData = afterData
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func nullableJson(data []byte) any {
+	if len(data) == 0 {
+		return nil
+	}
+
+	return string(data)
+}
@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+)
+
+type budgetAlerts struct {
+	dbtx repository.DBTX
+}
+
+func NewBudgetAlerts(dbtx repository.DBTX) *budgetAlerts {
+	return &budgetAlerts{
+		dbtx: dbtx,
+	}
+}
+
+// InsertOne records that a threshold was crossed in a budget period. It
+// returns false when the alert was already raised for that period, which is
+// what keeps every threshold from alerting more than once.
+func (r *budgetAlerts) InsertOne(ctx context.Context, alert entity.BudgetAlert) (bool, error) {
+	q := `
+		INSERT
+		INTO budget_alerts (budget_id, period_start, threshold, spent, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (budget_id, period_start, threshold) DO NOTHING
+		RETURNING alert_id
+	`
+
+	var alertId int64
+
+	err := r.dbtx.QueryRowContext(ctx, q,
+		alert.BudgetId,
+		alert.PeriodStart,
+		alert.Threshold,
+		alert.Spent,
+		helper.NowUnixMilli(),
+	).Scan(&alertId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("[repository][postgres][budgetAlerts][InsertOne][dbtx.QueryRowContext] %w", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,197 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+	"strconv"
+)
+
+type budgets struct {
+	dbtx repository.DBTX
+}
+
+func NewBudgets(dbtx repository.DBTX) *budgets {
+	return &budgets{
+		dbtx: dbtx,
+	}
+}
+
+func (r *budgets) NewTx(tx *sql.Tx) repository.Budgets {
+	return &budgets{
+		dbtx: tx,
+	}
+}
+
+// InsertOne returns a zero id when the device already has a budget for the
+// same category, period and currency.
+func (r *budgets) InsertOne(ctx context.Context, budget entity.Budget) (int64, error) {
+	q := `
+		INSERT
+		INTO budgets (device_id, category, period, currency, amount, timezone, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (device_id, category, period, currency) WHERE deleted_at IS NULL DO NOTHING
+		RETURNING budget_id
+	`
+
+	var budgetId int64
+
+	err := r.dbtx.QueryRowContext(ctx, q,
+		budget.DeviceId,
+		budget.Category,
+		budget.Period,
+		budget.Currency,
+		budget.Amount,
+		budget.Timezone,
+		helper.NowUnixMilli(),
+	).Scan(&budgetId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+
+		return 0, fmt.Errorf("[repository][postgres][budgets][InsertOne][dbtx.QueryRowContext] %w", err)
+	}
+
+	return budgetId, nil
+}
+
+func (r *budgets) GetByBudgetId(ctx context.Context, budgetId int64, deviceId string) (*entity.Budget, error) {
+	q := `
+		SELECT budget_id, device_id, category, period, currency, amount, timezone, created_at, updated_at
+		FROM budgets
+		WHERE budget_id = $1
+			AND device_id = $2
+			AND deleted_at IS NULL
+	`
+
+	var budget entity.Budget
+
+	err := r.dbtx.QueryRowContext(ctx, q, budgetId, deviceId).Scan(
+		&budget.BudgetId,
+		&budget.DeviceId,
+		&budget.Category,
+		&budget.Period,
+		&budget.Currency,
+		&budget.Amount,
+		&budget.Timezone,
+		&budget.CreatedAt,
+		&budget.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("[repository][postgres][budgets][GetByBudgetId][dbtx.QueryRowContext] %w", err)
+	}
+
+	return &budget, nil
+}
+
+func (r *budgets) GetByDeviceId(ctx context.Context, deviceId string) ([]entity.Budget, error) {
+	q := `
+		SELECT budget_id, device_id, category, period, currency, amount, timezone, created_at, updated_at
+		FROM budgets
+		WHERE device_id = $1
+			AND deleted_at IS NULL
+		ORDER BY category, period, currency
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, deviceId)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][budgets][GetByDeviceId][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	budgets := []entity.Budget{}
+
+	for rows.Next() {
+		var budget entity.Budget
+
+		err = rows.Scan(
+			&budget.BudgetId,
+			&budget.DeviceId,
+			&budget.Category,
+			&budget.Period,
+			&budget.Currency,
+			&budget.Amount,
+			&budget.Timezone,
+			&budget.CreatedAt,
+			&budget.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][postgres][budgets][GetByDeviceId][rows.Scan] %w", err)
+		}
+
+		budgets = append(budgets, budget)
+	}
+
+	return budgets, nil
+}
+
+func (r *budgets) UpdateOne(ctx context.Context, req entity.UpdateBudgetRequest) (bool, error) {
+	q := `
+		UPDATE budgets
+		SET 
+	`
+
+	args := []any{}
+	i := 1
+
+	if req.Amount != nil {
+		q += `amount = $` + strconv.Itoa(i) + `, `
+		args = append(args, *req.Amount)
+		i++
+	}
+
+	if req.Timezone != nil {
+		q += `timezone = $` + strconv.Itoa(i) + `, `
+		args = append(args, *req.Timezone)
+		i++
+	}
+
+	q += `updated_at = $` + strconv.Itoa(i) +
+		` WHERE budget_id = $` + strconv.Itoa(i+1) +
+		` AND device_id = $` + strconv.Itoa(i+2) +
+		` AND deleted_at IS NULL`
+	args = append(args, helper.NowUnixMilli(), req.BudgetId, req.DeviceId)
+
+	res, err := r.dbtx.ExecContext(ctx, q, args...)
+	if err != nil {
+		return false, fmt.Errorf("[repository][postgres][budgets][UpdateOne][dbtx.ExecContext] %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("[repository][postgres][budgets][UpdateOne][res.RowsAffected] %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+func (r *budgets) SoftDeleteOne(ctx context.Context, budgetId int64, deviceId string) (bool, error) {
+	q := `
+		UPDATE budgets
+		SET deleted_at = $3
+		WHERE budget_id = $1
+			AND device_id = $2
+			AND deleted_at IS NULL
+	`
+
+	res, err := r.dbtx.ExecContext(ctx, q, budgetId, deviceId, helper.NowUnixMilli())
+	if err != nil {
+		return false, fmt.Errorf("[repository][postgres][budgets][SoftDeleteOne][dbtx.ExecContext] %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("[repository][postgres][budgets][SoftDeleteOne][res.RowsAffected] %w", err)
+	}
+
+	return affected > 0, nil
+}
@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+)
+
+type deviceSettings struct {
+	dbtx repository.DBTX
+}
+
+func NewDeviceSettings(dbtx repository.DBTX) *deviceSettings {
+	return &deviceSettings{
+		dbtx: dbtx,
+	}
+}
+
+func (r *deviceSettings) NewTx(tx *sql.Tx) repository.DeviceSettings {
+	return &deviceSettings{
+		dbtx: tx,
+	}
+}
+
+func (r *deviceSettings) GetByDeviceId(ctx context.Context, deviceId string) (*entity.DeviceSetting, error) {
+	q := `
+		SELECT device_id, default_language, default_currency, default_country, base_currency, created_at, updated_at
+		FROM device_settings
+		WHERE device_id = $1
+			AND deleted_at IS NULL
+	`
+
+	var setting entity.DeviceSetting
+
+	err := r.dbtx.QueryRowContext(ctx, q, deviceId).Scan(
+		&setting.DeviceId,
+		&setting.DefaultLanguage,
+		&setting.DefaultCurrency,
+		&setting.DefaultCountry,
+		&setting.BaseCurrency,
+		&setting.CreatedAt,
+		&setting.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("[repository][postgres][deviceSettings][GetByDeviceId][dbtx.QueryRowContext] %w", err)
+	}
+
+	return &setting, nil
+}
+
+func (r *deviceSettings) UpsertOne(ctx context.Context, setting entity.DeviceSetting) error {
+	q := `
+		INSERT
+		INTO device_settings (device_id, default_language, default_currency, default_country, base_currency, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (device_id) DO UPDATE
+		SET default_language = EXCLUDED.default_language,
+			default_currency = EXCLUDED.default_currency,
+			default_country = EXCLUDED.default_country,
+			base_currency = EXCLUDED.base_currency,
+			updated_at = EXCLUDED.created_at,
+			deleted_at = NULL
+	`
+
+	_, err := r.dbtx.ExecContext(ctx, q,
+		setting.DeviceId,
+		setting.DefaultLanguage,
+		setting.DefaultCurrency,
+		setting.DefaultCountry,
+		setting.BaseCurrency,
+		helper.NowUnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("[repository][postgres][deviceSettings][UpsertOne][dbtx.ExecContext] %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+	"strconv"
+)
+
+type exchangeRates struct {
+	dbtx repository.DBTX
+}
+
+func NewExchangeRates(dbtx repository.DBTX) *exchangeRates {
+	return &exchangeRates{
+		dbtx: dbtx,
+	}
+}
+
+func (r *exchangeRates) NewTx(tx *sql.Tx) repository.ExchangeRates {
+	return &exchangeRates{
+		dbtx: tx,
+	}
+}
+
+// UpsertMany inserts the rates or overwrites the rate already stored for the
+// same currency pair and date.
+func (r *exchangeRates) UpsertMany(ctx context.Context, rates []entity.ExchangeRate) error {
+	q := `
+		INSERT
+		INTO exchange_rates (rate_date, base_currency, quote_currency, rate, source, created_at)
+		SELECT r.rate_date, r.base_currency, r.quote_currency, r.rate, r.source, $6
+		FROM unnest($1::text[]::date[], $2::text[], $3::text[], $4::numeric[], $5::text[])
+			AS r(rate_date, base_currency, quote_currency, rate, source)
+		ON CONFLICT (base_currency, quote_currency, rate_date) DO UPDATE
+		SET rate = EXCLUDED.rate,
+			source = EXCLUDED.source,
+			updated_at = EXCLUDED.created_at
+	`
+
+	var (
+		rateDates       = make([]string, len(rates))
+		baseCurrencies  = make([]string, len(rates))
+		quoteCurrencies = make([]string, len(rates))
+		values          = make([]float64, len(rates))
+		sources         = make([]string, len(rates))
+	)
+
+	for i, rate := range rates {
+		rateDates[i] = rate.RateDate
+		baseCurrencies[i] = rate.BaseCurrency
+		quoteCurrencies[i] = rate.QuoteCurrency
+		values[i] = rate.Rate
+		sources[i] = rate.Source
+	}
+
+	_, err := r.dbtx.ExecContext(ctx, q, rateDates, baseCurrencies, quoteCurrencies, values, sources, helper.NowUnixMilli())
+	if err != nil {
+		return fmt.Errorf("[repository][postgres][exchangeRates][UpsertMany][dbtx.ExecContext] %w", err)
+	}
+
+	return nil
+}
+
+func (r *exchangeRates) GetMany(ctx context.Context, filter entity.ExchangeRateFilter) ([]entity.ExchangeRate, error) {
+	q := `
+		SELECT rate_date::text, base_currency, quote_currency, rate::float8, source, created_at, updated_at
+		FROM exchange_rates
+		WHERE TRUE
+	`
+
+	args := []any{}
+
+	if filter.BaseCurrency != "" {
+		args = append(args, filter.BaseCurrency)
+		q += ` AND base_currency = $` + strconv.Itoa(len(args))
+	}
+
+	if filter.QuoteCurrency != "" {
+		args = append(args, filter.QuoteCurrency)
+		q += ` AND quote_currency = $` + strconv.Itoa(len(args))
+	}
+
+	if filter.DateFrom != "" {
+		args = append(args, filter.DateFrom)
+		q += ` AND rate_date >= $` + strconv.Itoa(len(args)) + `::date`
+	}
+
+	if filter.DateTo != "" {
+		args = append(args, filter.DateTo)
+		q += ` AND rate_date <= $` + strconv.Itoa(len(args)) + `::date`
+	}
+
+	args = append(args, filter.Limit)
+	q += ` ORDER BY rate_date DESC, base_currency, quote_currency LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := r.dbtx.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][exchangeRates][GetMany][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	rates := []entity.ExchangeRate{}
+
+	for rows.Next() {
+		var rate entity.ExchangeRate
+
+		err = rows.Scan(
+			&rate.RateDate,
+			&rate.BaseCurrency,
+			&rate.QuoteCurrency,
+			&rate.Rate,
+			&rate.Source,
+			&rate.CreatedAt,
+			&rate.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][postgres][exchangeRates][GetMany][rows.Scan] %w", err)
+		}
+
+		rates = append(rates, rate)
+	}
+
+	return rates, nil
+}
+
+// GetRates resolves the rate into toCurrency for every lookup through the
+// exchange_rate function. Lookups without a known rate are left out.
+func (r *exchangeRates) GetRates(ctx context.Context, toCurrency string, lookups []entity.ExchangeRateLookup) (map[entity.ExchangeRateLookup]float64, error) {
+	q := `
+		SELECT l.currency, l.rate_date::text, exchange_rate(l.currency, $1, l.rate_date)::float8
+		FROM (
+			SELECT DISTINCT currency, rate_date
+			FROM unnest($2::text[], $3::text[]::date[]) AS u(currency, rate_date)
+		) l
+	`
+
+	var (
+		currencies = make([]string, len(lookups))
+		rateDates  = make([]string, len(lookups))
+	)
+
+	for i, lookup := range lookups {
+		currencies[i] = lookup.Currency
+		rateDates[i] = lookup.RateDate
+	}
+
+	rows, err := r.dbtx.QueryContext(ctx, q, toCurrency, currencies, rateDates)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][exchangeRates][GetRates][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	rates := map[entity.ExchangeRateLookup]float64{}
+
+	for rows.Next() {
+		var (
+			lookup entity.ExchangeRateLookup
+			rate   sql.NullFloat64
+		)
+
+		err = rows.Scan(
+			&lookup.Currency,
+			&lookup.RateDate,
+			&rate,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][postgres][exchangeRates][GetRates][rows.Scan] %w", err)
+		}
+
+		if rate.Valid {
+			rates[lookup] = rate.Float64
+		}
+	}
+
+	return rates, nil
+}
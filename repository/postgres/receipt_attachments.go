@@ -0,0 +1,279 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+)
+
+type receiptAttachments struct {
+	dbtx repository.DBTX
+}
+
+func NewReceiptAttachments(dbtx repository.DBTX) *receiptAttachments {
+	return &receiptAttachments{
+		dbtx: dbtx,
+	}
+}
+
+func (r *receiptAttachments) NewTx(tx *sql.Tx) repository.ReceiptAttachments {
+	return &receiptAttachments{
+		dbtx: tx,
+	}
+}
+
+// InsertOne places the attachment after the existing attachments of the
+// receipt.
+func (r *receiptAttachments) InsertOne(ctx context.Context, attachment entity.ReceiptAttachment) (int64, error) {
+	q := `
+		INSERT
+		INTO receipt_attachments (receipt_id, device_id, file_path, file_name, content_type, file_size, kind, attachment_order, result_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, (
+			SELECT COALESCE(MAX(attachment_order) + 1, 0)
+			FROM receipt_attachments
+			WHERE receipt_id = $1
+		), $8, $9)
+		RETURNING attachment_id
+	`
+
+	var attachmentId int64
+
+	err := r.dbtx.QueryRowContext(ctx, q,
+		attachment.ReceiptId,
+		attachment.DeviceId,
+		attachment.FilePath,
+		attachment.FileName,
+		attachment.ContentType,
+		attachment.FileSize,
+		attachment.Kind,
+		attachment.ResultId,
+		helper.NowUnixMilli(),
+	).Scan(&attachmentId)
+	if err != nil {
+		return 0, fmt.Errorf("[repository][postgres][receiptAttachments][InsertOne][dbtx.QueryRowContext] %w", err)
+	}
+
+	return attachmentId, nil
+}
+
+func (r *receiptAttachments) scanMany(rows *sql.Rows) ([]entity.ReceiptAttachment, error) {
+	attachments := []entity.ReceiptAttachment{}
+
+	for rows.Next() {
+		var attachment entity.ReceiptAttachment
+
+		err := rows.Scan(
+			&attachment.AttachmentId,
+			&attachment.ReceiptId,
+			&attachment.DeviceId,
+			&attachment.FilePath,
+			&attachment.FileName,
+			&attachment.ContentType,
+			&attachment.FileSize,
+			&attachment.Kind,
+			&attachment.AttachmentOrder,
+			&attachment.ResultId,
+			&attachment.CreatedAt,
+			&attachment.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments, nil
+}
+
+func (r *receiptAttachments) GetByReceiptId(ctx context.Context, receiptId int64) ([]entity.ReceiptAttachment, error) {
+	q := `
+		SELECT attachment_id, receipt_id, device_id, file_path, file_name, content_type, file_size, kind, attachment_order, result_id, created_at, updated_at
+		FROM receipt_attachments
+		WHERE receipt_id = $1
+		ORDER BY attachment_order, attachment_id
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, receiptId)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptAttachments][GetByReceiptId][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	attachments, err := r.scanMany(rows)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptAttachments][GetByReceiptId][rows.Scan] %w", err)
+	}
+
+	return attachments, nil
+}
+
+func (r *receiptAttachments) GetByReceiptIds(ctx context.Context, receiptIds []int64) ([]entity.ReceiptAttachment, error) {
+	q := `
+		SELECT attachment_id, receipt_id, device_id, file_path, file_name, content_type, file_size, kind, attachment_order, result_id, created_at, updated_at
+		FROM receipt_attachments
+		WHERE receipt_id = ANY($1)
+		ORDER BY receipt_id, attachment_order, attachment_id
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, receiptIds)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptAttachments][GetByReceiptIds][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	attachments, err := r.scanMany(rows)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptAttachments][GetByReceiptIds][rows.Scan] %w", err)
+	}
+
+	return attachments, nil
+}
+
+func (r *receiptAttachments) CountByReceiptId(ctx context.Context, receiptId int64) (int, error) {
+	q := `
+		SELECT COUNT(*)
+		FROM receipt_attachments
+		WHERE receipt_id = $1
+	`
+
+	var count int
+
+	err := r.dbtx.QueryRowContext(ctx, q, receiptId).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("[repository][postgres][receiptAttachments][CountByReceiptId][dbtx.QueryRowContext] %w", err)
+	}
+
+	return count, nil
+}
+
+// DeleteOne removes the attachment row and returns it so that the caller can
+// remove the stored file. It returns nil when the attachment does not exist.
+func (r *receiptAttachments) DeleteOne(ctx context.Context, receiptId, attachmentId int64) (*entity.ReceiptAttachment, error) {
+	q := `
+		DELETE
+		FROM receipt_attachments
+		WHERE receipt_id = $1
+			AND attachment_id = $2
+		RETURNING attachment_id, receipt_id, device_id, file_path, file_name, content_type, file_size, kind, attachment_order, result_id, created_at, updated_at
+	`
+
+	var attachment entity.ReceiptAttachment
+
+	err := r.dbtx.QueryRowContext(ctx, q, receiptId, attachmentId).Scan(
+		&attachment.AttachmentId,
+		&attachment.ReceiptId,
+		&attachment.DeviceId,
+		&attachment.FilePath,
+		&attachment.FileName,
+		&attachment.ContentType,
+		&attachment.FileSize,
+		&attachment.Kind,
+		&attachment.AttachmentOrder,
+		&attachment.ResultId,
+		&attachment.CreatedAt,
+		&attachment.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("[repository][postgres][receiptAttachments][DeleteOne][dbtx.QueryRowContext] %w", err)
+	}
+
+	return &attachment, nil
+}
+
+func (r *receiptAttachments) UpdateOrder(ctx context.Context, receiptId int64, attachmentIds []int64) error {
+	q := `
+		UPDATE receipt_attachments ra
+		SET attachment_order = o.position - 1,
+			updated_at = $3
+		FROM UNNEST($2::BIGINT[]) WITH ORDINALITY AS o(attachment_id, position)
+		WHERE ra.attachment_id = o.attachment_id
+			AND ra.receipt_id = $1
+	`
+
+	_, err := r.dbtx.ExecContext(ctx, q, receiptId, attachmentIds, helper.NowUnixMilli())
+	if err != nil {
+		return fmt.Errorf("[repository][postgres][receiptAttachments][UpdateOrder][dbtx.ExecContext] %w", err)
+	}
+
+	return nil
+}
+
+// MoveMany reassigns every attachment of the source receipts to the target
+// receipt, after its existing attachments and in the order of fromReceiptIds.
+func (r *receiptAttachments) MoveMany(ctx context.Context, fromReceiptIds []int64, toReceiptId int64) error {
+	q := `
+		UPDATE receipt_attachments ra
+		SET receipt_id = $2,
+			attachment_order = b.base + m.position - 1,
+			updated_at = $3
+		FROM (
+			SELECT attachment_id, ROW_NUMBER() OVER (
+				ORDER BY ARRAY_POSITION($1::BIGINT[], receipt_id), attachment_order, attachment_id
+			) AS position
+			FROM receipt_attachments
+			WHERE receipt_id = ANY($1)
+		) m
+		CROSS JOIN (
+			SELECT COALESCE(MAX(attachment_order) + 1, 0) AS base
+			FROM receipt_attachments
+			WHERE receipt_id = $2
+		) b
+		WHERE ra.attachment_id = m.attachment_id
+	`
+
+	_, err := r.dbtx.ExecContext(ctx, q, fromReceiptIds, toReceiptId, helper.NowUnixMilli())
+	if err != nil {
+		return fmt.Errorf("[repository][postgres][receiptAttachments][MoveMany][dbtx.ExecContext] %w", err)
+	}
+
+	return nil
+}
+
+// GetFilePathsInUse returns the paths among filePaths that are still
+// referenced by attachments or detection images of receipts other than
+// excludeReceiptIds. Trashed receipts count, since they can be restored.
+func (r *receiptAttachments) GetFilePathsInUse(ctx context.Context, filePaths []string, excludeReceiptIds []int64) ([]string, error) {
+	q := `
+		SELECT file_path
+		FROM receipt_attachments
+		WHERE file_path = ANY($1)
+			AND NOT (receipt_id = ANY($2))
+		UNION
+		SELECT h.image_path
+		FROM receipt_detection_histories h
+		JOIN receipts r
+			ON r.result_id = h.result_id
+		WHERE h.image_path = ANY($1)
+			AND NOT (r.receipt_id = ANY($2))
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, filePaths, excludeReceiptIds)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptAttachments][GetFilePathsInUse][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	inUse := []string{}
+
+	for rows.Next() {
+		var filePath string
+
+		err = rows.Scan(&filePath)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][postgres][receiptAttachments][GetFilePathsInUse][rows.Scan] %w", err)
+		}
+
+		inUse = append(inUse, filePath)
+	}
+
+	return inUse, nil
+}
@@ -8,6 +8,7 @@ import (
 	"receipt-detector/entity"
 	"receipt-detector/helper"
 	"receipt-detector/repository"
+	"strconv"
 )
 
 type receiptDetectionHistories struct {
@@ -29,11 +30,19 @@ func (r *receiptDetectionHistories) NewTx(tx *sql.Tx) repository.ReceiptDetectio
 func (r *receiptDetectionHistories) InsertOne(ctx context.Context, history entity.ReceiptDetectionHistory) error {
 	q := `
 		INSERT 
-		INTO receipt_detection_histories (image_path, result_id, created_at)
-		VALUES ($1, $2, $3)
+		INTO receipt_detection_histories (image_path, result_id, device_id, ocr_language, ocr_currency, ocr_country, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 	`
 
-	_, err := r.dbtx.ExecContext(ctx, q, history.ImagePath, history.ResultId, helper.NowUnixMilli())
+	_, err := r.dbtx.ExecContext(ctx, q,
+		history.ImagePath,
+		history.ResultId,
+		history.DeviceId,
+		history.OcrOptions.Language,
+		history.OcrOptions.Currency,
+		history.OcrOptions.Country,
+		helper.NowUnixMilli(),
+	)
 	if err != nil {
 		return fmt.Errorf("[repository][postgres][receiptDetectionHistories][InsertOne][dbtx.ExecContext] %w", err)
 	}
@@ -43,10 +52,9 @@ func (r *receiptDetectionHistories) InsertOne(ctx context.Context, history entit
 
 func (r *receiptDetectionHistories) GetByResultId(ctx context.Context, resultId string) (*entity.ReceiptDetectionHistory, error) {
 	q := `
-		SELECT receipt_detection_history_id, image_path, result_id, revision_id, is_approved, is_reviewed, created_at, updated_at
+		SELECT receipt_detection_history_id, image_path, result_id, revision_id, device_id, is_approved, is_reviewed, ocr_language, ocr_currency, ocr_country, created_at, updated_at
 		FROM receipt_detection_histories
-		WHERE result_id = $1
-			OR revision_id = $1
+		WHERE (result_id = $1 OR revision_id = $1)
 			AND deleted_at IS NULL
 	`
 
@@ -57,8 +65,12 @@ func (r *receiptDetectionHistories) GetByResultId(ctx context.Context, resultId
 		&receiptDetectionHistory.ImagePath,
 		&receiptDetectionHistory.ResultId,
 		&receiptDetectionHistory.RevisionId,
+		&receiptDetectionHistory.DeviceId,
 		&receiptDetectionHistory.IsApproced,
 		&receiptDetectionHistory.IsReviewed,
+		&receiptDetectionHistory.OcrOptions.Language,
+		&receiptDetectionHistory.OcrOptions.Currency,
+		&receiptDetectionHistory.OcrOptions.Country,
 		&receiptDetectionHistory.CreatedAt,
 		&receiptDetectionHistory.UpdatedAt,
 	)
@@ -72,3 +84,75 @@ func (r *receiptDetectionHistories) GetByResultId(ctx context.Context, resultId
 
 	return &receiptDetectionHistory, nil
 }
+
+func (r *receiptDetectionHistories) GetApprovedRevisions(ctx context.Context, filter entity.ReceiptDetectionHistoryFilter) ([]entity.ReceiptDetectionHistory, error) {
+	q := `
+		SELECT receipt_detection_history_id, image_path, result_id, revision_id, is_approved, is_reviewed, created_at, updated_at
+		FROM receipt_detection_histories
+		WHERE is_approved = TRUE
+			AND revision_id <> ''
+			AND receipt_detection_history_id > $1
+			AND deleted_at IS NULL
+	`
+
+	args := []any{filter.AfterHistoryId}
+
+	if filter.CreatedFrom != 0 {
+		args = append(args, filter.CreatedFrom)
+		q += ` AND created_at >= $` + strconv.Itoa(len(args))
+	}
+
+	if filter.CreatedTo != 0 {
+		args = append(args, filter.CreatedTo)
+		q += ` AND created_at < $` + strconv.Itoa(len(args))
+	}
+
+	args = append(args, filter.Limit)
+	q += ` ORDER BY receipt_detection_history_id ASC LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := r.dbtx.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptDetectionHistories][GetApprovedRevisions][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	histories := []entity.ReceiptDetectionHistory{}
+
+	for rows.Next() {
+		var history entity.ReceiptDetectionHistory
+
+		err = rows.Scan(
+			&history.HistoryId,
+			&history.ImagePath,
+			&history.ResultId,
+			&history.RevisionId,
+			&history.IsApproced,
+			&history.IsReviewed,
+			&history.CreatedAt,
+			&history.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][postgres][receiptDetectionHistories][GetApprovedRevisions][rows.Scan] %w", err)
+		}
+
+		histories = append(histories, history)
+	}
+
+	return histories, nil
+}
+
+func (r *receiptDetectionHistories) SoftDeleteByResultId(ctx context.Context, resultId string) error {
+	q := `
+		UPDATE receipt_detection_histories
+		SET deleted_at = $2
+		WHERE result_id = $1
+			AND deleted_at IS NULL
+	`
+
+	_, err := r.dbtx.ExecContext(ctx, q, resultId, helper.NowUnixMilli())
+	if err != nil {
+		return fmt.Errorf("[repository][postgres][receiptDetectionHistories][SoftDeleteByResultId][dbtx.ExecContext] %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,204 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+	"strings"
+)
+
+type receiptDuplicates struct {
+	dbtx repository.DBTX
+}
+
+func NewReceiptDuplicates(dbtx repository.DBTX) *receiptDuplicates {
+	return &receiptDuplicates{
+		dbtx: dbtx,
+	}
+}
+
+func (r *receiptDuplicates) NewTx(tx *sql.Tx) repository.ReceiptDuplicates {
+	return &receiptDuplicates{
+		dbtx: tx,
+	}
+}
+
+// UpsertMany records the pairs. Pairs that are already known keep their
+// status; only the score and reasons of pending pairs are refreshed.
+func (r *receiptDuplicates) UpsertMany(ctx context.Context, duplicates []entity.ReceiptDuplicate) error {
+	if len(duplicates) == 0 {
+		return nil
+	}
+
+	q := `
+		INSERT
+		INTO receipt_duplicates (device_id, receipt_id, duplicate_receipt_id, score, reasons, status, created_at)
+		SELECT d.device_id, d.receipt_id, d.duplicate_receipt_id, d.score, d.reasons, $6, $7
+		FROM unnest($1::text[], $2::bigint[], $3::bigint[], $4::float8[], $5::text[])
+			AS d(device_id, receipt_id, duplicate_receipt_id, score, reasons)
+		ON CONFLICT (receipt_id, duplicate_receipt_id) DO UPDATE
+		SET score = EXCLUDED.score,
+			reasons = EXCLUDED.reasons,
+			updated_at = EXCLUDED.created_at
+		WHERE receipt_duplicates.status = $6
+	`
+
+	var (
+		deviceIds           = make([]string, len(duplicates))
+		receiptIds          = make([]int64, len(duplicates))
+		duplicateReceiptIds = make([]int64, len(duplicates))
+		scores              = make([]float64, len(duplicates))
+		reasons             = make([]string, len(duplicates))
+	)
+
+	for i, duplicate := range duplicates {
+		deviceIds[i] = duplicate.DeviceId
+		receiptIds[i] = duplicate.ReceiptId
+		duplicateReceiptIds[i] = duplicate.DuplicateReceiptId
+		scores[i] = duplicate.Score
+		reasons[i] = strings.Join(duplicate.Reasons, ",")
+	}
+
+	_, err := r.dbtx.ExecContext(ctx, q, deviceIds, receiptIds, duplicateReceiptIds, scores, reasons, entity.DuplicateStatusPending, helper.NowUnixMilli())
+	if err != nil {
+		return fmt.Errorf("[repository][postgres][receiptDuplicates][UpsertMany][dbtx.ExecContext] %w", err)
+	}
+
+	return nil
+}
+
+func splitReasons(reasons string) []string {
+	if reasons == "" {
+		return []string{}
+	}
+
+	return strings.Split(reasons, ",")
+}
+
+// GetMany lists the pairs of the device with the given status, highest score
+// first. Pairs where either receipt has been deleted are left out.
+func (r *receiptDuplicates) GetMany(ctx context.Context, deviceId, status string, limit int) ([]entity.ReceiptDuplicate, error) {
+	q := `
+		SELECT d.duplicate_id, d.device_id, d.receipt_id, d.duplicate_receipt_id, d.score, d.reasons, d.status, d.created_at, d.updated_at, d.resolved_at
+		FROM receipt_duplicates d
+		WHERE d.device_id = $1
+			AND d.status = $2
+			AND (
+				d.status <> $4
+				OR NOT EXISTS (
+					SELECT 1
+					FROM receipts r
+					WHERE r.receipt_id IN (d.receipt_id, d.duplicate_receipt_id)
+						AND r.deleted_at IS NOT NULL
+				)
+			)
+		ORDER BY d.score DESC, d.duplicate_id DESC
+		LIMIT $3
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, deviceId, status, limit, entity.DuplicateStatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptDuplicates][GetMany][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	duplicates := []entity.ReceiptDuplicate{}
+
+	for rows.Next() {
+		var (
+			duplicate entity.ReceiptDuplicate
+			reasons   string
+		)
+
+		err = rows.Scan(
+			&duplicate.DuplicateId,
+			&duplicate.DeviceId,
+			&duplicate.ReceiptId,
+			&duplicate.DuplicateReceiptId,
+			&duplicate.Score,
+			&reasons,
+			&duplicate.Status,
+			&duplicate.CreatedAt,
+			&duplicate.UpdatedAt,
+			&duplicate.ResolvedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][postgres][receiptDuplicates][GetMany][rows.Scan] %w", err)
+		}
+
+		duplicate.Reasons = splitReasons(reasons)
+
+		duplicates = append(duplicates, duplicate)
+	}
+
+	return duplicates, nil
+}
+
+func (r *receiptDuplicates) GetByDuplicateId(ctx context.Context, duplicateId int64, deviceId string) (*entity.ReceiptDuplicate, error) {
+	q := `
+		SELECT duplicate_id, device_id, receipt_id, duplicate_receipt_id, score, reasons, status, created_at, updated_at, resolved_at
+		FROM receipt_duplicates
+		WHERE duplicate_id = $1
+			AND device_id = $2
+	`
+
+	var (
+		duplicate entity.ReceiptDuplicate
+		reasons   string
+	)
+
+	err := r.dbtx.QueryRowContext(ctx, q, duplicateId, deviceId).Scan(
+		&duplicate.DuplicateId,
+		&duplicate.DeviceId,
+		&duplicate.ReceiptId,
+		&duplicate.DuplicateReceiptId,
+		&duplicate.Score,
+		&reasons,
+		&duplicate.Status,
+		&duplicate.CreatedAt,
+		&duplicate.UpdatedAt,
+		&duplicate.ResolvedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("[repository][postgres][receiptDuplicates][GetByDuplicateId][dbtx.QueryRowContext] %w", err)
+	}
+
+	duplicate.Reasons = splitReasons(reasons)
+
+	return &duplicate, nil
+}
+
+// UpdateStatus resolves a pending pair. It returns false when the pair was
+// already resolved.
+func (r *receiptDuplicates) UpdateStatus(ctx context.Context, duplicateId int64, status string) (bool, error) {
+	now := helper.NowUnixMilli()
+
+	q := `
+		UPDATE receipt_duplicates
+		SET status = $2,
+			resolved_at = $3,
+			updated_at = $3
+		WHERE duplicate_id = $1
+			AND status = $4
+	`
+
+	res, err := r.dbtx.ExecContext(ctx, q, duplicateId, status, now, entity.DuplicateStatusPending)
+	if err != nil {
+		return false, fmt.Errorf("[repository][postgres][receiptDuplicates][UpdateStatus][dbtx.ExecContext] %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("[repository][postgres][receiptDuplicates][UpdateStatus][res.RowsAffected] %w", err)
+	}
+
+	return affected > 0, nil
+}
@@ -0,0 +1,155 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+	"strconv"
+)
+
+type receiptItemAssignments struct {
+	dbtx repository.DBTX
+}
+
+func NewReceiptItemAssignments(dbtx repository.DBTX) *receiptItemAssignments {
+	return &receiptItemAssignments{
+		dbtx: dbtx,
+	}
+}
+
+func (r *receiptItemAssignments) NewTx(tx *sql.Tx) repository.ReceiptItemAssignments {
+	return &receiptItemAssignments{
+		dbtx: tx,
+	}
+}
+
+func (r *receiptItemAssignments) scanMany(rows *sql.Rows) ([]entity.ReceiptItemAssignment, error) {
+	assignments := []entity.ReceiptItemAssignment{}
+
+	for rows.Next() {
+		var assignment entity.ReceiptItemAssignment
+
+		err := rows.Scan(
+			&assignment.ReceiptItemId,
+			&assignment.ParticipantId,
+			&assignment.ShareWeight,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		assignments = append(assignments, assignment)
+	}
+
+	return assignments, nil
+}
+
+func (r *receiptItemAssignments) GetByReceiptId(ctx context.Context, receiptId int64) ([]entity.ReceiptItemAssignment, error) {
+	return r.GetByReceiptIds(ctx, []int64{receiptId})
+}
+
+func (r *receiptItemAssignments) GetByReceiptIds(ctx context.Context, receiptIds []int64) ([]entity.ReceiptItemAssignment, error) {
+	q := `
+		SELECT a.receipt_item_id, a.participant_id, a.share_weight
+		FROM receipt_item_assignments a
+		JOIN receipt_items ri
+			ON ri.receipt_item_id = a.receipt_item_id
+			AND ri.deleted_at IS NULL
+		JOIN receipt_participants p
+			ON p.participant_id = a.participant_id
+			AND p.deleted_at IS NULL
+		WHERE ri.receipt_id = ANY($1)
+		ORDER BY a.receipt_item_id, a.participant_id
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, receiptIds)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptItemAssignments][GetByReceiptIds][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	assignments, err := r.scanMany(rows)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptItemAssignments][GetByReceiptIds][r.scanMany] %w", err)
+	}
+
+	return assignments, nil
+}
+
+func (r *receiptItemAssignments) ReplaceForItem(ctx context.Context, receiptItemId int64, assignments []entity.ReceiptItemAssignment) error {
+	q := `
+		DELETE
+		FROM receipt_item_assignments
+		WHERE receipt_item_id = $1
+	`
+
+	_, err := r.dbtx.ExecContext(ctx, q, receiptItemId)
+	if err != nil {
+		return fmt.Errorf("[repository][postgres][receiptItemAssignments][ReplaceForItem][dbtx.ExecContext] %w", err)
+	}
+
+	if len(assignments) == 0 {
+		return nil
+	}
+
+	q = `
+		INSERT
+		INTO receipt_item_assignments (receipt_item_id, participant_id, share_weight, created_at)
+		VALUES
+	`
+
+	now := helper.NowUnixMilli()
+	args := []any{}
+
+	for i, assignment := range assignments {
+		if i > 0 {
+			q += `, `
+		}
+
+		args = append(args, assignment.ReceiptItemId, assignment.ParticipantId, assignment.ShareWeight, now)
+		q += `($` + strconv.Itoa(len(args)-3) +
+			`, $` + strconv.Itoa(len(args)-2) +
+			`, $` + strconv.Itoa(len(args)-1) +
+			`, $` + strconv.Itoa(len(args)) + `)`
+	}
+
+	_, err = r.dbtx.ExecContext(ctx, q, args...)
+	if err != nil {
+		return fmt.Errorf("[repository][postgres][receiptItemAssignments][ReplaceForItem][dbtx.ExecContext] %w", err)
+	}
+
+	return nil
+}
+
+func (r *receiptItemAssignments) DeleteByParticipantId(ctx context.Context, participantId int64) error {
+	q := `
+		DELETE
+		FROM receipt_item_assignments
+		WHERE participant_id = $1
+	`
+
+	_, err := r.dbtx.ExecContext(ctx, q, participantId)
+	if err != nil {
+		return fmt.Errorf("[repository][postgres][receiptItemAssignments][DeleteByParticipantId][dbtx.ExecContext] %w", err)
+	}
+
+	return nil
+}
+
+func (r *receiptItemAssignments) DeleteByReceiptItemIds(ctx context.Context, receiptItemIds []int64) error {
+	q := `
+		DELETE
+		FROM receipt_item_assignments
+		WHERE receipt_item_id = ANY($1)
+	`
+
+	_, err := r.dbtx.ExecContext(ctx, q, receiptItemIds)
+	if err != nil {
+		return fmt.Errorf("[repository][postgres][receiptItemAssignments][DeleteByReceiptItemIds][dbtx.ExecContext] %w", err)
+	}
+
+	return nil
+}
@@ -28,9 +28,13 @@ func (r *receiptItems) NewTx(tx *sql.Tx) repository.ReceiptItems {
 }
 
 func (r *receiptItems) InsertMany(ctx context.Context, receiptItems []entity.ReceiptItem) error {
+	if len(receiptItems) == 0 {
+		return nil
+	}
+
 	q := `
 		INSERT
-		INTO receipt_items (receipt_id, item_category, item_name, item_quantity, item_price_currency, item_price_numeric, created_at)
+		INTO receipt_items (receipt_id, item_category, item_name, item_quantity, item_price_currency, item_price_numeric, item_order, created_at)
 		VALUES
 	`
 
@@ -46,6 +50,7 @@ func (r *receiptItems) InsertMany(ctx context.Context, receiptItems []entity.Rec
 		itemQuantityIdx := strconv.Itoa(offset + 4)
 		itemPriceCurrencyIdx := strconv.Itoa(offset + 5)
 		itemPriceNumericIdx := strconv.Itoa(offset + 6)
+		itemOrder := strconv.Itoa(i)
 		createdAt := strconv.Itoa(int(now))
 
 		q += `($` + receiptIdIdx +
@@ -54,6 +59,7 @@ func (r *receiptItems) InsertMany(ctx context.Context, receiptItems []entity.Rec
 			`, $` + itemQuantityIdx +
 			`, $` + itemPriceCurrencyIdx +
 			`, $` + itemPriceNumericIdx +
+			`, ` + itemOrder +
 			`, ` + createdAt + `)`
 
 		if i < len(receiptItems)-1 {
@@ -86,11 +92,13 @@ func (r *receiptItems) GetByReceiptId(ctx context.Context, receiptId int64) ([]e
 			item_quantity, 
 			item_price_currency, 
 			item_price_numeric, 
+			item_order,
 			created_at, 
 			updated_at
 		FROM receipt_items
 		WHERE receipt_id = $1
 			AND deleted_at IS NULL
+		ORDER BY item_order, receipt_item_id
 	`
 
 	receiptItems := []entity.ReceiptItem{}
@@ -115,6 +123,7 @@ func (r *receiptItems) GetByReceiptId(ctx context.Context, receiptId int64) ([]e
 			&receiptItem.ItemQuantity,
 			&receiptItem.ItemPriceCurrency,
 			&receiptItem.ItemPriceNumeric,
+			&receiptItem.ItemOrder,
 			&receiptItem.CreatedAt,
 			&receiptItem.UpdatedAt,
 		)
@@ -127,3 +136,215 @@ func (r *receiptItems) GetByReceiptId(ctx context.Context, receiptId int64) ([]e
 
 	return receiptItems, nil
 }
+
+func (r *receiptItems) GetByReceiptIds(ctx context.Context, receiptIds []int64) ([]entity.ReceiptItem, error) {
+	q := `
+		SELECT
+			receipt_item_id,
+			receipt_id,
+			item_category,
+			item_name,
+			item_quantity,
+			item_price_currency,
+			item_price_numeric,
+			item_order,
+			created_at,
+			updated_at
+		FROM receipt_items
+		WHERE receipt_id = ANY($1)
+			AND deleted_at IS NULL
+		ORDER BY receipt_id, item_order, receipt_item_id
+	`
+
+	receiptItems := []entity.ReceiptItem{}
+
+	if len(receiptIds) == 0 {
+		return receiptItems, nil
+	}
+
+	rows, err := r.dbtx.QueryContext(ctx, q, receiptIds)
+	if err != nil {
+		return nil, fmt.Errorf("repository][postgres][receiptItems][GetByReceiptIds][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var receiptItem entity.ReceiptItem
+
+		err = rows.Scan(
+			&receiptItem.ReceiptItemId,
+			&receiptItem.ReceiptId,
+			&receiptItem.ItemCategory,
+			&receiptItem.ItemName,
+			&receiptItem.ItemQuantity,
+			&receiptItem.ItemPriceCurrency,
+			&receiptItem.ItemPriceNumeric,
+			&receiptItem.ItemOrder,
+			&receiptItem.CreatedAt,
+			&receiptItem.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("repository][postgres][receiptItems][GetByReceiptIds][rows.Scan] %w", err)
+		}
+
+		receiptItems = append(receiptItems, receiptItem)
+	}
+
+	return receiptItems, nil
+}
+
+func (r *receiptItems) InsertOne(ctx context.Context, receiptItem entity.ReceiptItem) (int64, error) {
+	q := `
+		INSERT
+		INTO receipt_items (receipt_id, item_category, item_name, item_quantity, item_price_currency, item_price_numeric, item_order, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, (
+			SELECT COALESCE(MAX(item_order) + 1, 0)
+			FROM receipt_items
+			WHERE receipt_id = $1
+				AND deleted_at IS NULL
+		), $7)
+		RETURNING receipt_item_id
+	`
+
+	var receiptItemId int64
+
+	err := r.dbtx.QueryRowContext(ctx, q,
+		receiptItem.ReceiptId,
+		receiptItem.ItemCategory,
+		receiptItem.ItemName,
+		receiptItem.ItemQuantity,
+		receiptItem.ItemPriceCurrency,
+		receiptItem.ItemPriceNumeric,
+		helper.NowUnixMilli(),
+	).Scan(&receiptItemId)
+	if err != nil {
+		return 0, fmt.Errorf("repository][postgres][receiptItems][InsertOne][dbtx.QueryRowContext] %w", err)
+	}
+
+	return receiptItemId, nil
+}
+
+func (r *receiptItems) UpdateOne(ctx context.Context, req entity.UpdateReceiptItemRequest) (bool, error) {
+	q := `
+		UPDATE receipt_items
+		SET 
+	`
+
+	args := []any{}
+	i := 1
+
+	if req.ItemCategory != nil {
+		q += `item_category = $` + strconv.Itoa(i) + `, `
+		args = append(args, *req.ItemCategory)
+		i++
+	}
+
+	if req.ItemName != nil {
+		q += `item_name = $` + strconv.Itoa(i) + `, `
+		args = append(args, *req.ItemName)
+		i++
+	}
+
+	if req.ItemQuantity != nil {
+		q += `item_quantity = $` + strconv.Itoa(i) + `, `
+		args = append(args, *req.ItemQuantity)
+		i++
+	}
+
+	if req.ItemPriceCurrency != nil {
+		q += `item_price_currency = $` + strconv.Itoa(i) + `, `
+		args = append(args, *req.ItemPriceCurrency)
+		i++
+	}
+
+	if req.ItemPriceNumeric != nil {
+		q += `item_price_numeric = $` + strconv.Itoa(i) + `, `
+		args = append(args, *req.ItemPriceNumeric)
+		i++
+	}
+
+	q += `updated_at = $` + strconv.Itoa(i) +
+		` WHERE receipt_item_id = $` + strconv.Itoa(i+1) +
+		` AND receipt_id = $` + strconv.Itoa(i+2) +
+		` AND deleted_at IS NULL`
+	args = append(args, helper.NowUnixMilli(), req.ReceiptItemId, req.ReceiptId)
+
+	res, err := r.dbtx.ExecContext(ctx, q, args...)
+	if err != nil {
+		return false, fmt.Errorf("repository][postgres][receiptItems][UpdateOne][dbtx.ExecContext] %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("repository][postgres][receiptItems][UpdateOne][res.RowsAffected] %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+func (r *receiptItems) SoftDeleteOne(ctx context.Context, receiptId, receiptItemId int64) (bool, error) {
+	q := `
+		UPDATE receipt_items
+		SET deleted_at = $3
+		WHERE receipt_item_id = $1
+			AND receipt_id = $2
+			AND deleted_at IS NULL
+	`
+
+	res, err := r.dbtx.ExecContext(ctx, q, receiptItemId, receiptId, helper.NowUnixMilli())
+	if err != nil {
+		return false, fmt.Errorf("repository][postgres][receiptItems][SoftDeleteOne][dbtx.ExecContext] %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("repository][postgres][receiptItems][SoftDeleteOne][res.RowsAffected] %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+func (r *receiptItems) UpdateOrder(ctx context.Context, receiptId int64, receiptItemIds []int64) error {
+	q := `
+		UPDATE receipt_items ri
+		SET item_order = o.position - 1,
+			updated_at = $3
+		FROM UNNEST($2::BIGINT[]) WITH ORDINALITY AS o(receipt_item_id, position)
+		WHERE ri.receipt_item_id = o.receipt_item_id
+			AND ri.receipt_id = $1
+			AND ri.deleted_at IS NULL
+	`
+
+	_, err := r.dbtx.ExecContext(ctx, q, receiptId, receiptItemIds, helper.NowUnixMilli())
+	if err != nil {
+		return fmt.Errorf("repository][postgres][receiptItems][UpdateOrder][dbtx.ExecContext] %w", err)
+	}
+
+	return nil
+}
+
+// MoveMany reassigns the items to another receipt, placing them after its
+// existing items in the given order.
+func (r *receiptItems) MoveMany(ctx context.Context, toReceiptId int64, receiptItemIds []int64) error {
+	q := `
+		UPDATE receipt_items ri
+		SET receipt_id = $1,
+			item_order = o.position - 1 + (
+				SELECT COALESCE(MAX(item_order) + 1, 0)
+				FROM receipt_items
+				WHERE receipt_id = $1
+					AND deleted_at IS NULL
+			),
+			updated_at = $3
+		FROM UNNEST($2::BIGINT[]) WITH ORDINALITY AS o(receipt_item_id, position)
+		WHERE ri.receipt_item_id = o.receipt_item_id
+			AND ri.deleted_at IS NULL
+	`
+
+	_, err := r.dbtx.ExecContext(ctx, q, toReceiptId, receiptItemIds, helper.NowUnixMilli())
+	if err != nil {
+		return fmt.Errorf("repository][postgres][receiptItems][MoveMany][dbtx.ExecContext] %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+)
+
+type receiptLineage struct {
+	dbtx repository.DBTX
+}
+
+func NewReceiptLineage(dbtx repository.DBTX) *receiptLineage {
+	return &receiptLineage{
+		dbtx: dbtx,
+	}
+}
+
+func (r *receiptLineage) NewTx(tx *sql.Tx) repository.ReceiptLineage {
+	return &receiptLineage{
+		dbtx: tx,
+	}
+}
+
+func (r *receiptLineage) InsertOne(ctx context.Context, lineage entity.ReceiptLineage) error {
+	q := `
+		INSERT
+		INTO receipt_lineage (device_id, operation, source_receipt_id, target_receipt_id, receipt_item_ids, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	receiptItemIds := lineage.ReceiptItemIds
+	if receiptItemIds == nil {
+		receiptItemIds = []int64{}
+	}
+
+	encoded, err := json.Marshal(receiptItemIds)
+	if err != nil {
+		return fmt.Errorf("[repository][postgres][receiptLineage][InsertOne][json.Marshal] %w", err)
+	}
+
+	_, err = r.dbtx.ExecContext(ctx, q,
+		lineage.DeviceId,
+		lineage.Operation,
+		lineage.SourceReceiptId,
+		lineage.TargetReceiptId,
+		string(encoded),
+		helper.NowUnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("[repository][postgres][receiptLineage][InsertOne][dbtx.ExecContext] %w", err)
+	}
+
+	return nil
+}
+
+// GetByReceiptId returns every entry where the receipt is either the source or
+// the target, oldest first.
+func (r *receiptLineage) GetByReceiptId(ctx context.Context, receiptId int64, deviceId string) ([]entity.ReceiptLineage, error) {
+	q := `
+		SELECT lineage_id, device_id, operation, source_receipt_id, target_receipt_id, receipt_item_ids, created_at
+		FROM receipt_lineage
+		WHERE (source_receipt_id = $1 OR target_receipt_id = $1)
+			AND device_id = $2
+		ORDER BY created_at, lineage_id
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, receiptId, deviceId)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptLineage][GetByReceiptId][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	lineage := []entity.ReceiptLineage{}
+
+	for rows.Next() {
+		var (
+			entry          entity.ReceiptLineage
+			receiptItemIds []byte
+		)
+
+		err = rows.Scan(
+			&entry.LineageId,
+			&entry.DeviceId,
+			&entry.Operation,
+			&entry.SourceReceiptId,
+			&entry.TargetReceiptId,
+			&receiptItemIds,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][postgres][receiptLineage][GetByReceiptId][rows.Scan] %w", err)
+		}
+
+		err = json.Unmarshal(receiptItemIds, &entry.ReceiptItemIds)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][postgres][receiptLineage][GetByReceiptId][json.Unmarshal] %w", err)
+		}
+
+		lineage = append(lineage, entry)
+	}
+
+	return lineage, nil
+}
@@ -0,0 +1,155 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+)
+
+type receiptParticipants struct {
+	dbtx repository.DBTX
+}
+
+func NewReceiptParticipants(dbtx repository.DBTX) *receiptParticipants {
+	return &receiptParticipants{
+		dbtx: dbtx,
+	}
+}
+
+func (r *receiptParticipants) NewTx(tx *sql.Tx) repository.ReceiptParticipants {
+	return &receiptParticipants{
+		dbtx: tx,
+	}
+}
+
+func (r *receiptParticipants) InsertOne(ctx context.Context, participant entity.ReceiptParticipant) (int64, error) {
+	q := `
+		INSERT
+		INTO receipt_participants (receipt_id, participant_name, created_at)
+		VALUES ($1, $2, $3)
+		RETURNING participant_id
+	`
+
+	var participantId int64
+
+	err := r.dbtx.QueryRowContext(ctx, q, participant.ReceiptId, participant.ParticipantName, helper.NowUnixMilli()).Scan(&participantId)
+	if err != nil {
+		return 0, fmt.Errorf("[repository][postgres][receiptParticipants][InsertOne][dbtx.QueryRowContext] %w", err)
+	}
+
+	return participantId, nil
+}
+
+func (r *receiptParticipants) scanMany(rows *sql.Rows) ([]entity.ReceiptParticipant, error) {
+	participants := []entity.ReceiptParticipant{}
+
+	for rows.Next() {
+		var participant entity.ReceiptParticipant
+
+		err := rows.Scan(
+			&participant.ParticipantId,
+			&participant.ReceiptId,
+			&participant.ParticipantName,
+			&participant.IsPayer,
+			&participant.CreatedAt,
+			&participant.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		participants = append(participants, participant)
+	}
+
+	return participants, nil
+}
+
+func (r *receiptParticipants) GetByReceiptId(ctx context.Context, receiptId int64) ([]entity.ReceiptParticipant, error) {
+	q := `
+		SELECT participant_id, receipt_id, participant_name, is_payer, created_at, updated_at
+		FROM receipt_participants
+		WHERE receipt_id = $1
+			AND deleted_at IS NULL
+		ORDER BY participant_id
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, receiptId)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptParticipants][GetByReceiptId][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	participants, err := r.scanMany(rows)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptParticipants][GetByReceiptId][r.scanMany] %w", err)
+	}
+
+	return participants, nil
+}
+
+func (r *receiptParticipants) GetByReceiptIds(ctx context.Context, receiptIds []int64) ([]entity.ReceiptParticipant, error) {
+	q := `
+		SELECT participant_id, receipt_id, participant_name, is_payer, created_at, updated_at
+		FROM receipt_participants
+		WHERE receipt_id = ANY($1)
+			AND deleted_at IS NULL
+		ORDER BY receipt_id, participant_id
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, receiptIds)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptParticipants][GetByReceiptIds][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	participants, err := r.scanMany(rows)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptParticipants][GetByReceiptIds][r.scanMany] %w", err)
+	}
+
+	return participants, nil
+}
+
+// SetPayer marks participantId as the one who paid the bill and clears the
+// flag on every other participant of the receipt.
+func (r *receiptParticipants) SetPayer(ctx context.Context, receiptId, participantId int64) error {
+	q := `
+		UPDATE receipt_participants
+		SET is_payer = (participant_id = $2),
+			updated_at = $3
+		WHERE receipt_id = $1
+			AND deleted_at IS NULL
+	`
+
+	_, err := r.dbtx.ExecContext(ctx, q, receiptId, participantId, helper.NowUnixMilli())
+	if err != nil {
+		return fmt.Errorf("[repository][postgres][receiptParticipants][SetPayer][dbtx.ExecContext] %w", err)
+	}
+
+	return nil
+}
+
+func (r *receiptParticipants) SoftDeleteOne(ctx context.Context, receiptId, participantId int64) (bool, error) {
+	q := `
+		UPDATE receipt_participants
+		SET deleted_at = $3
+		WHERE participant_id = $1
+			AND receipt_id = $2
+			AND deleted_at IS NULL
+	`
+
+	res, err := r.dbtx.ExecContext(ctx, q, participantId, receiptId, helper.NowUnixMilli())
+	if err != nil {
+		return false, fmt.Errorf("[repository][postgres][receiptParticipants][SoftDeleteOne][dbtx.ExecContext] %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("[repository][postgres][receiptParticipants][SoftDeleteOne][res.RowsAffected] %w", err)
+	}
+
+	return affected > 0, nil
+}
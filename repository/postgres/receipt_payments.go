@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+)
+
+type receiptPayments struct {
+	dbtx repository.DBTX
+}
+
+func NewReceiptPayments(dbtx repository.DBTX) *receiptPayments {
+	return &receiptPayments{
+		dbtx: dbtx,
+	}
+}
+
+func (r *receiptPayments) NewTx(tx *sql.Tx) repository.ReceiptPayments {
+	return &receiptPayments{
+		dbtx: tx,
+	}
+}
+
+func (r *receiptPayments) InsertOne(ctx context.Context, payment entity.ReceiptPayment) (int64, error) {
+	q := `
+		INSERT
+		INTO receipt_payments (receipt_id, participant_id, payment_currency, payment_amount, payment_method, note, paid_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING payment_id
+	`
+
+	var paymentId int64
+
+	err := r.dbtx.QueryRowContext(ctx, q,
+		payment.ReceiptId,
+		payment.ParticipantId,
+		payment.PaymentCurrency,
+		payment.PaymentAmount,
+		payment.PaymentMethod,
+		payment.Note,
+		payment.PaidAt,
+		helper.NowUnixMilli(),
+	).Scan(&paymentId)
+	if err != nil {
+		return 0, fmt.Errorf("[repository][postgres][receiptPayments][InsertOne][dbtx.QueryRowContext] %w", err)
+	}
+
+	return paymentId, nil
+}
+
+func (r *receiptPayments) GetByReceiptId(ctx context.Context, receiptId int64) ([]entity.ReceiptPayment, error) {
+	return r.GetByReceiptIds(ctx, []int64{receiptId})
+}
+
+func (r *receiptPayments) GetByReceiptIds(ctx context.Context, receiptIds []int64) ([]entity.ReceiptPayment, error) {
+	q := `
+		SELECT p.payment_id, p.receipt_id, p.participant_id, p.payment_currency, p.payment_amount, p.payment_method, p.note, p.paid_at, p.created_at
+		FROM receipt_payments p
+		JOIN receipt_participants rp
+			ON rp.participant_id = p.participant_id
+			AND rp.deleted_at IS NULL
+		WHERE p.receipt_id = ANY($1)
+			AND p.deleted_at IS NULL
+		ORDER BY p.receipt_id, p.paid_at, p.payment_id
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, receiptIds)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptPayments][GetByReceiptIds][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	payments := []entity.ReceiptPayment{}
+
+	for rows.Next() {
+		var payment entity.ReceiptPayment
+
+		err = rows.Scan(
+			&payment.PaymentId,
+			&payment.ReceiptId,
+			&payment.ParticipantId,
+			&payment.PaymentCurrency,
+			&payment.PaymentAmount,
+			&payment.PaymentMethod,
+			&payment.Note,
+			&payment.PaidAt,
+			&payment.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][postgres][receiptPayments][GetByReceiptIds][rows.Scan] %w", err)
+		}
+
+		payments = append(payments, payment)
+	}
+
+	return payments, nil
+}
+
+func (r *receiptPayments) SoftDeleteOne(ctx context.Context, receiptId, paymentId int64) (bool, error) {
+	q := `
+		UPDATE receipt_payments
+		SET deleted_at = $3
+		WHERE payment_id = $1
+			AND receipt_id = $2
+			AND deleted_at IS NULL
+	`
+
+	res, err := r.dbtx.ExecContext(ctx, q, paymentId, receiptId, helper.NowUnixMilli())
+	if err != nil {
+		return false, fmt.Errorf("[repository][postgres][receiptPayments][SoftDeleteOne][dbtx.ExecContext] %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("[repository][postgres][receiptPayments][SoftDeleteOne][res.RowsAffected] %w", err)
+	}
+
+	return affected > 0, nil
+}
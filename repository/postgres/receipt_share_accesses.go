@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/repository"
+)
+
+type receiptShareAccesses struct {
+	dbtx repository.DBTX
+}
+
+func NewReceiptShareAccesses(dbtx repository.DBTX) *receiptShareAccesses {
+	return &receiptShareAccesses{
+		dbtx: dbtx,
+	}
+}
+
+func (r *receiptShareAccesses) InsertOne(ctx context.Context, access entity.ReceiptShareAccess) error {
+	q := `
+		INSERT
+		INTO receipt_share_accesses (share_id, outcome, ip_address, user_agent, accessed_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err := r.dbtx.ExecContext(ctx, q,
+		access.ShareId,
+		access.Outcome,
+		access.IpAddress,
+		access.UserAgent,
+		access.AccessedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("[repository][postgres][receiptShareAccesses][InsertOne][dbtx.ExecContext] %w", err)
+	}
+
+	return nil
+}
+
+func (r *receiptShareAccesses) GetByShareId(ctx context.Context, shareId int64, limit int) ([]entity.ReceiptShareAccess, error) {
+	q := `
+		SELECT access_id, share_id, outcome, ip_address, user_agent, accessed_at
+		FROM receipt_share_accesses
+		WHERE share_id = $1
+		ORDER BY accessed_at DESC, access_id DESC
+		LIMIT $2
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, shareId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptShareAccesses][GetByShareId][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	accesses := []entity.ReceiptShareAccess{}
+
+	for rows.Next() {
+		var access entity.ReceiptShareAccess
+
+		err = rows.Scan(
+			&access.AccessId,
+			&access.ShareId,
+			&access.Outcome,
+			&access.IpAddress,
+			&access.UserAgent,
+			&access.AccessedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][postgres][receiptShareAccesses][GetByShareId][rows.Scan] %w", err)
+		}
+
+		accesses = append(accesses, access)
+	}
+
+	return accesses, nil
+}
@@ -0,0 +1,195 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+)
+
+type receiptShares struct {
+	dbtx repository.DBTX
+}
+
+func NewReceiptShares(dbtx repository.DBTX) *receiptShares {
+	return &receiptShares{
+		dbtx: dbtx,
+	}
+}
+
+func (r *receiptShares) InsertOne(ctx context.Context, share entity.ReceiptShare) (int64, error) {
+	q := `
+		INSERT
+		INTO receipt_shares (receipt_id, device_id, token_hash, expires_at, max_access, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING share_id
+	`
+
+	var shareId int64
+
+	err := r.dbtx.QueryRowContext(ctx, q,
+		share.ReceiptId,
+		share.DeviceId,
+		share.TokenHash,
+		share.ExpiresAt,
+		share.MaxAccess,
+		helper.NowUnixMilli(),
+	).Scan(&shareId)
+	if err != nil {
+		return 0, fmt.Errorf("[repository][postgres][receiptShares][InsertOne][dbtx.QueryRowContext] %w", err)
+	}
+
+	return shareId, nil
+}
+
+func (r *receiptShares) scanOne(row *sql.Row) (*entity.ReceiptShare, error) {
+	var share entity.ReceiptShare
+
+	err := row.Scan(
+		&share.ShareId,
+		&share.ReceiptId,
+		&share.DeviceId,
+		&share.TokenHash,
+		&share.ExpiresAt,
+		&share.MaxAccess,
+		&share.AccessCount,
+		&share.RevokedAt,
+		&share.CreatedAt,
+		&share.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &share, nil
+}
+
+func (r *receiptShares) GetByShareId(ctx context.Context, receiptId, shareId int64) (*entity.ReceiptShare, error) {
+	q := `
+		SELECT share_id, receipt_id, device_id, token_hash, expires_at, max_access, access_count, revoked_at, created_at, updated_at
+		FROM receipt_shares
+		WHERE receipt_id = $1
+			AND share_id = $2
+	`
+
+	share, err := r.scanOne(r.dbtx.QueryRowContext(ctx, q, receiptId, shareId))
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptShares][GetByShareId][dbtx.QueryRowContext] %w", err)
+	}
+
+	return share, nil
+}
+
+func (r *receiptShares) GetByTokenHash(ctx context.Context, tokenHash string) (*entity.ReceiptShare, error) {
+	q := `
+		SELECT share_id, receipt_id, device_id, token_hash, expires_at, max_access, access_count, revoked_at, created_at, updated_at
+		FROM receipt_shares
+		WHERE token_hash = $1
+	`
+
+	share, err := r.scanOne(r.dbtx.QueryRowContext(ctx, q, tokenHash))
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptShares][GetByTokenHash][dbtx.QueryRowContext] %w", err)
+	}
+
+	return share, nil
+}
+
+func (r *receiptShares) GetByReceiptId(ctx context.Context, receiptId int64) ([]entity.ReceiptShare, error) {
+	q := `
+		SELECT share_id, receipt_id, device_id, token_hash, expires_at, max_access, access_count, revoked_at, created_at, updated_at
+		FROM receipt_shares
+		WHERE receipt_id = $1
+		ORDER BY created_at DESC, share_id DESC
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, receiptId)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptShares][GetByReceiptId][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	shares := []entity.ReceiptShare{}
+
+	for rows.Next() {
+		var share entity.ReceiptShare
+
+		err = rows.Scan(
+			&share.ShareId,
+			&share.ReceiptId,
+			&share.DeviceId,
+			&share.TokenHash,
+			&share.ExpiresAt,
+			&share.MaxAccess,
+			&share.AccessCount,
+			&share.RevokedAt,
+			&share.CreatedAt,
+			&share.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][postgres][receiptShares][GetByReceiptId][rows.Scan] %w", err)
+		}
+
+		shares = append(shares, share)
+	}
+
+	return shares, nil
+}
+
+// ConsumeAccess counts one access against the share. It returns false when
+// the share is revoked, expired or has used up its access limit, so that
+// concurrent requests can never exceed the limit.
+func (r *receiptShares) ConsumeAccess(ctx context.Context, shareId int64) (bool, error) {
+	q := `
+		UPDATE receipt_shares
+		SET access_count = access_count + 1
+		WHERE share_id = $1
+			AND revoked_at IS NULL
+			AND expires_at > $2
+			AND (max_access IS NULL OR access_count < max_access)
+	`
+
+	res, err := r.dbtx.ExecContext(ctx, q, shareId, helper.NowUnixMilli())
+	if err != nil {
+		return false, fmt.Errorf("[repository][postgres][receiptShares][ConsumeAccess][dbtx.ExecContext] %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("[repository][postgres][receiptShares][ConsumeAccess][res.RowsAffected] %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+func (r *receiptShares) RevokeOne(ctx context.Context, receiptId, shareId int64) (bool, error) {
+	now := helper.NowUnixMilli()
+
+	q := `
+		UPDATE receipt_shares
+		SET revoked_at = $3,
+			updated_at = $3
+		WHERE receipt_id = $1
+			AND share_id = $2
+			AND revoked_at IS NULL
+	`
+
+	res, err := r.dbtx.ExecContext(ctx, q, receiptId, shareId, now)
+	if err != nil {
+		return false, fmt.Errorf("[repository][postgres][receiptShares][RevokeOne][dbtx.ExecContext] %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("[repository][postgres][receiptShares][RevokeOne][res.RowsAffected] %w", err)
+	}
+
+	return affected > 0, nil
+}
@@ -0,0 +1,179 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+)
+
+type receiptTags struct {
+	dbtx repository.DBTX
+}
+
+func NewReceiptTags(dbtx repository.DBTX) *receiptTags {
+	return &receiptTags{
+		dbtx: dbtx,
+	}
+}
+
+func (r *receiptTags) NewTx(tx *sql.Tx) repository.ReceiptTags {
+	return &receiptTags{
+		dbtx: tx,
+	}
+}
+
+func (r *receiptTags) GetByReceiptIds(ctx context.Context, receiptIds []int64) ([]entity.ReceiptTag, error) {
+	q := `
+		SELECT rt.receipt_id, t.tag_id, t.device_id, t.tag_name, t.color, t.created_at, t.updated_at
+		FROM receipt_tags rt
+		JOIN tags t
+			ON t.tag_id = rt.tag_id
+			AND t.deleted_at IS NULL
+		WHERE rt.receipt_id = ANY($1)
+		ORDER BY rt.receipt_id, LOWER(t.tag_name)
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, receiptIds)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptTags][GetByReceiptIds][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	receiptTags := []entity.ReceiptTag{}
+
+	for rows.Next() {
+		var receiptTag entity.ReceiptTag
+
+		err = rows.Scan(
+			&receiptTag.ReceiptId,
+			&receiptTag.Tag.TagId,
+			&receiptTag.Tag.DeviceId,
+			&receiptTag.Tag.TagName,
+			&receiptTag.Tag.Color,
+			&receiptTag.Tag.CreatedAt,
+			&receiptTag.Tag.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][postgres][receiptTags][GetByReceiptIds][rows.Scan] %w", err)
+		}
+
+		receiptTags = append(receiptTags, receiptTag)
+	}
+
+	return receiptTags, nil
+}
+
+func (r *receiptTags) GetReceiptIdsByTagId(ctx context.Context, tagId int64) ([]int64, error) {
+	q := `
+		SELECT receipt_id
+		FROM receipt_tags
+		WHERE tag_id = $1
+		ORDER BY receipt_id
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, tagId)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptTags][GetReceiptIdsByTagId][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	receiptIds := []int64{}
+
+	for rows.Next() {
+		var receiptId int64
+
+		err = rows.Scan(&receiptId)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][postgres][receiptTags][GetReceiptIdsByTagId][rows.Scan] %w", err)
+		}
+
+		receiptIds = append(receiptIds, receiptId)
+	}
+
+	return receiptIds, nil
+}
+
+// ReplaceByReceiptId makes tagIds the exact set of tags of the receipt. Tags
+// that stay on the receipt keep their original created_at.
+func (r *receiptTags) ReplaceByReceiptId(ctx context.Context, receiptId int64, tagIds []int64) error {
+	if tagIds == nil {
+		tagIds = []int64{}
+	}
+
+	q := `
+		WITH removed_tags AS (
+			DELETE
+			FROM receipt_tags
+			WHERE receipt_id = $1
+				AND NOT (tag_id = ANY($2))
+		)
+		INSERT
+		INTO receipt_tags (receipt_id, tag_id, created_at)
+		SELECT $1, tag_id, $3
+		FROM unnest($2::bigint[]) AS tag_id
+		ON CONFLICT (receipt_id, tag_id) DO NOTHING
+	`
+
+	_, err := r.dbtx.ExecContext(ctx, q, receiptId, tagIds, helper.NowUnixMilli())
+	if err != nil {
+		return fmt.Errorf("[repository][postgres][receiptTags][ReplaceByReceiptId][dbtx.ExecContext] %w", err)
+	}
+
+	return nil
+}
+
+func (r *receiptTags) DeleteOne(ctx context.Context, receiptId, tagId int64) (bool, error) {
+	q := `
+		DELETE
+		FROM receipt_tags
+		WHERE receipt_id = $1
+			AND tag_id = $2
+	`
+
+	res, err := r.dbtx.ExecContext(ctx, q, receiptId, tagId)
+	if err != nil {
+		return false, fmt.Errorf("[repository][postgres][receiptTags][DeleteOne][dbtx.ExecContext] %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("[repository][postgres][receiptTags][DeleteOne][res.RowsAffected] %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+// DeleteByTagId removes a tag from every receipt and returns the receipts it
+// was removed from.
+func (r *receiptTags) DeleteByTagId(ctx context.Context, tagId int64) ([]int64, error) {
+	q := `
+		DELETE
+		FROM receipt_tags
+		WHERE tag_id = $1
+		RETURNING receipt_id
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, tagId)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][receiptTags][DeleteByTagId][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	receiptIds := []int64{}
+
+	for rows.Next() {
+		var receiptId int64
+
+		err = rows.Scan(&receiptId)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][postgres][receiptTags][DeleteByTagId][rows.Scan] %w", err)
+		}
+
+		receiptIds = append(receiptIds, receiptId)
+	}
+
+	return receiptIds, nil
+}
@@ -9,6 +9,7 @@ import (
 	"receipt-detector/helper"
 	"receipt-detector/repository"
 	"strconv"
+	"strings"
 )
 
 type receipts struct {
@@ -30,14 +31,21 @@ func (r *receipts) NewTx(tx *sql.Tx) repository.Receipts {
 func (r *receipts) InsertOne(ctx context.Context, receipt entity.Receipt) (int64, error) {
 	q := `
 		INSERT
-		INTO receipts (receipt_name, receipt_date, result_id, device_id, created_at)
-		VALUES ($1, $2, $3, $4, $5)
+		INTO receipts (receipt_name, receipt_date, result_id, device_id, items_overridden, total_amount, total_currency, created_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8)
 		RETURNING receipt_id
 	`
 
-	var receiptId int64
+	var (
+		receiptId   int64
+		totalAmount float64
+	)
+
+	if receipt.Total != nil {
+		totalAmount = *receipt.Total
+	}
 
-	err := r.dbtx.QueryRowContext(ctx, q, receipt.ReceiptName, receipt.ReceiptDate, receipt.ResultId, receipt.DeviceId, helper.NowUnixMilli()).Scan(&receiptId)
+	err := r.dbtx.QueryRowContext(ctx, q, receipt.ReceiptName, receipt.ReceiptDate, receipt.ResultId, receipt.DeviceId, receipt.ItemsOverridden, totalAmount, receipt.TotalCurrency, helper.NowUnixMilli()).Scan(&receiptId)
 	if err != nil {
 		return receiptId, fmt.Errorf("repository][postgres][receipts][InsertOne][dbtx.ExecContext] %w", err)
 	}
@@ -47,7 +55,7 @@ func (r *receipts) InsertOne(ctx context.Context, receipt entity.Receipt) (int64
 
 func (r *receipts) GetByReceiptId(ctx context.Context, receiptId int64, deviceId string) (*entity.Receipt, error) {
 	q := `
-		SELECT receipt_id, receipt_name, receipt_date, result_id, created_at, updated_at
+		SELECT receipt_id, receipt_name, receipt_date, COALESCE(result_id, '') AS result_id, items_overridden, total_amount, total_currency, created_at, updated_at
 		FROM receipts
 		WHERE receipt_id = $1
 			AND device_id = $2
@@ -61,6 +69,9 @@ func (r *receipts) GetByReceiptId(ctx context.Context, receiptId int64, deviceId
 		&receipt.ReceiptName,
 		&receipt.ReceiptDate,
 		&receipt.ResultId,
+		&receipt.ItemsOverridden,
+		&receipt.Total,
+		&receipt.TotalCurrency,
 		&receipt.CreatedAt,
 		&receipt.UpdatedAt,
 	)
@@ -75,7 +86,9 @@ func (r *receipts) GetByReceiptId(ctx context.Context, receiptId int64, deviceId
 	return &receipt, nil
 }
 
-func (r *receipts) UpdateOne(ctx context.Context, newReceipt entity.UpdateReceiptRequest) error {
+// UpdateOne updates a live receipt of the device and reports whether it
+// found one.
+func (r *receipts) UpdateOne(ctx context.Context, newReceipt entity.UpdateReceiptRequest) (bool, error) {
 	q := `
 		UPDATE receipts
 		SET 
@@ -97,13 +110,517 @@ func (r *receipts) UpdateOne(ctx context.Context, newReceipt entity.UpdateReceip
 	}
 
 	q += `updated_at = $` + strconv.Itoa(i) +
-		` WHERE receipt_id = $` + strconv.Itoa(i+1)
+		` WHERE receipt_id = $` + strconv.Itoa(i+1) +
+		` AND device_id = $` + strconv.Itoa(i+2) +
+		` AND deleted_at IS NULL`
 	args = append(args, helper.NowUnixMilli())
 	args = append(args, newReceipt.ReceiptId)
+	args = append(args, newReceipt.DeviceId)
+
+	res, err := r.dbtx.ExecContext(ctx, q, args...)
+	if err != nil {
+		return false, fmt.Errorf("repository][postgres][receipts][UpdateOne][dbtx.ExecContext] %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("repository][postgres][receipts][UpdateOne][res.RowsAffected] %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+var (
+	receiptSortColumns = map[string]string{
+		entity.ReceiptSortByReceiptDate: "r.receipt_date",
+		entity.ReceiptSortByCreatedAt:   "r.created_at",
+		entity.ReceiptSortByTotal:       "r.total_amount",
+	}
+
+	likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+)
+
+func (r *receipts) GetMany(ctx context.Context, filter entity.ReceiptFilter) ([]entity.Receipt, error) {
+	q := `
+		SELECT r.receipt_id, r.receipt_name, r.receipt_date, COALESCE(r.result_id, '') AS result_id, r.items_overridden, r.total_amount, r.total_currency, r.created_at, r.updated_at
+		FROM receipts r
+		WHERE r.device_id = $1
+			AND r.deleted_at IS NULL
+	`
+
+	args := []any{filter.DeviceId}
+
+	if filter.DateFrom != nil {
+		args = append(args, *filter.DateFrom)
+		q += ` AND r.receipt_date >= $` + strconv.Itoa(len(args))
+	}
+
+	if filter.DateTo != nil {
+		args = append(args, *filter.DateTo)
+		q += ` AND r.receipt_date < $` + strconv.Itoa(len(args))
+	}
+
+	if filter.Name != "" {
+		args = append(args, "%"+likeEscaper.Replace(filter.Name)+"%")
+		q += ` AND r.receipt_name ILIKE $` + strconv.Itoa(len(args))
+	}
+
+	if filter.Category != "" {
+		args = append(args, filter.Category)
+		q += ` AND EXISTS (
+			SELECT 1
+			FROM receipt_items ri
+			WHERE ri.receipt_id = r.receipt_id
+				AND ri.item_category = $` + strconv.Itoa(len(args)) + `
+				AND ri.deleted_at IS NULL
+		)`
+	}
+
+	if filter.Currency != "" {
+		args = append(args, filter.Currency)
+		q += ` AND EXISTS (
+			SELECT 1
+			FROM receipt_items ri
+			WHERE ri.receipt_id = r.receipt_id
+				AND ri.item_price_currency = $` + strconv.Itoa(len(args)) + `
+				AND ri.deleted_at IS NULL
+		)`
+	}
+
+	if filter.AmountMin != nil {
+		args = append(args, *filter.AmountMin)
+		q += ` AND r.total_amount >= $` + strconv.Itoa(len(args))
+	}
+
+	if filter.AmountMax != nil {
+		args = append(args, *filter.AmountMax)
+		q += ` AND r.total_amount <= $` + strconv.Itoa(len(args))
+	}
+
+	if len(filter.TagIds) > 0 {
+		args = append(args, filter.TagIds, len(filter.TagIds))
+		q += ` AND r.receipt_id IN (
+			SELECT rt.receipt_id
+			FROM receipt_tags rt
+			WHERE rt.tag_id = ANY($` + strconv.Itoa(len(args)-1) + `)
+			GROUP BY rt.receipt_id
+			HAVING COUNT(*) = $` + strconv.Itoa(len(args)) + `
+		)`
+	}
+
+	sortColumn, ok := receiptSortColumns[filter.SortBy]
+	if !ok {
+		sortColumn = receiptSortColumns[entity.ReceiptSortByReceiptDate]
+	}
+
+	sortOrder, comparator := "DESC", "<"
+	if filter.SortOrder == entity.SortOrderAsc {
+		sortOrder, comparator = "ASC", ">"
+	}
+
+	if filter.CursorValue != nil {
+		args = append(args, filter.CursorValue, filter.CursorReceiptId)
+		q += ` AND (` + sortColumn + `, r.receipt_id) ` + comparator +
+			` ($` + strconv.Itoa(len(args)-1) + `, $` + strconv.Itoa(len(args)) + `)`
+	}
+
+	args = append(args, filter.Limit)
+	q += ` ORDER BY ` + sortColumn + ` ` + sortOrder + `, r.receipt_id ` + sortOrder +
+		` LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := r.dbtx.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("repository][postgres][receipts][GetMany][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	receipts := []entity.Receipt{}
+
+	for rows.Next() {
+		var receipt entity.Receipt
+
+		err = rows.Scan(
+			&receipt.ReceiptId,
+			&receipt.ReceiptName,
+			&receipt.ReceiptDate,
+			&receipt.ResultId,
+			&receipt.ItemsOverridden,
+			&receipt.Total,
+			&receipt.TotalCurrency,
+			&receipt.CreatedAt,
+			&receipt.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("repository][postgres][receipts][GetMany][rows.Scan] %w", err)
+		}
+
+		receipts = append(receipts, receipt)
+	}
+
+	return receipts, nil
+}
+
+func (r *receipts) SoftDeleteOne(ctx context.Context, receiptId int64, deviceId string) (bool, error) {
+	q := `
+		WITH deleted_receipt AS (
+			UPDATE receipts
+			SET deleted_at = $3
+			WHERE receipt_id = $1
+				AND device_id = $2
+				AND deleted_at IS NULL
+			RETURNING receipt_id
+		), deleted_items AS (
+			UPDATE receipt_items
+			SET deleted_at = $3
+			WHERE receipt_id IN (SELECT receipt_id FROM deleted_receipt)
+				AND deleted_at IS NULL
+		)
+		SELECT COUNT(*) FROM deleted_receipt
+	`
+
+	var count int
+
+	err := r.dbtx.QueryRowContext(ctx, q, receiptId, deviceId, helper.NowUnixMilli()).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("repository][postgres][receipts][SoftDeleteOne][dbtx.QueryRowContext] %w", err)
+	}
+
+	return count > 0, nil
+}
+
+func (r *receipts) RestoreOne(ctx context.Context, receiptId int64, deviceId string) (bool, error) {
+	q := `
+		WITH trashed_receipt AS (
+			SELECT receipt_id, deleted_at
+			FROM receipts
+			WHERE receipt_id = $1
+				AND device_id = $2
+				AND deleted_at IS NOT NULL
+			FOR UPDATE
+		), restored_receipt AS (
+			UPDATE receipts r
+			SET deleted_at = NULL,
+				updated_at = $3
+			FROM trashed_receipt t
+			WHERE r.receipt_id = t.receipt_id
+			RETURNING r.receipt_id
+		), restored_items AS (
+			UPDATE receipt_items ri
+			SET deleted_at = NULL
+			FROM trashed_receipt t
+			WHERE ri.receipt_id = t.receipt_id
+				AND ri.deleted_at = t.deleted_at
+		)
+		SELECT COUNT(*) FROM restored_receipt
+	`
+
+	var count int
+
+	err := r.dbtx.QueryRowContext(ctx, q, receiptId, deviceId, helper.NowUnixMilli()).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("repository][postgres][receipts][RestoreOne][dbtx.QueryRowContext] %w", err)
+	}
+
+	return count > 0, nil
+}
+
+func (r *receipts) GetManyDeleted(ctx context.Context, filter entity.ReceiptFilter) ([]entity.Receipt, error) {
+	q := `
+		SELECT receipt_id, receipt_name, receipt_date, COALESCE(result_id, '') AS result_id, created_at, updated_at, deleted_at
+		FROM receipts
+		WHERE device_id = $1
+			AND deleted_at IS NOT NULL
+	`
+
+	args := []any{filter.DeviceId}
+
+	if filter.CursorValue != nil {
+		args = append(args, filter.CursorValue, filter.CursorReceiptId)
+		q += ` AND (deleted_at, receipt_id) < ($` + strconv.Itoa(len(args)-1) + `, $` + strconv.Itoa(len(args)) + `)`
+	}
+
+	args = append(args, filter.Limit)
+	q += ` ORDER BY deleted_at DESC, receipt_id DESC LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := r.dbtx.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("repository][postgres][receipts][GetManyDeleted][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	receipts := []entity.Receipt{}
+
+	for rows.Next() {
+		var receipt entity.Receipt
+
+		err = rows.Scan(
+			&receipt.ReceiptId,
+			&receipt.ReceiptName,
+			&receipt.ReceiptDate,
+			&receipt.ResultId,
+			&receipt.CreatedAt,
+			&receipt.UpdatedAt,
+			&receipt.DeletedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("repository][postgres][receipts][GetManyDeleted][rows.Scan] %w", err)
+		}
+
+		receipts = append(receipts, receipt)
+	}
+
+	return receipts, nil
+}
+
+// GetPurgeable returns trashed receipts deleted before deletedBefore. Within a
+// transaction the rows stay locked, so they can not be restored until the
+// purge commits; rows locked by a restore in progress are skipped.
+func (r *receipts) GetPurgeable(ctx context.Context, deletedBefore int64, limit int) ([]entity.Receipt, error) {
+	q := `
+		SELECT receipt_id, receipt_name, receipt_date, COALESCE(result_id, '') AS result_id, device_id, created_at, updated_at, deleted_at
+		FROM receipts
+		WHERE deleted_at IS NOT NULL
+			AND deleted_at < $1
+		ORDER BY deleted_at ASC
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, deletedBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("repository][postgres][receipts][GetPurgeable][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	receipts := []entity.Receipt{}
+
+	for rows.Next() {
+		var receipt entity.Receipt
+
+		err = rows.Scan(
+			&receipt.ReceiptId,
+			&receipt.ReceiptName,
+			&receipt.ReceiptDate,
+			&receipt.ResultId,
+			&receipt.DeviceId,
+			&receipt.CreatedAt,
+			&receipt.UpdatedAt,
+			&receipt.DeletedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("repository][postgres][receipts][GetPurgeable][rows.Scan] %w", err)
+		}
+
+		receipts = append(receipts, receipt)
+	}
+
+	return receipts, nil
+}
+
+func (r *receipts) GetByDateRange(ctx context.Context, deviceId string, dateFrom, dateTo int64) ([]entity.Receipt, error) {
+	q := `
+		SELECT receipt_id, receipt_name, receipt_date, total_amount, total_currency
+		FROM receipts
+		WHERE device_id = $1
+			AND receipt_date >= $2
+			AND receipt_date <= $3
+			AND deleted_at IS NULL
+		ORDER BY receipt_date, receipt_id
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, deviceId, dateFrom, dateTo)
+	if err != nil {
+		return nil, fmt.Errorf("repository][postgres][receipts][GetByDateRange][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	receipts := []entity.Receipt{}
+
+	for rows.Next() {
+		var receipt entity.Receipt
+
+		err = rows.Scan(
+			&receipt.ReceiptId,
+			&receipt.ReceiptName,
+			&receipt.ReceiptDate,
+			&receipt.Total,
+			&receipt.TotalCurrency,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("repository][postgres][receipts][GetByDateRange][rows.Scan] %w", err)
+		}
+
+		receipts = append(receipts, receipt)
+	}
+
+	return receipts, nil
+}
+
+func (r *receipts) GetAfterId(ctx context.Context, afterReceiptId int64, limit int) ([]entity.Receipt, error) {
+	q := `
+		SELECT receipt_id, device_id
+		FROM receipts
+		WHERE receipt_id > $1
+			AND deleted_at IS NULL
+		ORDER BY receipt_id
+		LIMIT $2
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, afterReceiptId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("repository][postgres][receipts][GetAfterId][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	receipts := []entity.Receipt{}
+
+	for rows.Next() {
+		var receipt entity.Receipt
+
+		err = rows.Scan(
+			&receipt.ReceiptId,
+			&receipt.DeviceId,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("repository][postgres][receipts][GetAfterId][rows.Scan] %w", err)
+		}
+
+		receipts = append(receipts, receipt)
+	}
+
+	return receipts, nil
+}
+
+// GetResultIdsInUse returns the result ids still referenced by receipts other
+// than the excluded ones, directly or through an image linked by a merge or
+// split. Trashed receipts count, since they can be restored.
+func (r *receipts) GetResultIdsInUse(ctx context.Context, resultIds []string, excludeReceiptIds []int64) ([]string, error) {
+	q := `
+		SELECT result_id
+		FROM receipts
+		WHERE result_id = ANY($1)
+			AND NOT (receipt_id = ANY($2))
+		UNION
+		SELECT result_id
+		FROM receipt_attachments
+		WHERE result_id = ANY($1)
+			AND NOT (receipt_id = ANY($2))
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, resultIds, excludeReceiptIds)
+	if err != nil {
+		return nil, fmt.Errorf("repository][postgres][receipts][GetResultIdsInUse][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	inUse := []string{}
+
+	for rows.Next() {
+		var resultId string
+
+		err = rows.Scan(&resultId)
+		if err != nil {
+			return nil, fmt.Errorf("repository][postgres][receipts][GetResultIdsInUse][rows.Scan] %w", err)
+		}
+
+		inUse = append(inUse, resultId)
+	}
+
+	return inUse, nil
+}
+
+// HardDeleteMany removes the receipts that are still in the trash together
+// with everything attached to them, and returns the ids actually removed. A
+// receipt restored in the meantime is left untouched.
+func (r *receipts) HardDeleteMany(ctx context.Context, receiptIds []int64) ([]int64, error) {
+	q := `
+		WITH purged AS (
+			DELETE
+			FROM receipts
+			WHERE receipt_id = ANY($1)
+				AND deleted_at IS NOT NULL
+			RETURNING receipt_id
+		), deleted_items AS (
+			DELETE
+			FROM receipt_items
+			WHERE receipt_id IN (SELECT receipt_id FROM purged)
+			RETURNING receipt_item_id
+		), deleted_assignments AS (
+			DELETE
+			FROM receipt_item_assignments
+			WHERE receipt_item_id IN (SELECT receipt_item_id FROM deleted_items)
+		), deleted_participants AS (
+			DELETE
+			FROM receipt_participants
+			WHERE receipt_id IN (SELECT receipt_id FROM purged)
+		), deleted_payments AS (
+			DELETE
+			FROM receipt_payments
+			WHERE receipt_id IN (SELECT receipt_id FROM purged)
+		), deleted_tags AS (
+			DELETE
+			FROM receipt_tags
+			WHERE receipt_id IN (SELECT receipt_id FROM purged)
+		), deleted_attachments AS (
+			DELETE
+			FROM receipt_attachments
+			WHERE receipt_id IN (SELECT receipt_id FROM purged)
+		), deleted_share_accesses AS (
+			DELETE
+			FROM receipt_share_accesses
+			WHERE share_id IN (
+				SELECT share_id
+				FROM receipt_shares
+				WHERE receipt_id IN (SELECT receipt_id FROM purged)
+			)
+		), deleted_shares AS (
+			DELETE
+			FROM receipt_shares
+			WHERE receipt_id IN (SELECT receipt_id FROM purged)
+		), deleted_duplicates AS (
+			DELETE
+			FROM receipt_duplicates
+			WHERE receipt_id IN (SELECT receipt_id FROM purged)
+				OR duplicate_receipt_id IN (SELECT receipt_id FROM purged)
+		)
+		SELECT receipt_id
+		FROM purged
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, receiptIds)
+	if err != nil {
+		return nil, fmt.Errorf("repository][postgres][receipts][HardDeleteMany][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	purged := []int64{}
+
+	for rows.Next() {
+		var receiptId int64
+
+		err = rows.Scan(&receiptId)
+		if err != nil {
+			return nil, fmt.Errorf("repository][postgres][receipts][HardDeleteMany][rows.Scan] %w", err)
+		}
+
+		purged = append(purged, receiptId)
+	}
+
+	return purged, nil
+}
+
+func (r *receipts) UpdateTotal(ctx context.Context, receiptId int64, totalAmount float64, totalCurrency *string) error {
+	q := `
+		UPDATE receipts
+		SET total_amount = $2,
+			total_currency = $3,
+			updated_at = $4
+		WHERE receipt_id = $1
+	`
 
-	_, err := r.dbtx.ExecContext(ctx, q, args...)
+	_, err := r.dbtx.ExecContext(ctx, q, receiptId, totalAmount, totalCurrency, helper.NowUnixMilli())
 	if err != nil {
-		return fmt.Errorf("repository][postgres][receipts][UpdateOne][dbtx.ExecContext] %w", err)
+		return fmt.Errorf("repository][postgres][receipts][UpdateTotal][dbtx.ExecContext] %w", err)
 	}
 
 	return nil
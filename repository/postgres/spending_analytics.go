@@ -0,0 +1,194 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+	"strconv"
+)
+
+type spendingAnalytics struct {
+	dbtx repository.DBTX
+}
+
+func NewSpendingAnalytics(dbtx repository.DBTX) *spendingAnalytics {
+	return &spendingAnalytics{
+		dbtx: dbtx,
+	}
+}
+
+// spendingLines builds the per-item source of every aggregation. It walks the
+// receipts of a device through receipts_device_id_receipt_date_idx and reads
+// the items from the covering receipt_items_spending_idx. Lines are weighted by
+// their quantity and discounts always reduce the total, the same way receipt
+// totals are computed. When a base currency is requested each line carries
+// the rate of its receipt date, which is NULL when no rate is known.
+func (r *spendingAnalytics) spendingLines(filter entity.SpendingFilter, bucketExpr string, args []any) (string, []any) {
+	rateExpr := `NULL::numeric`
+
+	if filter.BaseCurrency != "" {
+		args = append(args, filter.BaseCurrency)
+		rateExpr = `exchange_rate(ri.item_price_currency, $` + strconv.Itoa(len(args)) + `::text, (to_timestamp(r.receipt_date / 1000.0) AT TIME ZONE 'UTC')::date)`
+	}
+
+	args = append(args, filter.DeviceId, filter.DateFrom, filter.DateTo)
+
+	q := `
+		SELECT
+			r.receipt_id,
+			r.receipt_name,
+			LOWER(TRIM(ri.item_category)) AS item_category,
+			UPPER(TRIM(ri.item_price_currency)) AS currency,
+			CASE
+				WHEN LOWER(TRIM(ri.item_category)) = 'discount' THEN -ABS(ri.item_price_numeric * COALESCE(ri.item_quantity, 1))
+				ELSE ri.item_price_numeric * COALESCE(ri.item_quantity, 1)
+			END AS amount,
+			` + rateExpr + ` AS rate,
+			LOWER(TRIM(ri.item_category)) IN ('tax', 'service', 'service_charge', 'discount') AS is_adjustment` + bucketExpr + `
+		FROM receipts r
+		JOIN receipt_items ri
+			ON ri.receipt_id = r.receipt_id
+			AND ri.deleted_at IS NULL
+		WHERE r.device_id = $` + strconv.Itoa(len(args)-2) + `
+			AND r.receipt_date >= $` + strconv.Itoa(len(args)-1) + `
+			AND r.receipt_date < $` + strconv.Itoa(len(args)) + `
+			AND r.deleted_at IS NULL`
+
+	if filter.Category != "" {
+		args = append(args, filter.Category)
+		q += ` AND LOWER(TRIM(ri.item_category)) = LOWER(TRIM($` + strconv.Itoa(len(args)) + `))`
+	}
+
+	if filter.Currency != "" {
+		args = append(args, helper.NormalizeCurrency(filter.Currency))
+		q += ` AND UPPER(TRIM(ri.item_price_currency)) = $` + strconv.Itoa(len(args))
+	}
+
+	return q, args
+}
+
+func (r *spendingAnalytics) GetBreakdown(ctx context.Context, filter entity.SpendingFilter) ([]entity.SpendingBreakdown, error) {
+	var keyExpr string
+
+	switch filter.GroupBy {
+	case entity.SpendingGroupByCategory:
+		keyExpr = `item_category`
+	case entity.SpendingGroupByMerchant:
+		keyExpr = `TRIM(receipt_name)`
+	case entity.SpendingGroupByCurrency:
+		keyExpr = `currency`
+	default:
+		return nil, fmt.Errorf("[repository][postgres][spendingAnalytics][GetBreakdown] unknown group by: %s", filter.GroupBy)
+	}
+
+	lines, args := r.spendingLines(filter, "", nil)
+
+	args = append(args, filter.Limit)
+
+	q := `
+		WITH lines AS (` + lines + `
+		), grouped AS (
+			SELECT
+				` + keyExpr + ` AS group_key,
+				currency,
+				SUM(amount)::float8 AS total,
+				COUNT(*) FILTER (WHERE NOT is_adjustment) AS item_count,
+				COUNT(DISTINCT receipt_id) AS receipt_count,
+				CASE WHEN BOOL_AND(rate IS NOT NULL) THEN SUM(amount * rate)::float8 END AS converted_total,
+				ROW_NUMBER() OVER (PARTITION BY currency ORDER BY SUM(amount) DESC, ` + keyExpr + `) AS rank
+			FROM lines
+			GROUP BY ` + keyExpr + `, currency
+		)
+		SELECT group_key, currency, total, item_count, receipt_count, converted_total
+		FROM grouped
+		WHERE rank <= $` + strconv.Itoa(len(args)) + `
+		ORDER BY currency, total DESC, group_key
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][spendingAnalytics][GetBreakdown][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	breakdown := []entity.SpendingBreakdown{}
+
+	for rows.Next() {
+		var row entity.SpendingBreakdown
+
+		err = rows.Scan(
+			&row.Key,
+			&row.Currency,
+			&row.Total,
+			&row.ItemCount,
+			&row.ReceiptCount,
+			&row.ConvertedTotal,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][postgres][spendingAnalytics][GetBreakdown][rows.Scan] %w", err)
+		}
+
+		breakdown = append(breakdown, row)
+	}
+
+	return breakdown, nil
+}
+
+func (r *spendingAnalytics) GetTimeseries(ctx context.Context, filter entity.SpendingFilter) ([]entity.SpendingTimeBucket, error) {
+	args := []any{filter.Interval, filter.Timezone}
+
+	// Receipt dates are unix millis; they are truncated in the requested time
+	// zone so that a bucket starts at local midnight, then turned back into
+	// unix millis.
+	bucketExpr := `,
+			(EXTRACT(EPOCH FROM (
+				date_trunc($1::text, to_timestamp(r.receipt_date / 1000.0) AT TIME ZONE $2::text) AT TIME ZONE $2::text
+			)) * 1000)::bigint AS bucket_start`
+
+	lines, args := r.spendingLines(filter, bucketExpr, args)
+
+	q := `
+		WITH lines AS (` + lines + `
+		)
+		SELECT
+			bucket_start,
+			currency,
+			SUM(amount)::float8 AS total,
+			COUNT(*) FILTER (WHERE NOT is_adjustment) AS item_count,
+			COUNT(DISTINCT receipt_id) AS receipt_count,
+			CASE WHEN BOOL_AND(rate IS NOT NULL) THEN SUM(amount * rate)::float8 END AS converted_total
+		FROM lines
+		GROUP BY bucket_start, currency
+		ORDER BY bucket_start, currency
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][spendingAnalytics][GetTimeseries][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	series := []entity.SpendingTimeBucket{}
+
+	for rows.Next() {
+		var bucket entity.SpendingTimeBucket
+
+		err = rows.Scan(
+			&bucket.Start,
+			&bucket.Currency,
+			&bucket.Total,
+			&bucket.ItemCount,
+			&bucket.ReceiptCount,
+			&bucket.ConvertedTotal,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][postgres][spendingAnalytics][GetTimeseries][rows.Scan] %w", err)
+		}
+
+		series = append(series, bucket)
+	}
+
+	return series, nil
+}
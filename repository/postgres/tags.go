@@ -0,0 +1,278 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+	"strconv"
+)
+
+type tags struct {
+	dbtx repository.DBTX
+}
+
+func NewTags(dbtx repository.DBTX) *tags {
+	return &tags{
+		dbtx: dbtx,
+	}
+}
+
+func (r *tags) NewTx(tx *sql.Tx) repository.Tags {
+	return &tags{
+		dbtx: tx,
+	}
+}
+
+// InsertOne returns a zero id when the device already has a tag with the same
+// name, compared case-insensitively.
+func (r *tags) InsertOne(ctx context.Context, tag entity.Tag) (int64, error) {
+	q := `
+		INSERT
+		INTO tags (device_id, tag_name, color, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (device_id, LOWER(tag_name)) WHERE deleted_at IS NULL DO NOTHING
+		RETURNING tag_id
+	`
+
+	var tagId int64
+
+	err := r.dbtx.QueryRowContext(ctx, q,
+		tag.DeviceId,
+		tag.TagName,
+		tag.Color,
+		helper.NowUnixMilli(),
+	).Scan(&tagId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+
+		return 0, fmt.Errorf("[repository][postgres][tags][InsertOne][dbtx.QueryRowContext] %w", err)
+	}
+
+	return tagId, nil
+}
+
+func (r *tags) GetByTagId(ctx context.Context, tagId int64, deviceId string) (*entity.Tag, error) {
+	q := `
+		SELECT tag_id, device_id, tag_name, color, created_at, updated_at
+		FROM tags
+		WHERE tag_id = $1
+			AND device_id = $2
+			AND deleted_at IS NULL
+	`
+
+	var tag entity.Tag
+
+	err := r.dbtx.QueryRowContext(ctx, q, tagId, deviceId).Scan(
+		&tag.TagId,
+		&tag.DeviceId,
+		&tag.TagName,
+		&tag.Color,
+		&tag.CreatedAt,
+		&tag.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("[repository][postgres][tags][GetByTagId][dbtx.QueryRowContext] %w", err)
+	}
+
+	return &tag, nil
+}
+
+func (r *tags) GetByTagName(ctx context.Context, tagName, deviceId string) (*entity.Tag, error) {
+	q := `
+		SELECT tag_id, device_id, tag_name, color, created_at, updated_at
+		FROM tags
+		WHERE LOWER(tag_name) = LOWER($1)
+			AND device_id = $2
+			AND deleted_at IS NULL
+	`
+
+	var tag entity.Tag
+
+	err := r.dbtx.QueryRowContext(ctx, q, tagName, deviceId).Scan(
+		&tag.TagId,
+		&tag.DeviceId,
+		&tag.TagName,
+		&tag.Color,
+		&tag.CreatedAt,
+		&tag.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("[repository][postgres][tags][GetByTagName][dbtx.QueryRowContext] %w", err)
+	}
+
+	return &tag, nil
+}
+
+func (r *tags) GetByTagIds(ctx context.Context, tagIds []int64, deviceId string) ([]entity.Tag, error) {
+	q := `
+		SELECT tag_id, device_id, tag_name, color, created_at, updated_at
+		FROM tags
+		WHERE tag_id = ANY($1)
+			AND device_id = $2
+			AND deleted_at IS NULL
+		ORDER BY tag_name
+	`
+
+	rows, err := r.dbtx.QueryContext(ctx, q, tagIds, deviceId)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][tags][GetByTagIds][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	tags := []entity.Tag{}
+
+	for rows.Next() {
+		var tag entity.Tag
+
+		err = rows.Scan(
+			&tag.TagId,
+			&tag.DeviceId,
+			&tag.TagName,
+			&tag.Color,
+			&tag.CreatedAt,
+			&tag.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][postgres][tags][GetByTagIds][rows.Scan] %w", err)
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+// GetCounts lists the tags of a device with the number of receipts carrying
+// each, most used first. Receipts in the trash are not counted. A query
+// narrows the tags to names starting with it.
+func (r *tags) GetCounts(ctx context.Context, deviceId, query string, limit int) ([]entity.TagCount, error) {
+	q := `
+		SELECT t.tag_id, t.device_id, t.tag_name, t.color, t.created_at, t.updated_at, COUNT(r.receipt_id) AS receipt_count
+		FROM tags t
+		LEFT JOIN receipt_tags rt
+			ON rt.tag_id = t.tag_id
+		LEFT JOIN receipts r
+			ON r.receipt_id = rt.receipt_id
+			AND r.deleted_at IS NULL
+		WHERE t.device_id = $1
+			AND t.deleted_at IS NULL
+	`
+
+	args := []any{deviceId}
+
+	if query != "" {
+		args = append(args, likeEscaper.Replace(query)+"%")
+		q += ` AND t.tag_name ILIKE $` + strconv.Itoa(len(args))
+	}
+
+	args = append(args, limit)
+	q += `
+		GROUP BY t.tag_id
+		ORDER BY receipt_count DESC, LOWER(t.tag_name)
+		LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := r.dbtx.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("[repository][postgres][tags][GetCounts][dbtx.QueryContext] %w", err)
+	}
+	defer rows.Close()
+
+	counts := []entity.TagCount{}
+
+	for rows.Next() {
+		var count entity.TagCount
+
+		err = rows.Scan(
+			&count.TagId,
+			&count.DeviceId,
+			&count.TagName,
+			&count.Color,
+			&count.CreatedAt,
+			&count.UpdatedAt,
+			&count.ReceiptCount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("[repository][postgres][tags][GetCounts][rows.Scan] %w", err)
+		}
+
+		counts = append(counts, count)
+	}
+
+	return counts, nil
+}
+
+func (r *tags) UpdateOne(ctx context.Context, req entity.UpdateTagRequest) (bool, error) {
+	q := `
+		UPDATE tags
+		SET 
+	`
+
+	args := []any{}
+	i := 1
+
+	if req.TagName != nil {
+		q += `tag_name = $` + strconv.Itoa(i) + `, `
+		args = append(args, *req.TagName)
+		i++
+	}
+
+	if req.Color != nil {
+		q += `color = $` + strconv.Itoa(i) + `, `
+		args = append(args, *req.Color)
+		i++
+	}
+
+	q += `updated_at = $` + strconv.Itoa(i) +
+		` WHERE tag_id = $` + strconv.Itoa(i+1) +
+		` AND device_id = $` + strconv.Itoa(i+2) +
+		` AND deleted_at IS NULL`
+	args = append(args, helper.NowUnixMilli(), req.TagId, req.DeviceId)
+
+	res, err := r.dbtx.ExecContext(ctx, q, args...)
+	if err != nil {
+		return false, fmt.Errorf("[repository][postgres][tags][UpdateOne][dbtx.ExecContext] %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("[repository][postgres][tags][UpdateOne][res.RowsAffected] %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+func (r *tags) SoftDeleteOne(ctx context.Context, tagId int64, deviceId string) (bool, error) {
+	q := `
+		UPDATE tags
+		SET deleted_at = $3
+		WHERE tag_id = $1
+			AND device_id = $2
+			AND deleted_at IS NULL
+	`
+
+	res, err := r.dbtx.ExecContext(ctx, q, tagId, deviceId, helper.NowUnixMilli())
+	if err != nil {
+		return false, fmt.Errorf("[repository][postgres][tags][SoftDeleteOne][dbtx.ExecContext] %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("[repository][postgres][tags][SoftDeleteOne][res.RowsAffected] %w", err)
+	}
+
+	return affected > 0, nil
+}
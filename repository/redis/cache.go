@@ -17,6 +17,7 @@ type cache struct {
 	receiptDetectionResultTTL time.Duration
 	receiptTTL                time.Duration
 	receiptItemsTTL           time.Duration
+	analyticsTTL              time.Duration
 
 	logTag string
 }
@@ -26,6 +27,7 @@ type CacheOpt struct {
 	ReceiptDetectionResultTTL time.Duration
 	ReceiptTTL                time.Duration
 	ReceiptItemsTTL           time.Duration
+	AnalyticsTTL              time.Duration
 }
 
 func NewCache(opt CacheOpt) *cache {
@@ -35,6 +37,7 @@ func NewCache(opt CacheOpt) *cache {
 		receiptDetectionResultTTL: opt.ReceiptDetectionResultTTL,
 		receiptTTL:                opt.ReceiptTTL,
 		receiptItemsTTL:           opt.ReceiptItemsTTL,
+		analyticsTTL:              opt.AnalyticsTTL,
 
 		logTag: "[repository][redis][cache]",
 	}
@@ -66,6 +69,17 @@ func (r *cache) Get(ctx context.Context, key string) ([]byte, error) {
 	return []byte(val), nil
 }
 
+func (r *cache) Del(ctx context.Context, keys ...string) error {
+	logTag := r.logTag + "[Del]"
+
+	err := r.client.Del(ctx, keys...).Err()
+	if err != nil {
+		return fmt.Errorf("%s[client.Del] Failed to delete data: %w [keys: %v]", logTag, err, keys)
+	}
+
+	return nil
+}
+
 func (r *cache) receiptDetectionResultKey(resultId string) string {
 	return fmt.Sprintf("receipt_detection_result:%s", resultId)
 }
@@ -188,3 +202,97 @@ func (r *cache) GetReceiptItems(ctx context.Context, receiptId int64) ([]entity.
 
 	return receiptItem, nil
 }
+
+func (r *cache) DeleteReceipt(ctx context.Context, receiptId int64) error {
+	return r.Del(ctx, r.receiptKey(receiptId), r.receiptItemsKey(receiptId))
+}
+
+func (r *cache) analyticsVersionKey(deviceId string) string {
+	return fmt.Sprintf("analytics_version:%s", deviceId)
+}
+
+func (r *cache) analyticsKey(deviceId string, version int64, queryHash string) string {
+	return fmt.Sprintf("analytics:%s:%v:%s", deviceId, version, queryHash)
+}
+
+// GetAnalyticsVersion returns the current analytics version of a device.
+// Cached aggregates are keyed by this version, so bumping it invalidates all
+// of them at once and the stale entries simply expire.
+func (r *cache) GetAnalyticsVersion(ctx context.Context, deviceId string) (int64, error) {
+	logTag := r.logTag + "[GetAnalyticsVersion]"
+
+	version, err := r.client.Get(ctx, r.analyticsVersionKey(deviceId)).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, nil
+		}
+
+		return 0, fmt.Errorf("%s[client.Get] Failed to get analytics version: %w [device_id: %s]", logTag, err, deviceId)
+	}
+
+	return version, nil
+}
+
+func (r *cache) BumpAnalyticsVersion(ctx context.Context, deviceId string) error {
+	logTag := r.logTag + "[BumpAnalyticsVersion]"
+
+	err := r.client.Incr(ctx, r.analyticsVersionKey(deviceId)).Err()
+	if err != nil {
+		return fmt.Errorf("%s[client.Incr] Failed to bump analytics version: %w [device_id: %s]", logTag, err, deviceId)
+	}
+
+	return nil
+}
+
+func (r *cache) SetAnalytics(ctx context.Context, deviceId string, version int64, queryHash string, data []byte) error {
+	return r.Set(
+		ctx,
+		r.analyticsKey(deviceId, version, queryHash),
+		data,
+		r.analyticsTTL,
+	)
+}
+
+func (r *cache) GetAnalytics(ctx context.Context, deviceId string, version int64, queryHash string) ([]byte, error) {
+	logTag := r.logTag + "[GetAnalytics]"
+
+	data, err := r.Get(ctx, r.analyticsKey(deviceId, version, queryHash))
+	if err != nil {
+		return nil, fmt.Errorf("%s[r.Get] Failed to get cache: %w [device_id: %s][query_hash: %s]", logTag, err, deviceId, queryHash)
+	}
+
+	return data, nil
+}
+
+func (r *cache) exchangeRatesVersionKey() string {
+	return "exchange_rates_version"
+}
+
+// GetExchangeRatesVersion returns the version of the exchange-rate table.
+// Converted aggregates are keyed by it as well, since loading rates changes
+// them for every device.
+func (r *cache) GetExchangeRatesVersion(ctx context.Context) (int64, error) {
+	logTag := r.logTag + "[GetExchangeRatesVersion]"
+
+	version, err := r.client.Get(ctx, r.exchangeRatesVersionKey()).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, nil
+		}
+
+		return 0, fmt.Errorf("%s[client.Get] Failed to get exchange rates version: %w", logTag, err)
+	}
+
+	return version, nil
+}
+
+func (r *cache) BumpExchangeRatesVersion(ctx context.Context) error {
+	logTag := r.logTag + "[BumpExchangeRatesVersion]"
+
+	err := r.client.Incr(ctx, r.exchangeRatesVersionKey()).Err()
+	if err != nil {
+		return fmt.Errorf("%s[client.Incr] Failed to bump exchange rates version: %w", logTag, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"receipt-detector/entity"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type idempotencyKeys struct {
+	client *redis.Client
+
+	logTag string
+}
+
+func NewIdempotencyKeys(client *redis.Client) *idempotencyKeys {
+	return &idempotencyKeys{
+		client: client,
+
+		logTag: "[repository][redis][idempotencyKeys]",
+	}
+}
+
+func (r *idempotencyKeys) key(deviceId, idempotencyKey string) string {
+	return fmt.Sprintf("idempotency:%s:%s", deviceId, idempotencyKey)
+}
+
+func (r *idempotencyKeys) Acquire(ctx context.Context, deviceId, idempotencyKey string, record entity.IdempotencyRecord, ttl time.Duration) (bool, error) {
+	logTag := r.logTag + "[Acquire]"
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return false, fmt.Errorf("%s[json.Marshal] Failed to marshal record: %w", logTag, err)
+	}
+
+	ok, err := r.client.SetNX(ctx, r.key(deviceId, idempotencyKey), data, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("%s[client.SetNX] Failed to set record: %w [idempotency_key: %s]", logTag, err, idempotencyKey)
+	}
+
+	return ok, nil
+}
+
+func (r *idempotencyKeys) Get(ctx context.Context, deviceId, idempotencyKey string) (*entity.IdempotencyRecord, error) {
+	logTag := r.logTag + "[Get]"
+
+	data, err := r.client.Get(ctx, r.key(deviceId, idempotencyKey)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("%s[client.Get] Failed to get record: %w [idempotency_key: %s]", logTag, err, idempotencyKey)
+	}
+
+	var record entity.IdempotencyRecord
+
+	err = json.Unmarshal(data, &record)
+	if err != nil {
+		return nil, fmt.Errorf("%s[json.Unmarshal] Failed to unmarshal record: %w [idempotency_key: %s]", logTag, err, idempotencyKey)
+	}
+
+	return &record, nil
+}
+
+func (r *idempotencyKeys) Complete(ctx context.Context, deviceId, idempotencyKey string, record entity.IdempotencyRecord, ttl time.Duration) error {
+	logTag := r.logTag + "[Complete]"
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("%s[json.Marshal] Failed to marshal record: %w", logTag, err)
+	}
+
+	err = r.client.Set(ctx, r.key(deviceId, idempotencyKey), data, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("%s[client.Set] Failed to set record: %w [idempotency_key: %s]", logTag, err, idempotencyKey)
+	}
+
+	return nil
+}
+
+func (r *idempotencyKeys) Release(ctx context.Context, deviceId, idempotencyKey string) error {
+	logTag := r.logTag + "[Release]"
+
+	err := r.client.Del(ctx, r.key(deviceId, idempotencyKey)).Err()
+	if err != nil {
+		return fmt.Errorf("%s[client.Del] Failed to delete record: %w [idempotency_key: %s]", logTag, err, idempotencyKey)
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 )
@@ -16,19 +17,29 @@ func NewSqlTransaction(db *sql.DB) *sqlTransaction {
 	}
 }
 
-func (s *sqlTransaction) Begin() (*sql.Tx, error) {
-	tx, err := s.db.Begin()
+func (s *sqlTransaction) Begin(ctx context.Context) (*sql.Tx, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("[transaction][Begin][db.Begin] Error: %w", err)
+		return nil, fmt.Errorf("[transaction][Begin][db.BeginTx] Error: %w", err)
 	}
 
+	s.tx = tx
+
 	return tx, nil
 }
 
 func (s *sqlTransaction) Rollback() error {
+	if s.tx == nil {
+		return fmt.Errorf("[transaction][Rollback] Error: transaction not started")
+	}
+
 	return s.tx.Rollback()
 }
 
 func (s *sqlTransaction) Commit() error {
+	if s.tx == nil {
+		return fmt.Errorf("[transaction][Commit] Error: transaction not started")
+	}
+
 	return s.tx.Commit()
 }
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+type unitOfWork struct {
+	db *sql.DB
+}
+
+func NewUnitOfWork(db *sql.DB) *unitOfWork {
+	return &unitOfWork{
+		db: db,
+	}
+}
+
+// WithTx runs fn inside a new transaction. Repositories join it through their
+// NewTx methods. The transaction is committed when fn returns nil and rolled
+// back when fn returns an error or panics. Errors returned by fn are passed
+// through unchanged.
+func (u *unitOfWork) WithTx(ctx context.Context, fn func(tx *sql.Tx) error) (err error) {
+	transaction := NewSqlTransaction(u.db)
+
+	tx, err := transaction.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("[repository][unitOfWork][WithTx][transaction.Begin] %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			rollbackErr := transaction.Rollback()
+			if rollbackErr != nil {
+				logrus.Errorf("[repository][unitOfWork][WithTx][transaction.Rollback] Failed to rollback after panic: %v", rollbackErr)
+			}
+
+			panic(p)
+		}
+	}()
+
+	err = fn(tx)
+	if err != nil {
+		rollbackErr := transaction.Rollback()
+		if rollbackErr != nil {
+			logrus.Errorf("[repository][unitOfWork][WithTx][transaction.Rollback] Failed to rollback: %v", rollbackErr)
+		}
+
+		return err
+	}
+
+	err = transaction.Commit()
+	if err != nil {
+		return fmt.Errorf("[repository][unitOfWork][WithTx][transaction.Commit] %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type backgroundJob struct {
+	name     string
+	interval time.Duration
+	run      func(ctx context.Context) error
+}
+
+func startJobs(ctx context.Context, jobs []backgroundJob) {
+	for _, job := range jobs {
+		if job.interval <= 0 {
+			logrus.Warnf("[server][startJobs] Job %s disabled, no interval configured", job.name)
+			continue
+		}
+
+		go runJob(ctx, job)
+	}
+}
+
+func runJob(ctx context.Context, job backgroundJob) {
+	ticker := time.NewTicker(job.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := job.run(ctx)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"job":   job.name,
+					"error": err,
+				}).Error("[server][runJob] Job failed")
+			}
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package server
 
 import (
+	"context"
+	"math"
 	"receipt-detector/adaptor"
 	"receipt-detector/config"
 	"receipt-detector/external/ocr"
 	"receipt-detector/handler"
+	"receipt-detector/middleware"
+	"receipt-detector/repository"
 	"receipt-detector/repository/elasticsearch"
 	"receipt-detector/repository/localstorage"
 	"receipt-detector/repository/postgres"
@@ -28,11 +32,31 @@ type routerOpts struct {
 	common           *hHandler.CommonHandler
 	receiptDetection *handler.ReceiptDetection
 	receipt          *handler.Receipt
+	receiptItem      *handler.ReceiptItem
+	deviceSetting    *handler.DeviceSetting
+	receiptImage     *handler.ReceiptImage
+	receiptSplit     *handler.ReceiptSplit
+	settlement       *handler.ReceiptSettlement
+	receiptExport    *handler.ReceiptExport
+	receiptImport    *handler.ReceiptImport
+	receiptSearch    *handler.ReceiptSearch
+	analytics        *handler.SpendingAnalytics
+	budget           *handler.Budget
+	exchangeRate     *handler.ExchangeRate
+	tag              *handler.Tag
+	attachment       *handler.ReceiptAttachment
+	share            *handler.ReceiptShare
+	lineage          *handler.ReceiptLineage
+	duplicate        *handler.ReceiptDuplicate
+	history          *handler.ReceiptHistory
+
+	idempotency gin.HandlerFunc
+	adminKey    gin.HandlerFunc
 
 	hash hHelper.HashHelper
 }
 
-func newRouter(config *config.AppConfig) *gin.Engine {
+func newRouter(config *config.AppConfig) (*gin.Engine, []backgroundJob) {
 	db, err := adaptor.ConnectPostgres(config.Db)
 	if err != nil {
 		logrus.Panicf("Failed to connect to db: %v", err)
@@ -52,18 +76,58 @@ func newRouter(config *config.AppConfig) *gin.Engine {
 
 	receiptDetectionHistoriesRepo := postgres.NewReceiptDetectionHistories(db)
 	receiptDetectionResultsRepo := elasticsearch.NewReceiptDetectionResults(es, config.Elasticsearch.Indices.ReceiptDetectionResults)
-	receiptImagesRepo := localstorage.NewReceiptImages(config.Storage.Local.Directory, config.Storage.Local.ServerHost+config.Storage.Local.ServerStaticPath)
+	receiptSearchRepo := elasticsearch.NewReceiptSearch(es, config.Elasticsearch.Indices.Receipts)
+
+	err = receiptSearchRepo.EnsureIndex(context.Background())
+	if err != nil {
+		logrus.Panicf("Failed to ensure receipt search index: %v", err)
+	}
+
+	if config.Storage.Local.EnableStaticServer && config.Storage.Local.SignedUrlSecret == "" {
+		logrus.Panic("Signed url secret must be set when the static server is enabled")
+	}
+
+	receiptImagesRepo := localstorage.NewReceiptImages(localstorage.ReceiptImagesOpt{
+		LocalDirectory:  config.Storage.Local.Directory,
+		ServerBaseUrl:   config.Storage.Local.ServerHost + config.Storage.Local.ServerStaticPath,
+		SignedUrlSecret: config.Storage.Local.SignedUrlSecret,
+		SignedUrlTTL:    time.Duration(config.Storage.Local.SignedUrlTTL),
+	})
 	cacheRepo := redis.NewCache(redis.CacheOpt{
 		Client:                    rds,
 		ReceiptDetectionResultTTL: time.Duration(config.Cache.TTL.ReceiptDetectionResult),
 		ReceiptTTL:                time.Duration(config.Cache.TTL.Receipt),
 		ReceiptItemsTTL:           time.Duration(config.Cache.TTL.ReceiptItems),
+		AnalyticsTTL:              time.Duration(config.Cache.TTL.Analytics),
 	})
+	unitOfWork := repository.NewUnitOfWork(db)
 	receiptsRepo := postgres.NewReceipts(db)
 	receiptItemsRepo := postgres.NewReceiptItems(db)
+	idempotencyKeysRepo := redis.NewIdempotencyKeys(rds)
+	deviceSettingsRepo := postgres.NewDeviceSettings(db)
+	receiptParticipantsRepo := postgres.NewReceiptParticipants(db)
+	receiptItemAssignmentsRepo := postgres.NewReceiptItemAssignments(db)
+	receiptPaymentsRepo := postgres.NewReceiptPayments(db)
+	spendingAnalyticsRepo := postgres.NewSpendingAnalytics(db)
+	budgetsRepo := postgres.NewBudgets(db)
+	budgetAlertsRepo := postgres.NewBudgetAlerts(db)
+	exchangeRatesRepo := postgres.NewExchangeRates(db)
+	tagsRepo := postgres.NewTags(db)
+	receiptTagsRepo := postgres.NewReceiptTags(db)
+	receiptAttachmentsRepo := postgres.NewReceiptAttachments(db)
+	receiptSharesRepo := postgres.NewReceiptShares(db)
+	receiptShareAccessesRepo := postgres.NewReceiptShareAccesses(db)
+	receiptLineageRepo := postgres.NewReceiptLineage(db)
+	receiptDuplicatesRepo := postgres.NewReceiptDuplicates(db)
+	auditLogsRepo := postgres.NewAuditLogs(db)
 
 	ocrEngine := ocr.NewOcEngineRestClient(config.Ocr.OcrEngine.BaseUrl)
 
+	budgetNotifier, err := adaptor.NewNotifier(config.Notifier)
+	if err != nil {
+		logrus.Panicf("Failed to create notifier: %v", err)
+	}
+
 	receiptDetectionService := service.NewReceiptDetectionService(service.ReceiptDetectionResultsOpts{
 		OcrEngine:                     ocrEngine,
 		ReceiptDetectionHistoriesRepo: receiptDetectionHistoriesRepo,
@@ -72,28 +136,292 @@ func newRouter(config *config.AppConfig) *gin.Engine {
 		MaxFileSizeMb:                 config.Ocr.MaxFileSize,
 		AllowedFileType:               config.Ocr.AllowedFileType,
 		CacheRepo:                     cacheRepo,
+		DeviceSettingsRepo:            deviceSettingsRepo,
+		AuditLogsRepo:                 auditLogsRepo,
+		UnitOfWork:                    unitOfWork,
 	})
 	receiptService := service.NewBillService(service.ReceiptOpts{
 		ReceiptsRepo:                  receiptsRepo,
 		ReceiptItemsRepo:              receiptItemsRepo,
 		ReceiptDetectionHistoriesRepo: receiptDetectionHistoriesRepo,
+		ReceiptDetectionResultsRepo:   receiptDetectionResultsRepo,
+		ReceiptImagesRepo:             receiptImagesRepo,
+		CacheRepo:                     cacheRepo,
+		UnitOfWork:                    unitOfWork,
+		ReceiptSearchRepo:             receiptSearchRepo,
+		ReceiptTagsRepo:               receiptTagsRepo,
+		ReceiptAttachmentsRepo:        receiptAttachmentsRepo,
+		BudgetsRepo:                   budgetsRepo,
+		BudgetAlertsRepo:              budgetAlertsRepo,
+		SpendingAnalyticsRepo:         spendingAnalyticsRepo,
+		Notifier:                      budgetNotifier,
+		DeviceSettingsRepo:            deviceSettingsRepo,
+		ExchangeRatesRepo:             exchangeRatesRepo,
+		ReceiptDuplicatesRepo:         receiptDuplicatesRepo,
+		AuditLogsRepo:                 auditLogsRepo,
+		ReceiptParticipantsRepo:       receiptParticipantsRepo,
+		ReceiptItemAssignmentsRepo:    receiptItemAssignmentsRepo,
+		TrashRetention:                time.Duration(config.Trash.RetentionPeriod),
+		DuplicateThreshold:            config.Duplicate.Threshold,
+		DuplicateDateWindow:           time.Duration(config.Duplicate.DateWindow),
+	})
+
+	receiptItemService := service.NewReceiptItemService(service.ReceiptItemOpts{
+		ReceiptsRepo:               receiptsRepo,
+		ReceiptItemsRepo:           receiptItemsRepo,
+		CacheRepo:                  cacheRepo,
+		UnitOfWork:                 unitOfWork,
+		ReceiptSearchRepo:          receiptSearchRepo,
+		ReceiptTagsRepo:            receiptTagsRepo,
+		BudgetsRepo:                budgetsRepo,
+		BudgetAlertsRepo:           budgetAlertsRepo,
+		SpendingAnalyticsRepo:      spendingAnalyticsRepo,
+		Notifier:                   budgetNotifier,
+		AuditLogsRepo:              auditLogsRepo,
+		ReceiptParticipantsRepo:    receiptParticipantsRepo,
+		ReceiptItemAssignmentsRepo: receiptItemAssignmentsRepo,
+	})
+	deviceSettingService := service.NewDeviceSettingService(service.DeviceSettingOpts{
+		DeviceSettingsRepo: deviceSettingsRepo,
+	})
+	receiptImageService := service.NewReceiptImageService(service.ReceiptImageOpts{
+		ReceiptImagesRepo: receiptImagesRepo,
+	})
+	receiptSplitService := service.NewReceiptSplitService(service.ReceiptSplitOpts{
+		ReceiptsRepo:               receiptsRepo,
+		ReceiptItemsRepo:           receiptItemsRepo,
+		ReceiptParticipantsRepo:    receiptParticipantsRepo,
+		ReceiptItemAssignmentsRepo: receiptItemAssignmentsRepo,
+		UnitOfWork:                 unitOfWork,
+		ReceiptTagsRepo:            receiptTagsRepo,
+		AuditLogsRepo:              auditLogsRepo,
+	})
+	receiptSettlementService := service.NewReceiptSettlementService(service.ReceiptSettlementOpts{
+		ReceiptsRepo:               receiptsRepo,
+		ReceiptItemsRepo:           receiptItemsRepo,
+		ReceiptParticipantsRepo:    receiptParticipantsRepo,
+		ReceiptItemAssignmentsRepo: receiptItemAssignmentsRepo,
+		ReceiptPaymentsRepo:        receiptPaymentsRepo,
+		ReceiptTagsRepo:            receiptTagsRepo,
+		UnitOfWork:                 unitOfWork,
+		AuditLogsRepo:              auditLogsRepo,
+	})
+	receiptExportService, err := service.NewReceiptExportService(service.ReceiptExportOpts{
+		ReceiptsRepo:           receiptsRepo,
+		ReceiptItemsRepo:       receiptItemsRepo,
+		LedgerPaymentAccount:   config.Ledger.PaymentAccount,
+		LedgerDefaultAccount:   config.Ledger.DefaultAccount,
+		LedgerCategoryAccounts: config.Ledger.CategoryAccounts,
+	})
+	if err != nil {
+		logrus.Panicf("Failed to create receipt export service: %v", err)
+	}
+	receiptImportService := service.NewReceiptImportService(service.ReceiptImportOpts{
+		ReceiptsRepo:               receiptsRepo,
+		ReceiptItemsRepo:           receiptItemsRepo,
+		UnitOfWork:                 unitOfWork,
+		ReceiptSearchRepo:          receiptSearchRepo,
+		ReceiptTagsRepo:            receiptTagsRepo,
+		CacheRepo:                  cacheRepo,
+		BudgetsRepo:                budgetsRepo,
+		BudgetAlertsRepo:           budgetAlertsRepo,
+		SpendingAnalyticsRepo:      spendingAnalyticsRepo,
+		Notifier:                   budgetNotifier,
+		AuditLogsRepo:              auditLogsRepo,
+		ReceiptParticipantsRepo:    receiptParticipantsRepo,
+		ReceiptItemAssignmentsRepo: receiptItemAssignmentsRepo,
+		ReceiptDuplicatesRepo:      receiptDuplicatesRepo,
+		DuplicateThreshold:         config.Duplicate.Threshold,
+		DuplicateDateWindow:        time.Duration(config.Duplicate.DateWindow),
+	})
+	receiptSearchService := service.NewReceiptSearchService(service.ReceiptSearchOpts{
+		ReceiptsRepo:      receiptsRepo,
+		ReceiptItemsRepo:  receiptItemsRepo,
+		ReceiptSearchRepo: receiptSearchRepo,
+		ReceiptTagsRepo:   receiptTagsRepo,
+	})
+	spendingAnalyticsService := service.NewSpendingAnalyticsService(service.SpendingAnalyticsOpts{
+		SpendingAnalyticsRepo: spendingAnalyticsRepo,
+		CacheRepo:             cacheRepo,
+		DeviceSettingsRepo:    deviceSettingsRepo,
+		ExchangeRatesRepo:     exchangeRatesRepo,
+	})
+	budgetService := service.NewBudgetService(service.BudgetOpts{
+		BudgetsRepo:           budgetsRepo,
+		BudgetAlertsRepo:      budgetAlertsRepo,
+		SpendingAnalyticsRepo: spendingAnalyticsRepo,
+		Notifier:              budgetNotifier,
+	})
+	tagService := service.NewTagService(service.TagOpts{
+		TagsRepo:                   tagsRepo,
+		ReceiptTagsRepo:            receiptTagsRepo,
+		ReceiptsRepo:               receiptsRepo,
+		ReceiptItemsRepo:           receiptItemsRepo,
+		ReceiptSearchRepo:          receiptSearchRepo,
+		UnitOfWork:                 unitOfWork,
+		ReceiptParticipantsRepo:    receiptParticipantsRepo,
+		ReceiptItemAssignmentsRepo: receiptItemAssignmentsRepo,
+		AuditLogsRepo:              auditLogsRepo,
+	})
+	receiptAttachmentService := service.NewReceiptAttachmentService(service.ReceiptAttachmentOpts{
+		OcrEngine:                   ocrEngine,
+		ReceiptsRepo:                receiptsRepo,
+		ReceiptItemsRepo:            receiptItemsRepo,
+		ReceiptAttachmentsRepo:      receiptAttachmentsRepo,
+		ReceiptImagesRepo:           receiptImagesRepo,
+		ReceiptDetectionResultsRepo: receiptDetectionResultsRepo,
+		DeviceSettingsRepo:          deviceSettingsRepo,
+		CacheRepo:                   cacheRepo,
+		UnitOfWork:                  unitOfWork,
+		ReceiptSearchRepo:           receiptSearchRepo,
+		ReceiptTagsRepo:             receiptTagsRepo,
+		BudgetsRepo:                 budgetsRepo,
+		BudgetAlertsRepo:            budgetAlertsRepo,
+		SpendingAnalyticsRepo:       spendingAnalyticsRepo,
+		Notifier:                    budgetNotifier,
+		AuditLogsRepo:               auditLogsRepo,
+		ReceiptParticipantsRepo:     receiptParticipantsRepo,
+		ReceiptItemAssignmentsRepo:  receiptItemAssignmentsRepo,
+		MaxFileSizeMb:               config.Attachment.MaxFileSize,
+		AllowedFileType:             config.Attachment.AllowedFileType,
+		MaxPerReceipt:               config.Attachment.MaxPerReceipt,
+	})
+	receiptShareService := service.NewReceiptShareService(service.ReceiptShareOpts{
+		ReceiptsRepo:                  receiptsRepo,
+		ReceiptItemsRepo:              receiptItemsRepo,
+		ReceiptSharesRepo:             receiptSharesRepo,
+		ReceiptShareAccessesRepo:      receiptShareAccessesRepo,
+		ReceiptDetectionHistoriesRepo: receiptDetectionHistoriesRepo,
 		ReceiptImagesRepo:             receiptImagesRepo,
+		ReceiptParticipantsRepo:       receiptParticipantsRepo,
+		ReceiptItemAssignmentsRepo:    receiptItemAssignmentsRepo,
+		SigningSecret:                 config.Share.SigningSecret,
+		BaseUrl:                       config.Share.BaseUrl,
+		DefaultTTL:                    time.Duration(config.Share.DefaultTTL),
+		MaxTTL:                        time.Duration(config.Share.MaxTTL),
+	})
+	receiptLineageService := service.NewReceiptLineageService(service.ReceiptLineageOpts{
+		ReceiptsRepo:                  receiptsRepo,
+		ReceiptItemsRepo:              receiptItemsRepo,
+		ReceiptItemAssignmentsRepo:    receiptItemAssignmentsRepo,
+		ReceiptAttachmentsRepo:        receiptAttachmentsRepo,
+		ReceiptTagsRepo:               receiptTagsRepo,
+		ReceiptLineageRepo:            receiptLineageRepo,
+		ReceiptDetectionHistoriesRepo: receiptDetectionHistoriesRepo,
 		CacheRepo:                     cacheRepo,
+		UnitOfWork:                    unitOfWork,
+		ReceiptSearchRepo:             receiptSearchRepo,
+		BudgetsRepo:                   budgetsRepo,
+		BudgetAlertsRepo:              budgetAlertsRepo,
+		SpendingAnalyticsRepo:         spendingAnalyticsRepo,
+		Notifier:                      budgetNotifier,
+		AuditLogsRepo:                 auditLogsRepo,
+		ReceiptParticipantsRepo:       receiptParticipantsRepo,
+	})
+	receiptDuplicateService := service.NewReceiptDuplicateService(service.ReceiptDuplicateOpts{
+		ReceiptsRepo:               receiptsRepo,
+		ReceiptItemsRepo:           receiptItemsRepo,
+		ReceiptDuplicatesRepo:      receiptDuplicatesRepo,
+		CacheRepo:                  cacheRepo,
+		UnitOfWork:                 unitOfWork,
+		ReceiptSearchRepo:          receiptSearchRepo,
+		ReceiptTagsRepo:            receiptTagsRepo,
+		BudgetsRepo:                budgetsRepo,
+		BudgetAlertsRepo:           budgetAlertsRepo,
+		SpendingAnalyticsRepo:      spendingAnalyticsRepo,
+		Notifier:                   budgetNotifier,
+		AuditLogsRepo:              auditLogsRepo,
+		ReceiptParticipantsRepo:    receiptParticipantsRepo,
+		ReceiptItemAssignmentsRepo: receiptItemAssignmentsRepo,
+		Threshold:                  config.Duplicate.Threshold,
+		DateWindow:                 time.Duration(config.Duplicate.DateWindow),
+	})
+	receiptHistoryService := service.NewReceiptHistoryService(service.ReceiptHistoryOpts{
+		AuditLogsRepo: auditLogsRepo,
+	})
+	exchangeRateService := service.NewExchangeRateService(service.ExchangeRateOpts{
+		ExchangeRatesRepo: exchangeRatesRepo,
+		CacheRepo:         cacheRepo,
+		UnitOfWork:        unitOfWork,
+	})
+
+	idempotencyMiddleware := middleware.NewIdempotency(middleware.IdempotencyOpt{
+		IdempotencyKeysRepo: idempotencyKeysRepo,
+		TTL:                 time.Duration(config.Idempotency.TTL),
+		LockTTL:             time.Duration(config.Idempotency.LockTTL),
+		MaxBodySizeMb:       math.Max(config.Ocr.MaxFileSize, config.Attachment.MaxFileSize),
+	})
+	adminKeyMiddleware := middleware.NewAdminKey(middleware.AdminKeyOpt{
+		Key: config.Admin.ApiKey,
 	})
 
 	commonHandler := hHandler.NewCommonHandler(&APP_HEALTHY)
 	receiptDetectionHandler := handler.NewReceiptDetection(receiptDetectionService)
 	receiptHandler := handler.NewReceipt(receiptService)
+	receiptItemHandler := handler.NewReceiptItem(receiptItemService)
+	deviceSettingHandler := handler.NewDeviceSetting(deviceSettingService)
+	receiptImageHandler := handler.NewReceiptImage(receiptImageService)
+	receiptSplitHandler := handler.NewReceiptSplit(receiptSplitService)
+	receiptSettlementHandler := handler.NewReceiptSettlement(receiptSettlementService)
+	receiptExportHandler := handler.NewReceiptExport(receiptExportService)
+	receiptImportHandler := handler.NewReceiptImport(receiptImportService)
+	receiptSearchHandler := handler.NewReceiptSearch(receiptSearchService)
+	spendingAnalyticsHandler := handler.NewSpendingAnalytics(spendingAnalyticsService)
+	budgetHandler := handler.NewBudget(budgetService)
+	exchangeRateHandler := handler.NewExchangeRate(exchangeRateService)
+	tagHandler := handler.NewTag(tagService)
+	receiptAttachmentHandler := handler.NewReceiptAttachment(receiptAttachmentService)
+	receiptShareHandler := handler.NewReceiptShare(receiptShareService)
+	receiptLineageHandler := handler.NewReceiptLineage(receiptLineageService)
+	receiptDuplicateHandler := handler.NewReceiptDuplicate(receiptDuplicateService)
+	receiptHistoryHandler := handler.NewReceiptHistory(receiptHistoryService)
+
+	jobs := []backgroundJob{
+		{
+			name:     "purge-trash",
+			interval: time.Duration(config.Trash.PurgeInterval),
+			run: func(ctx context.Context) error {
+				purged, err := receiptService.PurgeTrash(ctx)
+				if purged > 0 {
+					logrus.Infof("Purged %v trashed receipts", purged)
+				}
 
-	return createRouter(routerOpts{
+				return err
+			},
+		},
+	}
+
+	router := createRouter(routerOpts{
 		common:           commonHandler,
 		receiptDetection: receiptDetectionHandler,
 		receipt:          receiptHandler,
+		receiptItem:      receiptItemHandler,
+		deviceSetting:    deviceSettingHandler,
+		receiptImage:     receiptImageHandler,
+		receiptSplit:     receiptSplitHandler,
+		settlement:       receiptSettlementHandler,
+		receiptExport:    receiptExportHandler,
+		receiptImport:    receiptImportHandler,
+		receiptSearch:    receiptSearchHandler,
+		analytics:        spendingAnalyticsHandler,
+		budget:           budgetHandler,
+		exchangeRate:     exchangeRateHandler,
+		tag:              tagHandler,
+		attachment:       receiptAttachmentHandler,
+		share:            receiptShareHandler,
+		lineage:          receiptLineageHandler,
+		duplicate:        receiptDuplicateHandler,
+		history:          receiptHistoryHandler,
+
+		idempotency: idempotencyMiddleware.Handle(),
+		adminKey:    adminKeyMiddleware.Handle(),
 
 		hash: hashHelper,
 	},
 		config.Cors.AllowedOrigins,
 		config.Storage.Local)
+
+	return router, jobs
 }
 
 func createRouter(opts routerOpts, allowedOrigins []string, localStorageConfig config.LocalStorageConfig) *gin.Engine {
@@ -112,18 +440,35 @@ func createRouter(opts routerOpts, allowedOrigins []string, localStorageConfig c
 		authMiddleware.Auth(),
 		hMiddleware.Logger(logrus.New()),
 		hMiddleware.RequestIdHandlerMiddleware,
+		middleware.RequestIdContext,
 		hMiddleware.ErrorHandlerMiddleware,
 		gin.Recovery(),
 	)
 
 	if localStorageConfig.EnableStaticServer {
-		staticRouting(router, localStorageConfig.ServerStaticPath, localStorageConfig.Directory)
+		staticRouting(router, opts.receiptImage, localStorageConfig.ServerStaticPath)
 	}
 
 	corsRouting(router, corsConfig, allowedOrigins)
 	commonRouting(router, opts.common)
-	receiptDetectionRouting(router, opts.receiptDetection)
-	receiptRouting(router, opts.receipt)
+	receiptDetectionRouting(router, opts.receiptDetection, opts.idempotency)
+	receiptRouting(router, opts.receipt, opts.idempotency)
+	receiptItemRouting(router, opts.receiptItem, opts.idempotency)
+	receiptSplitRouting(router, opts.receiptSplit)
+	receiptSettlementRouting(router, opts.settlement)
+	receiptExportRouting(router, opts.receiptExport)
+	receiptImportRouting(router, opts.receiptImport, opts.idempotency)
+	receiptSearchRouting(router, opts.receiptSearch)
+	spendingAnalyticsRouting(router, opts.analytics)
+	budgetRouting(router, opts.budget, opts.idempotency)
+	tagRouting(router, opts.tag, opts.idempotency)
+	receiptAttachmentRouting(router, opts.attachment, opts.idempotency)
+	receiptShareRouting(router, opts.share, opts.idempotency)
+	receiptLineageRouting(router, opts.lineage, opts.idempotency)
+	receiptDuplicateRouting(router, opts.duplicate)
+	receiptHistoryRouting(router, opts.history)
+	adminRouting(router, opts.exchangeRate, opts.adminKey)
+	deviceSettingRouting(router, opts.deviceSetting)
 
 	return router
 }
@@ -131,8 +476,8 @@ func createRouter(opts routerOpts, allowedOrigins []string, localStorageConfig c
 func corsRouting(router *gin.Engine, corsConfig cors.Config, allowedOrigins []string) {
 	corsConfig.AllowOrigins = allowedOrigins
 	corsConfig.AllowMethods = []string{"POST", "GET", "PUT", "PATCH", "DELETE"}
-	corsConfig.AllowHeaders = []string{"Origin", "Authorization", "Content-Type", "Accept", "User-Agent", "Cache-Control"}
-	corsConfig.ExposeHeaders = []string{"Content-Length"}
+	corsConfig.AllowHeaders = []string{"Origin", "Authorization", "Content-Type", "Accept", "User-Agent", "Cache-Control", middleware.IdempotencyKeyHeader, middleware.AdminKeyHeader}
+	corsConfig.ExposeHeaders = []string{"Content-Length", middleware.IdempotentReplayedHeader}
 	corsConfig.AllowCredentials = true
 	router.Use(cors.New(corsConfig))
 }
@@ -142,21 +487,159 @@ func commonRouting(router *gin.Engine, handler *hHandler.CommonHandler) {
 	router.NoRoute(handler.NoRoute)
 }
 
-func staticRouting(router *gin.Engine, localStorageStaticPath, localStorageDirectory string) {
-	router.Static(localStorageStaticPath, localStorageDirectory)
+func staticRouting(router *gin.Engine, handler *handler.ReceiptImage, localStorageStaticPath string) {
+	router.GET(localStorageStaticPath+"/*filepath", handler.GetSignedImage)
 }
 
-func receiptDetectionRouting(router *gin.Engine, handler *handler.ReceiptDetection) {
+func receiptDetectionRouting(router *gin.Engine, handler *handler.ReceiptDetection, idempotency gin.HandlerFunc) {
 	receiptDetectionRouter := router.Group("/receipt/detect")
 
-	receiptDetectionRouter.POST("", handler.DetectReceipt)
+	receiptDetectionRouter.POST("", idempotency, handler.DetectReceipt)
 	receiptDetectionRouter.GET("/:result_id", handler.GetByResultId)
 }
 
-func receiptRouting(router *gin.Engine, handler *handler.Receipt) {
+func receiptRouting(router *gin.Engine, handler *handler.Receipt, idempotency gin.HandlerFunc) {
 	receiptRouter := router.Group("/receipt")
 
-	receiptRouter.POST("", handler.Create)
+	receiptRouter.POST("", idempotency, handler.Create)
+	receiptRouter.GET("", handler.List)
 	receiptRouter.GET("/:receipt_id", handler.GetByReceiptId)
+	receiptRouter.GET("/trash", handler.ListTrash)
 	receiptRouter.PATCH("/:receipt_id", handler.UpdateReceipt)
+	receiptRouter.DELETE("/:receipt_id", handler.Delete)
+	receiptRouter.POST("/:receipt_id/restore", handler.Restore)
+}
+
+func receiptItemRouting(router *gin.Engine, handler *handler.ReceiptItem, idempotency gin.HandlerFunc) {
+	receiptItemRouter := router.Group("/receipt/:receipt_id/items")
+
+	receiptItemRouter.POST("", idempotency, handler.Add)
+	receiptItemRouter.PUT("/order", handler.Reorder)
+	receiptItemRouter.PATCH("/:receipt_item_id", handler.Update)
+	receiptItemRouter.DELETE("/:receipt_item_id", handler.Delete)
+}
+
+func receiptSplitRouting(router *gin.Engine, handler *handler.ReceiptSplit) {
+	receiptRouter := router.Group("/receipt/:receipt_id")
+
+	receiptRouter.GET("/participants", handler.ListParticipants)
+	receiptRouter.POST("/participants", handler.AddParticipant)
+	receiptRouter.DELETE("/participants/:participant_id", handler.DeleteParticipant)
+	receiptRouter.PUT("/items/:receipt_item_id/assignments", handler.SetItemAssignments)
+	receiptRouter.GET("/split", handler.GetSplit)
+}
+
+func receiptSettlementRouting(router *gin.Engine, handler *handler.ReceiptSettlement) {
+	router.POST("/receipt/settle-up", handler.SettleUp)
+
+	receiptRouter := router.Group("/receipt/:receipt_id")
+
+	receiptRouter.PUT("/payer", handler.SetPayer)
+	receiptRouter.GET("/payments", handler.ListPayments)
+	receiptRouter.POST("/payments", handler.AddPayment)
+	receiptRouter.DELETE("/payments/:payment_id", handler.DeletePayment)
+	receiptRouter.GET("/balance", handler.GetBalance)
+}
+
+func receiptExportRouting(router *gin.Engine, handler *handler.ReceiptExport) {
+	router.GET("/receipt/export", handler.Export)
+	router.GET("/receipt/export/ledger", handler.ExportLedger)
+}
+
+func receiptImportRouting(router *gin.Engine, handler *handler.ReceiptImport, idempotency gin.HandlerFunc) {
+	router.POST("/receipt/import", idempotency, handler.Import)
+}
+
+func receiptSearchRouting(router *gin.Engine, handler *handler.ReceiptSearch) {
+	router.GET("/receipt/search", handler.Search)
+}
+
+func spendingAnalyticsRouting(router *gin.Engine, handler *handler.SpendingAnalytics) {
+	analyticsRouter := router.Group("/analytics/spending")
+
+	analyticsRouter.GET("/categories", handler.Categories)
+	analyticsRouter.GET("/merchants", handler.Merchants)
+	analyticsRouter.GET("/currencies", handler.Currencies)
+	analyticsRouter.GET("/timeseries", handler.Timeseries)
+}
+
+func budgetRouting(router *gin.Engine, handler *handler.Budget, idempotency gin.HandlerFunc) {
+	budgetRouter := router.Group("/budget")
+
+	budgetRouter.POST("", idempotency, handler.Create)
+	budgetRouter.GET("", handler.List)
+	budgetRouter.GET("/status", handler.ListStatus)
+	budgetRouter.GET("/:budget_id/status", handler.GetStatus)
+	budgetRouter.PATCH("/:budget_id", handler.Update)
+	budgetRouter.DELETE("/:budget_id", handler.Delete)
+}
+
+func tagRouting(router *gin.Engine, handler *handler.Tag, idempotency gin.HandlerFunc) {
+	tagRouter := router.Group("/tag")
+
+	tagRouter.POST("", idempotency, handler.Create)
+	tagRouter.GET("", handler.List)
+	tagRouter.PATCH("/:tag_id", handler.Update)
+	tagRouter.DELETE("/:tag_id", handler.Delete)
+
+	receiptRouter := router.Group("/receipt/:receipt_id")
+
+	receiptRouter.PUT("/tags", handler.SetReceiptTags)
+	receiptRouter.DELETE("/tags/:tag_id", handler.RemoveReceiptTag)
+}
+
+func receiptAttachmentRouting(router *gin.Engine, handler *handler.ReceiptAttachment, idempotency gin.HandlerFunc) {
+	attachmentRouter := router.Group("/receipt/:receipt_id/attachments")
+
+	attachmentRouter.POST("", idempotency, handler.Upload)
+	attachmentRouter.GET("", handler.List)
+	attachmentRouter.PUT("/order", handler.Reorder)
+	attachmentRouter.DELETE("/:attachment_id", handler.Delete)
+}
+
+func receiptShareRouting(router *gin.Engine, handler *handler.ReceiptShare, idempotency gin.HandlerFunc) {
+	shareRouter := router.Group("/receipt/:receipt_id/shares")
+
+	shareRouter.POST("", idempotency, handler.Create)
+	shareRouter.GET("", handler.List)
+	shareRouter.DELETE("/:share_id", handler.Revoke)
+	shareRouter.GET("/:share_id/accesses", handler.ListAccesses)
+
+	router.GET("/share/:token", handler.GetShared)
+}
+
+func receiptLineageRouting(router *gin.Engine, handler *handler.ReceiptLineage, idempotency gin.HandlerFunc) {
+	receiptRouter := router.Group("/receipt")
+
+	receiptRouter.POST("/merge", idempotency, handler.Merge)
+	receiptRouter.POST("/:receipt_id/split-off", idempotency, handler.Split)
+	receiptRouter.GET("/:receipt_id/lineage", handler.List)
+}
+
+func receiptDuplicateRouting(router *gin.Engine, handler *handler.ReceiptDuplicate) {
+	duplicateRouter := router.Group("/receipt/duplicates")
+
+	duplicateRouter.GET("", handler.List)
+	duplicateRouter.PATCH("/:duplicate_id", handler.Resolve)
+}
+
+func receiptHistoryRouting(router *gin.Engine, handler *handler.ReceiptHistory) {
+	receiptRouter := router.Group("/receipt")
+
+	receiptRouter.GET("/:receipt_id/history", handler.Get)
+}
+
+func adminRouting(router *gin.Engine, handler *handler.ExchangeRate, adminKey gin.HandlerFunc) {
+	adminRouter := router.Group("/admin", adminKey)
+
+	adminRouter.GET("/exchange-rates", handler.List)
+	adminRouter.POST("/exchange-rates", handler.Upsert)
+	adminRouter.POST("/exchange-rates/import", handler.Import)
+}
+
+func deviceSettingRouting(router *gin.Engine, handler *handler.DeviceSetting) {
+	deviceSettingRouter := router.Group("/device/settings")
+
+	deviceSettingRouter.GET("", handler.GetSetting)
+	deviceSettingRouter.PUT("", handler.UpdateSetting)
 }
@@ -21,7 +21,10 @@ func Init() {
 
 	log.Init(config.LogLevel)
 
-	router := newRouter(&config)
+	router, jobs := newRouter(&config)
+
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	startJobs(jobCtx, jobs)
 
 	srv := http.Server{
 		Handler: router,
@@ -47,6 +50,8 @@ func Init() {
 
 	APP_HEALTHY = false
 
+	stopJobs()
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.GracefulPeriod))
 	defer cancel()
 
@@ -0,0 +1,412 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+	"sort"
+	"strconv"
+
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+)
+
+// receiptSnapshot is the live state of a receipt, its items, tags, split
+// participants and item assignments. The receipt is nil when it does not exist
+// or is in the trash.
+type receiptSnapshot struct {
+	receiptId    int64
+	receipt      *entity.Receipt
+	receiptItems []entity.ReceiptItem
+	tagIds       []int64
+	participants []entity.ReceiptParticipant
+	assignments  []entity.ReceiptItemAssignment
+}
+
+// auditLogger writes the audit log. Callers take a snapshot before a change
+// and record it after the change in the same transaction, so an entry exists
+// exactly when the change was committed.
+type auditLogger struct {
+	receiptsRepo               repository.Receipts
+	receiptItemsRepo           repository.ReceiptItems
+	receiptTagsRepo            repository.ReceiptTags
+	receiptParticipantsRepo    repository.ReceiptParticipants
+	receiptItemAssignmentsRepo repository.ReceiptItemAssignments
+	auditLogsRepo              repository.AuditLogs
+
+	logTag string
+}
+
+func newAuditLogger(receiptsRepo repository.Receipts, receiptItemsRepo repository.ReceiptItems, receiptTagsRepo repository.ReceiptTags, receiptParticipantsRepo repository.ReceiptParticipants, receiptItemAssignmentsRepo repository.ReceiptItemAssignments, auditLogsRepo repository.AuditLogs) *auditLogger {
+	return &auditLogger{
+		receiptsRepo:               receiptsRepo,
+		receiptItemsRepo:           receiptItemsRepo,
+		receiptTagsRepo:            receiptTagsRepo,
+		receiptParticipantsRepo:    receiptParticipantsRepo,
+		receiptItemAssignmentsRepo: receiptItemAssignmentsRepo,
+		auditLogsRepo:              auditLogsRepo,
+
+		logTag: "[service][auditLogger]",
+	}
+}
+
+func actorDeviceId(ctx context.Context) string {
+	deviceId, _ := ctx.Value(hAppconstant.DeviceIdKey).(string)
+	return deviceId
+}
+
+func marshalAuditData(value any) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(value)
+}
+
+func newAuditEntry(ctx context.Context, deviceId, entityType, entityId string, receiptId *int64, operation string, before, after any) (*entity.AuditLog, error) {
+	beforeData, err := marshalAuditData(before)
+	if err != nil {
+		return nil, err
+	}
+
+	afterData, err := marshalAuditData(after)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.AuditLog{
+		DeviceId:   deviceId,
+		RequestId:  helper.RequestIdFromContext(ctx),
+		EntityType: entityType,
+		EntityId:   entityId,
+		ReceiptId:  receiptId,
+		Operation:  operation,
+		BeforeData: beforeData,
+		AfterData:  afterData,
+	}, nil
+}
+
+func insertAuditEntries(ctx context.Context, tx *sql.Tx, logTag string, auditLogsRepo repository.AuditLogs, entries []entity.AuditLog) error {
+	err := auditLogsRepo.NewTx(tx).InsertMany(ctx, entries)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[auditLogsRepo.InsertMany] Failed to write audit log: %v", logTag, err),
+		})
+	}
+
+	return nil
+}
+
+func (a *auditLogger) snapshot(ctx context.Context, tx *sql.Tx, logTag string, receiptId int64) (receiptSnapshot, error) {
+	snapshot := receiptSnapshot{
+		receiptId: receiptId,
+	}
+
+	receipt, err := a.receiptsRepo.NewTx(tx).GetByReceiptId(ctx, receiptId, actorDeviceId(ctx))
+	if err != nil {
+		return snapshot, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptsRepo.GetByReceiptId] Failed to get receipt for audit: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	receiptItems, err := a.receiptItemsRepo.NewTx(tx).GetByReceiptId(ctx, receiptId)
+	if err != nil {
+		return snapshot, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptItemsRepo.GetByReceiptId] Failed to get receipt items for audit: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	receiptTags, err := a.receiptTagsRepo.NewTx(tx).GetByReceiptIds(ctx, []int64{receiptId})
+	if err != nil {
+		return snapshot, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptTagsRepo.GetByReceiptIds] Failed to get receipt tags for audit: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	participants, err := a.receiptParticipantsRepo.NewTx(tx).GetByReceiptId(ctx, receiptId)
+	if err != nil {
+		return snapshot, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptParticipantsRepo.GetByReceiptId] Failed to get participants for audit: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	assignments, err := a.receiptItemAssignmentsRepo.NewTx(tx).GetByReceiptId(ctx, receiptId)
+	if err != nil {
+		return snapshot, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptItemAssignmentsRepo.GetByReceiptId] Failed to get assignments for audit: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	// Tag ids are sorted so that the same set always encodes the same way.
+	tagIds := []int64{}
+	for _, receiptTag := range receiptTags {
+		tagIds = append(tagIds, receiptTag.Tag.TagId)
+	}
+
+	sort.Slice(tagIds, func(i, j int) bool {
+		return tagIds[i] < tagIds[j]
+	})
+
+	snapshot.receipt = receipt
+	snapshot.receiptItems = receiptItems
+	snapshot.tagIds = tagIds
+	snapshot.participants = participants
+	snapshot.assignments = assignments
+
+	return snapshot, nil
+}
+
+// assignmentsByItem groups assignments by item. Items without assignments are
+// left out.
+func assignmentsByItem(assignments []entity.ReceiptItemAssignment) map[int64][]entity.ReceiptItemAssignment {
+	grouped := map[int64][]entity.ReceiptItemAssignment{}
+
+	for _, assignment := range assignments {
+		grouped[assignment.ReceiptItemId] = append(grouped[assignment.ReceiptItemId], assignment)
+	}
+
+	for _, itemAssignments := range grouped {
+		sort.Slice(itemAssignments, func(i, j int) bool {
+			return itemAssignments[i].ParticipantId < itemAssignments[j].ParticipantId
+		})
+	}
+
+	return grouped
+}
+
+// record compares the snapshot taken before the change with the current state
+// and writes one entry for the receipt and one per item that changed. Nothing
+// is written when the receipt is not a live receipt of the actor on either
+// side, since the actor can not have changed it.
+func (a *auditLogger) record(ctx context.Context, tx *sql.Tx, logTag, operation string, before receiptSnapshot) error {
+	after, err := a.snapshot(ctx, tx, logTag, before.receiptId)
+	if err != nil {
+		return err
+	}
+
+	if before.receipt == nil && after.receipt == nil {
+		return nil
+	}
+
+	deviceId := actorDeviceId(ctx)
+	receiptId := before.receiptId
+	entries := []entity.AuditLog{}
+
+	appendEntry := func(entityType, entityId string, beforeValue, afterValue any) error {
+		entry, err := newAuditEntry(ctx, deviceId, entityType, entityId, &receiptId, operation, beforeValue, afterValue)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[newAuditEntry] Failed to encode audit entry: %v [receipt_id: %v]", logTag, err, receiptId),
+			})
+		}
+
+		if !bytes.Equal(entry.BeforeData, entry.AfterData) {
+			entries = append(entries, *entry)
+		}
+
+		return nil
+	}
+
+	var beforeReceipt, afterReceipt any
+	if before.receipt != nil {
+		beforeReceipt = before.receipt
+	}
+	if after.receipt != nil {
+		afterReceipt = after.receipt
+	}
+
+	err = appendEntry(entity.AuditEntityReceipt, strconv.FormatInt(receiptId, 10), beforeReceipt, afterReceipt)
+	if err != nil {
+		return err
+	}
+
+	beforeItems := map[int64]entity.ReceiptItem{}
+	for _, receiptItem := range before.receiptItems {
+		beforeItems[receiptItem.ReceiptItemId] = receiptItem
+	}
+
+	for _, receiptItem := range after.receiptItems {
+		var beforeItem any
+		if previous, ok := beforeItems[receiptItem.ReceiptItemId]; ok {
+			beforeItem = previous
+			delete(beforeItems, receiptItem.ReceiptItemId)
+		}
+
+		err = appendEntry(entity.AuditEntityReceiptItem, strconv.FormatInt(receiptItem.ReceiptItemId, 10), beforeItem, receiptItem)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, receiptItem := range before.receiptItems {
+		if _, ok := beforeItems[receiptItem.ReceiptItemId]; !ok {
+			continue
+		}
+
+		err = appendEntry(entity.AuditEntityReceiptItem, strconv.FormatInt(receiptItem.ReceiptItemId, 10), receiptItem, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = appendEntry(entity.AuditEntityReceiptTags, strconv.FormatInt(receiptId, 10), before.tagIds, after.tagIds)
+	if err != nil {
+		return err
+	}
+
+	beforeParticipants := map[int64]entity.ReceiptParticipant{}
+	for _, participant := range before.participants {
+		beforeParticipants[participant.ParticipantId] = participant
+	}
+
+	for _, participant := range after.participants {
+		var beforeParticipant any
+		if previous, ok := beforeParticipants[participant.ParticipantId]; ok {
+			beforeParticipant = previous
+			delete(beforeParticipants, participant.ParticipantId)
+		}
+
+		err = appendEntry(entity.AuditEntityReceiptParticipant, strconv.FormatInt(participant.ParticipantId, 10), beforeParticipant, participant)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, participant := range before.participants {
+		if _, ok := beforeParticipants[participant.ParticipantId]; !ok {
+			continue
+		}
+
+		err = appendEntry(entity.AuditEntityReceiptParticipant, strconv.FormatInt(participant.ParticipantId, 10), participant, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	beforeAssignments := assignmentsByItem(before.assignments)
+	afterAssignments := assignmentsByItem(after.assignments)
+
+	receiptItemIds := []int64{}
+	for receiptItemId := range afterAssignments {
+		receiptItemIds = append(receiptItemIds, receiptItemId)
+	}
+	for receiptItemId := range beforeAssignments {
+		if _, ok := afterAssignments[receiptItemId]; !ok {
+			receiptItemIds = append(receiptItemIds, receiptItemId)
+		}
+	}
+
+	sort.Slice(receiptItemIds, func(i, j int) bool {
+		return receiptItemIds[i] < receiptItemIds[j]
+	})
+
+	for _, receiptItemId := range receiptItemIds {
+		var beforeValue, afterValue any
+		if itemAssignments, ok := beforeAssignments[receiptItemId]; ok {
+			beforeValue = itemAssignments
+		}
+		if itemAssignments, ok := afterAssignments[receiptItemId]; ok {
+			afterValue = itemAssignments
+		}
+
+		err = appendEntry(entity.AuditEntityReceiptItemAssignments, strconv.FormatInt(receiptItemId, 10), beforeValue, afterValue)
+		if err != nil {
+			return err
+		}
+	}
+
+	return insertAuditEntries(ctx, tx, logTag, a.auditLogsRepo, entries)
+}
+
+func (a *auditLogger) snapshotMany(ctx context.Context, tx *sql.Tx, logTag string, receiptIds []int64) ([]receiptSnapshot, error) {
+	snapshots := []receiptSnapshot{}
+
+	for _, receiptId := range receiptIds {
+		snapshot, err := a.snapshot(ctx, tx, logTag, receiptId)
+		if err != nil {
+			return nil, err
+		}
+
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, nil
+}
+
+// recordMany records a change that spans several receipts, such as items
+// moving between them.
+func (a *auditLogger) recordMany(ctx context.Context, tx *sql.Tx, logTag, operation string, before []receiptSnapshot) error {
+	for _, snapshot := range before {
+		err := a.record(ctx, tx, logTag, operation, snapshot)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordPurge writes the entries of receipts removed for good by the trash
+// purge. It runs outside of a request, so the owning device is the actor.
+func (a *auditLogger) recordPurge(ctx context.Context, tx *sql.Tx, logTag string, receipts []entity.Receipt, histories []entity.ReceiptDetectionHistory) error {
+	entries := []entity.AuditLog{}
+
+	for _, receipt := range receipts {
+		receiptId := receipt.ReceiptId
+
+		entry, err := newAuditEntry(ctx, receipt.DeviceId, entity.AuditEntityReceipt, strconv.FormatInt(receiptId, 10), &receiptId, entity.AuditOperationPurge, receipt, nil)
+		if err != nil {
+			return fmt.Errorf("%s[newAuditEntry] Failed to encode audit entry: %w [receipt_id: %v]", logTag, err, receiptId)
+		}
+
+		entries = append(entries, *entry)
+	}
+
+	for _, history := range histories {
+		entry, err := newAuditEntry(ctx, history.DeviceId, entity.AuditEntityDetectionHistory, history.ResultId, nil, entity.AuditOperationPurge, history, nil)
+		if err != nil {
+			return fmt.Errorf("%s[newAuditEntry] Failed to encode audit entry: %w [result_id: %s]", logTag, err, history.ResultId)
+		}
+
+		entries = append(entries, *entry)
+	}
+
+	err := a.auditLogsRepo.NewTx(tx).InsertMany(ctx, entries)
+	if err != nil {
+		return fmt.Errorf("%s[auditLogsRepo.InsertMany] Failed to write audit log: %w", logTag, err)
+	}
+
+	return nil
+}
+
+// recordDetectionHistory writes the entry of a detection history change. It
+// must run in the same transaction as the change.
+func recordDetectionHistory(ctx context.Context, tx *sql.Tx, logTag string, auditLogsRepo repository.AuditLogs, operation string, before, after *entity.ReceiptDetectionHistory) error {
+	var (
+		beforeValue, afterValue any
+		resultId                string
+	)
+
+	if before != nil {
+		beforeValue = before
+		resultId = before.ResultId
+	}
+	if after != nil {
+		afterValue = after
+		resultId = after.ResultId
+	}
+
+	entry, err := newAuditEntry(ctx, actorDeviceId(ctx), entity.AuditEntityDetectionHistory, resultId, nil, operation, beforeValue, afterValue)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[newAuditEntry] Failed to encode audit entry: %v [result_id: %s]", logTag, err, resultId),
+		})
+	}
+
+	return insertAuditEntries(ctx, tx, logTag, auditLogsRepo, []entity.AuditLog{*entry})
+}
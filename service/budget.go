@@ -0,0 +1,467 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"receipt-detector/entity"
+	"receipt-detector/external/notifier"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+	"strings"
+	"time"
+
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+func budgetInterval(period string) string {
+	if period == entity.BudgetPeriodWeekly {
+		return entity.SpendingIntervalWeek
+	}
+
+	return entity.SpendingIntervalMonth
+}
+
+// budgetEvaluator checks the budgets of a device against its spending in the
+// current period and raises an alert the first time a threshold is crossed.
+// Services that change receipts call evaluate once their transaction has
+// committed.
+type budgetEvaluator struct {
+	budgetsRepo           repository.Budgets
+	budgetAlertsRepo      repository.BudgetAlerts
+	spendingAnalyticsRepo repository.SpendingAnalytics
+	notifier              notifier.Notifier
+
+	logTag string
+}
+
+func newBudgetEvaluator(budgetsRepo repository.Budgets, budgetAlertsRepo repository.BudgetAlerts, spendingAnalyticsRepo repository.SpendingAnalytics, budgetNotifier notifier.Notifier) *budgetEvaluator {
+	return &budgetEvaluator{
+		budgetsRepo:           budgetsRepo,
+		budgetAlertsRepo:      budgetAlertsRepo,
+		spendingAnalyticsRepo: spendingAnalyticsRepo,
+		notifier:              budgetNotifier,
+
+		logTag: "[service][budgetEvaluator]",
+	}
+}
+
+// status computes how much of the budget has been spent in the period that
+// contains now. The projection extrapolates the daily spending so far over the
+// whole period.
+func (s *budgetEvaluator) status(ctx context.Context, budget entity.Budget, now time.Time) (entity.BudgetStatus, error) {
+	location, err := time.LoadLocation(budget.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	interval := budgetInterval(budget.Period)
+
+	start := truncateToInterval(now.In(location), interval)
+	end := nextInterval(start, interval)
+
+	breakdown, err := s.spendingAnalyticsRepo.GetBreakdown(ctx, entity.SpendingFilter{
+		DeviceId: budget.DeviceId,
+		DateFrom: start.UnixMilli(),
+		DateTo:   end.UnixMilli(),
+		Category: budget.Category,
+		Currency: budget.Currency,
+		GroupBy:  entity.SpendingGroupByCategory,
+		Limit:    1,
+	})
+	if err != nil {
+		return entity.BudgetStatus{}, fmt.Errorf("[spendingAnalyticsRepo.GetBreakdown] %w", err)
+	}
+
+	var spent int64
+	for _, row := range breakdown {
+		spent += helper.ToMinorUnits(row.Total, budget.Currency)
+	}
+
+	amount := helper.ToMinorUnits(budget.Amount, budget.Currency)
+
+	elapsedDays := max(math.Ceil(now.Sub(start).Hours()/24), 1)
+	periodDays := math.Round(end.Sub(start).Hours() / 24)
+	projected := int64(math.Round(float64(spent) / elapsedDays * periodDays))
+
+	// Budgets saved before amounts were checked against the currency can round
+	// to zero, which has no meaningful percentage.
+	var percent float64
+	if amount > 0 {
+		percent = math.Round(float64(spent)/float64(amount)*1000) / 10
+	}
+
+	return entity.BudgetStatus{
+		Budget:      budget,
+		PeriodStart: start.UnixMilli(),
+		PeriodEnd:   end.UnixMilli(),
+		Spent:       helper.FromMinorUnits(spent, budget.Currency),
+		Remaining:   helper.FromMinorUnits(amount-spent, budget.Currency),
+		Projected:   helper.FromMinorUnits(projected, budget.Currency),
+		Percent:     percent,
+	}, nil
+}
+
+// evaluate checks the budgets of the device in the background. Failures are
+// logged since the change that triggered it has already been saved.
+func (s *budgetEvaluator) evaluate(deviceId string) {
+	go func() {
+		c, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		s.evaluateAll(c, deviceId)
+	}()
+}
+
+func (s *budgetEvaluator) evaluateAll(ctx context.Context, deviceId string) {
+	logTag := s.logTag + "[evaluateAll]"
+
+	budgets, err := s.budgetsRepo.GetByDeviceId(ctx, deviceId)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"device_id": deviceId,
+			"error":     err,
+		}).Warnf("%s[budgetsRepo.GetByDeviceId] Failed to get budgets", logTag)
+
+		return
+	}
+
+	now := time.Now()
+
+	for _, budget := range budgets {
+		err = s.evaluateOne(ctx, budget, now)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"device_id": deviceId,
+				"budget_id": budget.BudgetId,
+				"error":     err,
+			}).Warnf("%s[evaluateOne] Failed to evaluate budget", logTag)
+		}
+	}
+}
+
+// evaluateOne records every threshold the budget has reached in the current
+// period. Only the highest newly reached threshold is notified, so a receipt
+// that jumps straight past 100% does not send two alerts at once.
+func (s *budgetEvaluator) evaluateOne(ctx context.Context, budget entity.Budget, now time.Time) error {
+	status, err := s.status(ctx, budget, now)
+	if err != nil {
+		return fmt.Errorf("[status] %w", err)
+	}
+
+	spent := helper.ToMinorUnits(status.Spent, budget.Currency)
+	amount := helper.ToMinorUnits(budget.Amount, budget.Currency)
+	if amount <= 0 {
+		return nil
+	}
+
+	var crossed int
+
+	for _, threshold := range entity.BudgetAlertThresholds {
+		if spent*100 < amount*int64(threshold) {
+			break
+		}
+
+		inserted, err := s.budgetAlertsRepo.InsertOne(ctx, entity.BudgetAlert{
+			BudgetId:    budget.BudgetId,
+			PeriodStart: status.PeriodStart,
+			Threshold:   threshold,
+			Spent:       status.Spent,
+		})
+		if err != nil {
+			return fmt.Errorf("[budgetAlertsRepo.InsertOne] %w", err)
+		}
+
+		if inserted {
+			crossed = threshold
+		}
+	}
+
+	if crossed == 0 {
+		return nil
+	}
+
+	err = s.notifier.NotifyBudgetAlert(ctx, entity.BudgetAlertEvent{
+		Type:       entity.BudgetAlertEventType,
+		DeviceId:   budget.DeviceId,
+		Threshold:  crossed,
+		Status:     status,
+		OccurredAt: now.UnixMilli(),
+	})
+	if err != nil {
+		return fmt.Errorf("[notifier.NotifyBudgetAlert] %w", err)
+	}
+
+	return nil
+}
+
+type budget struct {
+	budgetsRepo     repository.Budgets
+	budgetEvaluator *budgetEvaluator
+
+	defaultTimezone string
+
+	logTag string
+}
+
+type BudgetOpts struct {
+	BudgetsRepo           repository.Budgets
+	BudgetAlertsRepo      repository.BudgetAlerts
+	SpendingAnalyticsRepo repository.SpendingAnalytics
+	Notifier              notifier.Notifier
+}
+
+func NewBudgetService(opts BudgetOpts) *budget {
+	return &budget{
+		budgetsRepo:     opts.BudgetsRepo,
+		budgetEvaluator: newBudgetEvaluator(opts.BudgetsRepo, opts.BudgetAlertsRepo, opts.SpendingAnalyticsRepo, opts.Notifier),
+
+		defaultTimezone: "UTC",
+
+		logTag: "[service][budget]",
+	}
+}
+
+func (s *budget) validateTimezone(logTag, timezone string) error {
+	_, err := time.LoadLocation(timezone)
+	if err != nil {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s[time.LoadLocation] Invalid timezone: %v [timezone: %s]", logTag, err, timezone),
+			ResponseMessage: "timezone must be an IANA time zone, e.g. Asia/Jakarta",
+		})
+	}
+
+	return nil
+}
+
+// validateAmount rejects amounts below the smallest unit of the currency and
+// returns the amount rounded to it.
+func (s *budget) validateAmount(logTag string, amount float64, currency string) (float64, error) {
+	minor := helper.ToMinorUnits(amount, currency)
+	if minor < 1 {
+		return 0, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Amount below minor unit: %v [currency: %s]", logTag, amount, currency),
+			ResponseMessage: fmt.Sprintf("amount must be at least %s %s", helper.FormatCurrency(helper.FromMinorUnits(1, currency), currency), currency),
+		})
+	}
+
+	return helper.FromMinorUnits(minor, currency), nil
+}
+
+func (s *budget) getBudget(ctx context.Context, logTag string, budgetId int64) (*entity.Budget, error) {
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	budget, err := s.budgetsRepo.GetByBudgetId(ctx, budgetId, deviceId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[budgetsRepo.GetByBudgetId] Failed to get budget: %v [budget_id: %v]", logTag, err, budgetId),
+		})
+	}
+	if budget == nil {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusNotFound,
+			ResponseMessage: "Budget not found",
+		})
+	}
+
+	return budget, nil
+}
+
+func (s *budget) Create(ctx context.Context, req entity.CreateBudgetRequest) (*entity.CreateBudgetResponse, error) {
+	logTag := s.logTag + "[Create]"
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	category := strings.ToLower(strings.TrimSpace(req.Category))
+	if category == "" {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Empty category", logTag),
+			ResponseMessage: "category must not be empty",
+		})
+	}
+
+	if !helper.IsKnownCurrency(req.Currency) {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Unknown currency: %s", logTag, req.Currency),
+			ResponseMessage: fmt.Sprintf("Unknown currency code %s", req.Currency),
+		})
+	}
+
+	currency := helper.NormalizeCurrency(req.Currency)
+
+	amount, err := s.validateAmount(logTag, *req.Amount, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Timezone == "" {
+		req.Timezone = s.defaultTimezone
+	}
+
+	err = s.validateTimezone(logTag, req.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	budgetId, err := s.budgetsRepo.InsertOne(ctx, entity.Budget{
+		DeviceId: deviceId,
+		Category: category,
+		Period:   req.Period,
+		Currency: currency,
+		Amount:   amount,
+		Timezone: req.Timezone,
+	})
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[budgetsRepo.InsertOne] Failed to insert budget: %v [category: %s]", logTag, err, category),
+		})
+	}
+	if budgetId == 0 {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusConflict,
+			Message:         fmt.Sprintf("%s Budget already exists [category: %s][period: %s][currency: %s]", logTag, category, req.Period, req.Currency),
+			ResponseMessage: "A budget for this category, period and currency already exists",
+		})
+	}
+
+	s.budgetEvaluator.evaluate(deviceId)
+
+	return &entity.CreateBudgetResponse{
+		BudgetId: budgetId,
+	}, nil
+}
+
+func (s *budget) List(ctx context.Context) (*entity.ListBudgetsResponse, error) {
+	logTag := s.logTag + "[List]"
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	budgets, err := s.budgetsRepo.GetByDeviceId(ctx, deviceId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[budgetsRepo.GetByDeviceId] Failed to get budgets: %v", logTag, err),
+		})
+	}
+
+	return &entity.ListBudgetsResponse{
+		Budgets: budgets,
+	}, nil
+}
+
+func (s *budget) Update(ctx context.Context, req entity.UpdateBudgetRequest) error {
+	logTag := s.logTag + "[Update]"
+
+	req.DeviceId = ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	if req.Timezone != nil {
+		err := s.validateTimezone(logTag, *req.Timezone)
+		if err != nil {
+			return err
+		}
+	}
+
+	if req.Amount != nil {
+		budget, err := s.getBudget(ctx, logTag, req.BudgetId)
+		if err != nil {
+			return err
+		}
+
+		amount, err := s.validateAmount(logTag, *req.Amount, budget.Currency)
+		if err != nil {
+			return err
+		}
+
+		req.Amount = &amount
+	}
+
+	updated, err := s.budgetsRepo.UpdateOne(ctx, req)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[budgetsRepo.UpdateOne] Failed to update budget: %v [budget_id: %v]", logTag, err, req.BudgetId),
+		})
+	}
+	if !updated {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusNotFound,
+			ResponseMessage: "Budget not found",
+		})
+	}
+
+	s.budgetEvaluator.evaluate(req.DeviceId)
+
+	return nil
+}
+
+func (s *budget) Delete(ctx context.Context, budgetId int64) error {
+	logTag := s.logTag + "[Delete]"
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	deleted, err := s.budgetsRepo.SoftDeleteOne(ctx, budgetId, deviceId)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[budgetsRepo.SoftDeleteOne] Failed to delete budget: %v [budget_id: %v]", logTag, err, budgetId),
+		})
+	}
+	if !deleted {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusNotFound,
+			ResponseMessage: "Budget not found",
+		})
+	}
+
+	return nil
+}
+
+func (s *budget) GetStatus(ctx context.Context, budgetId int64) (*entity.BudgetStatus, error) {
+	logTag := s.logTag + "[GetStatus]"
+
+	budget, err := s.getBudget(ctx, logTag, budgetId)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := s.budgetEvaluator.status(ctx, *budget, time.Now())
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[budgetEvaluator.status] Failed to get budget status: %v [budget_id: %v]", logTag, err, budgetId),
+		})
+	}
+
+	return &status, nil
+}
+
+func (s *budget) ListStatus(ctx context.Context) (*entity.ListBudgetStatusResponse, error) {
+	logTag := s.logTag + "[ListStatus]"
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	budgets, err := s.budgetsRepo.GetByDeviceId(ctx, deviceId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[budgetsRepo.GetByDeviceId] Failed to get budgets: %v", logTag, err),
+		})
+	}
+
+	res := entity.ListBudgetStatusResponse{
+		Budgets: make([]entity.BudgetStatus, 0, len(budgets)),
+	}
+
+	now := time.Now()
+
+	for _, budget := range budgets {
+		status, err := s.budgetEvaluator.status(ctx, budget, now)
+		if err != nil {
+			return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[budgetEvaluator.status] Failed to get budget status: %v [budget_id: %v]", logTag, err, budget.BudgetId),
+			})
+		}
+
+		res.Budgets = append(res.Budgets, status)
+	}
+
+	return &res, nil
+}
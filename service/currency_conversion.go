@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+	"time"
+)
+
+// rateDate returns the date whose exchange rate applies to a receipt.
+func rateDate(receiptDate int64) string {
+	return time.UnixMilli(receiptDate).UTC().Format(time.DateOnly)
+}
+
+// currencyConverter converts receipt amounts into the base currency of the
+// device with the exchange rate of the receipt date.
+type currencyConverter struct {
+	deviceSettingsRepo repository.DeviceSettings
+	exchangeRatesRepo  repository.ExchangeRates
+}
+
+func newCurrencyConverter(deviceSettingsRepo repository.DeviceSettings, exchangeRatesRepo repository.ExchangeRates) *currencyConverter {
+	return &currencyConverter{
+		deviceSettingsRepo: deviceSettingsRepo,
+		exchangeRatesRepo:  exchangeRatesRepo,
+	}
+}
+
+// baseCurrency returns the requested currency, falling back to the base
+// currency of the device. It is empty when neither is set.
+func (c *currencyConverter) baseCurrency(ctx context.Context, deviceId, requested string) (string, error) {
+	if requested != "" {
+		return helper.NormalizeCurrency(requested), nil
+	}
+
+	setting, err := c.deviceSettingsRepo.GetByDeviceId(ctx, deviceId)
+	if err != nil {
+		return "", fmt.Errorf("[deviceSettingsRepo.GetByDeviceId] %w", err)
+	}
+	if setting == nil {
+		return "", nil
+	}
+
+	return setting.BaseCurrency, nil
+}
+
+// convertReceipts sets the converted total of every receipt and the converted
+// price of every item. Receipts and items are left unconverted when the
+// device has no base currency or a rate is missing.
+func (c *currencyConverter) convertReceipts(ctx context.Context, deviceId string, receipts []entity.Receipt, receiptItems []entity.ReceiptItem) error {
+	baseCurrency, err := c.baseCurrency(ctx, deviceId, "")
+	if err != nil {
+		return err
+	}
+	if baseCurrency == "" {
+		return nil
+	}
+
+	rateDates := map[int64]string{}
+	lookups := []entity.ExchangeRateLookup{}
+
+	for _, receipt := range receipts {
+		rateDates[receipt.ReceiptId] = rateDate(receipt.ReceiptDate)
+
+		if receipt.Summary == nil {
+			continue
+		}
+
+		for _, currencySummary := range receipt.Summary.Currencies {
+			lookups = append(lookups, entity.ExchangeRateLookup{
+				Currency: currencySummary.Currency,
+				RateDate: rateDates[receipt.ReceiptId],
+			})
+		}
+	}
+
+	for _, receiptItem := range receiptItems {
+		if _, ok := rateDates[receiptItem.ReceiptId]; !ok {
+			continue
+		}
+
+		lookups = append(lookups, entity.ExchangeRateLookup{
+			Currency: helper.NormalizeCurrency(receiptItem.ItemPriceCurrency),
+			RateDate: rateDates[receiptItem.ReceiptId],
+		})
+	}
+
+	if len(lookups) == 0 {
+		return nil
+	}
+
+	rates, err := c.exchangeRatesRepo.GetRates(ctx, baseCurrency, lookups)
+	if err != nil {
+		return fmt.Errorf("[exchangeRatesRepo.GetRates] %w", err)
+	}
+
+	for i := range receipts {
+		receipt := &receipts[i]
+
+		if receipt.Summary == nil || len(receipt.Summary.Currencies) == 0 {
+			continue
+		}
+
+		var (
+			total     int64
+			converted = true
+		)
+
+		for _, currencySummary := range receipt.Summary.Currencies {
+			rate, ok := rates[entity.ExchangeRateLookup{
+				Currency: currencySummary.Currency,
+				RateDate: rateDates[receipt.ReceiptId],
+			}]
+			if !ok {
+				converted = false
+				break
+			}
+
+			total += helper.ToMinorUnits(currencySummary.Total*rate, baseCurrency)
+		}
+
+		if converted {
+			receipt.Converted = &entity.ConvertedAmount{
+				Currency: baseCurrency,
+				Amount:   helper.FromMinorUnits(total, baseCurrency),
+			}
+		}
+	}
+
+	for i := range receiptItems {
+		receiptItem := &receiptItems[i]
+
+		rate, ok := rates[entity.ExchangeRateLookup{
+			Currency: helper.NormalizeCurrency(receiptItem.ItemPriceCurrency),
+			RateDate: rateDates[receiptItem.ReceiptId],
+		}]
+		if !ok {
+			continue
+		}
+
+		receiptItem.Converted = &entity.ConvertedAmount{
+			Currency: baseCurrency,
+			Amount:   helper.FromMinorUnits(helper.ToMinorUnits(receiptItem.ItemPriceNumeric*rate, baseCurrency), baseCurrency),
+			Rate:     &rate,
+		}
+	}
+
+	return nil
+}
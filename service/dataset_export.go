@@ -0,0 +1,266 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+	"time"
+
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+type datasetExport struct {
+	receiptDetectionHistoriesRepo repository.ReceiptDetectionHistories
+	receiptDetectionResultsRepo   repository.ReceiptDetectionResults
+	receiptImagesRepo             repository.ReceiptImages
+
+	batchSize int
+
+	logTag string
+}
+
+type DatasetExportOpts struct {
+	ReceiptDetectionHistoriesRepo repository.ReceiptDetectionHistories
+	ReceiptDetectionResultsRepo   repository.ReceiptDetectionResults
+	ReceiptImagesRepo             repository.ReceiptImages
+}
+
+func NewDatasetExportService(opts DatasetExportOpts) *datasetExport {
+	return &datasetExport{
+		receiptDetectionHistoriesRepo: opts.ReceiptDetectionHistoriesRepo,
+		receiptDetectionResultsRepo:   opts.ReceiptDetectionResultsRepo,
+		receiptImagesRepo:             opts.ReceiptImagesRepo,
+
+		batchSize: 100,
+
+		logTag: "[service][datasetExport]",
+	}
+}
+
+// sampleValue maps a result id to a stable value in [0, 1) so that sampling
+// and splitting do not depend on export order or on the date range.
+func (s *datasetExport) sampleValue(seed, purpose, resultId string) float64 {
+	sum := sha256.Sum256([]byte(seed + ":" + purpose + ":" + resultId))
+
+	return float64(binary.BigEndian.Uint64(sum[:8])) / math.Pow(2, 64)
+}
+
+func (s *datasetExport) validateRequest(req *entity.DatasetExportRequest) error {
+	if req.SampleRatio <= 0 || req.SampleRatio > 1 {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s[validateRequest] Invalid sample ratio: %v", s.logTag, req.SampleRatio),
+			ResponseMessage: "sample_ratio must be greater than 0 and at most 1",
+		})
+	}
+
+	if req.ValidationRatio < 0 || req.ValidationRatio >= 1 {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s[validateRequest] Invalid validation ratio: %v", s.logTag, req.ValidationRatio),
+			ResponseMessage: "validation_ratio must be at least 0 and less than 1",
+		})
+	}
+
+	if req.CreatedFrom != 0 && req.CreatedTo != 0 && req.CreatedFrom >= req.CreatedTo {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s[validateRequest] Invalid date range [created_from: %v][created_to: %v]", s.logTag, req.CreatedFrom, req.CreatedTo),
+			ResponseMessage: "created_from must be before created_to",
+		})
+	}
+
+	if req.Version == "" {
+		req.Version = time.Now().UTC().Format("20060102T150405Z")
+	}
+
+	return nil
+}
+
+func (s *datasetExport) writeJson(archive *zip.Writer, name string, data any) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(w).Encode(data)
+}
+
+// readImage loads the whole image before anything is added to the archive,
+// so an unreadable image never leaves a truncated entry behind.
+func (s *datasetExport) readImage(ctx context.Context, imagePath string) ([]byte, error) {
+	image, err := s.receiptImagesRepo.OpenOne(ctx, imagePath)
+	if err != nil {
+		return nil, err
+	}
+	defer image.Close()
+
+	return io.ReadAll(image)
+}
+
+func (s *datasetExport) writeFile(archive *zip.Writer, name string, data []byte) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+
+	return err
+}
+
+func (s *datasetExport) Export(ctx context.Context, req entity.DatasetExportRequest, w io.Writer) (*entity.DatasetMetadata, error) {
+	logTag := s.logTag + "[Export]"
+
+	err := s.validateRequest(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := entity.DatasetMetadata{
+		Version:         req.Version,
+		CreatedAt:       helper.NowUnixMilli(),
+		CreatedFrom:     req.CreatedFrom,
+		CreatedTo:       req.CreatedTo,
+		SampleRatio:     req.SampleRatio,
+		ValidationRatio: req.ValidationRatio,
+		Seed:            req.Seed,
+	}
+
+	archive := zip.NewWriter(w)
+
+	manifests := map[string][]entity.DatasetManifestEntry{
+		entity.DatasetSplitTrain:      {},
+		entity.DatasetSplitValidation: {},
+	}
+
+	filter := entity.ReceiptDetectionHistoryFilter{
+		CreatedFrom: req.CreatedFrom,
+		CreatedTo:   req.CreatedTo,
+		Limit:       s.batchSize,
+	}
+
+	for {
+		histories, err := s.receiptDetectionHistoriesRepo.GetApprovedRevisions(ctx, filter)
+		if err != nil {
+			return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptDetectionHistoriesRepo.GetApprovedRevisions] Failed to get histories: %v [after_history_id: %v]", logTag, err, filter.AfterHistoryId),
+			})
+		}
+
+		for _, history := range histories {
+			filter.AfterHistoryId = history.HistoryId
+
+			if s.sampleValue(req.Seed, "sample", history.ResultId) >= req.SampleRatio {
+				continue
+			}
+
+			original, err := s.receiptDetectionResultsRepo.GetByResultId(ctx, history.ResultId)
+			if err != nil {
+				return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+					Message: fmt.Sprintf("%s[receiptDetectionResultsRepo.GetByResultId] Failed to get original result: %v [result_id: %s]", logTag, err, history.ResultId),
+				})
+			}
+
+			approved, err := s.receiptDetectionResultsRepo.GetByResultId(ctx, history.RevisionId)
+			if err != nil {
+				return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+					Message: fmt.Sprintf("%s[receiptDetectionResultsRepo.GetByResultId] Failed to get approved revision: %v [revision_id: %s]", logTag, err, history.RevisionId),
+				})
+			}
+
+			if original == nil || approved == nil {
+				logrus.WithFields(logrus.Fields{
+					"result_id":   history.ResultId,
+					"revision_id": history.RevisionId,
+				}).Warnf("%s[MissingResult] Skipping history without stored results", logTag)
+				metadata.SkippedCount++
+				continue
+			}
+
+			imageName := fmt.Sprintf("images/%s%s", history.ResultId, filepath.Ext(history.ImagePath))
+
+			image, err := s.readImage(ctx, history.ImagePath)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"result_id":  history.ResultId,
+					"image_path": history.ImagePath,
+					"error":      err,
+				}).Warnf("%s[s.readImage] Skipping history with unreadable image", logTag)
+				metadata.SkippedCount++
+				continue
+			}
+
+			err = s.writeFile(archive, imageName, image)
+			if err != nil {
+				return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+					Message: fmt.Sprintf("%s[s.writeFile] Failed to write image: %v [result_id: %s]", logTag, err, history.ResultId),
+				})
+			}
+
+			split := entity.DatasetSplitTrain
+			if s.sampleValue(req.Seed, "split", history.ResultId) < req.ValidationRatio {
+				split = entity.DatasetSplitValidation
+			}
+
+			manifests[split] = append(manifests[split], entity.DatasetManifestEntry{
+				ResultId:   history.ResultId,
+				RevisionId: history.RevisionId,
+				Image:      imageName,
+				Original:   original,
+				Approved:   approved,
+				CreatedAt:  history.CreatedAt,
+			})
+		}
+
+		if len(histories) < s.batchSize {
+			break
+		}
+	}
+
+	for _, split := range []string{entity.DatasetSplitTrain, entity.DatasetSplitValidation} {
+		mw, err := archive.Create(split + ".jsonl")
+		if err != nil {
+			return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[archive.Create] Failed to create manifest: %v [split: %s]", logTag, err, split),
+			})
+		}
+
+		encoder := json.NewEncoder(mw)
+
+		for _, entry := range manifests[split] {
+			err = encoder.Encode(entry)
+			if err != nil {
+				return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+					Message: fmt.Sprintf("%s[encoder.Encode] Failed to write manifest entry: %v [result_id: %s]", logTag, err, entry.ResultId),
+				})
+			}
+		}
+	}
+
+	metadata.TrainCount = len(manifests[entity.DatasetSplitTrain])
+	metadata.ValidationCount = len(manifests[entity.DatasetSplitValidation])
+
+	err = s.writeJson(archive, "dataset.json", metadata)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[s.writeJson] Failed to write metadata: %v", logTag, err),
+		})
+	}
+
+	err = archive.Close()
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[archive.Close] Failed to finalize archive: %v", logTag, err),
+		})
+	}
+
+	return &metadata, nil
+}
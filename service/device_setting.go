@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+)
+
+type deviceSetting struct {
+	deviceSettingsRepo repository.DeviceSettings
+
+	logTag string
+}
+
+type DeviceSettingOpts struct {
+	DeviceSettingsRepo repository.DeviceSettings
+}
+
+func NewDeviceSettingService(opts DeviceSettingOpts) *deviceSetting {
+	return &deviceSetting{
+		deviceSettingsRepo: opts.DeviceSettingsRepo,
+
+		logTag: "[service][deviceSetting]",
+	}
+}
+
+func (s *deviceSetting) GetSetting(ctx context.Context) (*entity.DeviceSetting, error) {
+	logTag := s.logTag + "[GetSetting]"
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	setting, err := s.deviceSettingsRepo.GetByDeviceId(ctx, deviceId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[deviceSettingsRepo.GetByDeviceId] Failed to get device setting: %v", logTag, err),
+		})
+	}
+	if setting == nil {
+		return &entity.DeviceSetting{
+			DeviceId: deviceId,
+		}, nil
+	}
+
+	return setting, nil
+}
+
+func (s *deviceSetting) UpdateSetting(ctx context.Context, setting entity.DeviceSetting) error {
+	logTag := s.logTag + "[UpdateSetting]"
+
+	setting.DeviceId = ctx.Value(hAppconstant.DeviceIdKey).(string)
+	setting.DefaultCurrency = helper.NormalizeCurrency(setting.DefaultCurrency)
+	setting.DefaultCountry = helper.NormalizeCountry(setting.DefaultCountry)
+	setting.BaseCurrency = helper.NormalizeCurrency(setting.BaseCurrency)
+
+	for field, currency := range map[string]string{
+		"default_currency": setting.DefaultCurrency,
+		"base_currency":    setting.BaseCurrency,
+	} {
+		if currency != "" && !helper.IsKnownCurrency(currency) {
+			return hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Message:         fmt.Sprintf("%s Unknown currency [%s: %s]", logTag, field, currency),
+				ResponseMessage: fmt.Sprintf("unknown %s %q", field, currency),
+			})
+		}
+	}
+
+	if setting.DefaultCountry != "" && !helper.IsKnownCountry(setting.DefaultCountry) {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Unknown country [default_country: %s]", logTag, setting.DefaultCountry),
+			ResponseMessage: fmt.Sprintf("unknown default_country %q", setting.DefaultCountry),
+		})
+	}
+
+	err := s.deviceSettingsRepo.UpsertOne(ctx, setting)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[deviceSettingsRepo.UpsertOne] Failed to save device setting: %v", logTag, err),
+		})
+	}
+
+	return nil
+}
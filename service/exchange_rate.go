@@ -0,0 +1,381 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+	"strconv"
+	"strings"
+	"time"
+
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+// ecbEnvelope is the eurofxref XML published by the European Central Bank,
+// holding one Cube of EUR reference rates per day.
+type ecbEnvelope struct {
+	Days []struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string `xml:"currency,attr"`
+			Rate     string `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+type exchangeRate struct {
+	exchangeRatesRepo repository.ExchangeRates
+	cacheRepo         repository.Cache
+	unitOfWork        repository.UnitOfWork
+
+	batchSize    int
+	defaultLimit int
+
+	logTag string
+}
+
+type ExchangeRateOpts struct {
+	ExchangeRatesRepo repository.ExchangeRates
+	CacheRepo         repository.Cache
+	UnitOfWork        repository.UnitOfWork
+}
+
+func NewExchangeRateService(opts ExchangeRateOpts) *exchangeRate {
+	return &exchangeRate{
+		exchangeRatesRepo: opts.ExchangeRatesRepo,
+		cacheRepo:         opts.CacheRepo,
+		unitOfWork:        opts.UnitOfWork,
+
+		batchSize:    1000,
+		defaultLimit: 100,
+
+		logTag: "[service][exchangeRate]",
+	}
+}
+
+// validate normalizes the rate and returns the problems found with it. Any
+// well-formed code is accepted, since historical rates such as the ECB history
+// file quote currencies that are no longer in use.
+func (s *exchangeRate) validate(row int, rate *entity.ExchangeRate) []entity.ImportRowError {
+	rowErrors := []entity.ImportRowError{}
+	addError := func(field, message string) {
+		rowErrors = append(rowErrors, entity.ImportRowError{Row: row, Field: field, Message: message})
+	}
+
+	rate.BaseCurrency = helper.NormalizeCurrency(rate.BaseCurrency)
+	rate.QuoteCurrency = helper.NormalizeCurrency(rate.QuoteCurrency)
+
+	_, err := time.Parse(time.DateOnly, rate.RateDate)
+	if err != nil {
+		addError("rate_date", fmt.Sprintf("invalid rate date %q, expected yyyy-mm-dd", rate.RateDate))
+	}
+
+	if !helper.IsCurrencyCode(rate.BaseCurrency) {
+		addError("base_currency", fmt.Sprintf("invalid currency code %q", rate.BaseCurrency))
+	}
+
+	if !helper.IsCurrencyCode(rate.QuoteCurrency) {
+		addError("quote_currency", fmt.Sprintf("invalid currency code %q", rate.QuoteCurrency))
+	}
+
+	if rate.BaseCurrency == rate.QuoteCurrency {
+		addError("quote_currency", "quote currency must differ from base currency")
+	}
+
+	if rate.Rate <= 0 {
+		addError("rate", "rate must be positive")
+	}
+
+	return rowErrors
+}
+
+// parseCsv reads rates from a CSV with rate_date, base_currency,
+// quote_currency and rate columns.
+func (s *exchangeRate) parseCsv(logTag string, r io.Reader, res *entity.UpsertExchangeRatesResponse) ([]entity.ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s[reader.Read] Failed to read header: %v", logTag, err),
+			ResponseMessage: "file must be a CSV with a header row",
+		})
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, required := range []string{"rate_date", "base_currency", "quote_currency", "rate"} {
+		_, ok := columns[required]
+		if !ok {
+			return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Message:         fmt.Sprintf("%s Missing column [column: %s]", logTag, required),
+				ResponseMessage: fmt.Sprintf("missing column %q", required),
+			})
+		}
+	}
+
+	rates := []entity.ExchangeRate{}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		res.RowCount++
+
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+					Message:         fmt.Sprintf("%s[reader.Read] Failed to read row: %v [row: %v]", logTag, err, res.RowCount),
+					ResponseMessage: "failed to read file",
+				})
+			}
+
+			res.Errors = append(res.Errors, entity.ImportRowError{Row: parseErr.StartLine, Message: parseErr.Err.Error()})
+			continue
+		}
+
+		row, _ := reader.FieldPos(0)
+
+		get := func(column string) string {
+			i := columns[column]
+			if i >= len(record) {
+				return ""
+			}
+
+			return strings.TrimSpace(record[i])
+		}
+
+		rate := entity.ExchangeRate{
+			RateDate:      get("rate_date"),
+			BaseCurrency:  get("base_currency"),
+			QuoteCurrency: get("quote_currency"),
+			Source:        entity.ExchangeRateSourceCsv,
+		}
+
+		rawRate := get("rate")
+
+		rate.Rate, err = strconv.ParseFloat(rawRate, 64)
+		if err != nil {
+			res.Errors = append(res.Errors, entity.ImportRowError{Row: row, Field: "rate", Message: fmt.Sprintf("invalid rate %q", rawRate)})
+			continue
+		}
+
+		rowErrors := s.validate(row, &rate)
+		if len(rowErrors) > 0 {
+			res.Errors = append(res.Errors, rowErrors...)
+			continue
+		}
+
+		rates = append(rates, rate)
+	}
+
+	return rates, nil
+}
+
+// parseEcb reads EUR reference rates from ECB XML. Rows are numbered by their
+// position in the file.
+func (s *exchangeRate) parseEcb(logTag string, r io.Reader, res *entity.UpsertExchangeRatesResponse) ([]entity.ExchangeRate, error) {
+	var envelope ecbEnvelope
+
+	err := xml.NewDecoder(r).Decode(&envelope)
+	if err != nil {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s[xml.Decode] Failed to decode ECB rates: %v", logTag, err),
+			ResponseMessage: "file must be ECB eurofxref XML",
+		})
+	}
+
+	rates := []entity.ExchangeRate{}
+
+	for _, day := range envelope.Days {
+		for _, ecbRate := range day.Rates {
+			res.RowCount++
+
+			rate := entity.ExchangeRate{
+				RateDate:      day.Time,
+				BaseCurrency:  entity.EcbBaseCurrency,
+				QuoteCurrency: ecbRate.Currency,
+				Source:        entity.ExchangeRateSourceEcb,
+			}
+
+			rate.Rate, err = strconv.ParseFloat(strings.TrimSpace(ecbRate.Rate), 64)
+			if err != nil {
+				res.Errors = append(res.Errors, entity.ImportRowError{Row: res.RowCount, Field: "rate", Message: fmt.Sprintf("invalid rate %q", ecbRate.Rate)})
+				continue
+			}
+
+			rowErrors := s.validate(res.RowCount, &rate)
+			if len(rowErrors) > 0 {
+				res.Errors = append(res.Errors, rowErrors...)
+				continue
+			}
+
+			rates = append(rates, rate)
+		}
+	}
+
+	return rates, nil
+}
+
+// save upserts the rates in batches within one transaction. A pair appearing
+// twice for the same date keeps its last rate, since postgres rejects an
+// upsert that touches the same row twice.
+func (s *exchangeRate) save(ctx context.Context, logTag string, rates []entity.ExchangeRate) (int, error) {
+	type rateKey struct {
+		rateDate, baseCurrency, quoteCurrency string
+	}
+
+	positions := map[rateKey]int{}
+	unique := []entity.ExchangeRate{}
+
+	for _, rate := range rates {
+		key := rateKey{rate.RateDate, rate.BaseCurrency, rate.QuoteCurrency}
+
+		i, ok := positions[key]
+		if ok {
+			unique[i] = rate
+			continue
+		}
+
+		positions[key] = len(unique)
+		unique = append(unique, rate)
+	}
+
+	err := s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		exchangeRatesRepo := s.exchangeRatesRepo.NewTx(tx)
+
+		for start := 0; start < len(unique); start += s.batchSize {
+			end := min(start+s.batchSize, len(unique))
+
+			err := exchangeRatesRepo.UpsertMany(ctx, unique[start:end])
+			if err != nil {
+				return hApperror.InternalServerError(hApperror.AppErrorOpt{
+					Message: fmt.Sprintf("%s[exchangeRatesRepo.UpsertMany] Failed to upsert exchange rates: %v", logTag, err),
+				})
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.cacheRepo.BumpExchangeRatesVersion(ctx)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Warnf("%s[cacheRepo.BumpExchangeRatesVersion] Failed to invalidate converted analytics", logTag)
+	}
+
+	return len(unique), nil
+}
+
+func (s *exchangeRate) Upsert(ctx context.Context, req entity.UpsertExchangeRatesRequest) (*entity.UpsertExchangeRatesResponse, error) {
+	logTag := s.logTag + "[Upsert]"
+
+	res := entity.UpsertExchangeRatesResponse{
+		RowCount: len(req.Rates),
+		Errors:   []entity.ImportRowError{},
+	}
+
+	for i := range req.Rates {
+		req.Rates[i].Source = entity.ExchangeRateSourceApi
+		res.Errors = append(res.Errors, s.validate(i+1, &req.Rates[i])...)
+	}
+
+	if len(res.Errors) > 0 {
+		return &res, nil
+	}
+
+	upserted, err := s.save(ctx, logTag, req.Rates)
+	if err != nil {
+		return nil, err
+	}
+
+	res.UpsertedCount = upserted
+
+	return &res, nil
+}
+
+// Import loads rates from a CSV or ECB XML file. Nothing is saved when any of
+// the rows is invalid.
+func (s *exchangeRate) Import(ctx context.Context, req entity.ImportExchangeRatesRequest, r io.Reader) (*entity.UpsertExchangeRatesResponse, error) {
+	logTag := s.logTag + "[Import]"
+
+	res := entity.UpsertExchangeRatesResponse{
+		Errors: []entity.ImportRowError{},
+	}
+
+	var (
+		rates []entity.ExchangeRate
+		err   error
+	)
+
+	switch req.Format {
+	case entity.ExchangeRateFormatEcb:
+		rates, err = s.parseEcb(logTag, r, &res)
+	default:
+		rates, err = s.parseCsv(logTag, r, &res)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res.Errors) > 0 || len(rates) == 0 {
+		return &res, nil
+	}
+
+	upserted, err := s.save(ctx, logTag, rates)
+	if err != nil {
+		return nil, err
+	}
+
+	res.UpsertedCount = upserted
+
+	return &res, nil
+}
+
+func (s *exchangeRate) List(ctx context.Context, req entity.ListExchangeRatesRequest) (*entity.ListExchangeRatesResponse, error) {
+	logTag := s.logTag + "[List]"
+
+	if req.Limit == 0 {
+		req.Limit = s.defaultLimit
+	}
+
+	rates, err := s.exchangeRatesRepo.GetMany(ctx, entity.ExchangeRateFilter{
+		BaseCurrency:  helper.NormalizeCurrency(req.BaseCurrency),
+		QuoteCurrency: helper.NormalizeCurrency(req.QuoteCurrency),
+		DateFrom:      req.DateFrom,
+		DateTo:        req.DateTo,
+		Limit:         req.Limit,
+	})
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[exchangeRatesRepo.GetMany] Failed to get exchange rates: %v", logTag, err),
+		})
+	}
+
+	return &entity.ListExchangeRatesResponse{
+		Rates: rates,
+	}, nil
+}
@@ -2,17 +2,133 @@ package service
 
 import (
 	"context"
+	"io"
 	"mime/multipart"
 	"receipt-detector/entity"
 )
 
 type ReceiptDetection interface {
-	DetectAndStoreReceipt(ctx context.Context, file multipart.File, fileHeader *multipart.FileHeader) (*entity.ReceiptDetectionResult, error)
+	DetectAndStoreReceipt(ctx context.Context, file multipart.File, fileHeader *multipart.FileHeader, override entity.OcrEngineOptions) (*entity.ReceiptDetectionResult, error)
 	GetResult(ctx context.Context, resultId string) (*entity.ReceiptDetectionResult, error)
 }
 
 type Receipt interface {
-	CreateOne(ctx context.Context, bill entity.Receipt, detectionResult entity.DetectionResult) (int64, error)
+	CreateOne(ctx context.Context, bill entity.Receipt, detectionResult entity.DetectionResult) (*entity.CreateReceiptResponse, error)
 	GetByReceiptId(ctx context.Context, billId int64) (*entity.Receipt, []entity.ReceiptItem, error)
 	UpdateOne(ctx context.Context, newBill entity.UpdateReceiptRequest) error
+	List(ctx context.Context, req entity.ListReceiptsRequest) (*entity.ListReceiptsResponse, error)
+	DeleteOne(ctx context.Context, receiptId int64) error
+	RestoreOne(ctx context.Context, receiptId int64) error
+	ListTrash(ctx context.Context, req entity.ListTrashRequest) (*entity.ListReceiptsResponse, error)
+	PurgeTrash(ctx context.Context) (int, error)
+}
+
+type ReceiptItem interface {
+	AddItem(ctx context.Context, receiptId int64, req entity.AddReceiptItemRequest) (int64, error)
+	UpdateItem(ctx context.Context, req entity.UpdateReceiptItemRequest) error
+	DeleteItem(ctx context.Context, receiptId, receiptItemId int64) error
+	ReorderItems(ctx context.Context, receiptId int64, receiptItemIds []int64) error
+}
+
+type DeviceSetting interface {
+	GetSetting(ctx context.Context) (*entity.DeviceSetting, error)
+	UpdateSetting(ctx context.Context, setting entity.DeviceSetting) error
+}
+
+type DatasetExport interface {
+	Export(ctx context.Context, req entity.DatasetExportRequest, w io.Writer) (*entity.DatasetMetadata, error)
+}
+
+type ReceiptImage interface {
+	GetSignedImagePath(ctx context.Context, relativePath string, req entity.SignedImageRequest) (string, error)
+}
+
+type ReceiptSplit interface {
+	ListParticipants(ctx context.Context, receiptId int64) ([]entity.ReceiptParticipant, error)
+	AddParticipant(ctx context.Context, receiptId int64, req entity.AddReceiptParticipantRequest) (int64, error)
+	DeleteParticipant(ctx context.Context, receiptId, participantId int64) error
+	SetItemAssignments(ctx context.Context, receiptId, receiptItemId int64, req entity.SetItemAssignmentsRequest) error
+	GetSplit(ctx context.Context, receiptId int64) (*entity.ReceiptSplit, error)
+}
+
+type ReceiptSettlement interface {
+	SetPayer(ctx context.Context, receiptId int64, req entity.SetReceiptPayerRequest) error
+	AddPayment(ctx context.Context, receiptId int64, req entity.AddReceiptPaymentRequest) (int64, error)
+	ListPayments(ctx context.Context, receiptId int64) ([]entity.ReceiptPayment, error)
+	DeletePayment(ctx context.Context, receiptId, paymentId int64) error
+	GetBalance(ctx context.Context, receiptId int64) (*entity.ReceiptBalance, error)
+	SettleUp(ctx context.Context, req entity.SettleUpRequest) (*entity.SettleUpResponse, error)
+}
+
+type ReceiptExport interface {
+	Export(ctx context.Context, req entity.ExportReceiptsRequest, w io.Writer) error
+	ExportLedger(ctx context.Context, req entity.ExportLedgerRequest, w io.Writer) error
+}
+
+type ReceiptImport interface {
+	Import(ctx context.Context, req entity.ImportReceiptsRequest, r io.Reader) (*entity.ImportReceiptsResponse, error)
+}
+
+type ReceiptSearch interface {
+	Search(ctx context.Context, req entity.SearchReceiptsRequest) (*entity.SearchReceiptsResponse, error)
+	Reindex(ctx context.Context) (int, error)
+}
+
+type SpendingAnalytics interface {
+	GetBreakdown(ctx context.Context, groupBy string, req entity.SpendingBreakdownRequest) (*entity.SpendingBreakdownResponse, error)
+	GetTimeseries(ctx context.Context, req entity.SpendingTimeseriesRequest) (*entity.SpendingTimeseriesResponse, error)
+}
+
+type Budget interface {
+	Create(ctx context.Context, req entity.CreateBudgetRequest) (*entity.CreateBudgetResponse, error)
+	List(ctx context.Context) (*entity.ListBudgetsResponse, error)
+	Update(ctx context.Context, req entity.UpdateBudgetRequest) error
+	Delete(ctx context.Context, budgetId int64) error
+	GetStatus(ctx context.Context, budgetId int64) (*entity.BudgetStatus, error)
+	ListStatus(ctx context.Context) (*entity.ListBudgetStatusResponse, error)
+}
+
+type ExchangeRate interface {
+	Upsert(ctx context.Context, req entity.UpsertExchangeRatesRequest) (*entity.UpsertExchangeRatesResponse, error)
+	Import(ctx context.Context, req entity.ImportExchangeRatesRequest, r io.Reader) (*entity.UpsertExchangeRatesResponse, error)
+	List(ctx context.Context, req entity.ListExchangeRatesRequest) (*entity.ListExchangeRatesResponse, error)
+}
+
+type Tag interface {
+	Create(ctx context.Context, req entity.CreateTagRequest) (*entity.CreateTagResponse, error)
+	List(ctx context.Context, req entity.ListTagsRequest) (*entity.ListTagsResponse, error)
+	Update(ctx context.Context, req entity.UpdateTagRequest) error
+	Delete(ctx context.Context, tagId int64) error
+	SetReceiptTags(ctx context.Context, req entity.SetReceiptTagsRequest) (*entity.ReceiptTagsResponse, error)
+	RemoveReceiptTag(ctx context.Context, receiptId, tagId int64) error
+}
+
+type ReceiptAttachment interface {
+	Upload(ctx context.Context, receiptId int64, file multipart.File, fileHeader *multipart.FileHeader, req entity.UploadReceiptAttachmentRequest) (*entity.UploadReceiptAttachmentResponse, error)
+	List(ctx context.Context, receiptId int64) (*entity.ListReceiptAttachmentsResponse, error)
+	Delete(ctx context.Context, receiptId, attachmentId int64) error
+	Reorder(ctx context.Context, receiptId int64, attachmentIds []int64) error
+}
+
+type ReceiptShare interface {
+	Create(ctx context.Context, receiptId int64, req entity.CreateReceiptShareRequest) (*entity.CreateReceiptShareResponse, error)
+	List(ctx context.Context, receiptId int64) (*entity.ListReceiptSharesResponse, error)
+	Revoke(ctx context.Context, receiptId, shareId int64) error
+	ListAccesses(ctx context.Context, receiptId, shareId int64, req entity.ListReceiptShareAccessesRequest) (*entity.ListReceiptShareAccessesResponse, error)
+	GetShared(ctx context.Context, token, ipAddress, userAgent string) (*entity.SharedReceipt, error)
+}
+
+type ReceiptLineage interface {
+	Merge(ctx context.Context, req entity.MergeReceiptsRequest) (*entity.MergeReceiptsResponse, error)
+	Split(ctx context.Context, receiptId int64, req entity.SplitReceiptRequest) (*entity.SplitReceiptResponse, error)
+	List(ctx context.Context, receiptId int64) (*entity.ReceiptLineageResponse, error)
+}
+
+type ReceiptDuplicate interface {
+	List(ctx context.Context, req entity.ListReceiptDuplicatesRequest) (*entity.ListReceiptDuplicatesResponse, error)
+	Resolve(ctx context.Context, req entity.ResolveReceiptDuplicateRequest) error
+}
+
+type ReceiptHistory interface {
+	Get(ctx context.Context, receiptId int64, req entity.ReceiptHistoryRequest) (*entity.ReceiptHistoryResponse, error)
 }
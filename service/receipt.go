@@ -1,23 +1,44 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"receipt-detector/entity"
+	"receipt-detector/external/notifier"
 	"receipt-detector/helper"
 	"receipt-detector/repository"
+	"strconv"
+	"time"
 
 	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
 	hApperror "github.com/michaelyusak/go-helper/apperror"
+	"github.com/sirupsen/logrus"
 )
 
 type receipt struct {
 	receiptsRepo                  repository.Receipts
 	receiptItemsRepo              repository.ReceiptItems
 	receiptDetectionHistoriesRepo repository.ReceiptDetectionHistories
+	receiptDetectionResultsRepo   repository.ReceiptDetectionResults
 	receiptImagesRepo             repository.ReceiptImages
+	receiptTagsRepo               repository.ReceiptTags
+	receiptAttachmentsRepo        repository.ReceiptAttachments
 	cacheRepo                     repository.Cache
+	unitOfWork                    repository.UnitOfWork
+	searchIndexer                 *receiptSearchIndexer
+	budgetEvaluator               *budgetEvaluator
+	currencyConverter             *currencyConverter
+	duplicateDetector             *duplicateDetector
+	auditLogger                   *auditLogger
+
+	defaultPageSize int
+	purgeBatchSize  int
+	trashRetention  time.Duration
 
 	logTag string
 }
@@ -26,8 +47,26 @@ type ReceiptOpts struct {
 	ReceiptsRepo                  repository.Receipts
 	ReceiptItemsRepo              repository.ReceiptItems
 	ReceiptDetectionHistoriesRepo repository.ReceiptDetectionHistories
+	ReceiptDetectionResultsRepo   repository.ReceiptDetectionResults
 	ReceiptImagesRepo             repository.ReceiptImages
 	CacheRepo                     repository.Cache
+	UnitOfWork                    repository.UnitOfWork
+	ReceiptSearchRepo             repository.ReceiptSearch
+	ReceiptTagsRepo               repository.ReceiptTags
+	ReceiptAttachmentsRepo        repository.ReceiptAttachments
+	BudgetsRepo                   repository.Budgets
+	BudgetAlertsRepo              repository.BudgetAlerts
+	SpendingAnalyticsRepo         repository.SpendingAnalytics
+	Notifier                      notifier.Notifier
+	DeviceSettingsRepo            repository.DeviceSettings
+	ExchangeRatesRepo             repository.ExchangeRates
+	ReceiptDuplicatesRepo         repository.ReceiptDuplicates
+	AuditLogsRepo                 repository.AuditLogs
+	ReceiptParticipantsRepo       repository.ReceiptParticipants
+	ReceiptItemAssignmentsRepo    repository.ReceiptItemAssignments
+	TrashRetention                time.Duration
+	DuplicateThreshold            float64
+	DuplicateDateWindow           time.Duration
 }
 
 func NewBillService(opt ReceiptOpts) *receipt {
@@ -35,8 +74,21 @@ func NewBillService(opt ReceiptOpts) *receipt {
 		receiptsRepo:                  opt.ReceiptsRepo,
 		receiptItemsRepo:              opt.ReceiptItemsRepo,
 		receiptDetectionHistoriesRepo: opt.ReceiptDetectionHistoriesRepo,
+		receiptDetectionResultsRepo:   opt.ReceiptDetectionResultsRepo,
 		receiptImagesRepo:             opt.ReceiptImagesRepo,
+		receiptTagsRepo:               opt.ReceiptTagsRepo,
+		receiptAttachmentsRepo:        opt.ReceiptAttachmentsRepo,
 		cacheRepo:                     opt.CacheRepo,
+		unitOfWork:                    opt.UnitOfWork,
+		searchIndexer:                 newReceiptSearchIndexer(opt.ReceiptsRepo, opt.ReceiptItemsRepo, opt.ReceiptSearchRepo, opt.ReceiptTagsRepo),
+		budgetEvaluator:               newBudgetEvaluator(opt.BudgetsRepo, opt.BudgetAlertsRepo, opt.SpendingAnalyticsRepo, opt.Notifier),
+		currencyConverter:             newCurrencyConverter(opt.DeviceSettingsRepo, opt.ExchangeRatesRepo),
+		duplicateDetector:             newDuplicateDetector(opt.ReceiptsRepo, opt.ReceiptItemsRepo, opt.ReceiptDuplicatesRepo, opt.DuplicateThreshold, opt.DuplicateDateWindow),
+		auditLogger:                   newAuditLogger(opt.ReceiptsRepo, opt.ReceiptItemsRepo, opt.ReceiptTagsRepo, opt.ReceiptParticipantsRepo, opt.ReceiptItemAssignmentsRepo, opt.AuditLogsRepo),
+
+		defaultPageSize: 20,
+		purgeBatchSize:  100,
+		trashRetention:  opt.TrashRetention,
 
 		logTag: "[service][receipt]",
 	}
@@ -61,7 +113,62 @@ func (s *receipt) convertDetectionResultToReceiptItems(detectionResult entity.De
 	return receiptItems
 }
 
-func (s *receipt) CreateOne(ctx context.Context, receipt entity.Receipt, detectionResult entity.DetectionResult) (int64, error) {
+// getAuthoritativeResult loads the stored detection result for resultId,
+// following the latest revision, and makes sure it was uploaded by deviceId.
+func (s *receipt) getAuthoritativeResult(ctx context.Context, logTag, resultId, deviceId string) (entity.DetectionResult, error) {
+	notFoundErr := hApperror.BadRequestError(hApperror.AppErrorOpt{
+		Code:            http.StatusNotFound,
+		Message:         fmt.Sprintf("%s Detection result not found [result_id: %s]", logTag, resultId),
+		ResponseMessage: "Detection result not found",
+	})
+
+	history, err := s.receiptDetectionHistoriesRepo.GetByResultId(ctx, resultId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptDetectionHistoriesRepo.GetByResultId] Failed to get detection history: %v [result_id: %s]", logTag, err, resultId),
+		})
+	}
+	if history == nil || !ownsDetection(history, deviceId) {
+		return nil, notFoundErr
+	}
+
+	authoritativeId := history.ResultId
+	if history.RevisionId != "" {
+		authoritativeId = history.RevisionId
+	}
+
+	cachedResult, err := s.cacheRepo.GetReceiptDetectionResult(ctx, authoritativeId)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"result_id": authoritativeId,
+			"error":     err,
+		}).Warnf("%s[cacheRepo.GetReceiptDetectionResult] Failed to get cached result", logTag)
+	}
+	if cachedResult != nil {
+		return cachedResult.Result, nil
+	}
+
+	result, err := s.receiptDetectionResultsRepo.GetByResultId(ctx, authoritativeId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptDetectionResultsRepo.GetByResultId] Failed to get detection result: %v [result_id: %s]", logTag, err, authoritativeId),
+		})
+	}
+	if result == nil {
+		return nil, notFoundErr
+	}
+
+	return result, nil
+}
+
+func (s *receipt) isSameDetectionResult(a, b entity.DetectionResult) bool {
+	aJson, errA := json.Marshal(a)
+	bJson, errB := json.Marshal(b)
+
+	return errA == nil && errB == nil && bytes.Equal(aJson, bJson)
+}
+
+func (s *receipt) CreateOne(ctx context.Context, receipt entity.Receipt, detectionResult entity.DetectionResult) (*entity.CreateReceiptResponse, error) {
 	logTag := s.logTag + "[CreateOne]"
 
 	if receipt.ReceiptDate == 0 {
@@ -70,23 +177,80 @@ func (s *receipt) CreateOne(ctx context.Context, receipt entity.Receipt, detecti
 
 	receipt.DeviceId = ctx.Value(hAppconstant.DeviceIdKey).(string)
 
-	receiptId, err := s.receiptsRepo.InsertOne(ctx, receipt)
+	storedResult, err := s.getAuthoritativeResult(ctx, logTag, receipt.ResultId, receipt.DeviceId)
 	if err != nil {
-		return 0, hApperror.InternalServerError(hApperror.AppErrorOpt{
-			Message: fmt.Sprintf("%s[receiptsRepo.InsertOne] Failed to insert receipt to postgres: %v [result_id: %s]", logTag, err, receipt.ResultId),
-		})
+		return nil, err
+	}
+
+	// The flag is derived here only, never taken from the request.
+	receipt.ItemsOverridden = len(detectionResult) > 0 && !s.isSameDetectionResult(detectionResult, storedResult)
+
+	if !receipt.ItemsOverridden {
+		detectionResult = storedResult
+	} else {
+		logrus.WithFields(logrus.Fields{
+			"result_id": receipt.ResultId,
+		}).Infof("%s[ItemsOverridden] Client items differ from stored detection result", logTag)
 	}
 
-	receiptItems := s.convertDetectionResultToReceiptItems(detectionResult, receiptId)
+	receiptItems := s.convertDetectionResultToReceiptItems(detectionResult, 0)
 
-	err = s.receiptItemsRepo.InsertMany(ctx, receiptItems)
+	totalAmount, totalCurrency := primaryTotal(summarizeReceiptItems(receiptItems))
+	receipt.Total = &totalAmount
+	receipt.TotalCurrency = totalCurrency
+
+	var receiptId int64
+
+	err = s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		id, err := s.receiptsRepo.NewTx(tx).InsertOne(ctx, receipt)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptsRepo.InsertOne] Failed to insert receipt to postgres: %v [result_id: %s]", logTag, err, receipt.ResultId),
+			})
+		}
+
+		for i := range receiptItems {
+			receiptItems[i].ReceiptId = id
+		}
+
+		err = s.receiptItemsRepo.NewTx(tx).InsertMany(ctx, receiptItems)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptItemsRepo.InsertMany] Failed to insert receipt items to postgres %v [receipt_id: %v]", logTag, err, id),
+			})
+		}
+
+		receiptId = id
+
+		return s.auditLogger.record(ctx, tx, logTag, entity.AuditOperationCreate, receiptSnapshot{receiptId: id})
+	})
 	if err != nil {
-		return 0, hApperror.InternalServerError(hApperror.AppErrorOpt{
-			Message: fmt.Sprintf("%s[receiptItemsRepo.InsertMany] Failed to insert receipt items to postgres %v [receipt_id: %v]", logTag, err, receiptId),
-		})
+		return nil, err
 	}
 
-	return receiptId, nil
+	s.searchIndexer.sync(receiptId, receipt.DeviceId)
+	invalidateSpendingAnalytics(ctx, s.cacheRepo, logTag, receipt.DeviceId)
+	s.budgetEvaluator.evaluate(receipt.DeviceId)
+
+	receipt.ReceiptId = receiptId
+
+	// The receipt is already saved, so a failed duplicate check only costs
+	// the warnings.
+	duplicateWarnings, err := s.duplicateDetector.detect(ctx, receipt, receiptItems)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"receipt_id": receiptId,
+			"error":      err,
+		}).Warnf("%s[duplicateDetector.detect] Failed to check for duplicates", logTag)
+
+		duplicateWarnings = []entity.DuplicateWarning{}
+	}
+
+	return &entity.CreateReceiptResponse{
+		ReceiptId:         receiptId,
+		ItemsOverridden:   receipt.ItemsOverridden,
+		DuplicateWarnings: duplicateWarnings,
+	}, nil
 }
 
 func (s *receipt) GetByReceiptId(ctx context.Context, receiptId int64) (*entity.Receipt, []entity.ReceiptItem, error) {
@@ -114,6 +278,24 @@ func (s *receipt) GetByReceiptId(ctx context.Context, receiptId int64) (*entity.
 		})
 	}
 
+	summary := summarizeReceiptItems(receiptItems)
+	receipt.Summary = &summary
+
+	receipts := []entity.Receipt{*receipt}
+	s.convertReceipts(ctx, logTag, deviceId, receipts, receiptItems)
+
+	err = s.attachTags(ctx, logTag, receipts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	receipt = &receipts[0]
+
+	// Imported receipts have no detection result and therefore no image.
+	if receipt.ResultId == "" {
+		return receipt, receiptItems, nil
+	}
+
 	history, err := s.receiptDetectionHistoriesRepo.GetByResultId(ctx, receipt.ResultId)
 	if err != nil {
 		return nil, nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
@@ -121,18 +303,557 @@ func (s *receipt) GetByReceiptId(ctx context.Context, receiptId int64) (*entity.
 		})
 	}
 
-	imageUrl, err := s.receiptImagesRepo.GetImageUrl(ctx, history.ImagePath)
+	if history != nil {
+		imageUrl, err := s.receiptImagesRepo.GetImageUrl(ctx, history.ImagePath)
+		if err != nil {
+			return nil, nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptImagesRepo.GetImageUrl] Failed to get image url: %v [receipt_id: %v]", logTag, err, receiptId),
+			})
+		}
+
+		receipt.ReceiptImageUrl = imageUrl
+	}
+
+	return receipt, receiptItems, nil
+}
+
+func (s *receipt) UpdateOne(ctx context.Context, newReceipt entity.UpdateReceiptRequest) error {
+	logTag := s.logTag + "[UpdateOne]"
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+	newReceipt.DeviceId = deviceId
+
+	err := s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := s.auditLogger.snapshot(ctx, tx, logTag, newReceipt.ReceiptId)
+		if err != nil {
+			return err
+		}
+
+		updated, err := s.receiptsRepo.NewTx(tx).UpdateOne(ctx, newReceipt)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptsRepo.UpdateOne] Failed to update receipt: %v [receipt_id: %v]", logTag, err, newReceipt.ReceiptId),
+			})
+		}
+		if !updated {
+			return hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Code:            http.StatusNotFound,
+				ResponseMessage: "Receipt not found",
+			})
+		}
+
+		return s.auditLogger.record(ctx, tx, logTag, entity.AuditOperationUpdate, before)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.searchIndexer.sync(newReceipt.ReceiptId, deviceId)
+	invalidateSpendingAnalytics(ctx, s.cacheRepo, logTag, deviceId)
+	s.budgetEvaluator.evaluate(deviceId)
+
+	return nil
+}
+
+func (s *receipt) encodeCursor(cursor entity.ReceiptCursor) string {
+	data, _ := json.Marshal(cursor)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (s *receipt) decodeCursor(encoded, sortBy, sortOrder string) (any, int64, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var cursor entity.ReceiptCursor
+
+	err = json.Unmarshal(data, &cursor)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if cursor.SortBy != sortBy || cursor.SortOrder != sortOrder {
+		return nil, 0, fmt.Errorf("cursor was issued for a different sort")
+	}
+
+	// Totals are compared as exact numerics, so the validated string is
+	// passed through instead of a float.
+	if sortBy == entity.ReceiptSortByTotal {
+		_, err := strconv.ParseFloat(cursor.Value, 64)
+		return cursor.Value, cursor.ReceiptId, err
+	}
+
+	value, err := strconv.ParseInt(cursor.Value, 10, 64)
+	return value, cursor.ReceiptId, err
+}
+
+func (s *receipt) cursorValue(receipt entity.Receipt, sortBy string) string {
+	switch sortBy {
+	case entity.ReceiptSortByCreatedAt:
+		return strconv.FormatInt(receipt.CreatedAt, 10)
+	case entity.ReceiptSortByDeletedAt:
+		var deletedAt int64
+		if receipt.DeletedAt != nil {
+			deletedAt = *receipt.DeletedAt
+		}
+
+		return strconv.FormatInt(deletedAt, 10)
+	case entity.ReceiptSortByTotal:
+		var total float64
+		if receipt.Total != nil {
+			total = *receipt.Total
+		}
+
+		return strconv.FormatFloat(total, 'f', -1, 64)
+	default:
+		return strconv.FormatInt(receipt.ReceiptDate, 10)
+	}
+}
+
+// attachSummaries loads the items of every receipt in one query and sets the
+// computed summary on each receipt.
+func (s *receipt) attachSummaries(ctx context.Context, logTag string, receipts []entity.Receipt) error {
+	receiptIds := make([]int64, len(receipts))
+	for i, receipt := range receipts {
+		receiptIds[i] = receipt.ReceiptId
+	}
+
+	receiptItems, err := s.receiptItemsRepo.GetByReceiptIds(ctx, receiptIds)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptItemsRepo.GetByReceiptIds] Failed to get receipt items: %v", logTag, err),
+		})
+	}
+
+	itemsByReceiptId := map[int64][]entity.ReceiptItem{}
+	for _, receiptItem := range receiptItems {
+		itemsByReceiptId[receiptItem.ReceiptId] = append(itemsByReceiptId[receiptItem.ReceiptId], receiptItem)
+	}
+
+	for i := range receipts {
+		summary := summarizeReceiptItems(itemsByReceiptId[receipts[i].ReceiptId])
+		receipts[i].Summary = &summary
+	}
+
+	return nil
+}
+
+// attachTags loads the tags of every receipt in one query.
+func (s *receipt) attachTags(ctx context.Context, logTag string, receipts []entity.Receipt) error {
+	receiptIds := make([]int64, len(receipts))
+	for i, receipt := range receipts {
+		receiptIds[i] = receipt.ReceiptId
+	}
+
+	receiptTags, err := s.receiptTagsRepo.GetByReceiptIds(ctx, receiptIds)
 	if err != nil {
-		return nil, nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
-			Message: fmt.Sprintf("%s[receiptImagesRepo.GetImageUrl] Failed to get image url: %v [receipt_id: %v]", logTag, err, receiptId),
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptTagsRepo.GetByReceiptIds] Failed to get receipt tags: %v", logTag, err),
 		})
 	}
 
-	receipt.ReceiptImageUrl = imageUrl
+	tagsByReceiptId := map[int64][]entity.Tag{}
+	for _, receiptTag := range receiptTags {
+		tagsByReceiptId[receiptTag.ReceiptId] = append(tagsByReceiptId[receiptTag.ReceiptId], receiptTag.Tag)
+	}
 
-	return receipt, receiptItems, nil
+	for i := range receipts {
+		receipts[i].Tags = tagsByReceiptId[receipts[i].ReceiptId]
+	}
+
+	return nil
 }
 
-func (s *receipt) UpdateOne(ctx context.Context, newReceipt entity.UpdateReceiptRequest) error {
-	return s.receiptsRepo.UpdateOne(ctx, newReceipt)
+// convertReceipts adds amounts in the base currency of the device. Failures
+// are logged since converted amounts are only informational.
+func (s *receipt) convertReceipts(ctx context.Context, logTag, deviceId string, receipts []entity.Receipt, receiptItems []entity.ReceiptItem) {
+	err := s.currencyConverter.convertReceipts(ctx, deviceId, receipts, receiptItems)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"device_id": deviceId,
+			"error":     err,
+		}).Warnf("%s[currencyConverter.convertReceipts] Failed to convert receipt amounts", logTag)
+	}
+}
+
+func (s *receipt) List(ctx context.Context, req entity.ListReceiptsRequest) (*entity.ListReceiptsResponse, error) {
+	logTag := s.logTag + "[List]"
+
+	if req.Limit == 0 {
+		req.Limit = s.defaultPageSize
+	}
+
+	if req.SortBy == "" {
+		req.SortBy = entity.ReceiptSortByReceiptDate
+	}
+
+	if req.SortOrder == "" {
+		req.SortOrder = entity.SortOrderDesc
+	}
+
+	filter := entity.ReceiptFilter{
+		DeviceId:  ctx.Value(hAppconstant.DeviceIdKey).(string),
+		SortBy:    req.SortBy,
+		SortOrder: req.SortOrder,
+		DateFrom:  req.DateFrom,
+		DateTo:    req.DateTo,
+		Name:      req.Name,
+		Category:  req.Category,
+		Currency:  req.Currency,
+		AmountMin: req.AmountMin,
+		AmountMax: req.AmountMax,
+		TagIds:    uniqueIds(req.TagIds),
+		Limit:     req.Limit + 1,
+	}
+
+	if req.Cursor != "" {
+		value, receiptId, err := s.decodeCursor(req.Cursor, req.SortBy, req.SortOrder)
+		if err != nil {
+			return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Message:         fmt.Sprintf("%s[s.decodeCursor] Invalid cursor: %v [cursor: %s]", logTag, err, req.Cursor),
+				ResponseMessage: "invalid cursor",
+			})
+		}
+
+		filter.CursorValue = value
+		filter.CursorReceiptId = receiptId
+	}
+
+	receipts, err := s.receiptsRepo.GetMany(ctx, filter)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptsRepo.GetMany] Failed to get receipts: %v", logTag, err),
+		})
+	}
+
+	res := entity.ListReceiptsResponse{
+		Receipts: receipts,
+	}
+
+	if len(receipts) > req.Limit {
+		res.Receipts = receipts[:req.Limit]
+		last := res.Receipts[req.Limit-1]
+
+		res.NextCursor = s.encodeCursor(entity.ReceiptCursor{
+			SortBy:    req.SortBy,
+			SortOrder: req.SortOrder,
+			Value:     s.cursorValue(last, req.SortBy),
+			ReceiptId: last.ReceiptId,
+		})
+	}
+
+	err = s.attachSummaries(ctx, logTag, res.Receipts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.attachTags(ctx, logTag, res.Receipts)
+	if err != nil {
+		return nil, err
+	}
+
+	s.convertReceipts(ctx, logTag, filter.DeviceId, res.Receipts, nil)
+
+	return &res, nil
+}
+
+func (s *receipt) DeleteOne(ctx context.Context, receiptId int64) error {
+	logTag := s.logTag + "[DeleteOne]"
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	err := s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := s.auditLogger.snapshot(ctx, tx, logTag, receiptId)
+		if err != nil {
+			return err
+		}
+
+		deleted, err := s.receiptsRepo.NewTx(tx).SoftDeleteOne(ctx, receiptId, deviceId)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptsRepo.SoftDeleteOne] Failed to delete receipt: %v [receipt_id: %v]", logTag, err, receiptId),
+			})
+		}
+		if !deleted {
+			return hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Code:            http.StatusNotFound,
+				ResponseMessage: "Receipt not found",
+			})
+		}
+
+		return s.auditLogger.record(ctx, tx, logTag, entity.AuditOperationDelete, before)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.searchIndexer.sync(receiptId, deviceId)
+	invalidateSpendingAnalytics(ctx, s.cacheRepo, logTag, deviceId)
+
+	return nil
+}
+
+func (s *receipt) RestoreOne(ctx context.Context, receiptId int64) error {
+	logTag := s.logTag + "[RestoreOne]"
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	err := s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := s.auditLogger.snapshot(ctx, tx, logTag, receiptId)
+		if err != nil {
+			return err
+		}
+
+		restored, err := s.receiptsRepo.NewTx(tx).RestoreOne(ctx, receiptId, deviceId)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptsRepo.RestoreOne] Failed to restore receipt: %v [receipt_id: %v]", logTag, err, receiptId),
+			})
+		}
+		if !restored {
+			return hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Code:            http.StatusNotFound,
+				ResponseMessage: "Receipt not found in trash",
+			})
+		}
+
+		return s.auditLogger.record(ctx, tx, logTag, entity.AuditOperationRestore, before)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.searchIndexer.sync(receiptId, deviceId)
+	invalidateSpendingAnalytics(ctx, s.cacheRepo, logTag, deviceId)
+	s.budgetEvaluator.evaluate(deviceId)
+
+	return nil
+}
+
+func (s *receipt) ListTrash(ctx context.Context, req entity.ListTrashRequest) (*entity.ListReceiptsResponse, error) {
+	logTag := s.logTag + "[ListTrash]"
+
+	if req.Limit == 0 {
+		req.Limit = s.defaultPageSize
+	}
+
+	filter := entity.ReceiptFilter{
+		DeviceId:  ctx.Value(hAppconstant.DeviceIdKey).(string),
+		SortBy:    entity.ReceiptSortByDeletedAt,
+		SortOrder: entity.SortOrderDesc,
+		Limit:     req.Limit + 1,
+	}
+
+	if req.Cursor != "" {
+		value, receiptId, err := s.decodeCursor(req.Cursor, filter.SortBy, filter.SortOrder)
+		if err != nil {
+			return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Message:         fmt.Sprintf("%s[s.decodeCursor] Invalid cursor: %v [cursor: %s]", logTag, err, req.Cursor),
+				ResponseMessage: "invalid cursor",
+			})
+		}
+
+		filter.CursorValue = value
+		filter.CursorReceiptId = receiptId
+	}
+
+	receipts, err := s.receiptsRepo.GetManyDeleted(ctx, filter)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptsRepo.GetManyDeleted] Failed to get trashed receipts: %v", logTag, err),
+		})
+	}
+
+	res := entity.ListReceiptsResponse{
+		Receipts: receipts,
+	}
+
+	if len(receipts) > req.Limit {
+		res.Receipts = receipts[:req.Limit]
+		last := res.Receipts[req.Limit-1]
+
+		res.NextCursor = s.encodeCursor(entity.ReceiptCursor{
+			SortBy:    filter.SortBy,
+			SortOrder: filter.SortOrder,
+			Value:     s.cursorValue(last, filter.SortBy),
+			ReceiptId: last.ReceiptId,
+		})
+	}
+
+	return &res, nil
+}
+
+// purgeBatch removes one batch of expired receipts and returns the receipts
+// removed and the files no longer referenced by anything. Everything is read
+// within the transaction, with the receipts locked, so a receipt restored
+// concurrently is either restored first and skipped, or purged first.
+func (s *receipt) purgeBatch(ctx context.Context, logTag string, deletedBefore int64) ([]entity.Receipt, []string, error) {
+	var (
+		purgedReceipts []entity.Receipt
+		filePaths      []string
+	)
+
+	err := s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		receiptsRepo := s.receiptsRepo.NewTx(tx)
+		receiptDetectionHistoriesRepo := s.receiptDetectionHistoriesRepo.NewTx(tx)
+		receiptAttachmentsRepo := s.receiptAttachmentsRepo.NewTx(tx)
+
+		receipts, err := receiptsRepo.GetPurgeable(ctx, deletedBefore, s.purgeBatchSize)
+		if err != nil {
+			return fmt.Errorf("%s[receiptsRepo.GetPurgeable] Failed to get purgeable receipts: %w", logTag, err)
+		}
+		if len(receipts) == 0 {
+			return nil
+		}
+
+		receiptIds := []int64{}
+		for _, receipt := range receipts {
+			receiptIds = append(receiptIds, receipt.ReceiptId)
+		}
+
+		attachments, err := receiptAttachmentsRepo.GetByReceiptIds(ctx, receiptIds)
+		if err != nil {
+			return fmt.Errorf("%s[receiptAttachmentsRepo.GetByReceiptIds] Failed to get attachments: %w [receipt_ids: %v]", logTag, err, receiptIds)
+		}
+
+		receiptIds, err = receiptsRepo.HardDeleteMany(ctx, receiptIds)
+		if err != nil {
+			return fmt.Errorf("%s[receiptsRepo.HardDeleteMany] Failed to delete receipts: %w [receipt_ids: %v]", logTag, err, receiptIds)
+		}
+
+		purged := map[int64]bool{}
+		for _, receiptId := range receiptIds {
+			purged[receiptId] = true
+		}
+
+		imagePaths := map[string]string{}
+		histories := []entity.ReceiptDetectionHistory{}
+
+		for _, receipt := range receipts {
+			if !purged[receipt.ReceiptId] {
+				continue
+			}
+
+			purgedReceipts = append(purgedReceipts, receipt)
+
+			if receipt.ResultId == "" {
+				continue
+			}
+
+			history, err := receiptDetectionHistoriesRepo.GetByResultId(ctx, receipt.ResultId)
+			if err != nil {
+				return fmt.Errorf("%s[receiptDetectionHistoriesRepo.GetByResultId] Failed to get detection history: %w [receipt_id: %v]", logTag, err, receipt.ReceiptId)
+			}
+			if history != nil {
+				imagePaths[receipt.ResultId] = history.ImagePath
+				histories = append(histories, *history)
+			}
+		}
+
+		// Receipts can share a detection result, e.g. both receipts of a
+		// confirmed duplicate pair or a receipt and the image linked to the
+		// receipt it was merged or split into. Its image and history stay
+		// while another receipt still references it.
+		resultIds := []string{}
+		for resultId := range imagePaths {
+			resultIds = append(resultIds, resultId)
+		}
+
+		sharedResultIds, err := receiptsRepo.GetResultIdsInUse(ctx, resultIds, receiptIds)
+		if err != nil {
+			return fmt.Errorf("%s[receiptsRepo.GetResultIdsInUse] Failed to check result references: %w [receipt_ids: %v]", logTag, err, receiptIds)
+		}
+
+		for _, resultId := range sharedResultIds {
+			delete(imagePaths, resultId)
+		}
+
+		purgedHistories := []entity.ReceiptDetectionHistory{}
+		for _, history := range histories {
+			if _, ok := imagePaths[history.ResultId]; ok {
+				purgedHistories = append(purgedHistories, history)
+			}
+		}
+
+		for resultId := range imagePaths {
+			err = receiptDetectionHistoriesRepo.SoftDeleteByResultId(ctx, resultId)
+			if err != nil {
+				return fmt.Errorf("%s[receiptDetectionHistoriesRepo.SoftDeleteByResultId] Failed to delete detection history: %w [result_id: %s]", logTag, err, resultId)
+			}
+		}
+
+		candidates := []string{}
+		for _, imagePath := range imagePaths {
+			candidates = append(candidates, imagePath)
+		}
+		for _, attachment := range attachments {
+			if purged[attachment.ReceiptId] {
+				candidates = append(candidates, attachment.FilePath)
+			}
+		}
+
+		// Merges and splits link detection images to other receipts, so
+		// files still attached to or detected for another receipt are kept.
+		inUse, err := receiptAttachmentsRepo.GetFilePathsInUse(ctx, candidates, receiptIds)
+		if err != nil {
+			return fmt.Errorf("%s[receiptAttachmentsRepo.GetFilePathsInUse] Failed to check file references: %w [receipt_ids: %v]", logTag, err, receiptIds)
+		}
+
+		keep := map[string]bool{}
+		for _, filePath := range inUse {
+			keep[filePath] = true
+		}
+
+		for _, filePath := range candidates {
+			if !keep[filePath] {
+				keep[filePath] = true
+				filePaths = append(filePaths, filePath)
+			}
+		}
+
+		return s.auditLogger.recordPurge(ctx, tx, logTag, purgedReceipts, purgedHistories)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return purgedReceipts, filePaths, nil
+}
+
+func (s *receipt) PurgeTrash(ctx context.Context) (int, error) {
+	logTag := s.logTag + "[PurgeTrash]"
+
+	if s.trashRetention <= 0 {
+		return 0, nil
+	}
+
+	deletedBefore := helper.NowUnixMilli() - s.trashRetention.Milliseconds()
+	purged := 0
+
+	for {
+		receipts, filePaths, err := s.purgeBatch(ctx, logTag, deletedBefore)
+		if err != nil {
+			return purged, err
+		}
+
+		purged += len(receipts)
+
+		// Files are removed only after the commit, and only for receipts that
+		// were actually purged.
+		for _, filePath := range filePaths {
+			err = s.receiptImagesRepo.DeleteOne(ctx, filePath)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"file_path": filePath,
+					"error":     err,
+				}).Errorf("%s[receiptImagesRepo.DeleteOne] Failed to delete file", logTag)
+			}
+		}
+
+		if len(receipts) < s.purgeBatchSize {
+			return purged, nil
+		}
+	}
 }
@@ -0,0 +1,446 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"receipt-detector/entity"
+	"receipt-detector/external/notifier"
+	"receipt-detector/external/ocr"
+	"receipt-detector/repository"
+	"strings"
+
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+	hHelper "github.com/michaelyusak/go-helper/helper"
+	"github.com/sirupsen/logrus"
+)
+
+type receiptAttachment struct {
+	ocrEngine                   ocr.OcrEngine
+	receiptsRepo                repository.Receipts
+	receiptItemsRepo            repository.ReceiptItems
+	receiptAttachmentsRepo      repository.ReceiptAttachments
+	receiptImagesRepo           repository.ReceiptImages
+	receiptDetectionResultsRepo repository.ReceiptDetectionResults
+	deviceSettingsRepo          repository.DeviceSettings
+	cacheRepo                   repository.Cache
+	unitOfWork                  repository.UnitOfWork
+	searchIndexer               *receiptSearchIndexer
+	budgetEvaluator             *budgetEvaluator
+	auditLogger                 *auditLogger
+
+	maxFileSizeMb   float64
+	allowedFileType map[string]bool
+	allowedTypeStr  string
+	maxPerReceipt   int
+
+	logTag string
+}
+
+type ReceiptAttachmentOpts struct {
+	OcrEngine                   ocr.OcrEngine
+	ReceiptsRepo                repository.Receipts
+	ReceiptItemsRepo            repository.ReceiptItems
+	ReceiptAttachmentsRepo      repository.ReceiptAttachments
+	ReceiptImagesRepo           repository.ReceiptImages
+	ReceiptDetectionResultsRepo repository.ReceiptDetectionResults
+	DeviceSettingsRepo          repository.DeviceSettings
+	CacheRepo                   repository.Cache
+	UnitOfWork                  repository.UnitOfWork
+	ReceiptSearchRepo           repository.ReceiptSearch
+	ReceiptTagsRepo             repository.ReceiptTags
+	BudgetsRepo                 repository.Budgets
+	BudgetAlertsRepo            repository.BudgetAlerts
+	SpendingAnalyticsRepo       repository.SpendingAnalytics
+	Notifier                    notifier.Notifier
+	AuditLogsRepo               repository.AuditLogs
+	ReceiptParticipantsRepo     repository.ReceiptParticipants
+	ReceiptItemAssignmentsRepo  repository.ReceiptItemAssignments
+	MaxFileSizeMb               float64
+	AllowedFileType             map[string]bool
+	MaxPerReceipt               int
+}
+
+func NewReceiptAttachmentService(opts ReceiptAttachmentOpts) *receiptAttachment {
+	var allowedFileTypes []string
+
+	for k := range opts.AllowedFileType {
+		allowedFileTypes = append(allowedFileTypes, k)
+	}
+
+	return &receiptAttachment{
+		ocrEngine:                   opts.OcrEngine,
+		receiptsRepo:                opts.ReceiptsRepo,
+		receiptItemsRepo:            opts.ReceiptItemsRepo,
+		receiptAttachmentsRepo:      opts.ReceiptAttachmentsRepo,
+		receiptImagesRepo:           opts.ReceiptImagesRepo,
+		receiptDetectionResultsRepo: opts.ReceiptDetectionResultsRepo,
+		deviceSettingsRepo:          opts.DeviceSettingsRepo,
+		cacheRepo:                   opts.CacheRepo,
+		unitOfWork:                  opts.UnitOfWork,
+		searchIndexer:               newReceiptSearchIndexer(opts.ReceiptsRepo, opts.ReceiptItemsRepo, opts.ReceiptSearchRepo, opts.ReceiptTagsRepo),
+		budgetEvaluator:             newBudgetEvaluator(opts.BudgetsRepo, opts.BudgetAlertsRepo, opts.SpendingAnalyticsRepo, opts.Notifier),
+		auditLogger:                 newAuditLogger(opts.ReceiptsRepo, opts.ReceiptItemsRepo, opts.ReceiptTagsRepo, opts.ReceiptParticipantsRepo, opts.ReceiptItemAssignmentsRepo, opts.AuditLogsRepo),
+
+		maxFileSizeMb:   opts.MaxFileSizeMb,
+		allowedFileType: opts.AllowedFileType,
+		allowedTypeStr:  strings.Join(allowedFileTypes, ", "),
+		maxPerReceipt:   opts.MaxPerReceipt,
+
+		logTag: "[service][receiptAttachment]",
+	}
+}
+
+func (s *receiptAttachment) checkReceipt(ctx context.Context, logTag string, receiptId int64) error {
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	receipt, err := s.receiptsRepo.GetByReceiptId(ctx, receiptId, deviceId)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptsRepo.GetByReceiptId] Failed to get receipt: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+	if receipt == nil {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusNotFound,
+			ResponseMessage: "Receipt not found",
+		})
+	}
+
+	return nil
+}
+
+// deleteFile removes a stored attachment file. Failures are logged since the
+// attachment row is already gone or was never written.
+func (s *receiptAttachment) deleteFile(ctx context.Context, logTag, filePath string) {
+	err := s.receiptImagesRepo.DeleteOne(ctx, filePath)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"file_path": filePath,
+			"error":     err,
+		}).Errorf("%s[receiptImagesRepo.DeleteOne] Failed to delete attachment file", logTag)
+	}
+}
+
+func (s *receiptAttachment) withUrl(ctx context.Context, logTag string, attachment entity.ReceiptAttachment) (entity.ReceiptAttachment, error) {
+	url, err := s.receiptImagesRepo.GetImageUrl(ctx, attachment.FilePath)
+	if err != nil {
+		return attachment, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptImagesRepo.GetImageUrl] Failed to get attachment url: %v [attachment_id: %v]", logTag, err, attachment.AttachmentId),
+		})
+	}
+
+	attachment.Url = url
+
+	return attachment, nil
+}
+
+// detect runs OCR on an image attachment and records the result the same way
+// a detection upload does, returning the result id and the detected items.
+func (s *receiptAttachment) detect(ctx context.Context, logTag string, file multipart.File, fileHeader *multipart.FileHeader, override entity.OcrEngineOptions) (string, []entity.OcrEngineItemDetail, error) {
+	ocrOptions, err := resolveOcrOptions(ctx, logTag, s.deviceSettingsRepo, override)
+	if err != nil {
+		return "", nil, err
+	}
+
+	details, err := s.ocrEngine.DetectReceipt(ctx, file, fileHeader, ocrOptions)
+	if err != nil {
+		return "", nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[ocrEngine.DetectReceipt] Failed detect receipt: %v", logTag, err),
+		})
+	}
+
+	resultId, err := s.receiptDetectionResultsRepo.InsertOne(ctx, details)
+	if err != nil {
+		return "", nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptDetectionResultsRepo.InsertOne] Failed to record ocr result: %v", logTag, err),
+		})
+	}
+
+	return resultId, details, nil
+}
+
+// Upload stores a file as an attachment of the receipt. When OCR is requested
+// for an image, the detected items are appended to the receipt and its total
+// is recomputed.
+func (s *receiptAttachment) Upload(ctx context.Context, receiptId int64, file multipart.File, fileHeader *multipart.FileHeader, req entity.UploadReceiptAttachmentRequest) (*entity.UploadReceiptAttachmentResponse, error) {
+	logTag := s.logTag + "[Upload]"
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	err := s.checkReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := s.receiptAttachmentsRepo.CountByReceiptId(ctx, receiptId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptAttachmentsRepo.CountByReceiptId] Failed to count attachments: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+	if s.maxPerReceipt > 0 && count >= s.maxPerReceipt {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Attachment limit reached [receipt_id: %v][count: %v]", logTag, receiptId, count),
+			ResponseMessage: fmt.Sprintf("A receipt can have at most %d attachments", s.maxPerReceipt),
+		})
+	}
+
+	if fileHeader.Size > int64(s.maxFileSizeMb*1024*1024) {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusRequestEntityTooLarge,
+			Message:         fmt.Sprintf("%s File size too large", logTag),
+			ResponseMessage: "File size too large",
+		})
+	}
+
+	fileTypeOk, contentType, err := hHelper.FileTypeAllowed(fileHeader, s.allowedFileType)
+	if err != nil {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusUnprocessableEntity,
+			Message:         fmt.Sprintf("%s[hHelper.FileTypeAllowed] Failed to detect file type: %v", logTag, err),
+			ResponseMessage: "Corrupted or invalid file",
+		})
+	}
+	if !fileTypeOk {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s File type not allowed: %s", logTag, contentType),
+			ResponseMessage: fmt.Sprintf("File type %s not allowed. List of allowed file types: %s", contentType, s.allowedTypeStr),
+		})
+	}
+
+	kind := entity.AttachmentKindDocument
+	if strings.HasPrefix(contentType, "image/") {
+		kind = entity.AttachmentKindImage
+	}
+
+	if req.Ocr && kind != entity.AttachmentKindImage {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s OCR requested for a document [content_type: %s]", logTag, contentType),
+			ResponseMessage: "ocr is only available for image attachments",
+		})
+	}
+
+	attachment := entity.ReceiptAttachment{
+		ReceiptId:   receiptId,
+		DeviceId:    deviceId,
+		FileName:    fileHeader.Filename,
+		ContentType: contentType,
+		FileSize:    fileHeader.Size,
+		Kind:        kind,
+	}
+
+	receiptItems := []entity.ReceiptItem{}
+
+	if req.Ocr {
+		resultId, details, err := s.detect(ctx, logTag, file, fileHeader, req.OcrEngineOptions)
+		if err != nil {
+			return nil, err
+		}
+
+		attachment.ResultId = &resultId
+
+		for _, detail := range details {
+			receiptItems = append(receiptItems, entity.ReceiptItem{
+				ReceiptId:         receiptId,
+				ItemCategory:      detail.Category,
+				ItemName:          detail.Info.Item,
+				ItemQuantity:      detail.Info.Qty,
+				ItemPriceCurrency: detail.Info.Price.Currency,
+				ItemPriceNumeric:  detail.Info.Price.Numeric,
+			})
+		}
+	}
+
+	attachment.FilePath, err = s.receiptImagesRepo.StoreOne(ctx, contentType, fileHeader)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptImagesRepo.StoreOne] Failed to store attachment: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	err = s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		attachmentId, err := s.receiptAttachmentsRepo.NewTx(tx).InsertOne(ctx, attachment)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptAttachmentsRepo.InsertOne] Failed to insert attachment: %v [receipt_id: %v]", logTag, err, receiptId),
+			})
+		}
+
+		attachment.AttachmentId = attachmentId
+
+		if len(receiptItems) == 0 {
+			return nil
+		}
+
+		before, err := s.auditLogger.snapshot(ctx, tx, logTag, receiptId)
+		if err != nil {
+			return err
+		}
+
+		// Items are inserted one by one so that they are ordered after the
+		// items already on the receipt.
+		for _, receiptItem := range receiptItems {
+			_, err = s.receiptItemsRepo.NewTx(tx).InsertOne(ctx, receiptItem)
+			if err != nil {
+				return hApperror.InternalServerError(hApperror.AppErrorOpt{
+					Message: fmt.Sprintf("%s[receiptItemsRepo.InsertOne] Failed to insert receipt item: %v [receipt_id: %v]", logTag, err, receiptId),
+				})
+			}
+		}
+
+		err = refreshReceiptTotal(ctx, tx, logTag, s.receiptsRepo, s.receiptItemsRepo, receiptId)
+		if err != nil {
+			return err
+		}
+
+		return s.auditLogger.record(ctx, tx, logTag, entity.AuditOperationOcrMerge, before)
+	})
+	if err != nil {
+		s.deleteFile(ctx, logTag, attachment.FilePath)
+		return nil, err
+	}
+
+	if len(receiptItems) > 0 {
+		err = s.cacheRepo.DeleteReceipt(ctx, receiptId)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"receipt_id": receiptId,
+				"error":      err,
+			}).Warnf("%s[cacheRepo.DeleteReceipt] Failed to invalidate cache", logTag)
+		}
+
+		invalidateSpendingAnalytics(ctx, s.cacheRepo, logTag, deviceId)
+		s.searchIndexer.sync(receiptId, deviceId)
+		s.budgetEvaluator.evaluate(deviceId)
+	}
+
+	attachment, err = s.withUrl(ctx, logTag, attachment)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.UploadReceiptAttachmentResponse{
+		Attachment:      attachment,
+		MergedItemCount: len(receiptItems),
+	}, nil
+}
+
+func (s *receiptAttachment) List(ctx context.Context, receiptId int64) (*entity.ListReceiptAttachmentsResponse, error) {
+	logTag := s.logTag + "[List]"
+
+	err := s.checkReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return nil, err
+	}
+
+	attachments, err := s.receiptAttachmentsRepo.GetByReceiptId(ctx, receiptId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptAttachmentsRepo.GetByReceiptId] Failed to get attachments: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	for i := range attachments {
+		attachments[i], err = s.withUrl(ctx, logTag, attachments[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &entity.ListReceiptAttachmentsResponse{
+		Attachments: attachments,
+	}, nil
+}
+
+// Delete removes the attachment and its file. Items merged from its OCR
+// result stay on the receipt.
+func (s *receiptAttachment) Delete(ctx context.Context, receiptId, attachmentId int64) error {
+	logTag := s.logTag + "[Delete]"
+
+	err := s.checkReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return err
+	}
+
+	attachment, err := s.receiptAttachmentsRepo.DeleteOne(ctx, receiptId, attachmentId)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptAttachmentsRepo.DeleteOne] Failed to delete attachment: %v [receipt_id: %v][attachment_id: %v]", logTag, err, receiptId, attachmentId),
+		})
+	}
+	if attachment == nil {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusNotFound,
+			ResponseMessage: "Attachment not found",
+		})
+	}
+
+	// Images linked by a merge or split are shared with the receipt they
+	// were detected for and possibly other attachments.
+	inUse, err := s.receiptAttachmentsRepo.GetFilePathsInUse(ctx, []string{attachment.FilePath}, []int64{})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"attachment_id": attachmentId,
+			"error":         err,
+		}).Warnf("%s[receiptAttachmentsRepo.GetFilePathsInUse] Failed to check file references", logTag)
+
+		return nil
+	}
+	if len(inUse) == 0 {
+		s.deleteFile(ctx, logTag, attachment.FilePath)
+	}
+
+	return nil
+}
+
+func (s *receiptAttachment) Reorder(ctx context.Context, receiptId int64, attachmentIds []int64) error {
+	logTag := s.logTag + "[Reorder]"
+
+	err := s.checkReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return err
+	}
+
+	attachments, err := s.receiptAttachmentsRepo.GetByReceiptId(ctx, receiptId)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptAttachmentsRepo.GetByReceiptId] Failed to get attachments: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	remaining := map[int64]bool{}
+	for _, attachment := range attachments {
+		remaining[attachment.AttachmentId] = true
+	}
+
+	for _, attachmentId := range attachmentIds {
+		if !remaining[attachmentId] {
+			return hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Message:         fmt.Sprintf("%s Unknown or duplicated attachment: %v [receipt_id: %v]", logTag, attachmentId, receiptId),
+				ResponseMessage: fmt.Sprintf("attachment_id %v is unknown or listed more than once", attachmentId),
+			})
+		}
+
+		delete(remaining, attachmentId)
+	}
+
+	if len(remaining) > 0 {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Incomplete attachment order [receipt_id: %v]", logTag, receiptId),
+			ResponseMessage: "attachment_ids must list every attachment of the receipt",
+		})
+	}
+
+	err = s.receiptAttachmentsRepo.UpdateOrder(ctx, receiptId, attachmentIds)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptAttachmentsRepo.UpdateOrder] Failed to reorder attachments: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	return nil
+}
@@ -2,16 +2,19 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"mime/multipart"
 	"net/http"
 	"receipt-detector/entity"
 	"receipt-detector/external/ocr"
+	"receipt-detector/helper"
 	"receipt-detector/repository"
 	"strings"
 	"sync"
 	"time"
 
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
 	hApperror "github.com/michaelyusak/go-helper/apperror"
 	hHelper "github.com/michaelyusak/go-helper/helper"
 	"github.com/sirupsen/logrus"
@@ -23,11 +26,14 @@ type receiptDetection struct {
 	receiptDetectionResultsRepo   repository.ReceiptDetectionResults
 	receiptImagesRepo             repository.ReceiptImages
 	cacheRepo                     repository.Cache
+	deviceSettingsRepo            repository.DeviceSettings
+	auditLogsRepo                 repository.AuditLogs
+	unitOfWork                    repository.UnitOfWork
 
 	maxFileSizeMb   float64
 	allowedFileType map[string]bool
 
-	logTag     string
+	logTag         string
 	allowedTypeStr string
 }
 
@@ -37,6 +43,9 @@ type ReceiptDetectionResultsOpts struct {
 	ReceiptDetectionResultsRepo   repository.ReceiptDetectionResults
 	ReceiptImagesRepo             repository.ReceiptImages
 	CacheRepo                     repository.Cache
+	DeviceSettingsRepo            repository.DeviceSettings
+	AuditLogsRepo                 repository.AuditLogs
+	UnitOfWork                    repository.UnitOfWork
 	MaxFileSizeMb                 float64
 	AllowedFileType               map[string]bool
 }
@@ -54,6 +63,9 @@ func NewReceiptDetectionService(opts ReceiptDetectionResultsOpts) *receiptDetect
 		receiptDetectionResultsRepo:   opts.ReceiptDetectionResultsRepo,
 		receiptImagesRepo:             opts.ReceiptImagesRepo,
 		cacheRepo:                     opts.CacheRepo,
+		deviceSettingsRepo:            opts.DeviceSettingsRepo,
+		auditLogsRepo:                 opts.AuditLogsRepo,
+		unitOfWork:                    opts.UnitOfWork,
 
 		maxFileSizeMb:   opts.MaxFileSizeMb,
 		allowedFileType: opts.AllowedFileType,
@@ -63,7 +75,64 @@ func NewReceiptDetectionService(opts ReceiptDetectionResultsOpts) *receiptDetect
 	}
 }
 
-func (s *receiptDetection) DetectAndStoreReceipt(ctx context.Context, file multipart.File, fileHeader *multipart.FileHeader) (*entity.ReceiptDetectionResult, error) {
+// ownsDetection reports whether the detection history belongs to the device.
+// Histories from before ownership was recorded that no receipt could be
+// backfilled from have no owner, and belong to no device.
+func ownsDetection(history *entity.ReceiptDetectionHistory, deviceId string) bool {
+	return history.DeviceId != "" && history.DeviceId == deviceId
+}
+
+// resolveOcrOptions merges per-request OCR hints over the defaults saved in
+// the device settings. The hints are normalized like device settings are, and
+// unknown codes are rejected.
+func resolveOcrOptions(ctx context.Context, logTag string, deviceSettingsRepo repository.DeviceSettings, override entity.OcrEngineOptions) (entity.OcrEngineOptions, error) {
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	override.Currency = helper.NormalizeCurrency(override.Currency)
+	override.Country = helper.NormalizeCountry(override.Country)
+
+	if override.Currency != "" && !helper.IsKnownCurrency(override.Currency) {
+		return override, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Unknown currency [currency: %s]", logTag, override.Currency),
+			ResponseMessage: fmt.Sprintf("unknown currency %q", override.Currency),
+		})
+	}
+
+	if override.Country != "" && !helper.IsKnownCountry(override.Country) {
+		return override, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Unknown country [country: %s]", logTag, override.Country),
+			ResponseMessage: fmt.Sprintf("unknown country %q", override.Country),
+		})
+	}
+
+	setting, err := deviceSettingsRepo.GetByDeviceId(ctx, deviceId)
+	if err != nil {
+		return override, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[deviceSettingsRepo.GetByDeviceId] Failed to get device setting: %v", logTag, err),
+		})
+	}
+
+	var opts entity.OcrEngineOptions
+	if setting != nil {
+		opts = setting.OcrEngineOptions()
+	}
+
+	if override.Language != "" {
+		opts.Language = override.Language
+	}
+
+	if override.Currency != "" {
+		opts.Currency = override.Currency
+	}
+
+	if override.Country != "" {
+		opts.Country = override.Country
+	}
+
+	return opts, nil
+}
+
+func (s *receiptDetection) DetectAndStoreReceipt(ctx context.Context, file multipart.File, fileHeader *multipart.FileHeader, override entity.OcrEngineOptions) (*entity.ReceiptDetectionResult, error) {
 	logTag := s.logTag + "[DetectAndStoreReceipt]"
 
 	if fileHeader.Size > int64(s.maxFileSizeMb)*1024*1024 {
@@ -90,6 +159,11 @@ func (s *receiptDetection) DetectAndStoreReceipt(ctx context.Context, file multi
 		})
 	}
 
+	ocrOptions, err := resolveOcrOptions(ctx, logTag, s.deviceSettingsRepo, override)
+	if err != nil {
+		return nil, err
+	}
+
 	var wg sync.WaitGroup
 	var fileName, resultId string
 	var itemDetails []entity.OcrEngineItemDetail
@@ -115,7 +189,7 @@ func (s *receiptDetection) DetectAndStoreReceipt(ctx context.Context, file multi
 	go func() {
 		defer wg.Done()
 
-		details, err := s.ocrEngine.DetectReceipt(ctx, file, fileHeader)
+		details, err := s.ocrEngine.DetectReceipt(ctx, file, fileHeader, ocrOptions)
 		if err != nil {
 			errCh <- hApperror.InternalServerError(hApperror.AppErrorOpt{
 				Message: fmt.Sprintf("%s[ocrEngine.DetectReceipt] Failed detect receipt: %v", logTag, err),
@@ -146,22 +220,38 @@ func (s *receiptDetection) DetectAndStoreReceipt(ctx context.Context, file multi
 		}
 	}
 
-	go func(fileName, resultId string, itemDetails []entity.OcrEngineItemDetail) {
-		c, cancel := context.WithTimeout(context.Background(), time.Duration(time.Minute))
-		defer cancel()
-
-		err = s.receiptDetectionHistoriesRepo.InsertOne(c, entity.ReceiptDetectionHistory{
-			ImagePath: fileName,
-			ResultId:  resultId,
+	// The history is written before responding because receipt creation
+	// checks result ownership against it.
+	err = s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		err := s.receiptDetectionHistoriesRepo.NewTx(tx).InsertOne(ctx, entity.ReceiptDetectionHistory{
+			ImagePath:  fileName,
+			ResultId:   resultId,
+			DeviceId:   ctx.Value(hAppconstant.DeviceIdKey).(string),
+			OcrOptions: ocrOptions,
 		})
 		if err != nil {
-			logrus.WithFields(logrus.Fields{
-				"filename":  fileName,
-				"result_id": resultId,
-				"error":     err,
-			}).Errorf("%s[receiptDetectionHistoriesRepo.InsertOne] Failed to insert reciept detection history", logTag)
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptDetectionHistoriesRepo.InsertOne] Failed to insert reciept detection history: %v [result_id: %s]", logTag, err, resultId),
+			})
+		}
+
+		history, err := s.receiptDetectionHistoriesRepo.NewTx(tx).GetByResultId(ctx, resultId)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptDetectionHistoriesRepo.GetByResultId] Failed to get detection history: %v [result_id: %s]", logTag, err, resultId),
+			})
 		}
 
+		return recordDetectionHistory(ctx, tx, logTag, s.auditLogsRepo, entity.AuditOperationDetect, nil, history)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go func(fileName, resultId string, itemDetails []entity.OcrEngineItemDetail) {
+		c, cancel := context.WithTimeout(context.Background(), time.Duration(time.Minute))
+		defer cancel()
+
 		imageUrl, err := s.receiptImagesRepo.GetImageUrl(c, fileName)
 		if err != nil {
 			logrus.WithFields(logrus.Fields{
@@ -194,16 +284,19 @@ func (s *receiptDetection) DetectAndStoreReceipt(ctx context.Context, file multi
 func (s *receiptDetection) GetResult(ctx context.Context, resultId string) (*entity.ReceiptDetectionResult, error) {
 	logTag := s.logTag + "[GetResult]"
 
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
 	history, err := s.receiptDetectionHistoriesRepo.GetByResultId(ctx, resultId)
 	if err != nil {
 		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
 			Message: fmt.Sprintf("%s[receiptDetectionHistoriesRepo.GetByResultId] Failed to get history: %v [result_id: %s]", logTag, err, resultId),
 		})
 	}
-	if history == nil {
+	if history == nil || !ownsDetection(history, deviceId) {
 		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
-			Code:    http.StatusBadRequest,
-			Message: fmt.Sprintf("%s[NilHistory] History not found [result_id: %s]", logTag, resultId),
+			Code:            http.StatusNotFound,
+			Message:         fmt.Sprintf("%s[NilHistory] History not found [result_id: %s]", logTag, resultId),
+			ResponseMessage: "Detection result not found",
 		})
 	}
 
@@ -212,6 +305,15 @@ func (s *receiptDetection) GetResult(ctx context.Context, resultId string) (*ent
 		resultId = history.RevisionId
 	}
 
+	// Image urls are signed with a short expiry, so they are generated on
+	// every read instead of being served from the cache.
+	imageUrl, err := s.receiptImagesRepo.GetImageUrl(ctx, history.ImagePath)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptImagesRepo.GetImageUrl] Failed to get image url: %v [result_id: %s]", logTag, err, resultId),
+		})
+	}
+
 	cachedResult, err := s.cacheRepo.GetReceiptDetectionResult(ctx, resultId)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
@@ -223,6 +325,7 @@ func (s *receiptDetection) GetResult(ctx context.Context, resultId string) (*ent
 		logrus.WithFields(logrus.Fields{
 			"result_id": resultId,
 		}).Infof("%s[CacheFound]", logTag)
+		cachedResult.ImageUrl = imageUrl
 		return cachedResult, nil
 	}
 
@@ -233,13 +336,6 @@ func (s *receiptDetection) GetResult(ctx context.Context, resultId string) (*ent
 		})
 	}
 
-	imageUrl, err := s.receiptImagesRepo.GetImageUrl(ctx, history.ImagePath)
-	if err != nil {
-		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
-			Message: fmt.Sprintf("%s[receiptImagesRepo.GetImageUrl] Failed to get image url: %v [result_id: %s]", logTag, err, resultId),
-		})
-	}
-
 	detectionResult := entity.ReceiptDetectionResult{
 		ResultId: resultId,
 		ImageUrl: imageUrl,
@@ -0,0 +1,504 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"receipt-detector/entity"
+	"receipt-detector/external/notifier"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+// Weights of the duplicate signals. They add up to 1 so the score of a pair is
+// between 0 and 1.
+const (
+	duplicateWeightMerchant = 0.25
+	duplicateWeightDate     = 0.2
+	duplicateWeightTotal    = 0.25
+	duplicateWeightItems    = 0.3
+)
+
+type duplicateDetector struct {
+	receiptsRepo          repository.Receipts
+	receiptItemsRepo      repository.ReceiptItems
+	receiptDuplicatesRepo repository.ReceiptDuplicates
+
+	threshold  float64
+	dateWindow time.Duration
+
+	logTag string
+}
+
+func newDuplicateDetector(receiptsRepo repository.Receipts, receiptItemsRepo repository.ReceiptItems, receiptDuplicatesRepo repository.ReceiptDuplicates, threshold float64, dateWindow time.Duration) *duplicateDetector {
+	if threshold <= 0 {
+		threshold = 0.75
+	}
+
+	if dateWindow <= 0 {
+		dateWindow = 72 * time.Hour
+	}
+
+	return &duplicateDetector{
+		receiptsRepo:          receiptsRepo,
+		receiptItemsRepo:      receiptItemsRepo,
+		receiptDuplicatesRepo: receiptDuplicatesRepo,
+
+		threshold:  threshold,
+		dateWindow: dateWindow,
+
+		logTag: "[service][duplicateDetector]",
+	}
+}
+
+func normalizedTokens(value string) []string {
+	return strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// multisetSimilarity is the Jaccard similarity of two multisets: the shared
+// count over the combined count.
+func multisetSimilarity(a, b map[string]int) float64 {
+	var shared, combined int
+
+	for key, countA := range a {
+		countB := b[key]
+		shared += min(countA, countB)
+		combined += max(countA, countB)
+	}
+
+	for key, countB := range b {
+		if _, ok := a[key]; !ok {
+			combined += countB
+		}
+	}
+
+	if combined == 0 {
+		return 0
+	}
+
+	return float64(shared) / float64(combined)
+}
+
+func merchantSimilarity(a, b string) float64 {
+	tokensA, tokensB := map[string]int{}, map[string]int{}
+
+	for _, token := range normalizedTokens(a) {
+		tokensA[token] = 1
+	}
+
+	for _, token := range normalizedTokens(b) {
+		tokensB[token] = 1
+	}
+
+	return multisetSimilarity(tokensA, tokensB)
+}
+
+// itemKeys identifies purchased items by name and price, so that the same
+// item read slightly differently from two photos still matches.
+func itemKeys(receiptItems []entity.ReceiptItem) map[string]int {
+	keys := map[string]int{}
+
+	for _, receiptItem := range receiptItems {
+		if adjustmentCategory(receiptItem.ItemCategory) != "" {
+			continue
+		}
+
+		currency := helper.NormalizeCurrency(receiptItem.ItemPriceCurrency)
+		key := strings.Join(normalizedTokens(receiptItem.ItemName), " ") + "|" + strconv.FormatInt(helper.ToMinorUnits(receiptItem.ItemPriceNumeric, currency), 10)
+
+		keys[key]++
+	}
+
+	return keys
+}
+
+func totalSimilarity(a, b entity.Receipt) float64 {
+	if a.Total == nil || b.Total == nil {
+		return 0
+	}
+
+	var currencyA, currencyB string
+	if a.TotalCurrency != nil {
+		currencyA = helper.NormalizeCurrency(*a.TotalCurrency)
+	}
+	if b.TotalCurrency != nil {
+		currencyB = helper.NormalizeCurrency(*b.TotalCurrency)
+	}
+
+	if currencyA != currencyB {
+		return 0
+	}
+
+	if helper.ToMinorUnits(*a.Total, currencyA) == helper.ToMinorUnits(*b.Total, currencyB) {
+		return 1
+	}
+
+	// Totals within 2% usually mean one scan misread a line.
+	largest := math.Max(math.Abs(*a.Total), math.Abs(*b.Total))
+	if largest > 0 && math.Abs(*a.Total-*b.Total)/largest <= 0.02 {
+		return 0.5
+	}
+
+	return 0
+}
+
+// scoreDuplicate combines the merchant name, date proximity, total and item
+// set similarity of two receipts into a score between 0 and 1, together with
+// the signals that matched.
+func scoreDuplicate(a entity.Receipt, itemsA []entity.ReceiptItem, b entity.Receipt, itemsB []entity.ReceiptItem, dateWindow time.Duration) (float64, []string) {
+	reasons := []string{}
+
+	merchant := merchantSimilarity(a.ReceiptName, b.ReceiptName)
+	if merchant >= 0.5 {
+		reasons = append(reasons, entity.DuplicateReasonMerchant)
+	}
+
+	var date float64
+	dateDiff := math.Abs(float64(a.ReceiptDate - b.ReceiptDate))
+	if window := float64(dateWindow.Milliseconds()); dateDiff < window {
+		date = 1 - dateDiff/window
+	}
+	if date >= 0.5 {
+		reasons = append(reasons, entity.DuplicateReasonDate)
+	}
+
+	total := totalSimilarity(a, b)
+	if total == 1 {
+		reasons = append(reasons, entity.DuplicateReasonTotal)
+	}
+
+	items := multisetSimilarity(itemKeys(itemsA), itemKeys(itemsB))
+	if items >= 0.5 {
+		reasons = append(reasons, entity.DuplicateReasonItems)
+	}
+
+	score := merchant*duplicateWeightMerchant + date*duplicateWeightDate + total*duplicateWeightTotal + items*duplicateWeightItems
+
+	return math.Round(score*1000) / 1000, reasons
+}
+
+// detect scores the receipt against the other receipts of its device within
+// the date window and records every pair above the threshold. The receipt
+// must carry its id, device, name, date and total.
+func (d *duplicateDetector) detect(ctx context.Context, receipt entity.Receipt, receiptItems []entity.ReceiptItem) ([]entity.DuplicateWarning, error) {
+	window := d.dateWindow.Milliseconds()
+
+	candidates, err := d.receiptsRepo.GetByDateRange(ctx, receipt.DeviceId, receipt.ReceiptDate-window, receipt.ReceiptDate+window)
+	if err != nil {
+		return nil, fmt.Errorf("%s[receiptsRepo.GetByDateRange] %w [receipt_id: %v]", d.logTag, err, receipt.ReceiptId)
+	}
+
+	candidateIds := []int64{}
+	for _, candidate := range candidates {
+		if candidate.ReceiptId != receipt.ReceiptId {
+			candidateIds = append(candidateIds, candidate.ReceiptId)
+		}
+	}
+
+	warnings := []entity.DuplicateWarning{}
+
+	if len(candidateIds) == 0 {
+		return warnings, nil
+	}
+
+	candidateItems, err := d.receiptItemsRepo.GetByReceiptIds(ctx, candidateIds)
+	if err != nil {
+		return nil, fmt.Errorf("%s[receiptItemsRepo.GetByReceiptIds] %w [receipt_id: %v]", d.logTag, err, receipt.ReceiptId)
+	}
+
+	itemsByReceipt := map[int64][]entity.ReceiptItem{}
+	for _, receiptItem := range candidateItems {
+		itemsByReceipt[receiptItem.ReceiptId] = append(itemsByReceipt[receiptItem.ReceiptId], receiptItem)
+	}
+
+	duplicates := []entity.ReceiptDuplicate{}
+
+	for _, candidate := range candidates {
+		if candidate.ReceiptId == receipt.ReceiptId {
+			continue
+		}
+
+		score, reasons := scoreDuplicate(receipt, receiptItems, candidate, itemsByReceipt[candidate.ReceiptId], d.dateWindow)
+		if score < d.threshold {
+			continue
+		}
+
+		warnings = append(warnings, entity.DuplicateWarning{
+			ReceiptId: candidate.ReceiptId,
+			Score:     score,
+			Reasons:   reasons,
+		})
+
+		duplicates = append(duplicates, entity.ReceiptDuplicate{
+			DeviceId:           receipt.DeviceId,
+			ReceiptId:          min(receipt.ReceiptId, candidate.ReceiptId),
+			DuplicateReceiptId: max(receipt.ReceiptId, candidate.ReceiptId),
+			Score:              score,
+			Reasons:            reasons,
+		})
+	}
+
+	err = d.receiptDuplicatesRepo.UpsertMany(ctx, duplicates)
+	if err != nil {
+		return nil, fmt.Errorf("%s[receiptDuplicatesRepo.UpsertMany] %w [receipt_id: %v]", d.logTag, err, receipt.ReceiptId)
+	}
+
+	sort.SliceStable(warnings, func(i, j int) bool {
+		return warnings[i].Score > warnings[j].Score
+	})
+
+	return warnings, nil
+}
+
+type receiptDuplicate struct {
+	receiptsRepo          repository.Receipts
+	receiptItemsRepo      repository.ReceiptItems
+	receiptDuplicatesRepo repository.ReceiptDuplicates
+	cacheRepo             repository.Cache
+	unitOfWork            repository.UnitOfWork
+	duplicateDetector     *duplicateDetector
+	searchIndexer         *receiptSearchIndexer
+	budgetEvaluator       *budgetEvaluator
+	auditLogger           *auditLogger
+
+	scanBatchSize int
+	defaultLimit  int
+
+	logTag string
+}
+
+type ReceiptDuplicateOpts struct {
+	ReceiptsRepo               repository.Receipts
+	ReceiptItemsRepo           repository.ReceiptItems
+	ReceiptDuplicatesRepo      repository.ReceiptDuplicates
+	CacheRepo                  repository.Cache
+	UnitOfWork                 repository.UnitOfWork
+	ReceiptSearchRepo          repository.ReceiptSearch
+	ReceiptTagsRepo            repository.ReceiptTags
+	BudgetsRepo                repository.Budgets
+	BudgetAlertsRepo           repository.BudgetAlerts
+	SpendingAnalyticsRepo      repository.SpendingAnalytics
+	Notifier                   notifier.Notifier
+	AuditLogsRepo              repository.AuditLogs
+	ReceiptParticipantsRepo    repository.ReceiptParticipants
+	ReceiptItemAssignmentsRepo repository.ReceiptItemAssignments
+	Threshold                  float64
+	DateWindow                 time.Duration
+}
+
+func NewReceiptDuplicateService(opts ReceiptDuplicateOpts) *receiptDuplicate {
+	return &receiptDuplicate{
+		receiptsRepo:          opts.ReceiptsRepo,
+		receiptItemsRepo:      opts.ReceiptItemsRepo,
+		receiptDuplicatesRepo: opts.ReceiptDuplicatesRepo,
+		cacheRepo:             opts.CacheRepo,
+		unitOfWork:            opts.UnitOfWork,
+		duplicateDetector:     newDuplicateDetector(opts.ReceiptsRepo, opts.ReceiptItemsRepo, opts.ReceiptDuplicatesRepo, opts.Threshold, opts.DateWindow),
+		searchIndexer:         newReceiptSearchIndexer(opts.ReceiptsRepo, opts.ReceiptItemsRepo, opts.ReceiptSearchRepo, opts.ReceiptTagsRepo),
+		budgetEvaluator:       newBudgetEvaluator(opts.BudgetsRepo, opts.BudgetAlertsRepo, opts.SpendingAnalyticsRepo, opts.Notifier),
+		auditLogger:           newAuditLogger(opts.ReceiptsRepo, opts.ReceiptItemsRepo, opts.ReceiptTagsRepo, opts.ReceiptParticipantsRepo, opts.ReceiptItemAssignmentsRepo, opts.AuditLogsRepo),
+
+		scanBatchSize: 500,
+		defaultLimit:  20,
+
+		logTag: "[service][receiptDuplicate]",
+	}
+}
+
+// List returns the suspected pairs of the device. Pairs are found when a
+// receipt is created or imported and by Scan; receipts made by splitting
+// another one are only checked by Scan, since their items already belonged to
+// a receipt of the device.
+func (s *receiptDuplicate) List(ctx context.Context, req entity.ListReceiptDuplicatesRequest) (*entity.ListReceiptDuplicatesResponse, error) {
+	logTag := s.logTag + "[List]"
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	if req.Status == "" {
+		req.Status = entity.DuplicateStatusPending
+	}
+
+	if req.Limit == 0 {
+		req.Limit = s.defaultLimit
+	}
+
+	duplicates, err := s.receiptDuplicatesRepo.GetMany(ctx, deviceId, req.Status, req.Limit)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptDuplicatesRepo.GetMany] Failed to get duplicates: %v", logTag, err),
+		})
+	}
+
+	return &entity.ListReceiptDuplicatesResponse{
+		Duplicates: duplicates,
+	}, nil
+}
+
+// Resolve dismisses a suspected pair or confirms it. Confirming moves the
+// receipt other than the kept one to the trash, where it can still be
+// restored.
+func (s *receiptDuplicate) Resolve(ctx context.Context, req entity.ResolveReceiptDuplicateRequest) error {
+	logTag := s.logTag + "[Resolve]"
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	duplicate, err := s.receiptDuplicatesRepo.GetByDuplicateId(ctx, req.DuplicateId, deviceId)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptDuplicatesRepo.GetByDuplicateId] Failed to get duplicate: %v [duplicate_id: %v]", logTag, err, req.DuplicateId),
+		})
+	}
+	if duplicate == nil {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusNotFound,
+			ResponseMessage: "Duplicate not found",
+		})
+	}
+
+	status := entity.DuplicateStatusDismissed
+	var removedReceiptId int64
+
+	if req.Action == entity.DuplicateActionConfirm {
+		status = entity.DuplicateStatusConfirmed
+
+		switch req.KeepReceiptId {
+		case duplicate.ReceiptId:
+			removedReceiptId = duplicate.DuplicateReceiptId
+		case duplicate.DuplicateReceiptId:
+			removedReceiptId = duplicate.ReceiptId
+		default:
+			return hApperror.BadRequestError(hApperror.AppErrorOpt{
+				ResponseMessage: "keep_receipt_id must be one of the receipts of the pair",
+			})
+		}
+	}
+
+	alreadyResolved := hApperror.BadRequestError(hApperror.AppErrorOpt{
+		Code:            http.StatusConflict,
+		Message:         fmt.Sprintf("%s Duplicate already resolved [duplicate_id: %v]", logTag, req.DuplicateId),
+		ResponseMessage: "Duplicate has already been resolved",
+	})
+
+	err = s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		updated, err := s.receiptDuplicatesRepo.NewTx(tx).UpdateStatus(ctx, req.DuplicateId, status)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptDuplicatesRepo.UpdateStatus] Failed to resolve duplicate: %v [duplicate_id: %v]", logTag, err, req.DuplicateId),
+			})
+		}
+		if !updated {
+			return alreadyResolved
+		}
+
+		if removedReceiptId == 0 {
+			return nil
+		}
+
+		before, err := s.auditLogger.snapshot(ctx, tx, logTag, removedReceiptId)
+		if err != nil {
+			return err
+		}
+
+		deleted, err := s.receiptsRepo.NewTx(tx).SoftDeleteOne(ctx, removedReceiptId, deviceId)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptsRepo.SoftDeleteOne] Failed to delete receipt: %v [receipt_id: %v]", logTag, err, removedReceiptId),
+			})
+		}
+		if !deleted {
+			return hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Code:            http.StatusConflict,
+				Message:         fmt.Sprintf("%s Receipt already deleted [receipt_id: %v]", logTag, removedReceiptId),
+				ResponseMessage: "The duplicate receipt has already been deleted",
+			})
+		}
+
+		return s.auditLogger.record(ctx, tx, logTag, entity.AuditOperationResolve, before)
+	})
+	if err != nil {
+		return err
+	}
+
+	if removedReceiptId == 0 {
+		return nil
+	}
+
+	err = s.cacheRepo.DeleteReceipt(ctx, removedReceiptId)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"receipt_id": removedReceiptId,
+			"error":      err,
+		}).Warnf("%s[cacheRepo.DeleteReceipt] Failed to invalidate cache", logTag)
+	}
+
+	s.searchIndexer.sync(removedReceiptId, deviceId)
+	invalidateSpendingAnalytics(ctx, s.cacheRepo, logTag, deviceId)
+	s.budgetEvaluator.evaluate(deviceId)
+
+	return nil
+}
+
+// Scan runs the detector over every live receipt of every device and returns
+// the number of suspected pairs found. Known pairs keep their resolution.
+func (s *receiptDuplicate) Scan(ctx context.Context) (int, error) {
+	logTag := s.logTag + "[Scan]"
+
+	found := 0
+	var afterReceiptId int64
+
+	for {
+		receipts, err := s.receiptsRepo.GetAfterId(ctx, afterReceiptId, s.scanBatchSize)
+		if err != nil {
+			return found, fmt.Errorf("%s[receiptsRepo.GetAfterId] Failed to get receipts: %w [after_receipt_id: %v]", logTag, err, afterReceiptId)
+		}
+
+		for _, receipt := range receipts {
+			afterReceiptId = receipt.ReceiptId
+
+			stored, err := s.receiptsRepo.GetByReceiptId(ctx, receipt.ReceiptId, receipt.DeviceId)
+			if err != nil {
+				return found, fmt.Errorf("%s[receiptsRepo.GetByReceiptId] Failed to get receipt: %w [receipt_id: %v]", logTag, err, receipt.ReceiptId)
+			}
+			if stored == nil {
+				continue
+			}
+
+			stored.DeviceId = receipt.DeviceId
+
+			receiptItems, err := s.receiptItemsRepo.GetByReceiptId(ctx, receipt.ReceiptId)
+			if err != nil {
+				return found, fmt.Errorf("%s[receiptItemsRepo.GetByReceiptId] Failed to get receipt items: %w [receipt_id: %v]", logTag, err, receipt.ReceiptId)
+			}
+
+			warnings, err := s.duplicateDetector.detect(ctx, *stored, receiptItems)
+			if err != nil {
+				return found, err
+			}
+
+			// Every pair is seen from both receipts, so only count it from
+			// the receipt with the higher id.
+			for _, warning := range warnings {
+				if warning.ReceiptId < receipt.ReceiptId {
+					found++
+				}
+			}
+		}
+
+		if len(receipts) < s.scanBatchSize {
+			return found, nil
+		}
+	}
+}
@@ -0,0 +1,437 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+	"strconv"
+	"strings"
+	"time"
+
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+)
+
+type receiptExportColumn func(receipt entity.Receipt, item *entity.ReceiptItem) helper.XlsxCell
+
+var (
+	receiptExportColumns = map[string]receiptExportColumn{
+		entity.ReceiptExportColumnReceiptId: func(receipt entity.Receipt, item *entity.ReceiptItem) helper.XlsxCell {
+			return exportInt(receipt.ReceiptId)
+		},
+		entity.ReceiptExportColumnReceiptName: func(receipt entity.Receipt, item *entity.ReceiptItem) helper.XlsxCell {
+			return helper.XlsxCell{Text: receipt.ReceiptName}
+		},
+		entity.ReceiptExportColumnReceiptDate: func(receipt entity.Receipt, item *entity.ReceiptItem) helper.XlsxCell {
+			return helper.XlsxCell{Text: time.UnixMilli(receipt.ReceiptDate).UTC().Format(time.DateTime)}
+		},
+		entity.ReceiptExportColumnReceiptTotal: func(receipt entity.Receipt, item *entity.ReceiptItem) helper.XlsxCell {
+			if receipt.Total == nil {
+				return helper.XlsxCell{}
+			}
+
+			var currency string
+			if receipt.TotalCurrency != nil {
+				currency = *receipt.TotalCurrency
+			}
+
+			return exportAmount(*receipt.Total, currency)
+		},
+		entity.ReceiptExportColumnReceiptCurrency: func(receipt entity.Receipt, item *entity.ReceiptItem) helper.XlsxCell {
+			if receipt.TotalCurrency == nil {
+				return helper.XlsxCell{}
+			}
+
+			return helper.XlsxCell{Text: *receipt.TotalCurrency}
+		},
+		entity.ReceiptExportColumnReceiptItemId: func(receipt entity.Receipt, item *entity.ReceiptItem) helper.XlsxCell {
+			if item == nil {
+				return helper.XlsxCell{}
+			}
+
+			return exportInt(item.ReceiptItemId)
+		},
+		entity.ReceiptExportColumnItemCategory: func(receipt entity.Receipt, item *entity.ReceiptItem) helper.XlsxCell {
+			if item == nil {
+				return helper.XlsxCell{}
+			}
+
+			return helper.XlsxCell{Text: item.ItemCategory}
+		},
+		entity.ReceiptExportColumnItemName: func(receipt entity.Receipt, item *entity.ReceiptItem) helper.XlsxCell {
+			if item == nil {
+				return helper.XlsxCell{}
+			}
+
+			return helper.XlsxCell{Text: item.ItemName}
+		},
+		entity.ReceiptExportColumnItemQuantity: func(receipt entity.Receipt, item *entity.ReceiptItem) helper.XlsxCell {
+			if item == nil || item.ItemQuantity == nil {
+				return helper.XlsxCell{}
+			}
+
+			return exportInt(int64(*item.ItemQuantity))
+		},
+		entity.ReceiptExportColumnItemPriceCurrency: func(receipt entity.Receipt, item *entity.ReceiptItem) helper.XlsxCell {
+			if item == nil {
+				return helper.XlsxCell{}
+			}
+
+			return helper.XlsxCell{Text: item.ItemPriceCurrency}
+		},
+		entity.ReceiptExportColumnItemPriceNumeric: func(receipt entity.Receipt, item *entity.ReceiptItem) helper.XlsxCell {
+			if item == nil {
+				return helper.XlsxCell{}
+			}
+
+			return exportAmount(item.ItemPriceNumeric, item.ItemPriceCurrency)
+		},
+		entity.ReceiptExportColumnItemAmount: func(receipt entity.Receipt, item *entity.ReceiptItem) helper.XlsxCell {
+			if item == nil {
+				return helper.XlsxCell{}
+			}
+
+			amount, _ := itemAmount(*item, item.ItemPriceCurrency)
+
+			return exportAmount(helper.FromMinorUnits(amount, item.ItemPriceCurrency), item.ItemPriceCurrency)
+		},
+	}
+
+	defaultReceiptExportColumns = []string{
+		entity.ReceiptExportColumnReceiptId,
+		entity.ReceiptExportColumnReceiptName,
+		entity.ReceiptExportColumnReceiptDate,
+		entity.ReceiptExportColumnReceiptTotal,
+		entity.ReceiptExportColumnReceiptCurrency,
+		entity.ReceiptExportColumnReceiptItemId,
+		entity.ReceiptExportColumnItemCategory,
+		entity.ReceiptExportColumnItemName,
+		entity.ReceiptExportColumnItemQuantity,
+		entity.ReceiptExportColumnItemPriceCurrency,
+		entity.ReceiptExportColumnItemPriceNumeric,
+		entity.ReceiptExportColumnItemAmount,
+	}
+)
+
+func exportInt(value int64) helper.XlsxCell {
+	number := float64(value)
+
+	return helper.XlsxCell{
+		Text:   strconv.FormatInt(value, 10),
+		Number: &number,
+	}
+}
+
+// exportAmount renders an amount with the decimals of its currency so that
+// the same receipt always exports to the same text.
+func exportAmount(amount float64, currency string) helper.XlsxCell {
+	rounded := helper.RoundCurrency(amount, currency)
+
+	return helper.XlsxCell{
+		Text:     helper.FormatCurrency(amount, currency),
+		Number:   &rounded,
+		Decimals: helper.CurrencyMinorUnits(currency),
+	}
+}
+
+type receiptExportWriter interface {
+	WriteRow(cells []helper.XlsxCell) error
+	Close() error
+}
+
+type csvReceiptExportWriter struct {
+	writer *csv.Writer
+}
+
+// WriteRow prefixes text that a spreadsheet would evaluate as a formula.
+func (w *csvReceiptExportWriter) WriteRow(cells []helper.XlsxCell) error {
+	record := make([]string, len(cells))
+
+	for i, cell := range cells {
+		record[i] = cell.Text
+
+		if cell.Number == nil && cell.Text != "" && strings.ContainsRune("=+-@", rune(cell.Text[0])) {
+			record[i] = "'" + cell.Text
+		}
+	}
+
+	return w.writer.Write(record)
+}
+
+func (w *csvReceiptExportWriter) Close() error {
+	w.writer.Flush()
+
+	return w.writer.Error()
+}
+
+type receiptExport struct {
+	receiptsRepo     repository.Receipts
+	receiptItemsRepo repository.ReceiptItems
+
+	ledgerPaymentAccount   string
+	ledgerDefaultAccount   string
+	ledgerCategoryAccounts map[string]string
+
+	batchSize int
+
+	logTag string
+}
+
+type ReceiptExportOpts struct {
+	ReceiptsRepo           repository.Receipts
+	ReceiptItemsRepo       repository.ReceiptItems
+	LedgerPaymentAccount   string
+	LedgerDefaultAccount   string
+	LedgerCategoryAccounts map[string]string
+}
+
+// NewReceiptExportService fails on a configured ledger account that the
+// journal syntax can not hold, so that a typo is caught at startup rather than
+// in every export.
+func NewReceiptExportService(opts ReceiptExportOpts) (*receiptExport, error) {
+	s := &receiptExport{
+		receiptsRepo:     opts.ReceiptsRepo,
+		receiptItemsRepo: opts.ReceiptItemsRepo,
+
+		ledgerPaymentAccount:   opts.LedgerPaymentAccount,
+		ledgerDefaultAccount:   opts.LedgerDefaultAccount,
+		ledgerCategoryAccounts: map[string]string{},
+
+		batchSize: 100,
+
+		logTag: "[service][receiptExport]",
+	}
+
+	if s.ledgerPaymentAccount == "" {
+		s.ledgerPaymentAccount = "Assets:Cash"
+	}
+
+	if s.ledgerDefaultAccount == "" {
+		s.ledgerDefaultAccount = "Expenses:Uncategorized"
+	}
+
+	if !isValidLedgerAccount(s.ledgerPaymentAccount) {
+		return nil, fmt.Errorf("%s invalid ledger payment account %q", s.logTag, s.ledgerPaymentAccount)
+	}
+
+	if !isValidLedgerAccount(s.ledgerDefaultAccount) {
+		return nil, fmt.Errorf("%s invalid ledger default account %q", s.logTag, s.ledgerDefaultAccount)
+	}
+
+	for category, account := range opts.LedgerCategoryAccounts {
+		if !isValidLedgerAccount(account) {
+			return nil, fmt.Errorf("%s invalid ledger account %q for category %q", s.logTag, account, category)
+		}
+
+		s.ledgerCategoryAccounts[strings.ToLower(strings.TrimSpace(category))] = account
+	}
+
+	return s, nil
+}
+
+func (s *receiptExport) parseColumns(columns string) ([]string, error) {
+	if strings.TrimSpace(columns) == "" {
+		return defaultReceiptExportColumns, nil
+	}
+
+	parsed := []string{}
+
+	for _, column := range strings.Split(columns, ",") {
+		column = strings.TrimSpace(column)
+
+		_, ok := receiptExportColumns[column]
+		if !ok {
+			return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Message:         fmt.Sprintf("%s[parseColumns] Unknown column [column: %s]", s.logTag, column),
+				ResponseMessage: fmt.Sprintf("unknown column %q", column),
+			})
+		}
+
+		parsed = append(parsed, column)
+	}
+
+	return parsed, nil
+}
+
+func (s *receiptExport) newWriter(format string, w io.Writer) (receiptExportWriter, error) {
+	if format == entity.ReceiptExportFormatXlsx {
+		return helper.NewXlsxWriter(w, "Receipts")
+	}
+
+	return &csvReceiptExportWriter{writer: csv.NewWriter(w)}, nil
+}
+
+func (s *receiptExport) validateFilter(logTag string, filter entity.ReceiptExportFilter) error {
+	if filter.DateFrom != nil && filter.DateTo != nil && *filter.DateFrom >= *filter.DateTo {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Invalid date range [date_from: %v][date_to: %v]", logTag, *filter.DateFrom, *filter.DateTo),
+			ResponseMessage: "date_from must be before date_to",
+		})
+	}
+
+	return nil
+}
+
+// forEachBatch pages through the receipts matching the filter, oldest first,
+// and passes each page to fn together with the items of its receipts.
+func (s *receiptExport) forEachBatch(ctx context.Context, logTag string, exportFilter entity.ReceiptExportFilter, fn func(receipts []entity.Receipt, itemsByReceipt map[int64][]entity.ReceiptItem) error) error {
+	filter := entity.ReceiptFilter{
+		DeviceId:  ctx.Value(hAppconstant.DeviceIdKey).(string),
+		SortBy:    entity.ReceiptSortByReceiptDate,
+		SortOrder: entity.SortOrderAsc,
+		DateFrom:  exportFilter.DateFrom,
+		DateTo:    exportFilter.DateTo,
+		Name:      exportFilter.Name,
+		Category:  exportFilter.Category,
+		Currency:  exportFilter.Currency,
+		AmountMin: exportFilter.AmountMin,
+		AmountMax: exportFilter.AmountMax,
+		Limit:     s.batchSize,
+	}
+
+	for {
+		receipts, err := s.receiptsRepo.GetMany(ctx, filter)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptsRepo.GetMany] Failed to get receipts: %v", logTag, err),
+			})
+		}
+
+		if len(receipts) == 0 {
+			return nil
+		}
+
+		receiptIds := make([]int64, len(receipts))
+		for i, receipt := range receipts {
+			receiptIds[i] = receipt.ReceiptId
+		}
+
+		items, err := s.receiptItemsRepo.GetByReceiptIds(ctx, receiptIds)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptItemsRepo.GetByReceiptIds] Failed to get receipt items: %v", logTag, err),
+			})
+		}
+
+		itemsByReceipt := map[int64][]entity.ReceiptItem{}
+		for _, item := range items {
+			itemsByReceipt[item.ReceiptId] = append(itemsByReceipt[item.ReceiptId], item)
+		}
+
+		err = fn(receipts, itemsByReceipt)
+		if err != nil {
+			return err
+		}
+
+		if len(receipts) < s.batchSize {
+			return nil
+		}
+
+		last := receipts[len(receipts)-1]
+		filter.CursorValue = last.ReceiptDate
+		filter.CursorReceiptId = last.ReceiptId
+	}
+}
+
+// Export streams every receipt matching the request as one row per item,
+// oldest first. Receipts without items still get a row so that they are not
+// silently missing from the export.
+func (s *receiptExport) Export(ctx context.Context, req entity.ExportReceiptsRequest, w io.Writer) error {
+	logTag := s.logTag + "[Export]"
+
+	if req.Format == "" {
+		req.Format = entity.ReceiptExportFormatCsv
+	}
+
+	if req.Format != entity.ReceiptExportFormatCsv && req.Format != entity.ReceiptExportFormatXlsx {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Invalid format [format: %s]", logTag, req.Format),
+			ResponseMessage: "format must be csv or xlsx",
+		})
+	}
+
+	err := s.validateFilter(logTag, req.ReceiptExportFilter)
+	if err != nil {
+		return err
+	}
+
+	columns, err := s.parseColumns(req.Columns)
+	if err != nil {
+		return err
+	}
+
+	writer, err := s.newWriter(req.Format, w)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[s.newWriter] Failed to create writer: %v", logTag, err),
+		})
+	}
+
+	header := make([]helper.XlsxCell, len(columns))
+	for i, column := range columns {
+		header[i] = helper.XlsxCell{Text: column}
+	}
+
+	err = writer.WriteRow(header)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[writer.WriteRow] Failed to write header: %v", logTag, err),
+		})
+	}
+
+	writeRow := func(receipt entity.Receipt, item *entity.ReceiptItem) error {
+		row := make([]helper.XlsxCell, len(columns))
+		for i, column := range columns {
+			row[i] = receiptExportColumns[column](receipt, item)
+		}
+
+		err := writer.WriteRow(row)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[writer.WriteRow] Failed to write row: %v [receipt_id: %v]", logTag, err, receipt.ReceiptId),
+			})
+		}
+
+		return nil
+	}
+
+	err = s.forEachBatch(ctx, logTag, req.ReceiptExportFilter, func(receipts []entity.Receipt, itemsByReceipt map[int64][]entity.ReceiptItem) error {
+		for _, receipt := range receipts {
+			receiptItems := itemsByReceipt[receipt.ReceiptId]
+
+			if len(receiptItems) == 0 {
+				err := writeRow(receipt, nil)
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			for i := range receiptItems {
+				err := writeRow(receipt, &receiptItems[i])
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[writer.Close] Failed to finish export: %v", logTag, err),
+		})
+	}
+
+	return nil
+}
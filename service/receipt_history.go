@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"receipt-detector/entity"
+	"receipt-detector/repository"
+	"sort"
+
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+)
+
+type receiptHistory struct {
+	auditLogsRepo repository.AuditLogs
+
+	logTag string
+}
+
+type ReceiptHistoryOpts struct {
+	AuditLogsRepo repository.AuditLogs
+}
+
+func NewReceiptHistoryService(opts ReceiptHistoryOpts) *receiptHistory {
+	return &receiptHistory{
+		auditLogsRepo: opts.AuditLogsRepo,
+
+		logTag: "[service][receiptHistory]",
+	}
+}
+
+// stateAt returns the state of one entity at asOf from its entries, oldest
+// first. Before the first entry the entity is in the state that entry started
+// from, which covers receipts that existed before the audit log did.
+func stateAt(entries []entity.AuditLog, asOf int64) json.RawMessage {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	state := entries[0].BeforeData
+
+	for _, entry := range entries {
+		if entry.CreatedAt > asOf {
+			break
+		}
+
+		state = entry.AfterData
+	}
+
+	return state
+}
+
+func (s *receiptHistory) rebuild(logTag string, receiptId int64, entries []entity.AuditLog, asOf int64) (*entity.ReceiptState, error) {
+	receiptEntries := []entity.AuditLog{}
+	itemEntries := map[string][]entity.AuditLog{}
+	tagEntries := []entity.AuditLog{}
+	participantEntries := map[string][]entity.AuditLog{}
+	assignmentEntries := map[string][]entity.AuditLog{}
+
+	for _, entry := range entries {
+		switch entry.EntityType {
+		case entity.AuditEntityReceipt:
+			receiptEntries = append(receiptEntries, entry)
+		case entity.AuditEntityReceiptItem:
+			itemEntries[entry.EntityId] = append(itemEntries[entry.EntityId], entry)
+		case entity.AuditEntityReceiptTags:
+			tagEntries = append(tagEntries, entry)
+		case entity.AuditEntityReceiptParticipant:
+			participantEntries[entry.EntityId] = append(participantEntries[entry.EntityId], entry)
+		case entity.AuditEntityReceiptItemAssignments:
+			assignmentEntries[entry.EntityId] = append(assignmentEntries[entry.EntityId], entry)
+		}
+	}
+
+	state := entity.ReceiptState{
+		AsOf:         asOf,
+		ReceiptItems: []entity.ReceiptItem{},
+		TagIds:       []int64{},
+		Participants: []entity.ReceiptParticipant{},
+		Assignments:  []entity.ReceiptItemAssignment{},
+	}
+
+	receiptData := stateAt(receiptEntries, asOf)
+	if len(receiptData) == 0 || string(receiptData) == "null" {
+		return &state, nil
+	}
+
+	err := json.Unmarshal(receiptData, &state.Receipt)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[json.Unmarshal] Failed to decode receipt state: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	for receiptItemId, entries := range itemEntries {
+		itemData := stateAt(entries, asOf)
+		if len(itemData) == 0 || string(itemData) == "null" {
+			continue
+		}
+
+		var receiptItem entity.ReceiptItem
+
+		err = json.Unmarshal(itemData, &receiptItem)
+		if err != nil {
+			return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[json.Unmarshal] Failed to decode receipt item state: %v [receipt_item_id: %s]", logTag, err, receiptItemId),
+			})
+		}
+
+		// Items moved away by a merge or split are logged on both receipts.
+		if receiptItem.ReceiptId != receiptId {
+			continue
+		}
+
+		state.ReceiptItems = append(state.ReceiptItems, receiptItem)
+	}
+
+	sort.Slice(state.ReceiptItems, func(i, j int) bool {
+		a, b := state.ReceiptItems[i], state.ReceiptItems[j]
+		if a.ItemOrder != b.ItemOrder {
+			return a.ItemOrder < b.ItemOrder
+		}
+
+		return a.ReceiptItemId < b.ReceiptItemId
+	})
+
+	summary := summarizeReceiptItems(state.ReceiptItems)
+	state.Receipt.Summary = &summary
+
+	tagData := stateAt(tagEntries, asOf)
+	if len(tagData) > 0 && string(tagData) != "null" {
+		err = json.Unmarshal(tagData, &state.TagIds)
+		if err != nil {
+			return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[json.Unmarshal] Failed to decode receipt tags state: %v [receipt_id: %v]", logTag, err, receiptId),
+			})
+		}
+	}
+
+	for participantId, entries := range participantEntries {
+		participantData := stateAt(entries, asOf)
+		if len(participantData) == 0 || string(participantData) == "null" {
+			continue
+		}
+
+		var participant entity.ReceiptParticipant
+
+		err = json.Unmarshal(participantData, &participant)
+		if err != nil {
+			return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[json.Unmarshal] Failed to decode participant state: %v [participant_id: %s]", logTag, err, participantId),
+			})
+		}
+
+		state.Participants = append(state.Participants, participant)
+	}
+
+	sort.Slice(state.Participants, func(i, j int) bool {
+		return state.Participants[i].ParticipantId < state.Participants[j].ParticipantId
+	})
+
+	onReceipt := map[int64]bool{}
+	for _, receiptItem := range state.ReceiptItems {
+		onReceipt[receiptItem.ReceiptItemId] = true
+	}
+
+	for receiptItemId, entries := range assignmentEntries {
+		assignmentData := stateAt(entries, asOf)
+		if len(assignmentData) == 0 || string(assignmentData) == "null" {
+			continue
+		}
+
+		var assignments []entity.ReceiptItemAssignment
+
+		err = json.Unmarshal(assignmentData, &assignments)
+		if err != nil {
+			return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[json.Unmarshal] Failed to decode assignment state: %v [receipt_item_id: %s]", logTag, err, receiptItemId),
+			})
+		}
+
+		for _, assignment := range assignments {
+			if onReceipt[assignment.ReceiptItemId] {
+				state.Assignments = append(state.Assignments, assignment)
+			}
+		}
+	}
+
+	sort.Slice(state.Assignments, func(i, j int) bool {
+		a, b := state.Assignments[i], state.Assignments[j]
+		if a.ReceiptItemId != b.ReceiptItemId {
+			return a.ReceiptItemId < b.ReceiptItemId
+		}
+
+		return a.ParticipantId < b.ParticipantId
+	})
+
+	return &state, nil
+}
+
+func (s *receiptHistory) Get(ctx context.Context, receiptId int64, req entity.ReceiptHistoryRequest) (*entity.ReceiptHistoryResponse, error) {
+	logTag := s.logTag + "[Get]"
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	entries, err := s.auditLogsRepo.GetByReceiptId(ctx, receiptId, deviceId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[auditLogsRepo.GetByReceiptId] Failed to get audit log: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+	if len(entries) == 0 {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusNotFound,
+			ResponseMessage: "Receipt history not found",
+		})
+	}
+
+	res := entity.ReceiptHistoryResponse{
+		Entries: entries,
+	}
+
+	if req.AsOf != nil {
+		state, err := s.rebuild(logTag, receiptId, entries, *req.AsOf)
+		if err != nil {
+			return nil, err
+		}
+
+		res.State = state
+	}
+
+	return &res, nil
+}
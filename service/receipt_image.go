@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"receipt-detector/entity"
+	"receipt-detector/repository"
+
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+)
+
+type receiptImage struct {
+	receiptImagesRepo repository.ReceiptImages
+
+	logTag string
+}
+
+type ReceiptImageOpts struct {
+	ReceiptImagesRepo repository.ReceiptImages
+}
+
+func NewReceiptImageService(opts ReceiptImageOpts) *receiptImage {
+	return &receiptImage{
+		receiptImagesRepo: opts.ReceiptImagesRepo,
+
+		logTag: "[service][receiptImage]",
+	}
+}
+
+func (s *receiptImage) GetSignedImagePath(ctx context.Context, relativePath string, req entity.SignedImageRequest) (string, error) {
+	logTag := s.logTag + "[GetSignedImagePath]"
+
+	filePath, ok, err := s.receiptImagesRepo.ResolveSignedPath(ctx, relativePath, req.Expires, req.Signature)
+	if err != nil {
+		return "", hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusNotFound,
+			Message:         fmt.Sprintf("%s[receiptImagesRepo.ResolveSignedPath] Failed to resolve image path: %v", logTag, err),
+			ResponseMessage: "Image not found",
+		})
+	}
+	if !ok {
+		return "", hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusForbidden,
+			Message:         fmt.Sprintf("%s[InvalidSignature] Invalid or expired image url [relative_path: %s]", logTag, relativePath),
+			ResponseMessage: "Image url is invalid or has expired",
+		})
+	}
+
+	return filePath, nil
+}
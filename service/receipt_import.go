@@ -0,0 +1,551 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"receipt-detector/entity"
+	"receipt-detector/external/notifier"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+	"strconv"
+	"strings"
+	"time"
+
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	receiptImportDateLayouts = []string{
+		time.DateTime,
+		time.DateOnly,
+		time.RFC3339,
+	}
+)
+
+type importedReceipt struct {
+	row     int
+	key     string
+	receipt entity.Receipt
+	items   []entity.ReceiptItem
+	invalid bool
+}
+
+type receiptImport struct {
+	receiptsRepo      repository.Receipts
+	receiptItemsRepo  repository.ReceiptItems
+	unitOfWork        repository.UnitOfWork
+	cacheRepo         repository.Cache
+	searchIndexer     *receiptSearchIndexer
+	budgetEvaluator   *budgetEvaluator
+	auditLogger       *auditLogger
+	duplicateDetector *duplicateDetector
+
+	maxRows int
+
+	logTag string
+}
+
+type ReceiptImportOpts struct {
+	ReceiptsRepo               repository.Receipts
+	ReceiptItemsRepo           repository.ReceiptItems
+	UnitOfWork                 repository.UnitOfWork
+	ReceiptSearchRepo          repository.ReceiptSearch
+	ReceiptTagsRepo            repository.ReceiptTags
+	CacheRepo                  repository.Cache
+	BudgetsRepo                repository.Budgets
+	BudgetAlertsRepo           repository.BudgetAlerts
+	SpendingAnalyticsRepo      repository.SpendingAnalytics
+	Notifier                   notifier.Notifier
+	AuditLogsRepo              repository.AuditLogs
+	ReceiptParticipantsRepo    repository.ReceiptParticipants
+	ReceiptItemAssignmentsRepo repository.ReceiptItemAssignments
+	ReceiptDuplicatesRepo      repository.ReceiptDuplicates
+	DuplicateThreshold         float64
+	DuplicateDateWindow        time.Duration
+}
+
+func NewReceiptImportService(opts ReceiptImportOpts) *receiptImport {
+	return &receiptImport{
+		receiptsRepo:      opts.ReceiptsRepo,
+		receiptItemsRepo:  opts.ReceiptItemsRepo,
+		unitOfWork:        opts.UnitOfWork,
+		cacheRepo:         opts.CacheRepo,
+		searchIndexer:     newReceiptSearchIndexer(opts.ReceiptsRepo, opts.ReceiptItemsRepo, opts.ReceiptSearchRepo, opts.ReceiptTagsRepo),
+		budgetEvaluator:   newBudgetEvaluator(opts.BudgetsRepo, opts.BudgetAlertsRepo, opts.SpendingAnalyticsRepo, opts.Notifier),
+		auditLogger:       newAuditLogger(opts.ReceiptsRepo, opts.ReceiptItemsRepo, opts.ReceiptTagsRepo, opts.ReceiptParticipantsRepo, opts.ReceiptItemAssignmentsRepo, opts.AuditLogsRepo),
+		duplicateDetector: newDuplicateDetector(opts.ReceiptsRepo, opts.ReceiptItemsRepo, opts.ReceiptDuplicatesRepo, opts.DuplicateThreshold, opts.DuplicateDateWindow),
+
+		maxRows: 10000,
+
+		logTag: "[service][receiptImport]",
+	}
+}
+
+func (s *receiptImport) parseMapping(logTag, raw string) (entity.ReceiptImportMapping, error) {
+	var mapping entity.ReceiptImportMapping
+
+	if strings.TrimSpace(raw) != "" {
+		err := json.Unmarshal([]byte(raw), &mapping)
+		if err != nil {
+			return mapping, hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Message:         fmt.Sprintf("%s[json.Unmarshal] Invalid mapping: %v", logTag, err),
+				ResponseMessage: "mapping must be a JSON object of field to column name",
+			})
+		}
+	}
+
+	defaults := []struct {
+		column *string
+		name   string
+	}{
+		{&mapping.ReceiptRef, entity.ReceiptExportColumnReceiptId},
+		{&mapping.ReceiptName, entity.ReceiptExportColumnReceiptName},
+		{&mapping.ReceiptDate, entity.ReceiptExportColumnReceiptDate},
+		{&mapping.ItemCategory, entity.ReceiptExportColumnItemCategory},
+		{&mapping.ItemName, entity.ReceiptExportColumnItemName},
+		{&mapping.ItemQuantity, entity.ReceiptExportColumnItemQuantity},
+		{&mapping.ItemPriceCurrency, entity.ReceiptExportColumnItemPriceCurrency},
+		{&mapping.ItemPriceNumeric, entity.ReceiptExportColumnItemPriceNumeric},
+	}
+
+	for _, d := range defaults {
+		if strings.TrimSpace(*d.column) == "" {
+			*d.column = d.name
+		}
+	}
+
+	return mapping, nil
+}
+
+func (s *receiptImport) parseDate(value, layout string) (int64, error) {
+	if layout != "" {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			return 0, err
+		}
+
+		return t.UnixMilli(), nil
+	}
+
+	millis, err := strconv.ParseInt(value, 10, 64)
+	if err == nil {
+		return millis, nil
+	}
+
+	for _, layout := range receiptImportDateLayouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t.UnixMilli(), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unrecognized date %q", value)
+}
+
+// parse reads the CSV into receipts. Rows sharing a receipt_ref belong to the
+// same receipt; without a reference column, rows are grouped by name and date.
+// A row without an item name and price only describes its receipt.
+func (s *receiptImport) parse(logTag string, req entity.ImportReceiptsRequest, mapping entity.ReceiptImportMapping, r io.Reader, res *entity.ImportReceiptsResponse) ([]*importedReceipt, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s[reader.Read] Failed to read header: %v", logTag, err),
+			ResponseMessage: "file must be a CSV with a header row",
+		})
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+
+		columns[strings.TrimSpace(name)] = i
+	}
+
+	for _, required := range []string{mapping.ReceiptName, mapping.ReceiptDate} {
+		_, ok := columns[required]
+		if !ok {
+			return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Message:         fmt.Sprintf("%s Missing column [column: %s]", logTag, required),
+				ResponseMessage: fmt.Sprintf("missing column %q", required),
+			})
+		}
+	}
+
+	_, hasRef := columns[mapping.ReceiptRef]
+
+	receipts := []*importedReceipt{}
+	receiptsByKey := map[string]*importedReceipt{}
+
+	rowCount := 0
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		rowCount++
+
+		if rowCount > s.maxRows {
+			return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Message:         fmt.Sprintf("%s Too many rows [max_rows: %v]", logTag, s.maxRows),
+				ResponseMessage: fmt.Sprintf("file must not have more than %d rows", s.maxRows),
+			})
+		}
+
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+					Message:         fmt.Sprintf("%s[reader.Read] Failed to read row: %v [row: %v]", logTag, err, rowCount),
+					ResponseMessage: "failed to read file",
+				})
+			}
+
+			res.Errors = append(res.Errors, entity.ImportRowError{Row: parseErr.StartLine, Message: parseErr.Err.Error()})
+			continue
+		}
+
+		// Rows are reported by line number, which differs from the record
+		// count when quoted fields span several lines.
+		row, _ := reader.FieldPos(0)
+
+		get := func(column string) string {
+			i, ok := columns[column]
+			if !ok || i >= len(record) {
+				return ""
+			}
+
+			return strings.TrimSpace(record[i])
+		}
+
+		rowErrors := []entity.ImportRowError{}
+		addError := func(field, message string) {
+			rowErrors = append(rowErrors, entity.ImportRowError{Row: row, Field: field, Message: message})
+		}
+
+		name := get(mapping.ReceiptName)
+		if name == "" {
+			addError("receipt_name", "receipt name is required")
+		}
+
+		rawDate := get(mapping.ReceiptDate)
+
+		date, err := s.parseDate(rawDate, req.DateFormat)
+		if err != nil {
+			addError("receipt_date", fmt.Sprintf("invalid receipt date %q", rawDate))
+		}
+
+		key := name + "\n" + rawDate
+		if hasRef && get(mapping.ReceiptRef) != "" {
+			key = "ref\n" + get(mapping.ReceiptRef)
+		}
+
+		receipt, ok := receiptsByKey[key]
+		if !ok {
+			receipt = &importedReceipt{
+				row: row,
+				key: key,
+				receipt: entity.Receipt{
+					ReceiptName: name,
+					ReceiptDate: date,
+				},
+				items: []entity.ReceiptItem{},
+			}
+
+			receiptsByKey[key] = receipt
+			receipts = append(receipts, receipt)
+		}
+
+		itemName := get(mapping.ItemName)
+		rawPrice := get(mapping.ItemPriceNumeric)
+
+		if itemName != "" || rawPrice != "" {
+			item := entity.ReceiptItem{
+				ItemCategory: get(mapping.ItemCategory),
+				ItemName:     itemName,
+				ItemOrder:    len(receipt.items),
+			}
+
+			if itemName == "" {
+				addError("item_name", "item name is required")
+			}
+
+			price, err := strconv.ParseFloat(rawPrice, 64)
+			if err != nil {
+				addError("item_price_numeric", fmt.Sprintf("invalid item price %q", rawPrice))
+			} else if price < 0 {
+				addError("item_price_numeric", "item price must not be negative")
+			}
+
+			item.ItemPriceNumeric = price
+
+			rawQuantity := get(mapping.ItemQuantity)
+			if rawQuantity != "" {
+				quantity, err := strconv.Atoi(rawQuantity)
+				if err != nil || quantity < 1 {
+					addError("item_quantity", fmt.Sprintf("invalid item quantity %q", rawQuantity))
+				}
+
+				item.ItemQuantity = &quantity
+			}
+
+			currency := helper.NormalizeCurrency(get(mapping.ItemPriceCurrency))
+			if currency == "" {
+				currency = helper.NormalizeCurrency(req.Currency)
+			}
+
+			if currency == "" {
+				addError("item_price_currency", "item currency is required")
+			} else if !helper.IsKnownCurrency(currency) {
+				addError("item_price_currency", fmt.Sprintf("unknown currency code %s", currency))
+			}
+
+			item.ItemPriceCurrency = currency
+
+			receipt.items = append(receipt.items, item)
+		}
+
+		if len(rowErrors) > 0 {
+			receipt.invalid = true
+			res.Errors = append(res.Errors, rowErrors...)
+		}
+	}
+
+	res.RowCount = rowCount
+
+	return receipts, nil
+}
+
+func (s *receiptImport) isSameReceipt(imported entity.Receipt, existing entity.Receipt) bool {
+	if imported.ReceiptDate != existing.ReceiptDate {
+		return false
+	}
+
+	if !strings.EqualFold(strings.TrimSpace(imported.ReceiptName), strings.TrimSpace(existing.ReceiptName)) {
+		return false
+	}
+
+	var importedCurrency, existingCurrency string
+	if imported.TotalCurrency != nil {
+		importedCurrency = *imported.TotalCurrency
+	}
+	if existing.TotalCurrency != nil {
+		existingCurrency = *existing.TotalCurrency
+	}
+
+	if importedCurrency != existingCurrency {
+		return false
+	}
+
+	var existingTotal float64
+	if existing.Total != nil {
+		existingTotal = *existing.Total
+	}
+
+	return helper.ToMinorUnits(*imported.Total, importedCurrency) == helper.ToMinorUnits(existingTotal, existingCurrency)
+}
+
+// findDuplicates flags receipts that match an existing receipt of the device
+// by date, name and total.
+func (s *receiptImport) findDuplicates(ctx context.Context, logTag, deviceId string, receipts []*importedReceipt) (map[*importedReceipt]int64, error) {
+	duplicates := map[*importedReceipt]int64{}
+
+	if len(receipts) == 0 {
+		return duplicates, nil
+	}
+
+	dateFrom, dateTo := receipts[0].receipt.ReceiptDate, receipts[0].receipt.ReceiptDate
+	for _, receipt := range receipts {
+		dateFrom = min(dateFrom, receipt.receipt.ReceiptDate)
+		dateTo = max(dateTo, receipt.receipt.ReceiptDate)
+	}
+
+	existing, err := s.receiptsRepo.GetByDateRange(ctx, deviceId, dateFrom, dateTo)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptsRepo.GetByDateRange] Failed to get existing receipts: %v", logTag, err),
+		})
+	}
+
+	existingByDate := map[int64][]entity.Receipt{}
+	for _, receipt := range existing {
+		existingByDate[receipt.ReceiptDate] = append(existingByDate[receipt.ReceiptDate], receipt)
+	}
+
+	for _, receipt := range receipts {
+		for _, candidate := range existingByDate[receipt.receipt.ReceiptDate] {
+			if s.isSameReceipt(receipt.receipt, candidate) {
+				duplicates[receipt] = candidate.ReceiptId
+				break
+			}
+		}
+	}
+
+	return duplicates, nil
+}
+
+// Import creates receipts and their items from a CSV file in a single
+// transaction. Nothing is written when any row is invalid or when the request
+// is a dry run, so the response can be used to fix the file first. Receipts
+// that already exist are skipped unless duplicates are explicitly imported.
+func (s *receiptImport) Import(ctx context.Context, req entity.ImportReceiptsRequest, r io.Reader) (*entity.ImportReceiptsResponse, error) {
+	logTag := s.logTag + "[Import]"
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	if req.Currency != "" && !helper.IsKnownCurrency(req.Currency) {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Unknown currency: %s", logTag, req.Currency),
+			ResponseMessage: fmt.Sprintf("Unknown currency code %s", req.Currency),
+		})
+	}
+
+	mapping, err := s.parseMapping(logTag, req.Mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	res := entity.ImportReceiptsResponse{
+		DryRun:     req.DryRun,
+		ReceiptIds: []int64{},
+		Duplicates: []entity.ImportDuplicate{},
+		Errors:     []entity.ImportRowError{},
+	}
+
+	receipts, err := s.parse(logTag, req, mapping, r, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	valid := []*importedReceipt{}
+
+	for _, receipt := range receipts {
+		if receipt.invalid {
+			continue
+		}
+
+		totalAmount, totalCurrency := primaryTotal(summarizeReceiptItems(receipt.items))
+		receipt.receipt.Total = &totalAmount
+		receipt.receipt.TotalCurrency = totalCurrency
+		receipt.receipt.DeviceId = deviceId
+
+		valid = append(valid, receipt)
+
+		res.ItemCount += len(receipt.items)
+	}
+
+	res.ReceiptCount = len(receipts)
+
+	duplicates, err := s.findDuplicates(ctx, logTag, deviceId, valid)
+	if err != nil {
+		return nil, err
+	}
+
+	toImport := []*importedReceipt{}
+
+	for _, receipt := range valid {
+		existingId, ok := duplicates[receipt]
+		if ok {
+			res.Duplicates = append(res.Duplicates, entity.ImportDuplicate{
+				Row:               receipt.row,
+				ReceiptName:       receipt.receipt.ReceiptName,
+				ReceiptDate:       receipt.receipt.ReceiptDate,
+				ExistingReceiptId: existingId,
+			})
+
+			if !req.ImportDuplicates {
+				continue
+			}
+		}
+
+		toImport = append(toImport, receipt)
+	}
+
+	res.DuplicateCount = len(res.Duplicates)
+
+	if req.DryRun || len(res.Errors) > 0 {
+		return &res, nil
+	}
+
+	err = s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		receiptsRepo := s.receiptsRepo.NewTx(tx)
+		receiptItemsRepo := s.receiptItemsRepo.NewTx(tx)
+
+		for _, receipt := range toImport {
+			receiptId, err := receiptsRepo.InsertOne(ctx, receipt.receipt)
+			if err != nil {
+				return hApperror.InternalServerError(hApperror.AppErrorOpt{
+					Message: fmt.Sprintf("%s[receiptsRepo.InsertOne] Failed to insert receipt: %v [row: %v]", logTag, err, receipt.row),
+				})
+			}
+
+			receipt.receipt.ReceiptId = receiptId
+
+			for i := range receipt.items {
+				receipt.items[i].ReceiptId = receiptId
+			}
+
+			err = receiptItemsRepo.InsertMany(ctx, receipt.items)
+			if err != nil {
+				return hApperror.InternalServerError(hApperror.AppErrorOpt{
+					Message: fmt.Sprintf("%s[receiptItemsRepo.InsertMany] Failed to insert receipt items: %v [receipt_id: %v]", logTag, err, receiptId),
+				})
+			}
+
+			err = s.auditLogger.record(ctx, tx, logTag, entity.AuditOperationImport, receiptSnapshot{receiptId: receiptId})
+			if err != nil {
+				return err
+			}
+
+			res.ReceiptIds = append(res.ReceiptIds, receiptId)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res.ImportedCount = len(res.ReceiptIds)
+
+	invalidateSpendingAnalytics(ctx, s.cacheRepo, logTag, deviceId)
+
+	// Indexing, duplicate detection and budget evaluation run inline so that
+	// the CLI does not exit before they finish.
+	for _, receipt := range toImport {
+		receiptId := receipt.receipt.ReceiptId
+
+		err = s.searchIndexer.syncOne(ctx, receiptId, deviceId)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"receipt_id": receiptId,
+				"error":      err,
+			}).Warnf("%s[searchIndexer.syncOne] Failed to index imported receipt", logTag)
+		}
+
+		_, err = s.duplicateDetector.detect(ctx, receipt.receipt, receipt.items)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"receipt_id": receiptId,
+				"error":      err,
+			}).Warnf("%s[duplicateDetector.detect] Failed to check imported receipt for duplicates", logTag)
+		}
+	}
+
+	s.budgetEvaluator.evaluateAll(ctx, deviceId)
+
+	return &res, nil
+}
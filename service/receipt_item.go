@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"receipt-detector/entity"
+	"receipt-detector/external/notifier"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+type receiptItem struct {
+	receiptsRepo     repository.Receipts
+	receiptItemsRepo repository.ReceiptItems
+	cacheRepo        repository.Cache
+	unitOfWork       repository.UnitOfWork
+	searchIndexer    *receiptSearchIndexer
+	budgetEvaluator  *budgetEvaluator
+	auditLogger      *auditLogger
+
+	logTag string
+}
+
+type ReceiptItemOpts struct {
+	ReceiptsRepo               repository.Receipts
+	ReceiptItemsRepo           repository.ReceiptItems
+	CacheRepo                  repository.Cache
+	UnitOfWork                 repository.UnitOfWork
+	ReceiptSearchRepo          repository.ReceiptSearch
+	ReceiptTagsRepo            repository.ReceiptTags
+	BudgetsRepo                repository.Budgets
+	BudgetAlertsRepo           repository.BudgetAlerts
+	SpendingAnalyticsRepo      repository.SpendingAnalytics
+	Notifier                   notifier.Notifier
+	AuditLogsRepo              repository.AuditLogs
+	ReceiptParticipantsRepo    repository.ReceiptParticipants
+	ReceiptItemAssignmentsRepo repository.ReceiptItemAssignments
+}
+
+func NewReceiptItemService(opts ReceiptItemOpts) *receiptItem {
+	return &receiptItem{
+		receiptsRepo:     opts.ReceiptsRepo,
+		receiptItemsRepo: opts.ReceiptItemsRepo,
+		cacheRepo:        opts.CacheRepo,
+		unitOfWork:       opts.UnitOfWork,
+		searchIndexer:    newReceiptSearchIndexer(opts.ReceiptsRepo, opts.ReceiptItemsRepo, opts.ReceiptSearchRepo, opts.ReceiptTagsRepo),
+		budgetEvaluator:  newBudgetEvaluator(opts.BudgetsRepo, opts.BudgetAlertsRepo, opts.SpendingAnalyticsRepo, opts.Notifier),
+		auditLogger:      newAuditLogger(opts.ReceiptsRepo, opts.ReceiptItemsRepo, opts.ReceiptTagsRepo, opts.ReceiptParticipantsRepo, opts.ReceiptItemAssignmentsRepo, opts.AuditLogsRepo),
+
+		logTag: "[service][receiptItem]",
+	}
+}
+
+func (s *receiptItem) validatePrice(logTag string, price *float64, currency *string) error {
+	if price != nil && *price < 0 {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Negative item price: %v", logTag, *price),
+			ResponseMessage: "item_price_numeric must not be negative",
+		})
+	}
+
+	if currency != nil && !helper.IsKnownCurrency(*currency) {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Unknown currency: %s", logTag, *currency),
+			ResponseMessage: fmt.Sprintf("Unknown currency code %s", *currency),
+		})
+	}
+
+	return nil
+}
+
+func (s *receiptItem) checkReceipt(ctx context.Context, logTag string, receiptId int64) error {
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	receipt, err := s.receiptsRepo.GetByReceiptId(ctx, receiptId, deviceId)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptsRepo.GetByReceiptId] Failed to get receipt: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+	if receipt == nil {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusNotFound,
+			ResponseMessage: "Receipt not found",
+		})
+	}
+
+	return nil
+}
+
+// refreshReceiptTotal recomputes the stored receipt total from its items and
+// bumps updated_at. It must run in the same transaction as the item change.
+func refreshReceiptTotal(ctx context.Context, tx *sql.Tx, logTag string, receiptsRepo repository.Receipts, receiptItemsRepo repository.ReceiptItems, receiptId int64) error {
+	receiptItems, err := receiptItemsRepo.NewTx(tx).GetByReceiptId(ctx, receiptId)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptItemsRepo.GetByReceiptId] Failed to get receipt items: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	totalAmount, totalCurrency := primaryTotal(summarizeReceiptItems(receiptItems))
+
+	err = receiptsRepo.NewTx(tx).UpdateTotal(ctx, receiptId, totalAmount, totalCurrency)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptsRepo.UpdateTotal] Failed to update receipt: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	return nil
+}
+
+// refreshReceipt refreshes the receipt total and records the change that was
+// made since the before snapshot.
+func (s *receiptItem) refreshReceipt(ctx context.Context, tx *sql.Tx, logTag, operation string, before receiptSnapshot) error {
+	err := refreshReceiptTotal(ctx, tx, logTag, s.receiptsRepo, s.receiptItemsRepo, before.receiptId)
+	if err != nil {
+		return err
+	}
+
+	return s.auditLogger.record(ctx, tx, logTag, operation, before)
+}
+
+func (s *receiptItem) invalidateCache(ctx context.Context, logTag string, receiptId int64) {
+	err := s.cacheRepo.DeleteReceipt(ctx, receiptId)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"receipt_id": receiptId,
+			"error":      err,
+		}).Warnf("%s[cacheRepo.DeleteReceipt] Failed to invalidate cache", logTag)
+	}
+
+	invalidateSpendingAnalytics(ctx, s.cacheRepo, logTag, ctx.Value(hAppconstant.DeviceIdKey).(string))
+}
+
+func (s *receiptItem) AddItem(ctx context.Context, receiptId int64, req entity.AddReceiptItemRequest) (int64, error) {
+	logTag := s.logTag + "[AddItem]"
+
+	req.ItemPriceCurrency = helper.NormalizeCurrency(req.ItemPriceCurrency)
+
+	err := s.validatePrice(logTag, req.ItemPriceNumeric, &req.ItemPriceCurrency)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.checkReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return 0, err
+	}
+
+	var receiptItemId int64
+
+	err = s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := s.auditLogger.snapshot(ctx, tx, logTag, receiptId)
+		if err != nil {
+			return err
+		}
+
+		id, err := s.receiptItemsRepo.NewTx(tx).InsertOne(ctx, entity.ReceiptItem{
+			ReceiptId:         receiptId,
+			ItemCategory:      req.ItemCategory,
+			ItemName:          req.ItemName,
+			ItemQuantity:      req.ItemQuantity,
+			ItemPriceCurrency: req.ItemPriceCurrency,
+			ItemPriceNumeric:  *req.ItemPriceNumeric,
+		})
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptItemsRepo.InsertOne] Failed to insert receipt item: %v [receipt_id: %v]", logTag, err, receiptId),
+			})
+		}
+
+		receiptItemId = id
+
+		return s.refreshReceipt(ctx, tx, logTag, entity.AuditOperationCreate, before)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.invalidateCache(ctx, logTag, receiptId)
+	s.searchIndexer.sync(receiptId, ctx.Value(hAppconstant.DeviceIdKey).(string))
+	s.budgetEvaluator.evaluate(ctx.Value(hAppconstant.DeviceIdKey).(string))
+
+	return receiptItemId, nil
+}
+
+func (s *receiptItem) UpdateItem(ctx context.Context, req entity.UpdateReceiptItemRequest) error {
+	logTag := s.logTag + "[UpdateItem]"
+
+	if req.ItemPriceCurrency != nil {
+		currency := helper.NormalizeCurrency(*req.ItemPriceCurrency)
+		req.ItemPriceCurrency = &currency
+	}
+
+	err := s.validatePrice(logTag, req.ItemPriceNumeric, req.ItemPriceCurrency)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkReceipt(ctx, logTag, req.ReceiptId)
+	if err != nil {
+		return err
+	}
+
+	err = s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := s.auditLogger.snapshot(ctx, tx, logTag, req.ReceiptId)
+		if err != nil {
+			return err
+		}
+
+		updated, err := s.receiptItemsRepo.NewTx(tx).UpdateOne(ctx, req)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptItemsRepo.UpdateOne] Failed to update receipt item: %v [receipt_item_id: %v]", logTag, err, req.ReceiptItemId),
+			})
+		}
+		if !updated {
+			return hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Code:            http.StatusNotFound,
+				ResponseMessage: "Receipt item not found",
+			})
+		}
+
+		return s.refreshReceipt(ctx, tx, logTag, entity.AuditOperationUpdate, before)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.invalidateCache(ctx, logTag, req.ReceiptId)
+	s.searchIndexer.sync(req.ReceiptId, ctx.Value(hAppconstant.DeviceIdKey).(string))
+	s.budgetEvaluator.evaluate(ctx.Value(hAppconstant.DeviceIdKey).(string))
+
+	return nil
+}
+
+func (s *receiptItem) DeleteItem(ctx context.Context, receiptId, receiptItemId int64) error {
+	logTag := s.logTag + "[DeleteItem]"
+
+	err := s.checkReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return err
+	}
+
+	err = s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := s.auditLogger.snapshot(ctx, tx, logTag, receiptId)
+		if err != nil {
+			return err
+		}
+
+		deleted, err := s.receiptItemsRepo.NewTx(tx).SoftDeleteOne(ctx, receiptId, receiptItemId)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptItemsRepo.SoftDeleteOne] Failed to delete receipt item: %v [receipt_item_id: %v]", logTag, err, receiptItemId),
+			})
+		}
+		if !deleted {
+			return hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Code:            http.StatusNotFound,
+				ResponseMessage: "Receipt item not found",
+			})
+		}
+
+		return s.refreshReceipt(ctx, tx, logTag, entity.AuditOperationDelete, before)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.invalidateCache(ctx, logTag, receiptId)
+	s.searchIndexer.sync(receiptId, ctx.Value(hAppconstant.DeviceIdKey).(string))
+
+	return nil
+}
+
+func (s *receiptItem) ReorderItems(ctx context.Context, receiptId int64, receiptItemIds []int64) error {
+	logTag := s.logTag + "[ReorderItems]"
+
+	err := s.checkReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return err
+	}
+
+	receiptItems, err := s.receiptItemsRepo.GetByReceiptId(ctx, receiptId)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptItemsRepo.GetByReceiptId] Failed to get receipt items: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	remaining := map[int64]bool{}
+	for _, receiptItem := range receiptItems {
+		remaining[receiptItem.ReceiptItemId] = true
+	}
+
+	for _, receiptItemId := range receiptItemIds {
+		if !remaining[receiptItemId] {
+			return hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Message:         fmt.Sprintf("%s Unknown or duplicated item: %v [receipt_id: %v]", logTag, receiptItemId, receiptId),
+				ResponseMessage: fmt.Sprintf("receipt_item_id %v is unknown or listed more than once", receiptItemId),
+			})
+		}
+
+		delete(remaining, receiptItemId)
+	}
+
+	if len(remaining) > 0 {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Incomplete item order [receipt_id: %v]", logTag, receiptId),
+			ResponseMessage: "receipt_item_ids must list every item of the receipt",
+		})
+	}
+
+	err = s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := s.auditLogger.snapshot(ctx, tx, logTag, receiptId)
+		if err != nil {
+			return err
+		}
+
+		err = s.receiptItemsRepo.NewTx(tx).UpdateOrder(ctx, receiptId, receiptItemIds)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptItemsRepo.UpdateOrder] Failed to reorder receipt items: %v [receipt_id: %v]", logTag, err, receiptId),
+			})
+		}
+
+		return s.refreshReceipt(ctx, tx, logTag, entity.AuditOperationReorder, before)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.invalidateCache(ctx, logTag, receiptId)
+	s.searchIndexer.sync(receiptId, ctx.Value(hAppconstant.DeviceIdKey).(string))
+
+	return nil
+}
@@ -0,0 +1,315 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"sort"
+	"strings"
+	"time"
+
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+)
+
+const (
+	// ledgerUnknownCurrency is the ISO 4217 code for "no currency", used for
+	// items recorded without one since beancount requires a commodity.
+	ledgerUnknownCurrency = "XXX"
+
+	ledgerAccountWidth = 40
+)
+
+var (
+	beancountEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+type ledgerPosting struct {
+	account  string
+	currency string
+	amount   int64
+	comment  string
+}
+
+type ledgerTransaction struct {
+	date      string
+	payee     string
+	receiptId int64
+	postings  []ledgerPosting
+}
+
+func isValidLedgerAccount(account string) bool {
+	return account != "" &&
+		strings.TrimSpace(account) == account &&
+		!strings.ContainsAny(account, "\t\r\n;") &&
+		!strings.Contains(account, "  ")
+}
+
+// ledgerText collapses whitespace so that free text can not break the line
+// based journal syntax.
+func ledgerText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func ledgerAmount(amount int64, currency string) string {
+	return helper.FormatCurrency(helper.FromMinorUnits(amount, currency), currency) + " " + currency
+}
+
+func (s *receiptExport) ledgerAccount(category string) string {
+	account, ok := s.ledgerCategoryAccounts[strings.ToLower(strings.TrimSpace(category))]
+	if !ok {
+		return s.ledgerDefaultAccount
+	}
+
+	return account
+}
+
+// ledgerAccounts returns every account the export can post to, for the
+// beancount open directives.
+func (s *receiptExport) ledgerAccounts(paymentAccount string) []string {
+	seen := map[string]bool{
+		paymentAccount:         true,
+		s.ledgerDefaultAccount: true,
+	}
+
+	for _, account := range s.ledgerCategoryAccounts {
+		seen[account] = true
+	}
+
+	accounts := []string{}
+	for account := range seen {
+		accounts = append(accounts, account)
+	}
+
+	sort.Strings(accounts)
+
+	return accounts
+}
+
+// ledgerTransaction builds a balanced transaction for a receipt. Discount
+// lines are always posted as negative amounts, mirroring the receipt summary,
+// and the payment account is credited once per currency.
+func (s *receiptExport) ledgerTransaction(receipt entity.Receipt, receiptItems []entity.ReceiptItem, posting, paymentAccount string) ledgerTransaction {
+	transaction := ledgerTransaction{
+		date:      time.UnixMilli(receipt.ReceiptDate).UTC().Format(time.DateOnly),
+		payee:     ledgerText(receipt.ReceiptName),
+		receiptId: receipt.ReceiptId,
+		postings:  []ledgerPosting{},
+	}
+
+	totals := map[string]int64{}
+	postingIndex := map[string]int{}
+
+	for _, receiptItem := range receiptItems {
+		currency := helper.NormalizeCurrency(receiptItem.ItemPriceCurrency)
+		if currency == "" {
+			currency = ledgerUnknownCurrency
+		}
+
+		amount, _ := itemAmount(receiptItem, currency)
+		if adjustmentCategory(receiptItem.ItemCategory) == entity.ItemCategoryDiscount && amount > 0 {
+			amount = -amount
+		}
+
+		totals[currency] += amount
+
+		if posting == entity.LedgerPostingPerCategory {
+			category := strings.ToLower(strings.TrimSpace(receiptItem.ItemCategory))
+			key := category + "\n" + currency
+
+			i, ok := postingIndex[key]
+			if ok {
+				transaction.postings[i].amount += amount
+				continue
+			}
+
+			comment := category
+			if comment == "" {
+				comment = "uncategorized"
+			}
+
+			postingIndex[key] = len(transaction.postings)
+			transaction.postings = append(transaction.postings, ledgerPosting{
+				account:  s.ledgerAccount(category),
+				currency: currency,
+				amount:   amount,
+				comment:  ledgerText(comment),
+			})
+
+			continue
+		}
+
+		transaction.postings = append(transaction.postings, ledgerPosting{
+			account:  s.ledgerAccount(receiptItem.ItemCategory),
+			currency: currency,
+			amount:   amount,
+			comment:  ledgerText(receiptItem.ItemName),
+		})
+	}
+
+	currencies := []string{}
+	for currency := range totals {
+		currencies = append(currencies, currency)
+	}
+
+	sort.Strings(currencies)
+
+	for _, currency := range currencies {
+		transaction.postings = append(transaction.postings, ledgerPosting{
+			account:  paymentAccount,
+			currency: currency,
+			amount:   -totals[currency],
+		})
+	}
+
+	return transaction
+}
+
+func writeLedgerTransaction(w io.Writer, transaction ledgerTransaction) error {
+	_, err := fmt.Fprintf(w, "%s * %s\n    ; receipt_id: %d\n", transaction.date, transaction.payee, transaction.receiptId)
+	if err != nil {
+		return err
+	}
+
+	for _, posting := range transaction.postings {
+		line := fmt.Sprintf("    %-*s  %s", ledgerAccountWidth, posting.account, ledgerAmount(posting.amount, posting.currency))
+		if posting.comment != "" {
+			line += "  ; " + posting.comment
+		}
+
+		_, err = fmt.Fprintln(w, line)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintln(w)
+
+	return err
+}
+
+func writeBeancountTransaction(w io.Writer, transaction ledgerTransaction) error {
+	_, err := fmt.Fprintf(w, "%s * \"%s\" \"\"\n  receipt_id: %d\n", transaction.date, beancountEscaper.Replace(transaction.payee), transaction.receiptId)
+	if err != nil {
+		return err
+	}
+
+	for _, posting := range transaction.postings {
+		line := fmt.Sprintf("  %-*s  %s", ledgerAccountWidth, posting.account, ledgerAmount(posting.amount, posting.currency))
+		if posting.comment != "" {
+			line += "  ; " + posting.comment
+		}
+
+		_, err = fmt.Fprintln(w, line)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintln(w)
+
+	return err
+}
+
+// ExportLedger streams receipts as plain-text accounting transactions with
+// the receipt name as the payee. ledger and hledger share the same journal
+// syntax, so both formats produce the same output.
+func (s *receiptExport) ExportLedger(ctx context.Context, req entity.ExportLedgerRequest, w io.Writer) error {
+	logTag := s.logTag + "[ExportLedger]"
+
+	if req.Format == "" {
+		req.Format = entity.LedgerFormatLedger
+	}
+
+	if req.Posting == "" {
+		req.Posting = entity.LedgerPostingPerItem
+	}
+
+	if req.Format != entity.LedgerFormatLedger && req.Format != entity.LedgerFormatHledger && req.Format != entity.LedgerFormatBeancount {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Invalid format [format: %s]", logTag, req.Format),
+			ResponseMessage: "format must be ledger, hledger or beancount",
+		})
+	}
+
+	if req.Posting != entity.LedgerPostingPerItem && req.Posting != entity.LedgerPostingPerCategory {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Invalid posting [posting: %s]", logTag, req.Posting),
+			ResponseMessage: "posting must be item or category",
+		})
+	}
+
+	paymentAccount := s.ledgerPaymentAccount
+	if req.PaymentAccount != "" {
+		paymentAccount = req.PaymentAccount
+	}
+
+	if !isValidLedgerAccount(paymentAccount) {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Invalid payment account [payment_account: %s]", logTag, paymentAccount),
+			ResponseMessage: "invalid payment_account",
+		})
+	}
+
+	err := s.validateFilter(logTag, req.ReceiptExportFilter)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	opened := false
+
+	err = s.forEachBatch(ctx, logTag, req.ReceiptExportFilter, func(receipts []entity.Receipt, itemsByReceipt map[int64][]entity.ReceiptItem) error {
+		for _, receipt := range receipts {
+			receiptItems := itemsByReceipt[receipt.ReceiptId]
+			if len(receiptItems) == 0 {
+				continue
+			}
+
+			transaction := s.ledgerTransaction(receipt, receiptItems, req.Posting, paymentAccount)
+
+			var err error
+
+			if req.Format == entity.LedgerFormatBeancount {
+				// Accounts are opened on the date of the oldest exported
+				// receipt, since beancount rejects postings to unopened accounts.
+				if !opened {
+					for _, account := range s.ledgerAccounts(paymentAccount) {
+						fmt.Fprintf(out, "%s open %s\n", transaction.date, account)
+					}
+
+					_, err = fmt.Fprintln(out)
+					opened = true
+				}
+
+				if err == nil {
+					err = writeBeancountTransaction(out, transaction)
+				}
+			} else {
+				err = writeLedgerTransaction(out, transaction)
+			}
+
+			if err != nil {
+				return hApperror.InternalServerError(hApperror.AppErrorOpt{
+					Message: fmt.Sprintf("%s Failed to write transaction: %v [receipt_id: %v]", logTag, err, receipt.ReceiptId),
+				})
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = out.Flush()
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[out.Flush] Failed to finish export: %v", logTag, err),
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,499 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"receipt-detector/entity"
+	"receipt-detector/external/notifier"
+	"receipt-detector/repository"
+	"sort"
+
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+type receiptLineage struct {
+	receiptsRepo                  repository.Receipts
+	receiptItemsRepo              repository.ReceiptItems
+	receiptItemAssignmentsRepo    repository.ReceiptItemAssignments
+	receiptAttachmentsRepo        repository.ReceiptAttachments
+	receiptTagsRepo               repository.ReceiptTags
+	receiptLineageRepo            repository.ReceiptLineage
+	receiptDetectionHistoriesRepo repository.ReceiptDetectionHistories
+	cacheRepo                     repository.Cache
+	unitOfWork                    repository.UnitOfWork
+	searchIndexer                 *receiptSearchIndexer
+	budgetEvaluator               *budgetEvaluator
+	auditLogger                   *auditLogger
+
+	logTag string
+}
+
+type ReceiptLineageOpts struct {
+	ReceiptsRepo                  repository.Receipts
+	ReceiptItemsRepo              repository.ReceiptItems
+	ReceiptItemAssignmentsRepo    repository.ReceiptItemAssignments
+	ReceiptAttachmentsRepo        repository.ReceiptAttachments
+	ReceiptTagsRepo               repository.ReceiptTags
+	ReceiptLineageRepo            repository.ReceiptLineage
+	ReceiptDetectionHistoriesRepo repository.ReceiptDetectionHistories
+	CacheRepo                     repository.Cache
+	UnitOfWork                    repository.UnitOfWork
+	ReceiptSearchRepo             repository.ReceiptSearch
+	BudgetsRepo                   repository.Budgets
+	BudgetAlertsRepo              repository.BudgetAlerts
+	SpendingAnalyticsRepo         repository.SpendingAnalytics
+	Notifier                      notifier.Notifier
+	AuditLogsRepo                 repository.AuditLogs
+	ReceiptParticipantsRepo       repository.ReceiptParticipants
+}
+
+func NewReceiptLineageService(opts ReceiptLineageOpts) *receiptLineage {
+	return &receiptLineage{
+		receiptsRepo:                  opts.ReceiptsRepo,
+		receiptItemsRepo:              opts.ReceiptItemsRepo,
+		receiptItemAssignmentsRepo:    opts.ReceiptItemAssignmentsRepo,
+		receiptAttachmentsRepo:        opts.ReceiptAttachmentsRepo,
+		receiptTagsRepo:               opts.ReceiptTagsRepo,
+		receiptLineageRepo:            opts.ReceiptLineageRepo,
+		receiptDetectionHistoriesRepo: opts.ReceiptDetectionHistoriesRepo,
+		cacheRepo:                     opts.CacheRepo,
+		unitOfWork:                    opts.UnitOfWork,
+		searchIndexer:                 newReceiptSearchIndexer(opts.ReceiptsRepo, opts.ReceiptItemsRepo, opts.ReceiptSearchRepo, opts.ReceiptTagsRepo),
+		budgetEvaluator:               newBudgetEvaluator(opts.BudgetsRepo, opts.BudgetAlertsRepo, opts.SpendingAnalyticsRepo, opts.Notifier),
+		auditLogger:                   newAuditLogger(opts.ReceiptsRepo, opts.ReceiptItemsRepo, opts.ReceiptTagsRepo, opts.ReceiptParticipantsRepo, opts.ReceiptItemAssignmentsRepo, opts.AuditLogsRepo),
+
+		logTag: "[service][receiptLineage]",
+	}
+}
+
+func (s *receiptLineage) getReceipt(ctx context.Context, logTag string, receiptId int64) (*entity.Receipt, error) {
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	receipt, err := s.receiptsRepo.GetByReceiptId(ctx, receiptId, deviceId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptsRepo.GetByReceiptId] Failed to get receipt: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+	if receipt == nil {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusNotFound,
+			ResponseMessage: fmt.Sprintf("Receipt %v not found", receiptId),
+		})
+	}
+
+	return receipt, nil
+}
+
+func (s *receiptLineage) getTagIds(ctx context.Context, logTag string, receiptIds []int64) ([]int64, error) {
+	receiptTags, err := s.receiptTagsRepo.GetByReceiptIds(ctx, receiptIds)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptTagsRepo.GetByReceiptIds] Failed to get receipt tags: %v [receipt_ids: %v]", logTag, err, receiptIds),
+		})
+	}
+
+	tagIds := []int64{}
+	for _, receiptTag := range receiptTags {
+		tagIds = append(tagIds, receiptTag.Tag.TagId)
+	}
+
+	return uniqueIds(tagIds), nil
+}
+
+// linkedImage turns the detection image of a merged or split receipt into an
+// attachment of the receipt that takes over its items.
+func (s *receiptLineage) linkedImage(ctx context.Context, logTag string, source entity.Receipt, targetReceiptId int64) (*entity.ReceiptAttachment, error) {
+	if source.ResultId == "" {
+		return nil, nil
+	}
+
+	history, err := s.receiptDetectionHistoriesRepo.GetByResultId(ctx, source.ResultId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptDetectionHistoriesRepo.GetByResultId] Failed to get detection history: %v [receipt_id: %v]", logTag, err, source.ReceiptId),
+		})
+	}
+	if history == nil {
+		return nil, nil
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(history.ImagePath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	resultId := source.ResultId
+
+	return &entity.ReceiptAttachment{
+		ReceiptId:   targetReceiptId,
+		DeviceId:    ctx.Value(hAppconstant.DeviceIdKey).(string),
+		FilePath:    history.ImagePath,
+		FileName:    filepath.Base(history.ImagePath),
+		ContentType: contentType,
+		Kind:        entity.AttachmentKindImage,
+		ResultId:    &resultId,
+	}, nil
+}
+
+func (s *receiptLineage) afterChange(ctx context.Context, logTag, deviceId string, receiptIds []int64) {
+	for _, receiptId := range receiptIds {
+		err := s.cacheRepo.DeleteReceipt(ctx, receiptId)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"receipt_id": receiptId,
+				"error":      err,
+			}).Warnf("%s[cacheRepo.DeleteReceipt] Failed to invalidate cache", logTag)
+		}
+	}
+
+	invalidateSpendingAnalytics(ctx, s.cacheRepo, logTag, deviceId)
+	s.searchIndexer.syncMany(receiptIds, deviceId)
+	s.budgetEvaluator.evaluate(deviceId)
+}
+
+// Merge moves the items, attachments and tags of the source receipts into the
+// target receipt and moves the sources to the trash. The detection images of
+// the sources stay reachable as attachments of the target. Split assignments
+// of the moved items are dropped since participants belong to a receipt.
+func (s *receiptLineage) Merge(ctx context.Context, req entity.MergeReceiptsRequest) (*entity.MergeReceiptsResponse, error) {
+	logTag := s.logTag + "[Merge]"
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	sourceIds := uniqueIds(req.SourceReceiptIds)
+
+	for _, sourceId := range sourceIds {
+		if sourceId == req.TargetReceiptId {
+			return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+				ResponseMessage: "target_receipt_id must not be listed in source_receipt_ids",
+			})
+		}
+	}
+
+	_, err := s.getReceipt(ctx, logTag, req.TargetReceiptId)
+	if err != nil {
+		return nil, err
+	}
+
+	linkedImages := []entity.ReceiptAttachment{}
+
+	for _, sourceId := range sourceIds {
+		source, err := s.getReceipt(ctx, logTag, sourceId)
+		if err != nil {
+			return nil, err
+		}
+
+		attachment, err := s.linkedImage(ctx, logTag, *source, req.TargetReceiptId)
+		if err != nil {
+			return nil, err
+		}
+		if attachment != nil {
+			linkedImages = append(linkedImages, *attachment)
+		}
+	}
+
+	receiptItems, err := s.receiptItemsRepo.GetByReceiptIds(ctx, sourceIds)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptItemsRepo.GetByReceiptIds] Failed to get receipt items: %v [receipt_ids: %v]", logTag, err, sourceIds),
+		})
+	}
+
+	sourcePosition := map[int64]int{}
+	for i, sourceId := range sourceIds {
+		sourcePosition[sourceId] = i
+	}
+
+	sort.SliceStable(receiptItems, func(i, j int) bool {
+		return sourcePosition[receiptItems[i].ReceiptId] < sourcePosition[receiptItems[j].ReceiptId]
+	})
+
+	receiptItemIds := []int64{}
+	receiptItemIdsBySource := map[int64][]int64{}
+
+	for _, receiptItem := range receiptItems {
+		receiptItemIds = append(receiptItemIds, receiptItem.ReceiptItemId)
+		receiptItemIdsBySource[receiptItem.ReceiptId] = append(receiptItemIdsBySource[receiptItem.ReceiptId], receiptItem.ReceiptItemId)
+	}
+
+	tagIds, err := s.getTagIds(ctx, logTag, append([]int64{req.TargetReceiptId}, sourceIds...))
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := s.auditLogger.snapshotMany(ctx, tx, logTag, append([]int64{req.TargetReceiptId}, sourceIds...))
+		if err != nil {
+			return err
+		}
+
+		if len(receiptItemIds) > 0 {
+			err := s.receiptItemsRepo.NewTx(tx).MoveMany(ctx, req.TargetReceiptId, receiptItemIds)
+			if err != nil {
+				return hApperror.InternalServerError(hApperror.AppErrorOpt{
+					Message: fmt.Sprintf("%s[receiptItemsRepo.MoveMany] Failed to move receipt items: %v [receipt_id: %v]", logTag, err, req.TargetReceiptId),
+				})
+			}
+
+			err = s.receiptItemAssignmentsRepo.NewTx(tx).DeleteByReceiptItemIds(ctx, receiptItemIds)
+			if err != nil {
+				return hApperror.InternalServerError(hApperror.AppErrorOpt{
+					Message: fmt.Sprintf("%s[receiptItemAssignmentsRepo.DeleteByReceiptItemIds] Failed to delete assignments: %v [receipt_item_ids: %v]", logTag, err, receiptItemIds),
+				})
+			}
+		}
+
+		err = s.receiptAttachmentsRepo.NewTx(tx).MoveMany(ctx, sourceIds, req.TargetReceiptId)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptAttachmentsRepo.MoveMany] Failed to move attachments: %v [receipt_id: %v]", logTag, err, req.TargetReceiptId),
+			})
+		}
+
+		for _, attachment := range linkedImages {
+			_, err = s.receiptAttachmentsRepo.NewTx(tx).InsertOne(ctx, attachment)
+			if err != nil {
+				return hApperror.InternalServerError(hApperror.AppErrorOpt{
+					Message: fmt.Sprintf("%s[receiptAttachmentsRepo.InsertOne] Failed to link image: %v [receipt_id: %v]", logTag, err, req.TargetReceiptId),
+				})
+			}
+		}
+
+		if len(tagIds) > 0 {
+			err = s.receiptTagsRepo.NewTx(tx).ReplaceByReceiptId(ctx, req.TargetReceiptId, tagIds)
+			if err != nil {
+				return hApperror.InternalServerError(hApperror.AppErrorOpt{
+					Message: fmt.Sprintf("%s[receiptTagsRepo.ReplaceByReceiptId] Failed to merge tags: %v [receipt_id: %v]", logTag, err, req.TargetReceiptId),
+				})
+			}
+		}
+
+		for _, sourceId := range sourceIds {
+			deleted, err := s.receiptsRepo.NewTx(tx).SoftDeleteOne(ctx, sourceId, deviceId)
+			if err != nil {
+				return hApperror.InternalServerError(hApperror.AppErrorOpt{
+					Message: fmt.Sprintf("%s[receiptsRepo.SoftDeleteOne] Failed to delete merged receipt: %v [receipt_id: %v]", logTag, err, sourceId),
+				})
+			}
+			if !deleted {
+				return hApperror.BadRequestError(hApperror.AppErrorOpt{
+					Code:            http.StatusConflict,
+					Message:         fmt.Sprintf("%s Receipt deleted during merge [receipt_id: %v]", logTag, sourceId),
+					ResponseMessage: fmt.Sprintf("Receipt %v was deleted while merging", sourceId),
+				})
+			}
+
+			err = s.receiptLineageRepo.NewTx(tx).InsertOne(ctx, entity.ReceiptLineage{
+				DeviceId:        deviceId,
+				Operation:       entity.LineageOperationMerge,
+				SourceReceiptId: sourceId,
+				TargetReceiptId: req.TargetReceiptId,
+				ReceiptItemIds:  receiptItemIdsBySource[sourceId],
+			})
+			if err != nil {
+				return hApperror.InternalServerError(hApperror.AppErrorOpt{
+					Message: fmt.Sprintf("%s[receiptLineageRepo.InsertOne] Failed to record lineage: %v [receipt_id: %v]", logTag, err, sourceId),
+				})
+			}
+		}
+
+		err = refreshReceiptTotal(ctx, tx, logTag, s.receiptsRepo, s.receiptItemsRepo, req.TargetReceiptId)
+		if err != nil {
+			return err
+		}
+
+		return s.auditLogger.recordMany(ctx, tx, logTag, entity.AuditOperationMerge, before)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.afterChange(ctx, logTag, deviceId, append([]int64{req.TargetReceiptId}, sourceIds...))
+
+	return &entity.MergeReceiptsResponse{
+		ReceiptId:        req.TargetReceiptId,
+		MergedReceiptIds: sourceIds,
+		MovedItemCount:   len(receiptItemIds),
+	}, nil
+}
+
+// Split moves the selected items of a receipt into a new receipt that keeps
+// the tags of the original and links its image. At least one item has to stay
+// behind.
+func (s *receiptLineage) Split(ctx context.Context, receiptId int64, req entity.SplitReceiptRequest) (*entity.SplitReceiptResponse, error) {
+	logTag := s.logTag + "[Split]"
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	receipt, err := s.getReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return nil, err
+	}
+
+	receiptItems, err := s.receiptItemsRepo.GetByReceiptId(ctx, receiptId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptItemsRepo.GetByReceiptId] Failed to get receipt items: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	selected := map[int64]bool{}
+	for _, receiptItemId := range req.ReceiptItemIds {
+		selected[receiptItemId] = true
+	}
+
+	// Items keep their relative order on the new receipt.
+	receiptItemIds := []int64{}
+	for _, receiptItem := range receiptItems {
+		if selected[receiptItem.ReceiptItemId] {
+			receiptItemIds = append(receiptItemIds, receiptItem.ReceiptItemId)
+			delete(selected, receiptItem.ReceiptItemId)
+		}
+	}
+
+	for receiptItemId := range selected {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Unknown receipt item: %v [receipt_id: %v]", logTag, receiptItemId, receiptId),
+			ResponseMessage: fmt.Sprintf("receipt_item_id %v does not belong to the receipt", receiptItemId),
+		})
+	}
+
+	if len(receiptItemIds) == len(receiptItems) {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			ResponseMessage: "At least one item must stay on the receipt",
+		})
+	}
+
+	newReceipt := entity.Receipt{
+		ReceiptName: receipt.ReceiptName,
+		ReceiptDate: receipt.ReceiptDate,
+		DeviceId:    deviceId,
+	}
+	if req.ReceiptName != nil {
+		newReceipt.ReceiptName = *req.ReceiptName
+	}
+	if req.ReceiptDate != nil {
+		newReceipt.ReceiptDate = *req.ReceiptDate
+	}
+
+	tagIds, err := s.getTagIds(ctx, logTag, []int64{receiptId})
+	if err != nil {
+		return nil, err
+	}
+
+	linkedImage, err := s.linkedImage(ctx, logTag, *receipt, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var newReceiptId int64
+
+	err = s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := s.auditLogger.snapshot(ctx, tx, logTag, receiptId)
+		if err != nil {
+			return err
+		}
+
+		newReceiptId, err = s.receiptsRepo.NewTx(tx).InsertOne(ctx, newReceipt)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptsRepo.InsertOne] Failed to create receipt: %v [receipt_id: %v]", logTag, err, receiptId),
+			})
+		}
+
+		err = s.receiptItemsRepo.NewTx(tx).MoveMany(ctx, newReceiptId, receiptItemIds)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptItemsRepo.MoveMany] Failed to move receipt items: %v [receipt_id: %v]", logTag, err, newReceiptId),
+			})
+		}
+
+		err = s.receiptItemAssignmentsRepo.NewTx(tx).DeleteByReceiptItemIds(ctx, receiptItemIds)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptItemAssignmentsRepo.DeleteByReceiptItemIds] Failed to delete assignments: %v [receipt_item_ids: %v]", logTag, err, receiptItemIds),
+			})
+		}
+
+		if linkedImage != nil {
+			linkedImage.ReceiptId = newReceiptId
+
+			_, err = s.receiptAttachmentsRepo.NewTx(tx).InsertOne(ctx, *linkedImage)
+			if err != nil {
+				return hApperror.InternalServerError(hApperror.AppErrorOpt{
+					Message: fmt.Sprintf("%s[receiptAttachmentsRepo.InsertOne] Failed to link image: %v [receipt_id: %v]", logTag, err, newReceiptId),
+				})
+			}
+		}
+
+		if len(tagIds) > 0 {
+			err = s.receiptTagsRepo.NewTx(tx).ReplaceByReceiptId(ctx, newReceiptId, tagIds)
+			if err != nil {
+				return hApperror.InternalServerError(hApperror.AppErrorOpt{
+					Message: fmt.Sprintf("%s[receiptTagsRepo.ReplaceByReceiptId] Failed to copy tags: %v [receipt_id: %v]", logTag, err, newReceiptId),
+				})
+			}
+		}
+
+		err = s.receiptLineageRepo.NewTx(tx).InsertOne(ctx, entity.ReceiptLineage{
+			DeviceId:        deviceId,
+			Operation:       entity.LineageOperationSplit,
+			SourceReceiptId: receiptId,
+			TargetReceiptId: newReceiptId,
+			ReceiptItemIds:  receiptItemIds,
+		})
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptLineageRepo.InsertOne] Failed to record lineage: %v [receipt_id: %v]", logTag, err, receiptId),
+			})
+		}
+
+		err = refreshReceiptTotal(ctx, tx, logTag, s.receiptsRepo, s.receiptItemsRepo, receiptId)
+		if err != nil {
+			return err
+		}
+
+		err = refreshReceiptTotal(ctx, tx, logTag, s.receiptsRepo, s.receiptItemsRepo, newReceiptId)
+		if err != nil {
+			return err
+		}
+
+		return s.auditLogger.recordMany(ctx, tx, logTag, entity.AuditOperationSplit, []receiptSnapshot{before, {receiptId: newReceiptId}})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.afterChange(ctx, logTag, deviceId, []int64{receiptId, newReceiptId})
+
+	return &entity.SplitReceiptResponse{
+		ReceiptId:      newReceiptId,
+		MovedItemCount: len(receiptItemIds),
+	}, nil
+}
+
+// List returns the merges and splits the receipt took part in. It also works
+// for receipts that were merged away and now sit in the trash.
+func (s *receiptLineage) List(ctx context.Context, receiptId int64) (*entity.ReceiptLineageResponse, error) {
+	logTag := s.logTag + "[List]"
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	lineage, err := s.receiptLineageRepo.GetByReceiptId(ctx, receiptId, deviceId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptLineageRepo.GetByReceiptId] Failed to get lineage: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	return &entity.ReceiptLineageResponse{
+		Lineage: lineage,
+	}, nil
+}
@@ -0,0 +1,319 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/repository"
+	"sync"
+	"time"
+
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// receiptSearchMaxWindow is the default max_result_window of an
+	// Elasticsearch index.
+	receiptSearchMaxWindow = 10000
+)
+
+// receiptLocks hands out one mutex per receipt and drops it once nobody holds
+// or waits for it.
+type receiptLocks struct {
+	mu    sync.Mutex
+	locks map[int64]*receiptLock
+}
+
+type receiptLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func (l *receiptLocks) lock(receiptId int64) func() {
+	l.mu.Lock()
+	lock, ok := l.locks[receiptId]
+	if !ok {
+		lock = &receiptLock{}
+		l.locks[receiptId] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.mu.Lock()
+
+	return func() {
+		lock.mu.Unlock()
+
+		l.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.locks, receiptId)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// receiptSyncLocks serializes the syncs of a receipt across every indexer.
+// Each sync reads the state at the time it runs, so with no two running at
+// once the last one to finish always indexes the latest committed state, and
+// a slow sync cannot put back a version or a receipt that was changed since.
+var receiptSyncLocks = &receiptLocks{
+	locks: map[int64]*receiptLock{},
+}
+
+// receiptSearchIndexer keeps the search document of a receipt in sync with
+// postgres. Services that change a receipt or its items call sync once their
+// transaction has committed.
+type receiptSearchIndexer struct {
+	receiptsRepo      repository.Receipts
+	receiptItemsRepo  repository.ReceiptItems
+	receiptSearchRepo repository.ReceiptSearch
+	receiptTagsRepo   repository.ReceiptTags
+
+	logTag string
+}
+
+func newReceiptSearchIndexer(receiptsRepo repository.Receipts, receiptItemsRepo repository.ReceiptItems, receiptSearchRepo repository.ReceiptSearch, receiptTagsRepo repository.ReceiptTags) *receiptSearchIndexer {
+	return &receiptSearchIndexer{
+		receiptsRepo:      receiptsRepo,
+		receiptItemsRepo:  receiptItemsRepo,
+		receiptSearchRepo: receiptSearchRepo,
+		receiptTagsRepo:   receiptTagsRepo,
+
+		logTag: "[service][receiptSearchIndexer]",
+	}
+}
+
+// sync reindexes the receipt in the background from its current state, or
+// removes it from the index when it no longer exists. Failures are logged
+// since the change itself has already been saved.
+func (s *receiptSearchIndexer) sync(receiptId int64, deviceId string) {
+	go func() {
+		c, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		err := s.syncOne(c, receiptId, deviceId)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"receipt_id": receiptId,
+				"error":      err,
+			}).Warnf("%s[sync] Failed to sync receipt search document", s.logTag)
+		}
+	}()
+}
+
+// syncMany reindexes several receipts of a device in the background, one
+// after another.
+func (s *receiptSearchIndexer) syncMany(receiptIds []int64, deviceId string) {
+	if len(receiptIds) == 0 {
+		return
+	}
+
+	go func() {
+		c, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		for _, receiptId := range receiptIds {
+			err := s.syncOne(c, receiptId, deviceId)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"receipt_id": receiptId,
+					"error":      err,
+				}).Warnf("%s[syncMany] Failed to sync receipt search document", s.logTag)
+			}
+		}
+	}()
+}
+
+func (s *receiptSearchIndexer) syncOne(ctx context.Context, receiptId int64, deviceId string) error {
+	unlock := receiptSyncLocks.lock(receiptId)
+	defer unlock()
+
+	receipt, err := s.receiptsRepo.GetByReceiptId(ctx, receiptId, deviceId)
+	if err != nil {
+		return fmt.Errorf("[receiptsRepo.GetByReceiptId] %w", err)
+	}
+
+	if receipt == nil {
+		err = s.receiptSearchRepo.DeleteOne(ctx, receiptId)
+		if err != nil {
+			return fmt.Errorf("[receiptSearchRepo.DeleteOne] %w", err)
+		}
+
+		return nil
+	}
+
+	receiptItems, err := s.receiptItemsRepo.GetByReceiptId(ctx, receiptId)
+	if err != nil {
+		return fmt.Errorf("[receiptItemsRepo.GetByReceiptId] %w", err)
+	}
+
+	receiptTags, err := s.receiptTagsRepo.GetByReceiptIds(ctx, []int64{receiptId})
+	if err != nil {
+		return fmt.Errorf("[receiptTagsRepo.GetByReceiptIds] %w", err)
+	}
+
+	document := entity.ReceiptSearchDocument{
+		ReceiptId:     receipt.ReceiptId,
+		DeviceId:      deviceId,
+		ReceiptName:   receipt.ReceiptName,
+		ReceiptDate:   receipt.ReceiptDate,
+		TotalCurrency: receipt.TotalCurrency,
+		Items:         make([]entity.ReceiptSearchItem, len(receiptItems)),
+		TagIds:        make([]int64, len(receiptTags)),
+		Tags:          make([]string, len(receiptTags)),
+		CreatedAt:     receipt.CreatedAt,
+		UpdatedAt:     receipt.UpdatedAt,
+	}
+
+	if receipt.Total != nil {
+		document.Total = *receipt.Total
+	}
+
+	for i, receiptItem := range receiptItems {
+		document.Items[i] = entity.ReceiptSearchItem{
+			ReceiptItemId:     receiptItem.ReceiptItemId,
+			ItemCategory:      receiptItem.ItemCategory,
+			ItemName:          receiptItem.ItemName,
+			ItemQuantity:      receiptItem.ItemQuantity,
+			ItemPriceCurrency: receiptItem.ItemPriceCurrency,
+			ItemPriceNumeric:  receiptItem.ItemPriceNumeric,
+		}
+	}
+
+	for i, receiptTag := range receiptTags {
+		document.TagIds[i] = receiptTag.Tag.TagId
+		document.Tags[i] = receiptTag.Tag.TagName
+	}
+
+	err = s.receiptSearchRepo.IndexOne(ctx, document)
+	if err != nil {
+		return fmt.Errorf("[receiptSearchRepo.IndexOne] %w", err)
+	}
+
+	return nil
+}
+
+type receiptSearch struct {
+	receiptsRepo      repository.Receipts
+	receiptSearchRepo repository.ReceiptSearch
+	searchIndexer     *receiptSearchIndexer
+
+	defaultPageSize int
+	reindexBatch    int
+
+	logTag string
+}
+
+type ReceiptSearchOpts struct {
+	ReceiptsRepo      repository.Receipts
+	ReceiptItemsRepo  repository.ReceiptItems
+	ReceiptSearchRepo repository.ReceiptSearch
+	ReceiptTagsRepo   repository.ReceiptTags
+}
+
+func NewReceiptSearchService(opts ReceiptSearchOpts) *receiptSearch {
+	return &receiptSearch{
+		receiptsRepo:      opts.ReceiptsRepo,
+		receiptSearchRepo: opts.ReceiptSearchRepo,
+		searchIndexer:     newReceiptSearchIndexer(opts.ReceiptsRepo, opts.ReceiptItemsRepo, opts.ReceiptSearchRepo, opts.ReceiptTagsRepo),
+
+		defaultPageSize: 20,
+		reindexBatch:    100,
+
+		logTag: "[service][receiptSearch]",
+	}
+}
+
+func (s *receiptSearch) Search(ctx context.Context, req entity.SearchReceiptsRequest) (*entity.SearchReceiptsResponse, error) {
+	logTag := s.logTag + "[Search]"
+
+	if req.Limit == 0 {
+		req.Limit = s.defaultPageSize
+	}
+
+	if req.Offset+req.Limit > receiptSearchMaxWindow {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Result window too large [offset: %v][limit: %v]", logTag, req.Offset, req.Limit),
+			ResponseMessage: fmt.Sprintf("offset + limit must not exceed %d, narrow the search instead", receiptSearchMaxWindow),
+		})
+	}
+
+	if req.DateFrom != nil && req.DateTo != nil && *req.DateFrom >= *req.DateTo {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Invalid date range [date_from: %v][date_to: %v]", logTag, *req.DateFrom, *req.DateTo),
+			ResponseMessage: "date_from must be before date_to",
+		})
+	}
+
+	result, err := s.receiptSearchRepo.Search(ctx, entity.ReceiptSearchFilter{
+		DeviceId:  ctx.Value(hAppconstant.DeviceIdKey).(string),
+		Query:     req.Query,
+		Item:      req.Item,
+		Merchant:  req.Merchant,
+		DateFrom:  req.DateFrom,
+		DateTo:    req.DateTo,
+		AmountMin: req.AmountMin,
+		AmountMax: req.AmountMax,
+		TagIds:    req.TagIds,
+		From:      req.Offset,
+		Size:      req.Limit,
+	})
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptSearchRepo.Search] Failed to search receipts: %v", logTag, err),
+		})
+	}
+
+	res := entity.SearchReceiptsResponse{
+		Total: result.Total,
+		Hits:  result.Hits,
+	}
+
+	nextOffset := req.Offset + len(result.Hits)
+	if int64(nextOffset) < result.Total && len(result.Hits) == req.Limit && nextOffset < receiptSearchMaxWindow {
+		res.NextOffset = &nextOffset
+	}
+
+	return &res, nil
+}
+
+// Reindex rebuilds the search documents of every receipt, for receipts saved
+// before the index existed or after it was lost.
+func (s *receiptSearch) Reindex(ctx context.Context) (int, error) {
+	logTag := s.logTag + "[Reindex]"
+
+	err := s.receiptSearchRepo.EnsureIndex(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s[receiptSearchRepo.EnsureIndex] Failed to ensure index: %w", logTag, err)
+	}
+
+	var (
+		indexed        int
+		afterReceiptId int64
+	)
+
+	for {
+		receipts, err := s.receiptsRepo.GetAfterId(ctx, afterReceiptId, s.reindexBatch)
+		if err != nil {
+			return indexed, fmt.Errorf("%s[receiptsRepo.GetAfterId] Failed to get receipts: %w", logTag, err)
+		}
+
+		for _, receipt := range receipts {
+			err = s.searchIndexer.syncOne(ctx, receipt.ReceiptId, receipt.DeviceId)
+			if err != nil {
+				return indexed, fmt.Errorf("%s[searchIndexer.syncOne] Failed to index receipt: %w [receipt_id: %v]", logTag, err, receipt.ReceiptId)
+			}
+
+			indexed++
+		}
+
+		if len(receipts) < s.reindexBatch {
+			return indexed, nil
+		}
+
+		afterReceiptId = receipts[len(receipts)-1].ReceiptId
+	}
+}
@@ -0,0 +1,557 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+	"sort"
+	"strings"
+
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+)
+
+type receiptSettlement struct {
+	receiptsRepo               repository.Receipts
+	receiptItemsRepo           repository.ReceiptItems
+	receiptParticipantsRepo    repository.ReceiptParticipants
+	receiptItemAssignmentsRepo repository.ReceiptItemAssignments
+	receiptPaymentsRepo        repository.ReceiptPayments
+	unitOfWork                 repository.UnitOfWork
+	auditLogger                *auditLogger
+
+	logTag string
+}
+
+type ReceiptSettlementOpts struct {
+	ReceiptsRepo               repository.Receipts
+	ReceiptItemsRepo           repository.ReceiptItems
+	ReceiptParticipantsRepo    repository.ReceiptParticipants
+	ReceiptItemAssignmentsRepo repository.ReceiptItemAssignments
+	ReceiptPaymentsRepo        repository.ReceiptPayments
+	ReceiptTagsRepo            repository.ReceiptTags
+	UnitOfWork                 repository.UnitOfWork
+	AuditLogsRepo              repository.AuditLogs
+}
+
+func NewReceiptSettlementService(opts ReceiptSettlementOpts) *receiptSettlement {
+	return &receiptSettlement{
+		receiptsRepo:               opts.ReceiptsRepo,
+		receiptItemsRepo:           opts.ReceiptItemsRepo,
+		receiptParticipantsRepo:    opts.ReceiptParticipantsRepo,
+		receiptItemAssignmentsRepo: opts.ReceiptItemAssignmentsRepo,
+		receiptPaymentsRepo:        opts.ReceiptPaymentsRepo,
+		unitOfWork:                 opts.UnitOfWork,
+		auditLogger:                newAuditLogger(opts.ReceiptsRepo, opts.ReceiptItemsRepo, opts.ReceiptTagsRepo, opts.ReceiptParticipantsRepo, opts.ReceiptItemAssignmentsRepo, opts.AuditLogsRepo),
+
+		logTag: "[service][receiptSettlement]",
+	}
+}
+
+func (s *receiptSettlement) checkReceipt(ctx context.Context, logTag string, receiptId int64) error {
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	receipt, err := s.receiptsRepo.GetByReceiptId(ctx, receiptId, deviceId)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptsRepo.GetByReceiptId] Failed to get receipt: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+	if receipt == nil {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusNotFound,
+			Message:         fmt.Sprintf("%s Receipt not found [receipt_id: %v]", logTag, receiptId),
+			ResponseMessage: "Receipt not found",
+		})
+	}
+
+	return nil
+}
+
+func (s *receiptSettlement) findParticipant(ctx context.Context, logTag string, receiptId, participantId int64) (*entity.ReceiptParticipant, error) {
+	participants, err := s.receiptParticipantsRepo.GetByReceiptId(ctx, receiptId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptParticipantsRepo.GetByReceiptId] Failed to get participants: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	for _, participant := range participants {
+		if participant.ParticipantId == participantId {
+			return &participant, nil
+		}
+	}
+
+	return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+		Code:            http.StatusNotFound,
+		ResponseMessage: "Participant not found",
+	})
+}
+
+func (s *receiptSettlement) SetPayer(ctx context.Context, receiptId int64, req entity.SetReceiptPayerRequest) error {
+	logTag := s.logTag + "[SetPayer]"
+
+	err := s.checkReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.findParticipant(ctx, logTag, receiptId, req.ParticipantId)
+	if err != nil {
+		return err
+	}
+
+	return s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := s.auditLogger.snapshot(ctx, tx, logTag, receiptId)
+		if err != nil {
+			return err
+		}
+
+		err = s.receiptParticipantsRepo.NewTx(tx).SetPayer(ctx, receiptId, req.ParticipantId)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptParticipantsRepo.SetPayer] Failed to set payer: %v [receipt_id: %v][participant_id: %v]", logTag, err, receiptId, req.ParticipantId),
+			})
+		}
+
+		return s.auditLogger.record(ctx, tx, logTag, entity.AuditOperationUpdate, before)
+	})
+}
+
+func (s *receiptSettlement) AddPayment(ctx context.Context, receiptId int64, req entity.AddReceiptPaymentRequest) (int64, error) {
+	logTag := s.logTag + "[AddPayment]"
+
+	req.PaymentCurrency = helper.NormalizeCurrency(req.PaymentCurrency)
+
+	err := s.checkReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return 0, err
+	}
+
+	participant, err := s.findParticipant(ctx, logTag, receiptId, req.ParticipantId)
+	if err != nil {
+		return 0, err
+	}
+	if participant.IsPayer {
+		return 0, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			ResponseMessage: "The payer of the bill cannot record a payment",
+		})
+	}
+
+	receiptItems, err := s.receiptItemsRepo.GetByReceiptId(ctx, receiptId)
+	if err != nil {
+		return 0, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptItemsRepo.GetByReceiptId] Failed to get receipt items: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	knownCurrency := false
+	for _, receiptItem := range receiptItems {
+		if helper.NormalizeCurrency(receiptItem.ItemPriceCurrency) == req.PaymentCurrency {
+			knownCurrency = true
+			break
+		}
+	}
+	if !knownCurrency {
+		return 0, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Payment currency not on receipt [receipt_id: %v][currency: %s]", logTag, receiptId, req.PaymentCurrency),
+			ResponseMessage: fmt.Sprintf("The receipt has no items priced in %s", req.PaymentCurrency),
+		})
+	}
+
+	if req.PaymentMethod == "" {
+		req.PaymentMethod = entity.PaymentMethodOther
+	}
+
+	if req.PaidAt == 0 {
+		req.PaidAt = helper.NowUnixMilli()
+	}
+
+	paymentId, err := s.receiptPaymentsRepo.InsertOne(ctx, entity.ReceiptPayment{
+		ReceiptId:       receiptId,
+		ParticipantId:   req.ParticipantId,
+		PaymentCurrency: req.PaymentCurrency,
+		PaymentAmount:   helper.RoundCurrency(*req.PaymentAmount, req.PaymentCurrency),
+		PaymentMethod:   req.PaymentMethod,
+		Note:            req.Note,
+		PaidAt:          req.PaidAt,
+	})
+	if err != nil {
+		return 0, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptPaymentsRepo.InsertOne] Failed to insert payment: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	return paymentId, nil
+}
+
+func (s *receiptSettlement) ListPayments(ctx context.Context, receiptId int64) ([]entity.ReceiptPayment, error) {
+	logTag := s.logTag + "[ListPayments]"
+
+	err := s.checkReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return nil, err
+	}
+
+	payments, err := s.receiptPaymentsRepo.GetByReceiptId(ctx, receiptId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptPaymentsRepo.GetByReceiptId] Failed to get payments: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	return payments, nil
+}
+
+func (s *receiptSettlement) DeletePayment(ctx context.Context, receiptId, paymentId int64) error {
+	logTag := s.logTag + "[DeletePayment]"
+
+	err := s.checkReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := s.receiptPaymentsRepo.SoftDeleteOne(ctx, receiptId, paymentId)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptPaymentsRepo.SoftDeleteOne] Failed to delete payment: %v [payment_id: %v]", logTag, err, paymentId),
+		})
+	}
+	if !deleted {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusNotFound,
+			ResponseMessage: "Payment not found",
+		})
+	}
+
+	return nil
+}
+
+type receiptSettlementData struct {
+	receiptItems []entity.ReceiptItem
+	participants []entity.ReceiptParticipant
+	assignments  []entity.ReceiptItemAssignment
+	payments     []entity.ReceiptPayment
+}
+
+// loadSettlementData fetches everything needed to compute balances for the
+// given receipts in one query per table, grouped by receipt id.
+func (s *receiptSettlement) loadSettlementData(ctx context.Context, logTag string, receiptIds []int64) (map[int64]*receiptSettlementData, error) {
+	data := map[int64]*receiptSettlementData{}
+	for _, receiptId := range receiptIds {
+		data[receiptId] = &receiptSettlementData{}
+	}
+
+	receiptItems, err := s.receiptItemsRepo.GetByReceiptIds(ctx, receiptIds)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptItemsRepo.GetByReceiptIds] Failed to get receipt items: %v", logTag, err),
+		})
+	}
+
+	receiptIdByItemId := map[int64]int64{}
+	for _, receiptItem := range receiptItems {
+		receiptIdByItemId[receiptItem.ReceiptItemId] = receiptItem.ReceiptId
+		data[receiptItem.ReceiptId].receiptItems = append(data[receiptItem.ReceiptId].receiptItems, receiptItem)
+	}
+
+	participants, err := s.receiptParticipantsRepo.GetByReceiptIds(ctx, receiptIds)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptParticipantsRepo.GetByReceiptIds] Failed to get participants: %v", logTag, err),
+		})
+	}
+
+	for _, participant := range participants {
+		data[participant.ReceiptId].participants = append(data[participant.ReceiptId].participants, participant)
+	}
+
+	assignments, err := s.receiptItemAssignmentsRepo.GetByReceiptIds(ctx, receiptIds)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptItemAssignmentsRepo.GetByReceiptIds] Failed to get assignments: %v", logTag, err),
+		})
+	}
+
+	for _, assignment := range assignments {
+		receiptId := receiptIdByItemId[assignment.ReceiptItemId]
+		data[receiptId].assignments = append(data[receiptId].assignments, assignment)
+	}
+
+	payments, err := s.receiptPaymentsRepo.GetByReceiptIds(ctx, receiptIds)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptPaymentsRepo.GetByReceiptIds] Failed to get payments: %v", logTag, err),
+		})
+	}
+
+	for _, payment := range payments {
+		data[payment.ReceiptId].payments = append(data[payment.ReceiptId].payments, payment)
+	}
+
+	return data, nil
+}
+
+func (s *receiptSettlement) GetBalance(ctx context.Context, receiptId int64) (*entity.ReceiptBalance, error) {
+	logTag := s.logTag + "[GetBalance]"
+
+	err := s.checkReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.loadSettlementData(ctx, logTag, []int64{receiptId})
+	if err != nil {
+		return nil, err
+	}
+
+	receiptData := data[receiptId]
+	if len(receiptData.participants) == 0 {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			ResponseMessage: "Add participants before tracking payments",
+		})
+	}
+
+	balance := computeBalance(receiptId, receiptData)
+
+	return &balance, nil
+}
+
+func (s *receiptSettlement) SettleUp(ctx context.Context, req entity.SettleUpRequest) (*entity.SettleUpResponse, error) {
+	logTag := s.logTag + "[SettleUp]"
+
+	receiptIds := []int64{}
+	seen := map[int64]bool{}
+
+	for _, receiptId := range req.ReceiptIds {
+		if seen[receiptId] {
+			continue
+		}
+		seen[receiptId] = true
+
+		err := s.checkReceipt(ctx, logTag, receiptId)
+		if err != nil {
+			return nil, err
+		}
+
+		receiptIds = append(receiptIds, receiptId)
+	}
+
+	data, err := s.loadSettlementData(ctx, logTag, receiptIds)
+	if err != nil {
+		return nil, err
+	}
+
+	res := entity.SettleUpResponse{
+		Transfers:         []entity.SettlementTransfer{},
+		SkippedReceiptIds: []int64{},
+	}
+
+	// Participants are matched across receipts by name, since each receipt
+	// has its own participant rows.
+	nets := map[string]map[string]int64{}
+	displayNames := map[string]string{}
+
+	for _, receiptId := range receiptIds {
+		balance := computeBalance(receiptId, data[receiptId])
+		if balance.PayerId == nil {
+			res.SkippedReceiptIds = append(res.SkippedReceiptIds, receiptId)
+			continue
+		}
+
+		for _, currencyBalance := range balance.Currencies {
+			currency := currencyBalance.Currency
+
+			if _, ok := nets[currency]; !ok {
+				nets[currency] = map[string]int64{}
+			}
+
+			var payerKey string
+			for _, participantBalance := range currencyBalance.Balances {
+				if participantBalance.IsPayer {
+					payerKey = participantKey(participantBalance.ParticipantName)
+				}
+			}
+
+			for _, participantBalance := range currencyBalance.Balances {
+				key := participantKey(participantBalance.ParticipantName)
+				if _, ok := displayNames[key]; !ok {
+					displayNames[key] = strings.TrimSpace(participantBalance.ParticipantName)
+				}
+
+				if participantBalance.IsPayer {
+					continue
+				}
+
+				outstanding := helper.ToMinorUnits(participantBalance.Outstanding, currency)
+				nets[currency][key] -= outstanding
+				nets[currency][payerKey] += outstanding
+			}
+		}
+	}
+
+	currencies := make([]string, 0, len(nets))
+	for currency := range nets {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	for _, currency := range currencies {
+		res.Transfers = append(res.Transfers, minimalTransfers(currency, nets[currency], displayNames)...)
+	}
+
+	return &res, nil
+}
+
+func participantKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func paymentStatus(paid, outstanding int64) string {
+	switch {
+	case outstanding < 0:
+		return entity.PaymentStatusOverpaid
+	case outstanding == 0:
+		return entity.PaymentStatusSettled
+	case paid == 0:
+		return entity.PaymentStatusUnpaid
+	default:
+		return entity.PaymentStatusPartial
+	}
+}
+
+// computeBalance compares each participant's share of the split with what they
+// have paid. The payer fronted the whole bill, so their own share is settled
+// and every other outstanding amount is owed to them.
+func computeBalance(receiptId int64, data *receiptSettlementData) entity.ReceiptBalance {
+	balance := entity.ReceiptBalance{
+		ReceiptId:  receiptId,
+		Currencies: []entity.ReceiptCurrencyBalance{},
+	}
+
+	for _, participant := range data.participants {
+		if participant.IsPayer {
+			payerId := participant.ParticipantId
+			balance.PayerId = &payerId
+		}
+	}
+
+	paid := map[int64]map[string]int64{}
+	for _, payment := range data.payments {
+		if _, ok := paid[payment.ParticipantId]; !ok {
+			paid[payment.ParticipantId] = map[string]int64{}
+		}
+
+		currency := helper.NormalizeCurrency(payment.PaymentCurrency)
+		paid[payment.ParticipantId][currency] += helper.ToMinorUnits(payment.PaymentAmount, currency)
+	}
+
+	split := computeSplit(receiptId, data.receiptItems, data.participants, data.assignments)
+
+	for _, currencySplit := range split.Currencies {
+		currency := currencySplit.Currency
+
+		currencyBalance := entity.ReceiptCurrencyBalance{
+			Currency: currency,
+			Total:    currencySplit.Total,
+			Balances: []entity.ParticipantBalance{},
+		}
+
+		var totalOutstanding int64
+
+		for i, share := range currencySplit.Shares {
+			participant := data.participants[i]
+
+			shareAmount := helper.ToMinorUnits(share.Total, currency)
+			paidAmount := paid[participant.ParticipantId][currency]
+			if participant.IsPayer {
+				paidAmount = shareAmount
+			}
+
+			outstanding := shareAmount - paidAmount
+			if outstanding > 0 {
+				totalOutstanding += outstanding
+			}
+
+			currencyBalance.Balances = append(currencyBalance.Balances, entity.ParticipantBalance{
+				ParticipantId:   participant.ParticipantId,
+				ParticipantName: participant.ParticipantName,
+				IsPayer:         participant.IsPayer,
+				Share:           share.Total,
+				Paid:            helper.FromMinorUnits(paidAmount, currency),
+				Outstanding:     helper.FromMinorUnits(outstanding, currency),
+				Status:          paymentStatus(paidAmount, outstanding),
+			})
+		}
+
+		currencyBalance.Outstanding = helper.FromMinorUnits(totalOutstanding, currency)
+		balance.Currencies = append(balance.Currencies, currencyBalance)
+	}
+
+	return balance
+}
+
+type settlementParty struct {
+	key    string
+	amount int64
+}
+
+// minimalTransfers turns net positions into transfers by repeatedly matching
+// the largest debtor with the largest creditor. This settles n people with at
+// most n-1 transfers.
+func minimalTransfers(currency string, nets map[string]int64, displayNames map[string]string) []entity.SettlementTransfer {
+	creditors := []settlementParty{}
+	debtors := []settlementParty{}
+
+	for key, amount := range nets {
+		switch {
+		case amount > 0:
+			creditors = append(creditors, settlementParty{key: key, amount: amount})
+		case amount < 0:
+			debtors = append(debtors, settlementParty{key: key, amount: -amount})
+		}
+	}
+
+	byAmount := func(parties []settlementParty) func(i, j int) bool {
+		return func(i, j int) bool {
+			if parties[i].amount != parties[j].amount {
+				return parties[i].amount > parties[j].amount
+			}
+
+			return parties[i].key < parties[j].key
+		}
+	}
+
+	sort.Slice(creditors, byAmount(creditors))
+	sort.Slice(debtors, byAmount(debtors))
+
+	transfers := []entity.SettlementTransfer{}
+
+	for i, j := 0, 0; i < len(debtors) && j < len(creditors); {
+		amount := min(debtors[i].amount, creditors[j].amount)
+
+		transfers = append(transfers, entity.SettlementTransfer{
+			From:     displayNames[debtors[i].key],
+			To:       displayNames[creditors[j].key],
+			Currency: currency,
+			Amount:   helper.FromMinorUnits(amount, currency),
+		})
+
+		debtors[i].amount -= amount
+		creditors[j].amount -= amount
+
+		if debtors[i].amount == 0 {
+			i++
+		}
+
+		if creditors[j].amount == 0 {
+			j++
+		}
+	}
+
+	return transfers
+}
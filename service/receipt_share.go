@@ -0,0 +1,442 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+	"strings"
+	"time"
+
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+type receiptShare struct {
+	receiptsRepo                  repository.Receipts
+	receiptItemsRepo              repository.ReceiptItems
+	receiptSharesRepo             repository.ReceiptShares
+	receiptShareAccessesRepo      repository.ReceiptShareAccesses
+	receiptDetectionHistoriesRepo repository.ReceiptDetectionHistories
+	receiptImagesRepo             repository.ReceiptImages
+	receiptParticipantsRepo       repository.ReceiptParticipants
+	receiptItemAssignmentsRepo    repository.ReceiptItemAssignments
+
+	signingSecret []byte
+	baseUrl       string
+	defaultTTL    time.Duration
+	maxTTL        time.Duration
+
+	defaultLimit int
+
+	logTag string
+}
+
+type ReceiptShareOpts struct {
+	ReceiptsRepo                  repository.Receipts
+	ReceiptItemsRepo              repository.ReceiptItems
+	ReceiptSharesRepo             repository.ReceiptShares
+	ReceiptShareAccessesRepo      repository.ReceiptShareAccesses
+	ReceiptDetectionHistoriesRepo repository.ReceiptDetectionHistories
+	ReceiptImagesRepo             repository.ReceiptImages
+	ReceiptParticipantsRepo       repository.ReceiptParticipants
+	ReceiptItemAssignmentsRepo    repository.ReceiptItemAssignments
+	SigningSecret                 string
+	BaseUrl                       string
+	DefaultTTL                    time.Duration
+	MaxTTL                        time.Duration
+}
+
+func NewReceiptShareService(opts ReceiptShareOpts) *receiptShare {
+	return &receiptShare{
+		receiptsRepo:                  opts.ReceiptsRepo,
+		receiptItemsRepo:              opts.ReceiptItemsRepo,
+		receiptSharesRepo:             opts.ReceiptSharesRepo,
+		receiptShareAccessesRepo:      opts.ReceiptShareAccessesRepo,
+		receiptDetectionHistoriesRepo: opts.ReceiptDetectionHistoriesRepo,
+		receiptImagesRepo:             opts.ReceiptImagesRepo,
+		receiptParticipantsRepo:       opts.ReceiptParticipantsRepo,
+		receiptItemAssignmentsRepo:    opts.ReceiptItemAssignmentsRepo,
+
+		signingSecret: []byte(opts.SigningSecret),
+		baseUrl:       strings.TrimRight(opts.BaseUrl, "/"),
+		defaultTTL:    opts.DefaultTTL,
+		maxTTL:        opts.MaxTTL,
+
+		defaultLimit: 100,
+
+		logTag: "[service][receiptShare]",
+	}
+}
+
+func (s *receiptShare) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.signingSecret)
+	mac.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// generateToken returns a random payload followed by its signature. Only the
+// hash of the token is stored, so a leaked database cannot be turned into
+// working links.
+func (s *receiptShare) generateToken() (string, error) {
+	payload := make([]byte, 24)
+
+	_, err := rand.Read(payload)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	return encoded + "." + s.sign(encoded), nil
+}
+
+// verifyToken checks the signature so that forged tokens are rejected
+// without a database lookup.
+func (s *receiptShare) verifyToken(token string) bool {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok || payload == "" {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature), []byte(s.sign(payload)))
+}
+
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *receiptShare) checkEnabled(logTag string) error {
+	if len(s.signingSecret) == 0 {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusForbidden,
+			Message:         fmt.Sprintf("%s Share signing secret is not configured", logTag),
+			ResponseMessage: "sharing is disabled",
+		})
+	}
+
+	return nil
+}
+
+func (s *receiptShare) checkReceipt(ctx context.Context, logTag string, receiptId int64) error {
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	receipt, err := s.receiptsRepo.GetByReceiptId(ctx, receiptId, deviceId)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptsRepo.GetByReceiptId] Failed to get receipt: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+	if receipt == nil {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusNotFound,
+			ResponseMessage: "Receipt not found",
+		})
+	}
+
+	return nil
+}
+
+func (s *receiptShare) getShare(ctx context.Context, logTag string, receiptId, shareId int64) (*entity.ReceiptShare, error) {
+	share, err := s.receiptSharesRepo.GetByShareId(ctx, receiptId, shareId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptSharesRepo.GetByShareId] Failed to get share: %v [receipt_id: %v][share_id: %v]", logTag, err, receiptId, shareId),
+		})
+	}
+	if share == nil {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusNotFound,
+			ResponseMessage: "Share link not found",
+		})
+	}
+
+	return share, nil
+}
+
+func (s *receiptShare) Create(ctx context.Context, receiptId int64, req entity.CreateReceiptShareRequest) (*entity.CreateReceiptShareResponse, error) {
+	logTag := s.logTag + "[Create]"
+
+	err := s.checkEnabled(logTag)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.checkReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := s.defaultTTL
+	if req.ExpiresInHours != nil {
+		ttl = time.Duration(*req.ExpiresInHours) * time.Hour
+	}
+
+	if s.maxTTL > 0 && ttl > s.maxTTL {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			ResponseMessage: fmt.Sprintf("expires_in_hours must not exceed %v", int(s.maxTTL.Hours())),
+		})
+	}
+	if ttl <= 0 {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			ResponseMessage: "expires_in_hours must be provided",
+		})
+	}
+
+	token, err := s.generateToken()
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[generateToken] Failed to generate share token: %v", logTag, err),
+		})
+	}
+
+	shareId, err := s.receiptSharesRepo.InsertOne(ctx, entity.ReceiptShare{
+		ReceiptId: receiptId,
+		DeviceId:  ctx.Value(hAppconstant.DeviceIdKey).(string),
+		TokenHash: hashShareToken(token),
+		ExpiresAt: helper.NowUnixMilli() + ttl.Milliseconds(),
+		MaxAccess: req.MaxAccess,
+	})
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptSharesRepo.InsertOne] Failed to create share: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	share, err := s.getShare(ctx, logTag, receiptId, shareId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.CreateReceiptShareResponse{
+		Share: *share,
+		Token: token,
+		Url:   s.baseUrl + "/" + token,
+	}, nil
+}
+
+func (s *receiptShare) List(ctx context.Context, receiptId int64) (*entity.ListReceiptSharesResponse, error) {
+	logTag := s.logTag + "[List]"
+
+	err := s.checkReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return nil, err
+	}
+
+	shares, err := s.receiptSharesRepo.GetByReceiptId(ctx, receiptId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptSharesRepo.GetByReceiptId] Failed to get shares: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	return &entity.ListReceiptSharesResponse{
+		Shares: shares,
+	}, nil
+}
+
+// Revoke disables the share link. Revoking a link twice is not an error.
+func (s *receiptShare) Revoke(ctx context.Context, receiptId, shareId int64) error {
+	logTag := s.logTag + "[Revoke]"
+
+	err := s.checkReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := s.receiptSharesRepo.RevokeOne(ctx, receiptId, shareId)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptSharesRepo.RevokeOne] Failed to revoke share: %v [receipt_id: %v][share_id: %v]", logTag, err, receiptId, shareId),
+		})
+	}
+	if !revoked {
+		_, err = s.getShare(ctx, logTag, receiptId, shareId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *receiptShare) ListAccesses(ctx context.Context, receiptId, shareId int64, req entity.ListReceiptShareAccessesRequest) (*entity.ListReceiptShareAccessesResponse, error) {
+	logTag := s.logTag + "[ListAccesses]"
+
+	err := s.checkReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.getShare(ctx, logTag, receiptId, shareId)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Limit == 0 {
+		req.Limit = s.defaultLimit
+	}
+
+	accesses, err := s.receiptShareAccessesRepo.GetByShareId(ctx, shareId, req.Limit)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptShareAccessesRepo.GetByShareId] Failed to get share accesses: %v [share_id: %v]", logTag, err, shareId),
+		})
+	}
+
+	return &entity.ListReceiptShareAccessesResponse{
+		Accesses: accesses,
+	}, nil
+}
+
+func (s *receiptShare) recordAccess(ctx context.Context, logTag string, shareId int64, outcome, ipAddress, userAgent string) {
+	err := s.receiptShareAccessesRepo.InsertOne(ctx, entity.ReceiptShareAccess{
+		ShareId:    shareId,
+		Outcome:    outcome,
+		IpAddress:  ipAddress,
+		UserAgent:  userAgent,
+		AccessedAt: helper.NowUnixMilli(),
+	})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"share_id": shareId,
+			"outcome":  outcome,
+			"error":    err,
+		}).Warnf("%s[receiptShareAccessesRepo.InsertOne] Failed to record share access", logTag)
+	}
+}
+
+// deniedOutcome explains why ConsumeAccess refused the share.
+func deniedOutcome(share entity.ReceiptShare) string {
+	switch {
+	case share.RevokedAt != nil:
+		return entity.ShareAccessRevoked
+	case share.ExpiresAt <= helper.NowUnixMilli():
+		return entity.ShareAccessExpired
+	default:
+		return entity.ShareAccessLimitReached
+	}
+}
+
+// GetShared resolves a share token into the read-only receipt view. It runs
+// without device auth; the receipt is loaded with the device of the share
+// owner. Every attempt on an existing share is recorded in the access log.
+func (s *receiptShare) GetShared(ctx context.Context, token, ipAddress, userAgent string) (*entity.SharedReceipt, error) {
+	logTag := s.logTag + "[GetShared]"
+
+	notFound := hApperror.BadRequestError(hApperror.AppErrorOpt{
+		Code:            http.StatusNotFound,
+		ResponseMessage: "Share link not found",
+	})
+
+	if len(s.signingSecret) == 0 || !s.verifyToken(token) {
+		return nil, notFound
+	}
+
+	share, err := s.receiptSharesRepo.GetByTokenHash(ctx, hashShareToken(token))
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptSharesRepo.GetByTokenHash] Failed to get share: %v", logTag, err),
+		})
+	}
+	if share == nil {
+		return nil, notFound
+	}
+
+	receipt, err := s.receiptsRepo.GetByReceiptId(ctx, share.ReceiptId, share.DeviceId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptsRepo.GetByReceiptId] Failed to get receipt: %v [receipt_id: %v]", logTag, err, share.ReceiptId),
+		})
+	}
+	if receipt == nil {
+		return nil, notFound
+	}
+
+	granted, err := s.receiptSharesRepo.ConsumeAccess(ctx, share.ShareId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptSharesRepo.ConsumeAccess] Failed to consume share access: %v [share_id: %v]", logTag, err, share.ShareId),
+		})
+	}
+	if !granted {
+		outcome := deniedOutcome(*share)
+		s.recordAccess(ctx, logTag, share.ShareId, outcome, ipAddress, userAgent)
+
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusGone,
+			Message:         fmt.Sprintf("%s Share access denied [share_id: %v][outcome: %s]", logTag, share.ShareId, outcome),
+			ResponseMessage: "Share link is no longer available",
+		})
+	}
+
+	s.recordAccess(ctx, logTag, share.ShareId, entity.ShareAccessGranted, ipAddress, userAgent)
+
+	receiptItems, err := s.receiptItemsRepo.GetByReceiptId(ctx, receipt.ReceiptId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptItemsRepo.GetByReceiptId] Failed to get receipt items: %v [receipt_id: %v]", logTag, err, receipt.ReceiptId),
+		})
+	}
+
+	shared := entity.SharedReceipt{
+		ReceiptName:   receipt.ReceiptName,
+		ReceiptDate:   receipt.ReceiptDate,
+		Total:         receipt.Total,
+		TotalCurrency: receipt.TotalCurrency,
+		Summary:       summarizeReceiptItems(receiptItems),
+		ReceiptItems:  receiptItems,
+		ExpiresAt:     share.ExpiresAt,
+	}
+
+	if receipt.ResultId != "" {
+		history, err := s.receiptDetectionHistoriesRepo.GetByResultId(ctx, receipt.ResultId)
+		if err != nil {
+			return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptDetectionHistoriesRepo.GetByResultId] Failed to get detection history: %v [receipt_id: %v]", logTag, err, receipt.ReceiptId),
+			})
+		}
+
+		if history != nil {
+			shared.ReceiptImageUrl, err = s.receiptImagesRepo.GetImageUrl(ctx, history.ImagePath)
+			if err != nil {
+				return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+					Message: fmt.Sprintf("%s[receiptImagesRepo.GetImageUrl] Failed to get image url: %v [receipt_id: %v]", logTag, err, receipt.ReceiptId),
+				})
+			}
+		}
+	}
+
+	participants, err := s.receiptParticipantsRepo.GetByReceiptId(ctx, receipt.ReceiptId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptParticipantsRepo.GetByReceiptId] Failed to get participants: %v [receipt_id: %v]", logTag, err, receipt.ReceiptId),
+		})
+	}
+
+	// Receipts that have not been split yet are shared without a breakdown.
+	if len(participants) > 0 {
+		assignments, err := s.receiptItemAssignmentsRepo.GetByReceiptId(ctx, receipt.ReceiptId)
+		if err != nil {
+			return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptItemAssignmentsRepo.GetByReceiptId] Failed to get assignments: %v [receipt_id: %v]", logTag, err, receipt.ReceiptId),
+			})
+		}
+
+		split := computeSplit(receipt.ReceiptId, receiptItems, participants, assignments)
+		shared.Split = &split
+	}
+
+	return &shared, nil
+}
@@ -0,0 +1,566 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+	"sort"
+	"strings"
+
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+)
+
+type receiptSplit struct {
+	receiptsRepo               repository.Receipts
+	receiptItemsRepo           repository.ReceiptItems
+	receiptParticipantsRepo    repository.ReceiptParticipants
+	receiptItemAssignmentsRepo repository.ReceiptItemAssignments
+	unitOfWork                 repository.UnitOfWork
+	auditLogger                *auditLogger
+
+	logTag string
+}
+
+type ReceiptSplitOpts struct {
+	ReceiptsRepo               repository.Receipts
+	ReceiptItemsRepo           repository.ReceiptItems
+	ReceiptParticipantsRepo    repository.ReceiptParticipants
+	ReceiptItemAssignmentsRepo repository.ReceiptItemAssignments
+	UnitOfWork                 repository.UnitOfWork
+	ReceiptTagsRepo            repository.ReceiptTags
+	AuditLogsRepo              repository.AuditLogs
+}
+
+func NewReceiptSplitService(opts ReceiptSplitOpts) *receiptSplit {
+	return &receiptSplit{
+		receiptsRepo:               opts.ReceiptsRepo,
+		receiptItemsRepo:           opts.ReceiptItemsRepo,
+		receiptParticipantsRepo:    opts.ReceiptParticipantsRepo,
+		receiptItemAssignmentsRepo: opts.ReceiptItemAssignmentsRepo,
+		unitOfWork:                 opts.UnitOfWork,
+		auditLogger:                newAuditLogger(opts.ReceiptsRepo, opts.ReceiptItemsRepo, opts.ReceiptTagsRepo, opts.ReceiptParticipantsRepo, opts.ReceiptItemAssignmentsRepo, opts.AuditLogsRepo),
+
+		logTag: "[service][receiptSplit]",
+	}
+}
+
+func (s *receiptSplit) checkReceipt(ctx context.Context, logTag string, receiptId int64) error {
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	receipt, err := s.receiptsRepo.GetByReceiptId(ctx, receiptId, deviceId)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptsRepo.GetByReceiptId] Failed to get receipt: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+	if receipt == nil {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusNotFound,
+			ResponseMessage: "Receipt not found",
+		})
+	}
+
+	return nil
+}
+
+func (s *receiptSplit) getParticipants(ctx context.Context, logTag string, receiptId int64) ([]entity.ReceiptParticipant, error) {
+	participants, err := s.receiptParticipantsRepo.GetByReceiptId(ctx, receiptId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptParticipantsRepo.GetByReceiptId] Failed to get participants: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	return participants, nil
+}
+
+func (s *receiptSplit) ListParticipants(ctx context.Context, receiptId int64) ([]entity.ReceiptParticipant, error) {
+	logTag := s.logTag + "[ListParticipants]"
+
+	err := s.checkReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.getParticipants(ctx, logTag, receiptId)
+}
+
+func (s *receiptSplit) AddParticipant(ctx context.Context, receiptId int64, req entity.AddReceiptParticipantRequest) (int64, error) {
+	logTag := s.logTag + "[AddParticipant]"
+
+	req.ParticipantName = strings.TrimSpace(req.ParticipantName)
+	if req.ParticipantName == "" {
+		return 0, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			ResponseMessage: "participant_name must not be blank",
+		})
+	}
+
+	err := s.checkReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return 0, err
+	}
+
+	participants, err := s.getParticipants(ctx, logTag, receiptId)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, participant := range participants {
+		if strings.EqualFold(participant.ParticipantName, req.ParticipantName) {
+			return 0, hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Code:            http.StatusConflict,
+				Message:         fmt.Sprintf("%s Duplicate participant name [receipt_id: %v][participant_name: %s]", logTag, receiptId, req.ParticipantName),
+				ResponseMessage: "A participant with this name already exists",
+			})
+		}
+	}
+
+	var participantId int64
+
+	err = s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := s.auditLogger.snapshot(ctx, tx, logTag, receiptId)
+		if err != nil {
+			return err
+		}
+
+		participantId, err = s.receiptParticipantsRepo.NewTx(tx).InsertOne(ctx, entity.ReceiptParticipant{
+			ReceiptId:       receiptId,
+			ParticipantName: req.ParticipantName,
+		})
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptParticipantsRepo.InsertOne] Failed to insert participant: %v [receipt_id: %v]", logTag, err, receiptId),
+			})
+		}
+
+		return s.auditLogger.record(ctx, tx, logTag, entity.AuditOperationUpdate, before)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return participantId, nil
+}
+
+// soleAssigneeItems returns the items that only the participant is assigned
+// to. Removing the participant would leave them unassigned, which splits them
+// evenly across everyone.
+func soleAssigneeItems(participantId int64, assignments []entity.ReceiptItemAssignment) []int64 {
+	assignees := map[int64][]int64{}
+	for _, assignment := range assignments {
+		assignees[assignment.ReceiptItemId] = append(assignees[assignment.ReceiptItemId], assignment.ParticipantId)
+	}
+
+	receiptItemIds := []int64{}
+	for receiptItemId, participantIds := range assignees {
+		if len(participantIds) == 1 && participantIds[0] == participantId {
+			receiptItemIds = append(receiptItemIds, receiptItemId)
+		}
+	}
+
+	sort.Slice(receiptItemIds, func(i, j int) bool {
+		return receiptItemIds[i] < receiptItemIds[j]
+	})
+
+	return receiptItemIds
+}
+
+// DeleteParticipant removes a participant and their share of shared items.
+// A participant who is the only one assigned to an item can not be removed
+// until the item is reassigned.
+func (s *receiptSplit) DeleteParticipant(ctx context.Context, receiptId, participantId int64) error {
+	logTag := s.logTag + "[DeleteParticipant]"
+
+	err := s.checkReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return err
+	}
+
+	return s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := s.auditLogger.snapshot(ctx, tx, logTag, receiptId)
+		if err != nil {
+			return err
+		}
+
+		assignments, err := s.receiptItemAssignmentsRepo.NewTx(tx).GetByReceiptId(ctx, receiptId)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptItemAssignmentsRepo.GetByReceiptId] Failed to get assignments: %v [receipt_id: %v]", logTag, err, receiptId),
+			})
+		}
+
+		receiptItemIds := soleAssigneeItems(participantId, assignments)
+		if len(receiptItemIds) > 0 {
+			return hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Code:            http.StatusConflict,
+				Message:         fmt.Sprintf("%s Participant is the only assignee [participant_id: %v][receipt_item_ids: %v]", logTag, participantId, receiptItemIds),
+				ResponseMessage: fmt.Sprintf("Participant is the only one assigned to receipt items %v, reassign them first", receiptItemIds),
+			})
+		}
+
+		deleted, err := s.receiptParticipantsRepo.NewTx(tx).SoftDeleteOne(ctx, receiptId, participantId)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptParticipantsRepo.SoftDeleteOne] Failed to delete participant: %v [participant_id: %v]", logTag, err, participantId),
+			})
+		}
+		if !deleted {
+			return hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Code:            http.StatusNotFound,
+				ResponseMessage: "Participant not found",
+			})
+		}
+
+		err = s.receiptItemAssignmentsRepo.NewTx(tx).DeleteByParticipantId(ctx, participantId)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptItemAssignmentsRepo.DeleteByParticipantId] Failed to delete assignments: %v [participant_id: %v]", logTag, err, participantId),
+			})
+		}
+
+		return s.auditLogger.record(ctx, tx, logTag, entity.AuditOperationUpdate, before)
+	})
+}
+
+func (s *receiptSplit) SetItemAssignments(ctx context.Context, receiptId, receiptItemId int64, req entity.SetItemAssignmentsRequest) error {
+	logTag := s.logTag + "[SetItemAssignments]"
+
+	err := s.checkReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return err
+	}
+
+	receiptItems, err := s.receiptItemsRepo.GetByReceiptId(ctx, receiptId)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptItemsRepo.GetByReceiptId] Failed to get receipt items: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	var receiptItem *entity.ReceiptItem
+	for i := range receiptItems {
+		if receiptItems[i].ReceiptItemId == receiptItemId {
+			receiptItem = &receiptItems[i]
+			break
+		}
+	}
+	if receiptItem == nil {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusNotFound,
+			ResponseMessage: "Receipt item not found",
+		})
+	}
+
+	if adjustmentCategory(receiptItem.ItemCategory) != "" {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Assignment to adjustment line [receipt_item_id: %v][item_category: %s]", logTag, receiptItemId, receiptItem.ItemCategory),
+			ResponseMessage: "Tax, service charge and discount lines are allocated automatically",
+		})
+	}
+
+	participants, err := s.getParticipants(ctx, logTag, receiptId)
+	if err != nil {
+		return err
+	}
+
+	known := map[int64]bool{}
+	for _, participant := range participants {
+		known[participant.ParticipantId] = true
+	}
+
+	assignments := []entity.ReceiptItemAssignment{}
+
+	for _, assignment := range req.Assignments {
+		if !known[assignment.ParticipantId] {
+			return hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Message:         fmt.Sprintf("%s Unknown or duplicated participant: %v [receipt_id: %v]", logTag, assignment.ParticipantId, receiptId),
+				ResponseMessage: fmt.Sprintf("participant_id %v is unknown or listed more than once", assignment.ParticipantId),
+			})
+		}
+
+		delete(known, assignment.ParticipantId)
+
+		shareWeight := 1.0
+		if assignment.ShareWeight != nil {
+			shareWeight = *assignment.ShareWeight
+		}
+
+		assignments = append(assignments, entity.ReceiptItemAssignment{
+			ReceiptItemId: receiptItemId,
+			ParticipantId: assignment.ParticipantId,
+			ShareWeight:   shareWeight,
+		})
+	}
+
+	return s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := s.auditLogger.snapshot(ctx, tx, logTag, receiptId)
+		if err != nil {
+			return err
+		}
+
+		err = s.receiptItemAssignmentsRepo.NewTx(tx).ReplaceForItem(ctx, receiptItemId, assignments)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptItemAssignmentsRepo.ReplaceForItem] Failed to save assignments: %v [receipt_item_id: %v]", logTag, err, receiptItemId),
+			})
+		}
+
+		return s.auditLogger.record(ctx, tx, logTag, entity.AuditOperationUpdate, before)
+	})
+}
+
+func (s *receiptSplit) GetSplit(ctx context.Context, receiptId int64) (*entity.ReceiptSplit, error) {
+	logTag := s.logTag + "[GetSplit]"
+
+	err := s.checkReceipt(ctx, logTag, receiptId)
+	if err != nil {
+		return nil, err
+	}
+
+	participants, err := s.getParticipants(ctx, logTag, receiptId)
+	if err != nil {
+		return nil, err
+	}
+	if len(participants) == 0 {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			ResponseMessage: "Add participants before splitting the receipt",
+		})
+	}
+
+	receiptItems, err := s.receiptItemsRepo.GetByReceiptId(ctx, receiptId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptItemsRepo.GetByReceiptId] Failed to get receipt items: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	assignments, err := s.receiptItemAssignmentsRepo.GetByReceiptId(ctx, receiptId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptItemAssignmentsRepo.GetByReceiptId] Failed to get assignments: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+
+	split := computeSplit(receiptId, receiptItems, participants, assignments)
+
+	return &split, nil
+}
+
+// allocateMinorUnits splits amount in proportion to weights with the largest
+// remainder method, so the parts always add up to amount exactly. Negative
+// weights count as zero, and when no weight is positive the amount is split
+// evenly.
+func allocateMinorUnits(amount int64, weights []float64) []int64 {
+	parts := make([]int64, len(weights))
+	if len(weights) == 0 {
+		return parts
+	}
+
+	normalized := make([]float64, len(weights))
+	var totalWeight float64
+	for i, weight := range weights {
+		if weight > 0 {
+			normalized[i] = weight
+			totalWeight += weight
+		}
+	}
+
+	if totalWeight == 0 {
+		for i := range normalized {
+			normalized[i] = 1
+		}
+		totalWeight = float64(len(normalized))
+	}
+
+	sign := int64(1)
+	if amount < 0 {
+		sign, amount = -1, -amount
+	}
+
+	remainders := make([]float64, len(weights))
+	var allocated int64
+
+	for i, weight := range normalized {
+		exact := float64(amount) * weight / totalWeight
+		parts[i] = int64(math.Floor(exact))
+		remainders[i] = exact - float64(parts[i])
+		allocated += parts[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+
+	for i := 0; allocated < amount; i++ {
+		parts[order[i%len(order)]]++
+		allocated++
+	}
+
+	for i := range parts {
+		parts[i] *= sign
+	}
+
+	return parts
+}
+
+type participantSplit struct {
+	subtotal      int64
+	tax           int64
+	serviceCharge int64
+	discount      int64
+	items         []entity.ParticipantItemShare
+}
+
+type currencyAdjustments struct {
+	tax           int64
+	serviceCharge int64
+	discount      int64
+}
+
+// computeSplit works out what each participant owes per currency. Items are
+// shared by their assignment weights, unassigned items are shared evenly by
+// everyone, and tax, service charge and discount lines are allocated in
+// proportion to each participant's subtotal. All arithmetic is done in minor
+// units so the shares add up exactly to the receipt total.
+func computeSplit(receiptId int64, receiptItems []entity.ReceiptItem, participants []entity.ReceiptParticipant, assignments []entity.ReceiptItemAssignment) entity.ReceiptSplit {
+	participantIndex := map[int64]int{}
+	for i, participant := range participants {
+		participantIndex[participant.ParticipantId] = i
+	}
+
+	assignmentsByItem := map[int64][]entity.ReceiptItemAssignment{}
+	for _, assignment := range assignments {
+		assignmentsByItem[assignment.ReceiptItemId] = append(assignmentsByItem[assignment.ReceiptItemId], assignment)
+	}
+
+	splits := map[string][]participantSplit{}
+	adjustments := map[string]*currencyAdjustments{}
+
+	for _, receiptItem := range receiptItems {
+		currency := helper.NormalizeCurrency(receiptItem.ItemPriceCurrency)
+
+		if _, ok := splits[currency]; !ok {
+			splits[currency] = make([]participantSplit, len(participants))
+			adjustments[currency] = &currencyAdjustments{}
+		}
+
+		amount, _ := itemAmount(receiptItem, currency)
+
+		switch adjustmentCategory(receiptItem.ItemCategory) {
+		case entity.ItemCategoryTax:
+			adjustments[currency].tax += amount
+			continue
+		case entity.ItemCategoryServiceCharge:
+			adjustments[currency].serviceCharge += amount
+			continue
+		case entity.ItemCategoryDiscount:
+			if amount < 0 {
+				amount = -amount
+			}
+			adjustments[currency].discount += amount
+			continue
+		}
+
+		weights := make([]float64, len(participants))
+
+		itemAssignments := assignmentsByItem[receiptItem.ReceiptItemId]
+		if len(itemAssignments) == 0 {
+			for i := range weights {
+				weights[i] = 1
+			}
+		}
+
+		for _, assignment := range itemAssignments {
+			if i, ok := participantIndex[assignment.ParticipantId]; ok {
+				weights[i] = assignment.ShareWeight
+			}
+		}
+
+		for i, part := range allocateMinorUnits(amount, weights) {
+			if weights[i] <= 0 && part == 0 {
+				continue
+			}
+
+			splits[currency][i].subtotal += part
+			splits[currency][i].items = append(splits[currency][i].items, entity.ParticipantItemShare{
+				ReceiptItemId: receiptItem.ReceiptItemId,
+				ItemName:      receiptItem.ItemName,
+				Amount:        helper.FromMinorUnits(part, currency),
+			})
+		}
+	}
+
+	currencies := make([]string, 0, len(splits))
+	for currency := range splits {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	result := entity.ReceiptSplit{
+		ReceiptId:  receiptId,
+		Currencies: []entity.ReceiptCurrencySplit{},
+	}
+
+	for _, currency := range currencies {
+		participantSplits := splits[currency]
+		adjustment := adjustments[currency]
+
+		subtotals := make([]float64, len(participantSplits))
+		for i, participantSplit := range participantSplits {
+			subtotals[i] = float64(participantSplit.subtotal)
+		}
+
+		taxes := allocateMinorUnits(adjustment.tax, subtotals)
+		serviceCharges := allocateMinorUnits(adjustment.serviceCharge, subtotals)
+		discounts := allocateMinorUnits(adjustment.discount, subtotals)
+
+		currencySplit := entity.ReceiptCurrencySplit{
+			Currency: currency,
+			Shares:   []entity.ParticipantShare{},
+		}
+
+		var currencyTotal int64
+
+		for i, participant := range participants {
+			participantSplit := participantSplits[i]
+			participantSplit.tax = taxes[i]
+			participantSplit.serviceCharge = serviceCharges[i]
+			participantSplit.discount = discounts[i]
+
+			total := participantSplit.subtotal + participantSplit.tax + participantSplit.serviceCharge - participantSplit.discount
+			currencyTotal += total
+
+			items := participantSplit.items
+			if items == nil {
+				items = []entity.ParticipantItemShare{}
+			}
+
+			currencySplit.Shares = append(currencySplit.Shares, entity.ParticipantShare{
+				ParticipantId:   participant.ParticipantId,
+				ParticipantName: participant.ParticipantName,
+				Subtotal:        helper.FromMinorUnits(participantSplit.subtotal, currency),
+				Tax:             helper.FromMinorUnits(participantSplit.tax, currency),
+				ServiceCharge:   helper.FromMinorUnits(participantSplit.serviceCharge, currency),
+				Discount:        helper.FromMinorUnits(participantSplit.discount, currency),
+				Total:           helper.FromMinorUnits(total, currency),
+				Items:           items,
+			})
+		}
+
+		currencySplit.Total = helper.FromMinorUnits(currencyTotal, currency)
+		result.Currencies = append(result.Currencies, currencySplit)
+	}
+
+	return result
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"sort"
+	"strings"
+)
+
+type currencyTotals struct {
+	itemCount     int
+	totalQuantity int
+	subtotal      int64
+	tax           *int64
+	serviceCharge *int64
+	discount      *int64
+}
+
+// adjustmentCategory returns the normalized category of lines that adjust the
+// receipt total, or an empty string for regular items.
+func adjustmentCategory(category string) string {
+	switch strings.ToLower(strings.TrimSpace(category)) {
+	case entity.ItemCategoryTax:
+		return entity.ItemCategoryTax
+	case entity.ItemCategoryService, entity.ItemCategoryServiceCharge:
+		return entity.ItemCategoryServiceCharge
+	case entity.ItemCategoryDiscount:
+		return entity.ItemCategoryDiscount
+	default:
+		return ""
+	}
+}
+
+// itemAmount returns the quantity-weighted line amount in minor units.
+func itemAmount(receiptItem entity.ReceiptItem, currency string) (int64, int) {
+	quantity := 1
+	if receiptItem.ItemQuantity != nil {
+		quantity = *receiptItem.ItemQuantity
+	}
+
+	return helper.ToMinorUnits(receiptItem.ItemPriceNumeric, currency) * int64(quantity), quantity
+}
+
+func addMinorUnits(total **int64, amount int64) {
+	if *total == nil {
+		*total = new(int64)
+	}
+
+	**total += amount
+}
+
+func optionalAmount(amount *int64, currency string) *float64 {
+	if amount == nil {
+		return nil
+	}
+
+	value := helper.FromMinorUnits(*amount, currency)
+
+	return &value
+}
+
+// summarizeReceiptItems computes per-currency totals for a receipt. Items are
+// priced per unit, so each line is weighted by its quantity. Lines categorized
+// as tax or service charge are added to the total and discount lines are
+// subtracted from it, regardless of the sign they were recorded with.
+func summarizeReceiptItems(receiptItems []entity.ReceiptItem) entity.ReceiptSummary {
+	totalsByCurrency := map[string]*currencyTotals{}
+
+	summary := entity.ReceiptSummary{
+		Currencies: []entity.ReceiptCurrencySummary{},
+	}
+
+	for _, receiptItem := range receiptItems {
+		currency := helper.NormalizeCurrency(receiptItem.ItemPriceCurrency)
+
+		totals, ok := totalsByCurrency[currency]
+		if !ok {
+			totals = &currencyTotals{}
+			totalsByCurrency[currency] = totals
+		}
+
+		amount, quantity := itemAmount(receiptItem, currency)
+
+		switch adjustmentCategory(receiptItem.ItemCategory) {
+		case entity.ItemCategoryTax:
+			addMinorUnits(&totals.tax, amount)
+		case entity.ItemCategoryServiceCharge:
+			addMinorUnits(&totals.serviceCharge, amount)
+		case entity.ItemCategoryDiscount:
+			if amount < 0 {
+				amount = -amount
+			}
+			addMinorUnits(&totals.discount, amount)
+		default:
+			totals.itemCount++
+			totals.totalQuantity += quantity
+			totals.subtotal += amount
+
+			summary.ItemCount++
+			summary.TotalQuantity += quantity
+		}
+	}
+
+	for currency, totals := range totalsByCurrency {
+		total := totals.subtotal
+		if totals.tax != nil {
+			total += *totals.tax
+		}
+		if totals.serviceCharge != nil {
+			total += *totals.serviceCharge
+		}
+		if totals.discount != nil {
+			total -= *totals.discount
+		}
+
+		summary.Currencies = append(summary.Currencies, entity.ReceiptCurrencySummary{
+			Currency:      currency,
+			ItemCount:     totals.itemCount,
+			TotalQuantity: totals.totalQuantity,
+			Subtotal:      helper.FromMinorUnits(totals.subtotal, currency),
+			Tax:           optionalAmount(totals.tax, currency),
+			ServiceCharge: optionalAmount(totals.serviceCharge, currency),
+			Discount:      optionalAmount(totals.discount, currency),
+			Total:         helper.FromMinorUnits(total, currency),
+		})
+	}
+
+	sort.Slice(summary.Currencies, func(i, j int) bool {
+		return summary.Currencies[i].Currency < summary.Currencies[j].Currency
+	})
+
+	// The primary currency is the one most items were priced in; it is what
+	// the denormalized receipt total is stored in.
+	var primary *entity.ReceiptCurrencySummary
+	for i := range summary.Currencies {
+		currencySummary := &summary.Currencies[i]
+
+		if primary == nil ||
+			currencySummary.ItemCount > primary.ItemCount ||
+			(currencySummary.ItemCount == primary.ItemCount && currencySummary.Total > primary.Total) {
+			primary = currencySummary
+		}
+	}
+
+	if primary != nil {
+		summary.PrimaryCurrency = primary.Currency
+	}
+
+	return summary
+}
+
+// primaryTotal returns the total in the primary currency of the summary, or
+// zero and nil when the receipt has no items.
+func primaryTotal(summary entity.ReceiptSummary) (float64, *string) {
+	for _, currencySummary := range summary.Currencies {
+		if currencySummary.Currency == summary.PrimaryCurrency {
+			currency := currencySummary.Currency
+			return currencySummary.Total, &currency
+		}
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,404 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"receipt-detector/entity"
+	"receipt-detector/helper"
+	"receipt-detector/repository"
+	"sort"
+	"time"
+
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+// invalidateSpendingAnalytics drops the cached aggregates of a device after
+// one of its receipts changed. Failures are logged since the change itself has
+// already been saved; stale aggregates expire with the analytics TTL.
+func invalidateSpendingAnalytics(ctx context.Context, cacheRepo repository.Cache, logTag, deviceId string) {
+	err := cacheRepo.BumpAnalyticsVersion(ctx, deviceId)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"device_id": deviceId,
+			"error":     err,
+		}).Warnf("%s[cacheRepo.BumpAnalyticsVersion] Failed to invalidate analytics cache", logTag)
+	}
+}
+
+type spendingAnalytics struct {
+	spendingAnalyticsRepo repository.SpendingAnalytics
+	cacheRepo             repository.Cache
+	currencyConverter     *currencyConverter
+
+	defaultLimit    int
+	defaultInterval string
+	defaultTimezone string
+	maxBuckets      int
+
+	logTag string
+}
+
+type SpendingAnalyticsOpts struct {
+	SpendingAnalyticsRepo repository.SpendingAnalytics
+	CacheRepo             repository.Cache
+	DeviceSettingsRepo    repository.DeviceSettings
+	ExchangeRatesRepo     repository.ExchangeRates
+}
+
+func NewSpendingAnalyticsService(opts SpendingAnalyticsOpts) *spendingAnalytics {
+	return &spendingAnalytics{
+		spendingAnalyticsRepo: opts.SpendingAnalyticsRepo,
+		cacheRepo:             opts.CacheRepo,
+		currencyConverter:     newCurrencyConverter(opts.DeviceSettingsRepo, opts.ExchangeRatesRepo),
+
+		defaultLimit:    10,
+		defaultInterval: entity.SpendingIntervalMonth,
+		defaultTimezone: "UTC",
+		maxBuckets:      1000,
+
+		logTag: "[service][spendingAnalytics]",
+	}
+}
+
+func (s *spendingAnalytics) validateDateRange(logTag string, dateFrom, dateTo int64) error {
+	if dateFrom >= dateTo {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Invalid date range [date_from: %v][date_to: %v]", logTag, dateFrom, dateTo),
+			ResponseMessage: "date_from must be before date_to",
+		})
+	}
+
+	return nil
+}
+
+// cached loads res from the analytics cache of the device, or fills it with
+// load and caches the result. Entries are keyed by the analytics version of
+// the device, so they are never served after one of its receipts changed, and
+// converted entries also by the exchange rates version.
+func (s *spendingAnalytics) cached(ctx context.Context, logTag string, filter entity.SpendingFilter, res any, load func() error) error {
+	version, err := s.cacheRepo.GetAnalyticsVersion(ctx, filter.DeviceId)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"device_id": filter.DeviceId,
+			"error":     err,
+		}).Warnf("%s[cacheRepo.GetAnalyticsVersion] Failed to get analytics version", logTag)
+
+		return load()
+	}
+
+	var ratesVersion int64
+
+	if filter.BaseCurrency != "" {
+		ratesVersion, err = s.cacheRepo.GetExchangeRatesVersion(ctx)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"device_id": filter.DeviceId,
+				"error":     err,
+			}).Warnf("%s[cacheRepo.GetExchangeRatesVersion] Failed to get exchange rates version", logTag)
+
+			return load()
+		}
+	}
+
+	key, err := json.Marshal(struct {
+		Filter       entity.SpendingFilter
+		RatesVersion int64
+	}{filter, ratesVersion})
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[json.Marshal] Failed to marshal filter: %v [filter: %+v]", logTag, err, filter),
+		})
+	}
+
+	hash := sha256.Sum256(key)
+	queryHash := hex.EncodeToString(hash[:])
+
+	data, err := s.cacheRepo.GetAnalytics(ctx, filter.DeviceId, version, queryHash)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"device_id": filter.DeviceId,
+			"error":     err,
+		}).Warnf("%s[cacheRepo.GetAnalytics] Failed to get cached analytics", logTag)
+	}
+
+	if len(data) > 0 {
+		err = json.Unmarshal(data, res)
+		if err == nil {
+			return nil
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"device_id": filter.DeviceId,
+			"error":     err,
+		}).Warnf("%s[json.Unmarshal] Failed to unmarshal cached analytics", logTag)
+	}
+
+	err = load()
+	if err != nil {
+		return err
+	}
+
+	data, err = json.Marshal(res)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[json.Marshal] Failed to marshal analytics: %v", logTag, err),
+		})
+	}
+
+	err = s.cacheRepo.SetAnalytics(ctx, filter.DeviceId, version, queryHash, data)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"device_id": filter.DeviceId,
+			"error":     err,
+		}).Warnf("%s[cacheRepo.SetAnalytics] Failed to cache analytics", logTag)
+	}
+
+	return nil
+}
+
+func (s *spendingAnalytics) roundTotal(total float64, currency string) float64 {
+	return helper.FromMinorUnits(helper.ToMinorUnits(total, currency), currency)
+}
+
+func (s *spendingAnalytics) roundConvertedTotal(total *float64, baseCurrency string) *float64 {
+	if total == nil {
+		return nil
+	}
+
+	rounded := s.roundTotal(*total, baseCurrency)
+
+	return &rounded
+}
+
+func (s *spendingAnalytics) baseCurrency(ctx context.Context, logTag, deviceId, requested string) (string, error) {
+	baseCurrency, err := s.currencyConverter.baseCurrency(ctx, deviceId, requested)
+	if err != nil {
+		return "", hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[currencyConverter.baseCurrency] Failed to get base currency: %v", logTag, err),
+		})
+	}
+
+	return baseCurrency, nil
+}
+
+func (s *spendingAnalytics) GetBreakdown(ctx context.Context, groupBy string, req entity.SpendingBreakdownRequest) (*entity.SpendingBreakdownResponse, error) {
+	logTag := s.logTag + "[GetBreakdown]"
+
+	err := s.validateDateRange(logTag, *req.DateFrom, *req.DateTo)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Limit == 0 {
+		req.Limit = s.defaultLimit
+	}
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	baseCurrency, err := s.baseCurrency(ctx, logTag, deviceId, req.BaseCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := entity.SpendingFilter{
+		DeviceId:     deviceId,
+		DateFrom:     *req.DateFrom,
+		DateTo:       *req.DateTo,
+		Category:     req.Category,
+		Currency:     req.Currency,
+		GroupBy:      groupBy,
+		Limit:        req.Limit,
+		BaseCurrency: baseCurrency,
+	}
+
+	res := entity.SpendingBreakdownResponse{
+		GroupBy:      groupBy,
+		BaseCurrency: baseCurrency,
+		DateFrom:     filter.DateFrom,
+		DateTo:       filter.DateTo,
+	}
+
+	err = s.cached(ctx, logTag, filter, &res, func() error {
+		breakdown, err := s.spendingAnalyticsRepo.GetBreakdown(ctx, filter)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[spendingAnalyticsRepo.GetBreakdown] Failed to get spending breakdown: %v [filter: %+v]", logTag, err, filter),
+			})
+		}
+
+		for i := range breakdown {
+			breakdown[i].Total = s.roundTotal(breakdown[i].Total, breakdown[i].Currency)
+			breakdown[i].ConvertedTotal = s.roundConvertedTotal(breakdown[i].ConvertedTotal, baseCurrency)
+		}
+
+		res.Breakdown = breakdown
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// truncateToInterval returns the start of the interval t falls in, matching
+// date_trunc in postgres: weeks start on monday.
+func truncateToInterval(t time.Time, interval string) time.Time {
+	year, month, day := t.Date()
+
+	switch interval {
+	case entity.SpendingIntervalDay:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	case entity.SpendingIntervalWeek:
+		return time.Date(year, month, day-(int(t.Weekday())+6)%7, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	}
+}
+
+func nextInterval(start time.Time, interval string) time.Time {
+	year, month, day := start.Date()
+
+	switch interval {
+	case entity.SpendingIntervalDay:
+		return time.Date(year, month, day+1, 0, 0, 0, 0, start.Location())
+	case entity.SpendingIntervalWeek:
+		return time.Date(year, month, day+7, 0, 0, 0, 0, start.Location())
+	default:
+		return time.Date(year, month+1, 1, 0, 0, 0, 0, start.Location())
+	}
+}
+
+// fillBuckets adds empty buckets for periods without spending, so that every
+// currency has a continuous series over the requested range.
+func (s *spendingAnalytics) fillBuckets(series []entity.SpendingTimeBucket, bucketStarts []int64, baseCurrency string) []entity.SpendingTimeBucket {
+	byCurrency := map[string]map[int64]entity.SpendingTimeBucket{}
+
+	for _, bucket := range series {
+		bucket.Total = s.roundTotal(bucket.Total, bucket.Currency)
+		bucket.ConvertedTotal = s.roundConvertedTotal(bucket.ConvertedTotal, baseCurrency)
+
+		if byCurrency[bucket.Currency] == nil {
+			byCurrency[bucket.Currency] = map[int64]entity.SpendingTimeBucket{}
+		}
+
+		byCurrency[bucket.Currency][bucket.Start] = bucket
+	}
+
+	currencies := make([]string, 0, len(byCurrency))
+	for currency := range byCurrency {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	filled := make([]entity.SpendingTimeBucket, 0, len(bucketStarts)*len(currencies))
+
+	for _, start := range bucketStarts {
+		for _, currency := range currencies {
+			bucket, ok := byCurrency[currency][start]
+			if !ok {
+				bucket = entity.SpendingTimeBucket{
+					Start:    start,
+					Currency: currency,
+				}
+
+				if baseCurrency != "" {
+					bucket.ConvertedTotal = new(float64)
+				}
+			}
+
+			filled = append(filled, bucket)
+		}
+	}
+
+	return filled
+}
+
+func (s *spendingAnalytics) GetTimeseries(ctx context.Context, req entity.SpendingTimeseriesRequest) (*entity.SpendingTimeseriesResponse, error) {
+	logTag := s.logTag + "[GetTimeseries]"
+
+	err := s.validateDateRange(logTag, *req.DateFrom, *req.DateTo)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Interval == "" {
+		req.Interval = s.defaultInterval
+	}
+
+	if req.Timezone == "" {
+		req.Timezone = s.defaultTimezone
+	}
+
+	location, err := time.LoadLocation(req.Timezone)
+	if err != nil {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s[time.LoadLocation] Invalid timezone: %v [timezone: %s]", logTag, err, req.Timezone),
+			ResponseMessage: "timezone must be an IANA time zone, e.g. Asia/Jakarta",
+		})
+	}
+
+	bucketStarts := []int64{}
+
+	start := truncateToInterval(time.UnixMilli(*req.DateFrom).In(location), req.Interval)
+	for ; start.UnixMilli() < *req.DateTo; start = nextInterval(start, req.Interval) {
+		if len(bucketStarts) == s.maxBuckets {
+			return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Message:         fmt.Sprintf("%s Too many buckets [date_from: %v][date_to: %v][interval: %s]", logTag, *req.DateFrom, *req.DateTo, req.Interval),
+				ResponseMessage: fmt.Sprintf("The date range must not span more than %d buckets, use a larger interval", s.maxBuckets),
+			})
+		}
+
+		bucketStarts = append(bucketStarts, start.UnixMilli())
+	}
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	baseCurrency, err := s.baseCurrency(ctx, logTag, deviceId, req.BaseCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := entity.SpendingFilter{
+		DeviceId:     deviceId,
+		DateFrom:     *req.DateFrom,
+		DateTo:       *req.DateTo,
+		Category:     req.Category,
+		Currency:     req.Currency,
+		Interval:     req.Interval,
+		Timezone:     location.String(),
+		BaseCurrency: baseCurrency,
+	}
+
+	res := entity.SpendingTimeseriesResponse{
+		Interval:     filter.Interval,
+		BaseCurrency: baseCurrency,
+		Timezone:     filter.Timezone,
+		DateFrom:     filter.DateFrom,
+		DateTo:       filter.DateTo,
+	}
+
+	err = s.cached(ctx, logTag, filter, &res, func() error {
+		series, err := s.spendingAnalyticsRepo.GetTimeseries(ctx, filter)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[spendingAnalyticsRepo.GetTimeseries] Failed to get spending timeseries: %v [filter: %+v]", logTag, err, filter),
+			})
+		}
+
+		res.Series = s.fillBuckets(series, bucketStarts, baseCurrency)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
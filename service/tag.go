@@ -0,0 +1,366 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"receipt-detector/entity"
+	"receipt-detector/repository"
+	"strings"
+
+	hAppconstant "github.com/michaelyusak/go-helper/appconstant"
+	hApperror "github.com/michaelyusak/go-helper/apperror"
+)
+
+// uniqueIds drops repeated ids, keeping the first occurrence of each.
+func uniqueIds(ids []int64) []int64 {
+	seen := map[int64]bool{}
+	unique := []int64{}
+
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+
+		seen[id] = true
+		unique = append(unique, id)
+	}
+
+	return unique
+}
+
+type tag struct {
+	tagsRepo        repository.Tags
+	receiptTagsRepo repository.ReceiptTags
+	receiptsRepo    repository.Receipts
+	unitOfWork      repository.UnitOfWork
+	searchIndexer   *receiptSearchIndexer
+	auditLogger     *auditLogger
+
+	defaultLimit int
+
+	logTag string
+}
+
+type TagOpts struct {
+	TagsRepo                   repository.Tags
+	ReceiptTagsRepo            repository.ReceiptTags
+	ReceiptsRepo               repository.Receipts
+	ReceiptItemsRepo           repository.ReceiptItems
+	ReceiptSearchRepo          repository.ReceiptSearch
+	UnitOfWork                 repository.UnitOfWork
+	ReceiptParticipantsRepo    repository.ReceiptParticipants
+	ReceiptItemAssignmentsRepo repository.ReceiptItemAssignments
+	AuditLogsRepo              repository.AuditLogs
+}
+
+func NewTagService(opts TagOpts) *tag {
+	return &tag{
+		tagsRepo:        opts.TagsRepo,
+		receiptTagsRepo: opts.ReceiptTagsRepo,
+		receiptsRepo:    opts.ReceiptsRepo,
+		unitOfWork:      opts.UnitOfWork,
+		searchIndexer:   newReceiptSearchIndexer(opts.ReceiptsRepo, opts.ReceiptItemsRepo, opts.ReceiptSearchRepo, opts.ReceiptTagsRepo),
+		auditLogger:     newAuditLogger(opts.ReceiptsRepo, opts.ReceiptItemsRepo, opts.ReceiptTagsRepo, opts.ReceiptParticipantsRepo, opts.ReceiptItemAssignmentsRepo, opts.AuditLogsRepo),
+
+		defaultLimit: 20,
+
+		logTag: "[service][tag]",
+	}
+}
+
+func (s *tag) normalizeTagName(logTag, tagName string) (string, error) {
+	tagName = strings.Join(strings.Fields(tagName), " ")
+	if tagName == "" {
+		return "", hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Empty tag name", logTag),
+			ResponseMessage: "tag_name must not be empty",
+		})
+	}
+
+	return tagName, nil
+}
+
+func (s *tag) Create(ctx context.Context, req entity.CreateTagRequest) (*entity.CreateTagResponse, error) {
+	logTag := s.logTag + "[Create]"
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	tagName, err := s.normalizeTagName(logTag, req.TagName)
+	if err != nil {
+		return nil, err
+	}
+
+	tagId, err := s.tagsRepo.InsertOne(ctx, entity.Tag{
+		DeviceId: deviceId,
+		TagName:  tagName,
+		Color:    req.Color,
+	})
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[tagsRepo.InsertOne] Failed to insert tag: %v [tag_name: %s]", logTag, err, tagName),
+		})
+	}
+	if tagId == 0 {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusConflict,
+			Message:         fmt.Sprintf("%s Tag already exists [tag_name: %s]", logTag, tagName),
+			ResponseMessage: "A tag with this name already exists",
+		})
+	}
+
+	return &entity.CreateTagResponse{
+		TagId: tagId,
+	}, nil
+}
+
+// List returns the tags of the device with their receipt counts, most used
+// first, so that it can back tag autocomplete.
+func (s *tag) List(ctx context.Context, req entity.ListTagsRequest) (*entity.ListTagsResponse, error) {
+	logTag := s.logTag + "[List]"
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	if req.Limit == 0 {
+		req.Limit = s.defaultLimit
+	}
+
+	tags, err := s.tagsRepo.GetCounts(ctx, deviceId, strings.TrimSpace(req.Query), req.Limit)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[tagsRepo.GetCounts] Failed to get tags: %v", logTag, err),
+		})
+	}
+
+	return &entity.ListTagsResponse{
+		Tags: tags,
+	}, nil
+}
+
+func (s *tag) Update(ctx context.Context, req entity.UpdateTagRequest) error {
+	logTag := s.logTag + "[Update]"
+
+	req.DeviceId = ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	if req.TagName == nil && req.Color == nil {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Nothing to update [tag_id: %v]", logTag, req.TagId),
+			ResponseMessage: "tag_name or color must be provided",
+		})
+	}
+
+	if req.TagName != nil {
+		tagName, err := s.normalizeTagName(logTag, *req.TagName)
+		if err != nil {
+			return err
+		}
+
+		existing, err := s.tagsRepo.GetByTagName(ctx, tagName, req.DeviceId)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[tagsRepo.GetByTagName] Failed to get tag: %v [tag_name: %s]", logTag, err, tagName),
+			})
+		}
+		if existing != nil && existing.TagId != req.TagId {
+			return hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Code:            http.StatusConflict,
+				Message:         fmt.Sprintf("%s Tag already exists [tag_name: %s]", logTag, tagName),
+				ResponseMessage: "A tag with this name already exists",
+			})
+		}
+
+		req.TagName = &tagName
+	}
+
+	updated, err := s.tagsRepo.UpdateOne(ctx, req)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[tagsRepo.UpdateOne] Failed to update tag: %v [tag_id: %v]", logTag, err, req.TagId),
+		})
+	}
+	if !updated {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusNotFound,
+			ResponseMessage: "Tag not found",
+		})
+	}
+
+	// Search documents carry the tag names, so a rename reaches every tagged
+	// receipt.
+	if req.TagName != nil {
+		receiptIds, err := s.receiptTagsRepo.GetReceiptIdsByTagId(ctx, req.TagId)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptTagsRepo.GetReceiptIdsByTagId] Failed to get tagged receipts: %v [tag_id: %v]", logTag, err, req.TagId),
+			})
+		}
+
+		s.searchIndexer.syncMany(receiptIds, req.DeviceId)
+	}
+
+	return nil
+}
+
+func (s *tag) Delete(ctx context.Context, tagId int64) error {
+	logTag := s.logTag + "[Delete]"
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	var receiptIds []int64
+
+	err := s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		deleted, err := s.tagsRepo.NewTx(tx).SoftDeleteOne(ctx, tagId, deviceId)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[tagsRepo.SoftDeleteOne] Failed to delete tag: %v [tag_id: %v]", logTag, err, tagId),
+			})
+		}
+		if !deleted {
+			return hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Code:            http.StatusNotFound,
+				ResponseMessage: "Tag not found",
+			})
+		}
+
+		receiptTagsRepo := s.receiptTagsRepo.NewTx(tx)
+
+		taggedIds, err := receiptTagsRepo.GetReceiptIdsByTagId(ctx, tagId)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptTagsRepo.GetReceiptIdsByTagId] Failed to get tagged receipts: %v [tag_id: %v]", logTag, err, tagId),
+			})
+		}
+
+		before, err := s.auditLogger.snapshotMany(ctx, tx, logTag, taggedIds)
+		if err != nil {
+			return err
+		}
+
+		receiptIds, err = receiptTagsRepo.DeleteByTagId(ctx, tagId)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptTagsRepo.DeleteByTagId] Failed to untag receipts: %v [tag_id: %v]", logTag, err, tagId),
+			})
+		}
+
+		return s.auditLogger.recordMany(ctx, tx, logTag, entity.AuditOperationUpdate, before)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.searchIndexer.syncMany(receiptIds, deviceId)
+
+	return nil
+}
+
+func (s *tag) getReceipt(ctx context.Context, logTag string, receiptId int64, deviceId string) error {
+	receipt, err := s.receiptsRepo.GetByReceiptId(ctx, receiptId, deviceId)
+	if err != nil {
+		return hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[receiptsRepo.GetByReceiptId] Failed to get receipt: %v [receipt_id: %v]", logTag, err, receiptId),
+		})
+	}
+	if receipt == nil {
+		return hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Code:            http.StatusNotFound,
+			ResponseMessage: "Receipt not found",
+		})
+	}
+
+	return nil
+}
+
+// SetReceiptTags replaces the tags of a receipt. Every tag must belong to the
+// device.
+func (s *tag) SetReceiptTags(ctx context.Context, req entity.SetReceiptTagsRequest) (*entity.ReceiptTagsResponse, error) {
+	logTag := s.logTag + "[SetReceiptTags]"
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	err := s.getReceipt(ctx, logTag, req.ReceiptId, deviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	tagIds := uniqueIds(req.TagIds)
+
+	tags, err := s.tagsRepo.GetByTagIds(ctx, tagIds, deviceId)
+	if err != nil {
+		return nil, hApperror.InternalServerError(hApperror.AppErrorOpt{
+			Message: fmt.Sprintf("%s[tagsRepo.GetByTagIds] Failed to get tags: %v [receipt_id: %v]", logTag, err, req.ReceiptId),
+		})
+	}
+	if len(tags) != len(tagIds) {
+		return nil, hApperror.BadRequestError(hApperror.AppErrorOpt{
+			Message:         fmt.Sprintf("%s Unknown tag [receipt_id: %v][tag_ids: %v]", logTag, req.ReceiptId, tagIds),
+			ResponseMessage: "One or more tags were not found",
+		})
+	}
+
+	err = s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := s.auditLogger.snapshot(ctx, tx, logTag, req.ReceiptId)
+		if err != nil {
+			return err
+		}
+
+		err = s.receiptTagsRepo.NewTx(tx).ReplaceByReceiptId(ctx, req.ReceiptId, tagIds)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptTagsRepo.ReplaceByReceiptId] Failed to set receipt tags: %v [receipt_id: %v]", logTag, err, req.ReceiptId),
+			})
+		}
+
+		return s.auditLogger.record(ctx, tx, logTag, entity.AuditOperationUpdate, before)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.searchIndexer.sync(req.ReceiptId, deviceId)
+
+	return &entity.ReceiptTagsResponse{
+		Tags: tags,
+	}, nil
+}
+
+func (s *tag) RemoveReceiptTag(ctx context.Context, receiptId, tagId int64) error {
+	logTag := s.logTag + "[RemoveReceiptTag]"
+
+	deviceId := ctx.Value(hAppconstant.DeviceIdKey).(string)
+
+	err := s.getReceipt(ctx, logTag, receiptId, deviceId)
+	if err != nil {
+		return err
+	}
+
+	err = s.unitOfWork.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := s.auditLogger.snapshot(ctx, tx, logTag, receiptId)
+		if err != nil {
+			return err
+		}
+
+		removed, err := s.receiptTagsRepo.NewTx(tx).DeleteOne(ctx, receiptId, tagId)
+		if err != nil {
+			return hApperror.InternalServerError(hApperror.AppErrorOpt{
+				Message: fmt.Sprintf("%s[receiptTagsRepo.DeleteOne] Failed to remove receipt tag: %v [receipt_id: %v][tag_id: %v]", logTag, err, receiptId, tagId),
+			})
+		}
+		if !removed {
+			return hApperror.BadRequestError(hApperror.AppErrorOpt{
+				Code:            http.StatusNotFound,
+				ResponseMessage: "Tag not found on receipt",
+			})
+		}
+
+		return s.auditLogger.record(ctx, tx, logTag, entity.AuditOperationUpdate, before)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.searchIndexer.sync(receiptId, deviceId)
+
+	return nil
+}